@@ -0,0 +1,1024 @@
+package aperture
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/pricer"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/macaroon.v2"
+)
+
+const (
+	// adminGRPCPrefix is the prefix a gRPC request URI has when it is
+	// meant for the admin server to be handled.
+	adminGRPCPrefix = "/adminrpc.Admin/"
+
+	// adminRESTPrefix is the prefix a REST request URI has when it is
+	// meant for the admin server to be handled.
+	adminRESTPrefix = "/v1/admin"
+
+	// defaultAdminMacaroonFilename is the file name of the admin macaroon
+	// within aperture's base directory.
+	defaultAdminMacaroonFilename = "admin.macaroon"
+
+	// adminMacaroonLocation is the location of the admin macaroon.
+	adminMacaroonLocation = "aperture"
+
+	// adminMacaroonMetadataKey is the gRPC metadata key the hex encoded
+	// admin macaroon is expected under.
+	adminMacaroonMetadataKey = "macaroon"
+
+	// defaultListTokensLimit is the maximum number of issued L402s that are
+	// listed if the request doesn't specify a limit.
+	defaultListTokensLimit = 100
+)
+
+var (
+	// adminMacaroonID is the identifier of the admin macaroon. Its hash is
+	// used to store the macaroon's root key in the secret store.
+	adminMacaroonID = []byte("aperture-admin")
+
+	// errAdminMacaroonInvalid is returned when a call to the admin server
+	// doesn't carry a valid admin macaroon.
+	errAdminMacaroonInvalid = status.Error(
+		codes.Unauthenticated, "invalid admin macaroon",
+	)
+)
+
+// adminServerConfig holds the dependencies of the admin server.
+type adminServerConfig struct {
+	// secrets is the store the admin macaroon's root key is kept in.
+	secrets mint.SecretStore
+
+	// store is used to persist services that are added or changed through
+	// the admin server.
+	store proxy.ServiceStore
+
+	// staticServices are the services defined in the configuration file.
+	// They can be updated but not removed through the admin server.
+	staticServices []*proxy.Service
+
+	// services is the initial, unprepared configuration of all backend
+	// services.
+	services []*proxy.Service
+
+	// updateServices is called with a fresh copy of the full list of
+	// backend services whenever it changes.
+	updateServices func([]*proxy.Service) error
+
+	// revocations is the revocation list of L402s that is checked by the
+	// mint whenever an L402 is verified.
+	revocations mint.RevocationStore
+
+	// tokens is the inventory of issued L402s that is kept by the mint.
+	tokens mint.TokenStore
+
+	// rootKeys manages the root keys that wrap the secrets of L402s.
+	rootKeys mint.RootKeyStore
+
+	// verificationCache is the optional cache of verified L402s that is
+	// invalidated whenever L402s are revoked.
+	verificationCache *auth.VerificationCache
+}
+
+// adminServer is an implementation of the Admin gRPC service that allows the
+// backend services of the proxy to be managed at run time.
+type adminServer struct {
+	adminrpc.UnimplementedAdminServer
+
+	cfg adminServerConfig
+
+	// macaroonPath is the path the admin macaroon was written to. It is
+	// written there again whenever its root key is renewed.
+	macaroonPath string
+
+	// mu guards services and serializes all modifications.
+	mu sync.Mutex
+
+	// services is the unprepared configuration of all backend services
+	// in the order they are matched against requests.
+	services []*proxy.Service
+}
+
+// A compile-time constraint to ensure adminServer implements
+// adminrpc.AdminServer.
+var _ adminrpc.AdminServer = (*adminServer)(nil)
+
+// newAdminServer creates a new admin server. The root key of the admin
+// macaroon is created in the secret store if it doesn't exist yet.
+func newAdminServer(ctx context.Context,
+	cfg adminServerConfig) (*adminServer, error) {
+
+	s := &adminServer{
+		cfg:      cfg,
+		services: cloneServices(cfg.services),
+	}
+	if _, _, err := s.rootKey(ctx); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// rootKey loads the root key of the admin macaroon from the secret store,
+// creating a new one if it doesn't exist, for example because it was
+// invalidated along with the root keys that wrapped it. It also returns
+// whether a new root key was created.
+func (s *adminServer) rootKey(ctx context.Context) ([l402.SecretSize]byte,
+	bool, error) {
+
+	rootKeyID := sha256.Sum256(adminMacaroonID)
+	rootKey, err := s.cfg.secrets.GetSecret(ctx, rootKeyID)
+	if err == nil {
+		return rootKey, false, nil
+	}
+	if errors.Is(err, mint.ErrSecretNotFound) {
+		rootKey, err = s.cfg.secrets.NewSecret(ctx, rootKeyID)
+	}
+	if err != nil {
+		return rootKey, false, fmt.Errorf("unable to load admin "+
+			"macaroon root key: %w", err)
+	}
+
+	return rootKey, true, nil
+}
+
+// bakeMacaroon creates the admin macaroon with the given root key.
+func bakeMacaroon(rootKey [l402.SecretSize]byte) (*macaroon.Macaroon, error) {
+	return macaroon.New(
+		rootKey[:], adminMacaroonID, adminMacaroonLocation,
+		macaroon.LatestVersion,
+	)
+}
+
+// writeMacaroon writes the admin macaroon to the given path unless there
+// already is a valid one. The path is remembered, so that the macaroon is
+// written again whenever its root key is renewed.
+func (s *adminServer) writeMacaroon(ctx context.Context, path string) error {
+	s.macaroonPath = path
+
+	rootKey, _, err := s.rootKey(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A macaroon that was baked with an invalidated root key is replaced,
+	// as it can't be used anymore.
+	macBytes, err := os.ReadFile(path)
+	if err == nil && verifyMacaroon(macBytes, rootKey) == nil {
+		return nil
+	}
+
+	return writeMacaroonFile(path, rootKey)
+}
+
+// writeMacaroonFile writes the admin macaroon baked with the given root key to
+// the given path.
+func writeMacaroonFile(path string, rootKey [l402.SecretSize]byte) error {
+	mac, err := bakeMacaroon(rootKey)
+	if err != nil {
+		return err
+	}
+	macBytes, err := mac.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, macBytes, 0600)
+}
+
+// checkMacaroon verifies that the incoming context carries a valid admin
+// macaroon. The root key is loaded from the secret store on every call, so
+// that renewing it takes effect on all instances right away.
+func (s *adminServer) checkMacaroon(ctx context.Context) error {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return errAdminMacaroonInvalid
+	}
+
+	values := md.Get(adminMacaroonMetadataKey)
+	if len(values) != 1 {
+		return errAdminMacaroonInvalid
+	}
+
+	macBytes, err := hex.DecodeString(values[0])
+	if err != nil {
+		return errAdminMacaroonInvalid
+	}
+
+	rootKey, err := s.cfg.secrets.GetSecret(
+		ctx, sha256.Sum256(adminMacaroonID),
+	)
+	if errors.Is(err, mint.ErrSecretNotFound) {
+		return errAdminMacaroonInvalid
+	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "unable to load admin "+
+			"macaroon root key: %v", err)
+	}
+
+	return verifyMacaroon(macBytes, rootKey)
+}
+
+// verifyMacaroon verifies that the given serialized macaroon is an admin
+// macaroon baked with the given root key.
+func verifyMacaroon(macBytes []byte, rootKey [l402.SecretSize]byte) error {
+	mac := &macaroon.Macaroon{}
+	if err := mac.UnmarshalBinary(macBytes); err != nil {
+		return errAdminMacaroonInvalid
+	}
+	if !bytes.Equal(mac.Id(), adminMacaroonID) {
+		return errAdminMacaroonInvalid
+	}
+
+	// The admin macaroon doesn't know any caveats, so we reject all of
+	// them.
+	err := mac.Verify(rootKey[:], func(caveat string) error {
+		return fmt.Errorf("unknown caveat %s", caveat)
+	}, nil)
+	if err != nil {
+		return errAdminMacaroonInvalid
+	}
+
+	return nil
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that rejects all calls
+// without a valid admin macaroon.
+func (s *adminServer) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if err := s.checkMacaroon(ctx); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ListServices returns all backend services the proxy is currently configured
+// with.
+func (s *adminServer) ListServices(_ context.Context,
+	_ *adminrpc.ListServicesRequest) (*adminrpc.ListServicesResponse,
+	error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := &adminrpc.ListServicesResponse{
+		Services: make([]*adminrpc.Service, 0, len(s.services)),
+	}
+	for _, service := range s.services {
+		resp.Services = append(resp.Services, marshalService(service))
+	}
+
+	return resp, nil
+}
+
+// AddService adds a new backend service to the proxy and persists it.
+func (s *adminServer) AddService(ctx context.Context,
+	req *adminrpc.AddServiceRequest) (*adminrpc.AddServiceResponse, error) {
+
+	service, err := unmarshalService(req.Service)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.indexOf(service.Name) >= 0 {
+		return nil, status.Errorf(codes.AlreadyExists, "service %s "+
+			"already exists", service.Name)
+	}
+
+	services := append(cloneServices(s.services), service)
+	if err := s.apply(ctx, services, service); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Added service %s through admin API", service.Name)
+
+	return &adminrpc.AddServiceResponse{
+		Service: marshalService(service),
+	}, nil
+}
+
+// UpdateService replaces the configuration of an existing backend service and
+// persists the new configuration.
+func (s *adminServer) UpdateService(ctx context.Context,
+	req *adminrpc.UpdateServiceRequest) (*adminrpc.UpdateServiceResponse,
+	error) {
+
+	service, err := unmarshalService(req.Service)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexOf(service.Name)
+	if idx < 0 {
+		return nil, status.Errorf(codes.NotFound, "service %s not "+
+			"found", service.Name)
+	}
+
+	services := cloneServices(s.services)
+	services[idx] = service
+	if err := s.apply(ctx, services, service); err != nil {
+		return nil, err
+	}
+
+	log.Infof("Updated service %s through admin API", service.Name)
+
+	return &adminrpc.UpdateServiceResponse{
+		Service: marshalService(service),
+	}, nil
+}
+
+// RemoveService removes a backend service that was added at run time.
+func (s *adminServer) RemoveService(ctx context.Context,
+	req *adminrpc.RemoveServiceRequest) (*adminrpc.RemoveServiceResponse,
+	error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := s.indexOf(req.Name)
+	if idx < 0 {
+		return nil, status.Errorf(codes.NotFound, "service %s not "+
+			"found", req.Name)
+	}
+
+	for _, static := range s.cfg.staticServices {
+		if static.Name == req.Name {
+			return nil, status.Errorf(codes.FailedPrecondition,
+				"service %s is defined in the configuration "+
+					"file and can't be removed", req.Name)
+		}
+	}
+
+	services := cloneServices(s.services)
+	services = append(services[:idx], services[idx+1:]...)
+	if err := s.cfg.updateServices(cloneServices(services)); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	err := s.cfg.store.DeleteService(ctx, req.Name)
+	if err != nil {
+		s.rollback()
+
+		return nil, status.Errorf(codes.Internal, "unable to remove "+
+			"service: %v", err)
+	}
+	s.services = services
+
+	log.Infof("Removed service %s through admin API", req.Name)
+
+	return &adminrpc.RemoveServiceResponse{}, nil
+}
+
+// RevokeToken adds L402s to the revocation list by their token ID or by their
+// payment hash.
+func (s *adminServer) RevokeToken(ctx context.Context,
+	req *adminrpc.RevokeTokenRequest) (*adminrpc.RevokeTokenResponse,
+	error) {
+
+	revocation := &mint.Revocation{Reason: req.Reason}
+
+	var err error
+	switch {
+	case req.TokenId != "" && req.PaymentHash != "":
+		return nil, status.Error(codes.InvalidArgument, "only one of "+
+			"token_id and payment_hash can be set")
+
+	case req.TokenId != "":
+		revocation.TokenID, err = l402.MakeIDFromString(req.TokenId)
+
+	case req.PaymentHash != "":
+		revocation.PaymentHash, err = lntypes.MakeHashFromStr(
+			req.PaymentHash,
+		)
+
+	default:
+		return nil, status.Error(codes.InvalidArgument, "either "+
+			"token_id or payment_hash must be set")
+	}
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = s.cfg.revocations.RevokeL402(ctx, revocation)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to revoke "+
+			"L402: %v", err)
+	}
+
+	if s.cfg.verificationCache != nil {
+		s.cfg.verificationCache.InvalidateL402(
+			revocation.TokenID, revocation.PaymentHash,
+		)
+	}
+
+	log.Infof("Revoked L402 (token_id=%s, payment_hash=%s) through "+
+		"admin API: %s", req.TokenId, req.PaymentHash, req.Reason)
+
+	return &adminrpc.RevokeTokenResponse{}, nil
+}
+
+// ListRevokedTokens returns all entries of the revocation list.
+func (s *adminServer) ListRevokedTokens(ctx context.Context,
+	_ *adminrpc.ListRevokedTokensRequest) (
+	*adminrpc.ListRevokedTokensResponse, error) {
+
+	revocations, err := s.cfg.revocations.Revocations(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to list "+
+			"revocations: %v", err)
+	}
+
+	resp := &adminrpc.ListRevokedTokensResponse{
+		RevokedTokens: make(
+			[]*adminrpc.RevokedToken, 0, len(revocations),
+		),
+	}
+	for _, revocation := range revocations {
+		resp.RevokedTokens = append(
+			resp.RevokedTokens, marshalRevocation(revocation),
+		)
+	}
+
+	return resp, nil
+}
+
+// ListTokens returns the issued L402s that match the given filter in the order
+// they were issued.
+func (s *adminServer) ListTokens(ctx context.Context,
+	req *adminrpc.ListTokensRequest) (*adminrpc.ListTokensResponse,
+	error) {
+
+	filter := &mint.TokenFilter{
+		Service: req.Service,
+		Offset:  int(req.Offset),
+		Limit:   int(req.Limit),
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultListTokensLimit
+	}
+
+	if req.PaymentHash != "" {
+		hash, err := lntypes.MakeHashFromStr(req.PaymentHash)
+		if err != nil {
+			return nil, status.Error(
+				codes.InvalidArgument, err.Error(),
+			)
+		}
+		filter.PaymentHash = hash
+	}
+
+	switch req.State {
+	case adminrpc.TokenState_TOKEN_STATE_ANY:
+		// Settled and unsettled L402s are listed alike.
+
+	case adminrpc.TokenState_TOKEN_STATE_SETTLED:
+		settled := true
+		filter.Settled = &settled
+
+	case adminrpc.TokenState_TOKEN_STATE_UNSETTLED:
+		settled := false
+		filter.Settled = &settled
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown "+
+			"token state %v", req.State)
+	}
+
+	if req.CreatedAfter != 0 {
+		filter.CreatedAfter = time.Unix(req.CreatedAfter, 0)
+	}
+	if req.CreatedBefore != 0 {
+		filter.CreatedBefore = time.Unix(req.CreatedBefore, 0)
+	}
+
+	tokens, err := s.cfg.tokens.ListTokens(ctx, filter)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to list "+
+			"tokens: %v", err)
+	}
+
+	resp := &adminrpc.ListTokensResponse{
+		Tokens: make([]*adminrpc.Token, 0, len(tokens)),
+	}
+	for _, token := range tokens {
+		resp.Tokens = append(resp.Tokens, marshalToken(token))
+	}
+
+	return resp, nil
+}
+
+// GetToken returns the issued L402 with the given token ID.
+func (s *adminServer) GetToken(ctx context.Context,
+	req *adminrpc.GetTokenRequest) (*adminrpc.GetTokenResponse, error) {
+
+	tokenID, err := l402.MakeIDFromString(req.TokenId)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	token, err := s.cfg.tokens.GetToken(ctx, tokenID)
+	switch {
+	case errors.Is(err, mint.ErrTokenNotFound):
+		return nil, status.Errorf(codes.NotFound, "token %v not found",
+			tokenID)
+
+	case err != nil:
+		return nil, status.Errorf(codes.Internal, "unable to get "+
+			"token: %v", err)
+	}
+
+	return &adminrpc.GetTokenResponse{Token: marshalToken(token)}, nil
+}
+
+// ListRootKeys returns the versions of the root keys that wrap the secrets of
+// L402s.
+func (s *adminServer) ListRootKeys(ctx context.Context,
+	_ *adminrpc.ListRootKeysRequest) (*adminrpc.ListRootKeysResponse,
+	error) {
+
+	rootKeys, err := s.cfg.rootKeys.ListRootKeys(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to list "+
+			"root keys: %v", err)
+	}
+
+	resp := &adminrpc.ListRootKeysResponse{
+		RootKeys: make([]*adminrpc.RootKey, 0, len(rootKeys)),
+	}
+	for _, rootKey := range rootKeys {
+		resp.RootKeys = append(resp.RootKeys, marshalRootKey(rootKey))
+	}
+
+	return resp, nil
+}
+
+// RotateRootKey creates a new root key that wraps the secrets of newly issued
+// L402s and wraps all stored secrets with it.
+func (s *adminServer) RotateRootKey(ctx context.Context,
+	_ *adminrpc.RotateRootKeyRequest) (*adminrpc.RotateRootKeyResponse,
+	error) {
+
+	rootKey, rewrapped, err := s.cfg.rootKeys.RotateRootKey(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to rotate "+
+			"root key: %v", err)
+	}
+
+	log.Infof("Rotated to root key %d, wrapped %d secrets with it",
+		rootKey.Version, rewrapped)
+
+	return &adminrpc.RotateRootKeyResponse{
+		RootKey:      marshalRootKey(rootKey),
+		NumRewrapped: rewrapped,
+	}, nil
+}
+
+// InvalidateRootKeys invalidates all L402s that were issued before the root
+// key of the given version was created, along with the older root keys.
+func (s *adminServer) InvalidateRootKeys(ctx context.Context,
+	req *adminrpc.InvalidateRootKeysRequest) (
+	*adminrpc.InvalidateRootKeysResponse, error) {
+
+	rootKeys, err := s.cfg.rootKeys.ListRootKeys(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to list "+
+			"root keys: %v", err)
+	}
+
+	// Invalidating the latest root key as well would invalidate every
+	// L402, so a new root key must be created by rotating first.
+	if len(rootKeys) == 0 || req.Version == 0 ||
+		req.Version > rootKeys[len(rootKeys)-1].Version {
+
+		return nil, status.Error(codes.InvalidArgument, "version must "+
+			"be between 1 and the version of the latest root key")
+	}
+
+	invalidated, err := s.cfg.rootKeys.InvalidateRootKeys(
+		ctx, req.Version,
+	)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to "+
+			"invalidate root keys: %v", err)
+	}
+
+	// We don't know which of the cached L402s were wrapped by the
+	// invalidated root keys, so all of them are verified again.
+	if s.cfg.verificationCache != nil {
+		s.cfg.verificationCache.InvalidateAll()
+	}
+
+	// The root key of the admin macaroon is invalidated as well if it was
+	// created before the given version. A new one is created right away
+	// and the admin macaroon is written again, so the operator isn't
+	// locked out.
+	rootKey, renewed, err := s.rootKey(ctx)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "unable to renew "+
+			"admin macaroon: %v", err)
+	}
+	if renewed && s.macaroonPath != "" {
+		err := writeMacaroonFile(s.macaroonPath, rootKey)
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "unable to "+
+				"write admin macaroon: %v", err)
+		}
+
+		log.Infof("Renewed admin macaroon %s", s.macaroonPath)
+	}
+
+	log.Infof("Invalidated root keys before version %d and %d L402s",
+		req.Version, invalidated)
+
+	return &adminrpc.InvalidateRootKeysResponse{
+		NumInvalidated: invalidated,
+	}, nil
+}
+
+// updateStaticServices replaces the services of the configuration file, for
+// example after the file was reloaded. The stored services are applied on top
+// of the new list again before it is activated in the proxy. If the new
+// services are rejected by the proxy, the running configuration is kept.
+func (s *adminServer) updateStaticServices(ctx context.Context,
+	static []*proxy.Service) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, err := s.cfg.store.Services(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to load stored services: %w", err)
+	}
+
+	services := mergeServices(cloneServices(static), stored)
+	if err := s.cfg.updateServices(cloneServices(services)); err != nil {
+		return err
+	}
+
+	s.cfg.staticServices = cloneServices(static)
+	s.services = services
+
+	return nil
+}
+
+// apply activates the given list of services in the proxy and persists the
+// changed service. If persisting fails, the previous services are restored.
+//
+// NOTE: The caller must hold s.mu.
+func (s *adminServer) apply(ctx context.Context, services []*proxy.Service,
+	changed *proxy.Service) error {
+
+	// The proxy prepares the services it is given in place, so we hand it
+	// a copy to keep our own list free of any resolved header values or
+	// defaults.
+	if err := s.cfg.updateServices(cloneServices(services)); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if err := s.cfg.store.StoreService(ctx, changed); err != nil {
+		s.rollback()
+
+		return status.Errorf(codes.Internal, "unable to persist "+
+			"service: %v", err)
+	}
+	s.services = services
+
+	return nil
+}
+
+// rollback restores the services that were active before a failed change.
+//
+// NOTE: The caller must hold s.mu.
+func (s *adminServer) rollback() {
+	err := s.cfg.updateServices(cloneServices(s.services))
+	if err != nil {
+		log.Errorf("Unable to restore previous services: %v", err)
+	}
+}
+
+// indexOf returns the index of the service with the given name or -1 if there
+// is no such service.
+//
+// NOTE: The caller must hold s.mu.
+func (s *adminServer) indexOf(name string) int {
+	for idx, service := range s.services {
+		if service.Name == name {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// mergeServices returns the services of the configuration file with the stored
+// services applied on top. A stored service replaces the configuration file
+// service with the same name, all other stored services are appended.
+func mergeServices(static, stored []*proxy.Service) []*proxy.Service {
+	merged := make([]*proxy.Service, 0, len(static)+len(stored))
+	merged = append(merged, static...)
+
+	for _, service := range stored {
+		replaced := false
+		for idx, existing := range merged {
+			if existing.Name == service.Name {
+				merged[idx] = service
+				replaced = true
+
+				break
+			}
+		}
+
+		if !replaced {
+			merged = append(merged, service)
+		}
+	}
+
+	return merged
+}
+
+// cloneServices returns a deep copy of the given services.
+func cloneServices(services []*proxy.Service) []*proxy.Service {
+	clones := make([]*proxy.Service, 0, len(services))
+	for _, service := range services {
+		clones = append(clones, service.Clone())
+	}
+
+	return clones
+}
+
+// marshalRevocation converts an entry of the revocation list to its RPC
+// representation.
+func marshalRevocation(r *mint.Revocation) *adminrpc.RevokedToken {
+	revokedToken := &adminrpc.RevokedToken{
+		Reason:    r.Reason,
+		RevokedAt: r.RevokedAt.Unix(),
+	}
+	if r.TokenID != (l402.TokenID{}) {
+		revokedToken.TokenId = r.TokenID.String()
+	}
+	if r.PaymentHash != (lntypes.Hash{}) {
+		revokedToken.PaymentHash = r.PaymentHash.String()
+	}
+
+	return revokedToken
+}
+
+// marshalToken converts an issued L402 to its RPC representation.
+func marshalToken(t *mint.Token) *adminrpc.Token {
+	services := make([]*adminrpc.TokenService, 0, len(t.Services))
+	for _, service := range t.Services {
+		services = append(services, &adminrpc.TokenService{
+			Name:  service.Name,
+			Tier:  uint32(service.Tier),
+			Price: service.Price,
+		})
+	}
+
+	token := &adminrpc.Token{
+		TokenId:     t.TokenID.String(),
+		PaymentHash: t.PaymentHash.String(),
+		Services:    services,
+		Price:       t.Price,
+		CreatedAt:   t.CreatedAt.Unix(),
+	}
+	if !t.SettledAt.IsZero() {
+		token.SettledAt = t.SettledAt.Unix()
+	}
+
+	return token
+}
+
+// marshalRootKey converts a root key to its RPC representation without its key
+// material.
+func marshalRootKey(rootKey *mint.RootKey) *adminrpc.RootKey {
+	return &adminrpc.RootKey{
+		Version:   rootKey.Version,
+		CreatedAt: rootKey.CreatedAt.Unix(),
+	}
+}
+
+// marshalService converts a backend service to its RPC representation.
+func marshalService(s *proxy.Service) *adminrpc.Service {
+	rateLimits := make([]*adminrpc.RateLimit, 0, len(s.RateLimits))
+	for _, rl := range s.RateLimits {
+		rateLimits = append(rateLimits, &adminrpc.RateLimit{
+			PathRegexp: rl.PathRegexp,
+			Requests:   uint32(rl.Requests),
+			PerMs:      uint64(rl.Per.Milliseconds()),
+			Burst:      uint32(rl.Burst),
+			Caveats:    rl.Caveats,
+		})
+	}
+
+	tiers := make([]*adminrpc.ServiceTier, 0, len(s.Tiers))
+	for _, tier := range s.Tiers {
+		tiers = append(tiers, &adminrpc.ServiceTier{
+			Name:         tier.Name,
+			Level:        uint32(tier.Level),
+			Price:        tier.Price,
+			Timeout:      tier.Timeout,
+			MaxRequests:  tier.MaxRequests,
+			Capabilities: tier.Capabilities,
+			Constraints:  tier.Constraints,
+		})
+	}
+
+	capabilityRules := make(
+		[]*adminrpc.CapabilityRule, 0, len(s.CapabilityRules),
+	)
+	for _, rule := range s.CapabilityRules {
+		capabilityRules = append(
+			capabilityRules, &adminrpc.CapabilityRule{
+				PathRegexp: rule.PathRegexp,
+				Capability: rule.Capability,
+			},
+		)
+	}
+
+	priceRules := make([]*adminrpc.PriceRule, 0, len(s.PriceRules))
+	for _, rule := range s.PriceRules {
+		priceRules = append(priceRules, &adminrpc.PriceRule{
+			Method:      rule.Method,
+			PathRegexp:  rule.PathRegexp,
+			Query:       rule.Query,
+			Headers:     rule.Headers,
+			MinBodySize: rule.MinBodySize,
+			MaxBodySize: rule.MaxBodySize,
+			Price:       rule.Price,
+		})
+	}
+
+	dp := s.DynamicPrice
+	return &adminrpc.Service{
+		Name:         s.Name,
+		Address:      s.Address,
+		Protocol:     s.Protocol,
+		TlsCertPath:  s.TLSCertPath,
+		Auth:         string(s.Auth),
+		FreebieKey:   s.FreebieKey,
+		HostRegexp:   s.HostRegexp,
+		PathRegexp:   s.PathRegexp,
+		Headers:      s.Headers,
+		Timeout:      s.Timeout,
+		MaxRequests:  s.MaxRequests,
+		Balance:      s.Balance,
+		TopUp:        s.TopUp,
+		Capabilities: s.Capabilities,
+		Constraints:  s.Constraints,
+		Price:        s.Price,
+		DynamicPrice: &adminrpc.DynamicPrice{
+			Enabled:          dp.Enabled,
+			GrpcAddress:      dp.GRPCAddress,
+			Insecure:         dp.Insecure,
+			TlsCertPath:      dp.TLSCertPath,
+			TimeoutMs:        uint64(dp.Timeout.Milliseconds()),
+			CacheTtlMs:       uint64(dp.CacheTTL.Milliseconds()),
+			BreakerThreshold: dp.BreakerThreshold,
+			BreakerCooldownMs: uint64(
+				dp.BreakerCooldown.Milliseconds(),
+			),
+			FallbackPrice: dp.FallbackPrice,
+		},
+		AuthWhitelistPaths:           s.AuthWhitelistPaths,
+		AuthSkipInvoiceCreationPaths: s.AuthSkipInvoiceCreationPaths,
+		RateLimits:                   rateLimits,
+		Tiers:                        tiers,
+		CapabilityRules:              capabilityRules,
+		PriceRules:                   priceRules,
+	}
+}
+
+// unmarshalService converts the RPC representation of a backend service to
+// the proxy's configuration type.
+func unmarshalService(s *adminrpc.Service) (*proxy.Service, error) {
+	if s == nil {
+		return nil, errors.New("service must be set")
+	}
+	if s.Name == "" {
+		return nil, errors.New("service name must be set")
+	}
+
+	service := &proxy.Service{
+		Name:                         s.Name,
+		TLSCertPath:                  s.TlsCertPath,
+		Address:                      s.Address,
+		Protocol:                     s.Protocol,
+		Auth:                         auth.Level(s.Auth),
+		FreebieKey:                   s.FreebieKey,
+		HostRegexp:                   s.HostRegexp,
+		PathRegexp:                   s.PathRegexp,
+		Headers:                      s.Headers,
+		Timeout:                      s.Timeout,
+		MaxRequests:                  s.MaxRequests,
+		Balance:                      s.Balance,
+		TopUp:                        s.TopUp,
+		Capabilities:                 s.Capabilities,
+		Constraints:                  s.Constraints,
+		Price:                        s.Price,
+		AuthWhitelistPaths:           s.AuthWhitelistPaths,
+		AuthSkipInvoiceCreationPaths: s.AuthSkipInvoiceCreationPaths,
+	}
+
+	if s.DynamicPrice != nil {
+		dp := s.DynamicPrice
+		service.DynamicPrice = pricer.Config{
+			Enabled:     dp.Enabled,
+			GRPCAddress: dp.GrpcAddress,
+			Insecure:    dp.Insecure,
+			TLSCertPath: dp.TlsCertPath,
+			Timeout: time.Duration(dp.TimeoutMs) *
+				time.Millisecond,
+			CacheTTL: time.Duration(dp.CacheTtlMs) *
+				time.Millisecond,
+			BreakerThreshold: dp.BreakerThreshold,
+			BreakerCooldown: time.Duration(dp.BreakerCooldownMs) *
+				time.Millisecond,
+			FallbackPrice: dp.FallbackPrice,
+		}
+	}
+
+	for _, tier := range s.Tiers {
+		if tier.Level > math.MaxUint8 {
+			return nil, fmt.Errorf("tier %s: level %d out of range",
+				tier.Name, tier.Level)
+		}
+
+		service.Tiers = append(service.Tiers, &proxy.ServiceTier{
+			Name:         tier.Name,
+			Level:        uint8(tier.Level),
+			Price:        tier.Price,
+			Timeout:      tier.Timeout,
+			MaxRequests:  tier.MaxRequests,
+			Capabilities: tier.Capabilities,
+			Constraints:  tier.Constraints,
+		})
+	}
+
+	for _, rule := range s.CapabilityRules {
+		service.CapabilityRules = append(
+			service.CapabilityRules, &proxy.CapabilityRule{
+				PathRegexp: rule.PathRegexp,
+				Capability: rule.Capability,
+			},
+		)
+	}
+
+	for _, rule := range s.PriceRules {
+		service.PriceRules = append(
+			service.PriceRules, &pricer.PriceRule{
+				Method:      rule.Method,
+				PathRegexp:  rule.PathRegexp,
+				Query:       rule.Query,
+				Headers:     rule.Headers,
+				MinBodySize: rule.MinBodySize,
+				MaxBodySize: rule.MaxBodySize,
+				Price:       rule.Price,
+			},
+		)
+	}
+
+	for _, rl := range s.RateLimits {
+		service.RateLimits = append(
+			service.RateLimits, &proxy.RateLimitConfig{
+				PathRegexp: rl.PathRegexp,
+				Requests:   int(rl.Requests),
+				Per: time.Duration(rl.PerMs) *
+					time.Millisecond,
+				Burst:   int(rl.Burst),
+				Caveats: rl.Caveats,
+			},
+		)
+	}
+
+	return service, nil
+}
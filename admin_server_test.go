@@ -0,0 +1,466 @@
+package aperture
+
+import (
+	"context"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+	"github.com/lightninglabs/aperture/aperturedb"
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newTestAdminServer creates an admin server backed by the given test database
+// and a proxy that is configured with the given static services.
+func newTestAdminServer(t *testing.T, db *aperturedb.BaseDB,
+	static []*proxy.Service) (*adminServer, *proxy.Proxy) {
+
+	t.Helper()
+
+	secrets := aperturedb.NewSecretsStore(
+		aperturedb.NewTransactionExecutor(
+			db, func(tx *sql.Tx) aperturedb.SecretsDB {
+				return db.WithTx(tx)
+			},
+		), nil,
+	)
+	store := aperturedb.NewServicesStore(aperturedb.NewTransactionExecutor(
+		db, func(tx *sql.Tx) aperturedb.ServicesDB {
+			return db.WithTx(tx)
+		},
+	))
+
+	revocations := aperturedb.NewRevocationStore(
+		aperturedb.NewTransactionExecutor(
+			db, func(tx *sql.Tx) aperturedb.RevocationsDB {
+				return db.WithTx(tx)
+			},
+		),
+	)
+	tokens := aperturedb.NewTokenStore(aperturedb.NewTransactionExecutor(
+		db, func(tx *sql.Tx) aperturedb.TokensDB {
+			return db.WithTx(tx)
+		},
+	))
+
+	ctx := context.Background()
+	stored, err := store.Services(ctx)
+	require.NoError(t, err)
+	services := mergeServices(static, stored)
+
+	prxy, err := proxy.New(
+		auth.NewMockAuthenticator(), cloneServices(services), nil,
+		nil, nil, nil,
+	)
+	require.NoError(t, err)
+
+	server, err := newAdminServer(ctx, adminServerConfig{
+		secrets:        secrets,
+		store:          store,
+		staticServices: static,
+		services:       services,
+		updateServices: prxy.UpdateServices,
+		revocations:    revocations,
+		tokens:         tokens,
+		rootKeys:       secrets,
+	})
+	require.NoError(t, err)
+
+	return server, prxy
+}
+
+// serviceNames returns the names of the given services.
+func serviceNames(services []*proxy.Service) []string {
+	names := make([]string, 0, len(services))
+	for _, service := range services {
+		names = append(names, service.Name)
+	}
+
+	return names
+}
+
+// TestAdminServerServices tests that services can be added, updated and
+// removed through the admin server and that the changes are persisted.
+func TestAdminServerServices(t *testing.T) {
+	ctx := context.Background()
+	db := aperturedb.NewTestDB(t).BaseDB
+
+	static := []*proxy.Service{{
+		Name:       "static",
+		Address:    "127.0.0.1:10009",
+		Protocol:   "https",
+		HostRegexp: "^static.com$",
+		Price:      10,
+	}}
+	server, prxy := newTestAdminServer(t, db, static)
+
+	// Initially only the static service is known.
+	listResp, err := server.ListServices(
+		ctx, &adminrpc.ListServicesRequest{},
+	)
+	require.NoError(t, err)
+	require.Len(t, listResp.Services, 1)
+	require.Equal(t, "static", listResp.Services[0].Name)
+
+	// Add a new service.
+	newService := &adminrpc.Service{
+		Name:       "dynamic",
+		Address:    "127.0.0.1:8080",
+		Protocol:   "http",
+		Auth:       "freebie 2",
+		HostRegexp: "^dynamic.com$",
+		Price:      20,
+		RateLimits: []*adminrpc.RateLimit{{
+			Requests: 10,
+			PerMs:    1000,
+		}},
+	}
+	_, err = server.AddService(ctx, &adminrpc.AddServiceRequest{
+		Service: newService,
+	})
+	require.NoError(t, err)
+	require.Equal(
+		t, []string{"static", "dynamic"},
+		serviceNames(prxy.Services()),
+	)
+
+	// Adding it again or adding an invalid service fails and leaves the
+	// proxy untouched.
+	_, err = server.AddService(ctx, &adminrpc.AddServiceRequest{
+		Service: newService,
+	})
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = server.AddService(ctx, &adminrpc.AddServiceRequest{
+		Service: &adminrpc.Service{
+			Name:       "invalid",
+			HostRegexp: "[",
+		},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = server.AddService(ctx, &adminrpc.AddServiceRequest{
+		Service: &adminrpc.Service{
+			Name: "invalid",
+			Auth: "freebie many",
+		},
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(
+		t, []string{"static", "dynamic"},
+		serviceNames(prxy.Services()),
+	)
+
+	// Services from the config file can be updated, unknown ones can't.
+	_, err = server.UpdateService(ctx, &adminrpc.UpdateServiceRequest{
+		Service: &adminrpc.Service{
+			Name:       "static",
+			Address:    "127.0.0.1:10010",
+			Protocol:   "https",
+			HostRegexp: "^static.com$",
+			Price:      30,
+		},
+	})
+	require.NoError(t, err)
+
+	_, err = server.UpdateService(ctx, &adminrpc.UpdateServiceRequest{
+		Service: &adminrpc.Service{Name: "unknown"},
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	require.Equal(t, "127.0.0.1:10010", prxy.Services()[0].Address)
+	require.EqualValues(t, 30, prxy.Services()[0].Price)
+
+	// Services from the config file can't be removed.
+	_, err = server.RemoveService(ctx, &adminrpc.RemoveServiceRequest{
+		Name: "static",
+	})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	// A restart should pick up both the added service and the update of
+	// the static one.
+	restarted, restartedProxy := newTestAdminServer(t, db, static)
+	require.Equal(
+		t, []string{"static", "dynamic"},
+		serviceNames(restartedProxy.Services()),
+	)
+	require.Equal(
+		t, "127.0.0.1:10010", restartedProxy.Services()[0].Address,
+	)
+	rootKey, renewed, err := server.rootKey(ctx)
+	require.NoError(t, err)
+	require.False(t, renewed)
+	restartedRootKey, renewed, err := restarted.rootKey(ctx)
+	require.NoError(t, err)
+	require.False(t, renewed)
+	require.Equal(t, rootKey, restartedRootKey)
+
+	// Finally, remove the dynamic service.
+	_, err = server.RemoveService(ctx, &adminrpc.RemoveServiceRequest{
+		Name: "dynamic",
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"static"}, serviceNames(prxy.Services()))
+
+	_, err = server.RemoveService(ctx, &adminrpc.RemoveServiceRequest{
+		Name: "dynamic",
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+// TestAdminServerRevocations tests that L402s can be revoked by their token ID
+// or payment hash through the admin server.
+func TestAdminServerRevocations(t *testing.T) {
+	ctx := context.Background()
+	db := aperturedb.NewTestDB(t).BaseDB
+	server, _ := newTestAdminServer(t, db, nil)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	paymentHash := lntypes.Hash{4, 5, 6}
+
+	// Exactly one of the token ID and the payment hash must be given and
+	// it must be valid.
+	invalid := []*adminrpc.RevokeTokenRequest{{}, {
+		TokenId:     tokenID.String(),
+		PaymentHash: paymentHash.String(),
+	}, {
+		TokenId: "abcd",
+	}, {
+		PaymentHash: "xyz",
+	}}
+	for _, req := range invalid {
+		_, err := server.RevokeToken(ctx, req)
+		require.Equal(t, codes.InvalidArgument, status.Code(err))
+	}
+
+	_, err := server.RevokeToken(ctx, &adminrpc.RevokeTokenRequest{
+		TokenId: tokenID.String(),
+		Reason:  "chargeback",
+	})
+	require.NoError(t, err)
+
+	_, err = server.RevokeToken(ctx, &adminrpc.RevokeTokenRequest{
+		PaymentHash: paymentHash.String(),
+	})
+	require.NoError(t, err)
+
+	resp, err := server.ListRevokedTokens(
+		ctx, &adminrpc.ListRevokedTokensRequest{},
+	)
+	require.NoError(t, err)
+	require.Len(t, resp.RevokedTokens, 2)
+	require.Equal(t, tokenID.String(), resp.RevokedTokens[0].TokenId)
+	require.Empty(t, resp.RevokedTokens[0].PaymentHash)
+	require.Equal(t, "chargeback", resp.RevokedTokens[0].Reason)
+	require.NotZero(t, resp.RevokedTokens[0].RevokedAt)
+	require.Empty(t, resp.RevokedTokens[1].TokenId)
+	require.Equal(
+		t, paymentHash.String(), resp.RevokedTokens[1].PaymentHash,
+	)
+}
+
+// TestAdminServerTokens tests that issued L402s can be looked up through the
+// admin server.
+func TestAdminServerTokens(t *testing.T) {
+	ctx := context.Background()
+	db := aperturedb.NewTestDB(t).BaseDB
+	server, _ := newTestAdminServer(t, db, nil)
+
+	for i := byte(1); i <= 3; i++ {
+		err := server.cfg.tokens.AddToken(ctx, &mint.Token{
+			TokenID:     l402.TokenID{i},
+			PaymentHash: lntypes.Hash{i},
+			Services: []l402.Service{{
+				Name:  "service1",
+				Tier:  l402.BaseTier,
+				Price: 10,
+			}},
+			Price:     10,
+			CreatedAt: time.Unix(int64(i)*1_000, 0),
+		})
+		require.NoError(t, err)
+	}
+	err := server.cfg.tokens.SettleToken(
+		ctx, l402.TokenID{2}, time.Unix(2_500, 0),
+	)
+	require.NoError(t, err)
+
+	getResp, err := server.GetToken(ctx, &adminrpc.GetTokenRequest{
+		TokenId: l402.TokenID{2}.String(),
+	})
+	require.NoError(t, err)
+	require.Equal(t, lntypes.Hash{2}.String(), getResp.Token.PaymentHash)
+	require.Len(t, getResp.Token.Services, 1)
+	require.Equal(t, "service1", getResp.Token.Services[0].Name)
+	require.EqualValues(t, 2_000, getResp.Token.CreatedAt)
+	require.EqualValues(t, 2_500, getResp.Token.SettledAt)
+
+	_, err = server.GetToken(ctx, &adminrpc.GetTokenRequest{
+		TokenId: l402.TokenID{7}.String(),
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = server.GetToken(ctx, &adminrpc.GetTokenRequest{
+		TokenId: "abcd",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	listResp, err := server.ListTokens(ctx, &adminrpc.ListTokensRequest{
+		State: adminrpc.TokenState_TOKEN_STATE_UNSETTLED,
+		Limit: 1,
+	})
+	require.NoError(t, err)
+	require.Len(t, listResp.Tokens, 1)
+	require.Equal(t, l402.TokenID{1}.String(), listResp.Tokens[0].TokenId)
+	require.Zero(t, listResp.Tokens[0].SettledAt)
+
+	listResp, err = server.ListTokens(ctx, &adminrpc.ListTokensRequest{
+		Service:      "service1",
+		CreatedAfter: 2_000,
+	})
+	require.NoError(t, err)
+	require.Len(t, listResp.Tokens, 2)
+	require.Equal(t, l402.TokenID{3}.String(), listResp.Tokens[1].TokenId)
+
+	_, err = server.ListTokens(ctx, &adminrpc.ListTokensRequest{
+		PaymentHash: "xyz",
+	})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+// TestAdminServerMacaroon tests that only calls carrying the admin macaroon
+// are accepted by the admin server.
+func TestAdminServerMacaroon(t *testing.T) {
+	db := aperturedb.NewTestDB(t).BaseDB
+	server, _ := newTestAdminServer(t, db, nil)
+
+	// An existing file that doesn't hold a valid admin macaroon is
+	// replaced.
+	macPath := filepath.Join(t.TempDir(), defaultAdminMacaroonFilename)
+	require.NoError(t, os.WriteFile(macPath, []byte{1}, 0600))
+	require.NoError(t, server.writeMacaroon(context.Background(), macPath))
+	macBytes, err := os.ReadFile(macPath)
+	require.NoError(t, err)
+
+	call := newAdminCall(server)
+
+	// Calls without or with a wrong macaroon are rejected.
+	err = call(context.Background())
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	badMac := hex.EncodeToString([]byte{1})
+	badCtx := metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs(
+			adminMacaroonMetadataKey, badMac,
+		),
+	)
+	require.Equal(t, codes.Unauthenticated, status.Code(call(badCtx)))
+
+	// The macaroon written to disk is accepted.
+	ctx := adminMacaroonContext(macBytes)
+	require.NoError(t, call(ctx))
+
+	// A valid admin macaroon is kept as it is.
+	require.NoError(t, server.writeMacaroon(ctx, macPath))
+	keptBytes, err := os.ReadFile(macPath)
+	require.NoError(t, err)
+	require.Equal(t, macBytes, keptBytes)
+}
+
+// newAdminCall returns a function that passes a call with the given context
+// through the macaroon interceptor of the given admin server.
+func newAdminCall(server *adminServer) func(context.Context) error {
+	interceptor := server.UnaryServerInterceptor()
+	handler := func(context.Context, interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+
+	return func(ctx context.Context) error {
+		_, err := interceptor(
+			ctx, nil, &grpc.UnaryServerInfo{}, handler,
+		)
+		return err
+	}
+}
+
+// adminMacaroonContext returns an incoming context that carries the given
+// serialized admin macaroon.
+func adminMacaroonContext(macBytes []byte) context.Context {
+	return metadata.NewIncomingContext(
+		context.Background(), metadata.Pairs(
+			adminMacaroonMetadataKey, hex.EncodeToString(macBytes),
+		),
+	)
+}
+
+// TestAdminServerRootKeys tests that root keys can be listed, rotated and
+// invalidated through the admin server.
+func TestAdminServerRootKeys(t *testing.T) {
+	ctx := context.Background()
+	db := aperturedb.NewTestDB(t).BaseDB
+	server, _ := newTestAdminServer(t, db, nil)
+
+	// The first root key was created along with the root key of the admin
+	// macaroon.
+	listResp, err := server.ListRootKeys(
+		ctx, &adminrpc.ListRootKeysRequest{},
+	)
+	require.NoError(t, err)
+	require.Len(t, listResp.RootKeys, 1)
+	require.EqualValues(t, 1, listResp.RootKeys[0].Version)
+
+	// The latest root key can't be invalidated.
+	_, err = server.InvalidateRootKeys(
+		ctx, &adminrpc.InvalidateRootKeysRequest{Version: 2},
+	)
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	rotateResp, err := server.RotateRootKey(
+		ctx, &adminrpc.RotateRootKeyRequest{},
+	)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rotateResp.RootKey.Version)
+	require.EqualValues(t, 1, rotateResp.NumRewrapped)
+
+	macPath := filepath.Join(t.TempDir(), defaultAdminMacaroonFilename)
+	require.NoError(t, server.writeMacaroon(ctx, macPath))
+	oldMacBytes, err := os.ReadFile(macPath)
+	require.NoError(t, err)
+
+	// Invalidating the root keys invalidates the admin macaroon as well,
+	// so it is renewed and written again right away.
+	invalidateResp, err := server.InvalidateRootKeys(
+		ctx, &adminrpc.InvalidateRootKeysRequest{Version: 2},
+	)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, invalidateResp.NumInvalidated)
+
+	macBytes, err := os.ReadFile(macPath)
+	require.NoError(t, err)
+	require.NotEqual(t, oldMacBytes, macBytes)
+
+	call := newAdminCall(server)
+	err = call(adminMacaroonContext(oldMacBytes))
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	require.NoError(t, call(adminMacaroonContext(macBytes)))
+
+	listResp, err = server.ListRootKeys(
+		ctx, &adminrpc.ListRootKeysRequest{},
+	)
+	require.NoError(t, err)
+	require.Len(t, listResp.RootKeys, 1)
+	require.EqualValues(t, 2, listResp.RootKeys[0].Version)
+}
@@ -2,27 +2,34 @@ package aperture
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	_ "net/http/pprof" // Blank import to set up profiling HTTP handlers.
 	"os"
+	ossignal "os/signal"
 	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/goccy/go-yaml"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	gateway "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	flags "github.com/jessevdk/go-flags"
+	"github.com/lightninglabs/aperture/adminrpc"
 	"github.com/lightninglabs/aperture/aperturedb"
 	"github.com/lightninglabs/aperture/auth"
 	"github.com/lightninglabs/aperture/challenger"
+	"github.com/lightninglabs/aperture/freebie"
+	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/lnc"
 	"github.com/lightninglabs/aperture/mint"
 	"github.com/lightninglabs/aperture/proxy"
@@ -86,6 +93,10 @@ const (
 	// defaultMailboxAddress is the default address of the mailbox server
 	// that will be used if none is specified.
 	defaultMailboxAddress = "mailbox.terminal.lightning.today:443"
+
+	// defaultSecretsRootKeyFilename is the file name of the root key the
+	// secrets of L402s are derived from in stateless mode.
+	defaultSecretsRootKeyFilename = "secrets.key"
 )
 
 var (
@@ -155,15 +166,54 @@ func run() error {
 		return fmt.Errorf("unable to start aperture: %v", err)
 	}
 
-	select {
-	case <-interceptor.ShutdownChannel():
-		log.Infof("Received interrupt signal, shutting down aperture.")
+	// The services and blocklist can be reloaded from the configuration
+	// file without a restart by sending SIGHUP to the process.
+	reload := make(chan os.Signal, 1)
+	ossignal.Notify(reload, syscall.SIGHUP)
+	defer ossignal.Stop(reload)
+
+	for {
+		select {
+		case <-reload:
+			log.Infof("Received SIGHUP, reloading configuration.")
+
+			reloadConfig(a)
+
+		case <-interceptor.ShutdownChannel():
+			log.Infof("Received interrupt signal, shutting down " +
+				"aperture.")
+
+			return a.Stop()
+
+		case err := <-errChan:
+			log.Errorf("Error while running aperture: %v", err)
+
+			return a.Stop()
+		}
+	}
+}
+
+// reloadConfig parses the configuration file again and applies it to the
+// running aperture instance. Any error is only logged, as the running
+// configuration stays active in that case.
+func reloadConfig(a *Aperture) {
+	cfg, err := getConfig()
+	if err != nil {
+		log.Errorf("Unable to parse config file, keeping running "+
+			"configuration: %v", err)
 
-	case err := <-errChan:
-		log.Errorf("Error while running aperture: %v", err)
+		return
 	}
 
-	return a.Stop()
+	if err := a.Reload(cfg); err != nil {
+		log.Errorf("Unable to apply config file, keeping running "+
+			"configuration: %v", err)
+
+		return
+	}
+
+	log.Infof("Configuration reloaded. Changes to options other than " +
+		"services and blocklist require a restart.")
 }
 
 // Aperture is the main type of the aperture service. It holds all components
@@ -171,13 +221,16 @@ func run() error {
 type Aperture struct {
 	cfg *Config
 
-	etcdClient    *clientv3.Client
-	db            *sql.DB
-	challenger    challenger.Challenger
-	httpsServer   *http.Server
-	torHTTPServer *http.Server
-	proxy         *proxy.Proxy
-	proxyCleanup  func()
+	etcdClient     *clientv3.Client
+	db             *sql.DB
+	challenger     challenger.Challenger
+	serviceLimiter *staticServiceLimiter
+	constraints    *l402.ConstraintRegistry
+	adminSrv       *adminServer
+	httpsServer    *http.Server
+	torHTTPServer  *http.Server
+	proxy          *proxy.Proxy
+	proxyCleanup   func()
 
 	wg   sync.WaitGroup
 	quit chan struct{}
@@ -186,13 +239,24 @@ type Aperture struct {
 // NewAperture creates a new instance of the Aperture service.
 func NewAperture(cfg *Config) *Aperture {
 	return &Aperture{
-		cfg:  cfg,
-		quit: make(chan struct{}),
+		cfg:         cfg,
+		constraints: l402.NewConstraintRegistry(),
+		quit:        make(chan struct{}),
 	}
 }
 
+// RegisterConstraint adds the satisfier of a custom constraint that services
+// can add to their L402s. It must be called before the service is started.
+func (a *Aperture) RegisterConstraint(condition string,
+	satisfier l402.ConstraintSatisfier) error {
+
+	return a.constraints.Register(condition, satisfier)
+}
+
 // Start sets up the proxy server and starts it.
 func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
+	a.cfg.setDefaults()
+
 	// Start the prometheus exporter.
 	err := StartPrometheusExporter(a.cfg.Prometheus, shutdown)
 	if err != nil {
@@ -220,9 +284,19 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 	}
 
 	var (
-		secretStore mint.SecretStore
-		onionStore  tor.OnionStore
-		lncStore    lnc.Store
+		secretStore  mint.SecretStore
+		secretExpiry mint.SecretExpiryStore
+		rootKeys     mint.RootKeyStore
+		onionStore   tor.OnionStore
+		lncStore     lnc.Store
+		serviceStore proxy.ServiceStore
+		freebieStore freebie.Store
+		limiterStore proxy.LimiterStore
+		usageStore   proxy.UsageStore
+		topUpStore   mint.TopUpStore
+		revocations  mint.RevocationStore
+		tokenStore   mint.TokenStore
+		denylist     mint.SecretDenylist
 	)
 
 	// Connect to the chosen database backend.
@@ -239,8 +313,21 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 			return fmt.Errorf("unable to connect to etcd: %v", err)
 		}
 
-		secretStore = newSecretStore(a.etcdClient)
-		onionStore = newOnionStore(a.etcdClient)
+		encrypter, err := a.newEncrypter(newDataKeyStore(a.etcdClient))
+		if err != nil {
+			return err
+		}
+
+		secrets := newSecretStore(a.etcdClient, encrypter)
+		secretStore, secretExpiry, rootKeys = secrets, secrets, secrets
+		onionStore = newOnionStore(a.etcdClient, encrypter)
+		serviceStore = newServiceStore(a.etcdClient)
+		limiterStore = newLimiterStore(a.etcdClient)
+		usageStore = newUsageStore(a.etcdClient)
+		topUpStore = newTopUpStore(a.etcdClient)
+		revocations = newRevocationStore(a.etcdClient)
+		tokenStore = newTokenStore(a.etcdClient)
+		denylist = newSecretDenylist(a.etcdClient)
 
 	case "postgres":
 		db, err := aperturedb.NewPostgresStore(a.cfg.Postgres)
@@ -250,26 +337,97 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 		}
 		a.db = db.DB
 
+		dbDataKeysTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.DataKeysDB {
+				return db.WithTx(tx)
+			},
+		)
+		encrypter, err := a.newEncrypter(
+			aperturedb.NewDataKeysStore(dbDataKeysTxer),
+		)
+		if err != nil {
+			return err
+		}
+
 		dbSecretTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.SecretsDB {
 				return db.WithTx(tx)
 			},
 		)
-		secretStore = aperturedb.NewSecretsStore(dbSecretTxer)
+		secrets := aperturedb.NewSecretsStore(dbSecretTxer, encrypter)
+		secretStore, secretExpiry, rootKeys = secrets, secrets, secrets
 
 		dbOnionTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.OnionDB {
 				return db.WithTx(tx)
 			},
 		)
-		onionStore = aperturedb.NewOnionStore(dbOnionTxer)
+		onionStore = aperturedb.NewOnionStore(dbOnionTxer, encrypter)
 
 		dbLNCTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.LNCSessionsDB {
 				return db.WithTx(tx)
 			},
 		)
-		lncStore = aperturedb.NewLNCSessionsStore(dbLNCTxer)
+		lncStore = aperturedb.NewLNCSessionsStore(dbLNCTxer, encrypter)
+
+		dbServicesTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.ServicesDB {
+				return db.WithTx(tx)
+			},
+		)
+		serviceStore = aperturedb.NewServicesStore(dbServicesTxer)
+
+		dbFreebieTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.FreebieDB {
+				return db.WithTx(tx)
+			},
+		)
+		freebieStore = aperturedb.NewFreebieStore(
+			dbFreebieTxer, a.cfg.FreebieResetWindow,
+		)
+
+		dbRateLimitTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.RateLimitDB {
+				return db.WithTx(tx)
+			},
+		)
+		limiterStore = aperturedb.NewRateLimitStore(dbRateLimitTxer)
+
+		dbUsageTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.UsageDB {
+				return db.WithTx(tx)
+			},
+		)
+		usageStore = aperturedb.NewUsageStore(dbUsageTxer)
+
+		dbTopUpsTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.TopUpsDB {
+				return db.WithTx(tx)
+			},
+		)
+		topUpStore = aperturedb.NewTopUpStore(dbTopUpsTxer)
+
+		dbRevocationsTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.RevocationsDB {
+				return db.WithTx(tx)
+			},
+		)
+		revocations = aperturedb.NewRevocationStore(dbRevocationsTxer)
+
+		dbTokensTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.TokensDB {
+				return db.WithTx(tx)
+			},
+		)
+		tokenStore = aperturedb.NewTokenStore(dbTokensTxer)
+
+		dbDenylistTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.SecretDenylistDB {
+				return db.WithTx(tx)
+			},
+		)
+		denylist = aperturedb.NewSecretDenylistStore(dbDenylistTxer)
 
 	case "sqlite":
 		db, err := aperturedb.NewSqliteStore(a.cfg.Sqlite)
@@ -279,26 +437,94 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 		}
 		a.db = db.DB
 
+		dbDataKeysTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.DataKeysDB {
+				return db.WithTx(tx)
+			},
+		)
+		encrypter, err := a.newEncrypter(
+			aperturedb.NewDataKeysStore(dbDataKeysTxer),
+		)
+		if err != nil {
+			return err
+		}
+
 		dbSecretTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.SecretsDB {
 				return db.WithTx(tx)
 			},
 		)
-		secretStore = aperturedb.NewSecretsStore(dbSecretTxer)
+		secrets := aperturedb.NewSecretsStore(dbSecretTxer, encrypter)
+		secretStore, secretExpiry, rootKeys = secrets, secrets, secrets
 
 		dbOnionTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.OnionDB {
 				return db.WithTx(tx)
 			},
 		)
-		onionStore = aperturedb.NewOnionStore(dbOnionTxer)
+		onionStore = aperturedb.NewOnionStore(dbOnionTxer, encrypter)
 
 		dbLNCTxer := aperturedb.NewTransactionExecutor(db,
 			func(tx *sql.Tx) aperturedb.LNCSessionsDB {
 				return db.WithTx(tx)
 			},
 		)
-		lncStore = aperturedb.NewLNCSessionsStore(dbLNCTxer)
+		lncStore = aperturedb.NewLNCSessionsStore(dbLNCTxer, encrypter)
+
+		dbServicesTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.ServicesDB {
+				return db.WithTx(tx)
+			},
+		)
+		serviceStore = aperturedb.NewServicesStore(dbServicesTxer)
+
+		dbFreebieTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.FreebieDB {
+				return db.WithTx(tx)
+			},
+		)
+		freebieStore = aperturedb.NewFreebieStore(
+			dbFreebieTxer, a.cfg.FreebieResetWindow,
+		)
+
+		dbUsageTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.UsageDB {
+				return db.WithTx(tx)
+			},
+		)
+		usageStore = aperturedb.NewUsageStore(dbUsageTxer)
+
+		dbTopUpsTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.TopUpsDB {
+				return db.WithTx(tx)
+			},
+		)
+		topUpStore = aperturedb.NewTopUpStore(dbTopUpsTxer)
+
+		dbRevocationsTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.RevocationsDB {
+				return db.WithTx(tx)
+			},
+		)
+		revocations = aperturedb.NewRevocationStore(dbRevocationsTxer)
+
+		dbTokensTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.TokensDB {
+				return db.WithTx(tx)
+			},
+		)
+		tokenStore = aperturedb.NewTokenStore(dbTokensTxer)
+
+		dbDenylistTxer := aperturedb.NewTransactionExecutor(db,
+			func(tx *sql.Tx) aperturedb.SecretDenylistDB {
+				return db.WithTx(tx)
+			},
+		)
+		denylist = aperturedb.NewSecretDenylistStore(dbDenylistTxer)
+
+		// A sqlite database can't be shared between multiple instances,
+		// so the token buckets of the rate limits are kept in memory,
+		// which avoids a database write for every rate limited request.
 
 	default:
 		return fmt.Errorf("unknown database backend: %s",
@@ -311,8 +537,9 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 		authCfg := a.cfg.Authenticator
 		genInvoiceReq := func(price int64) (*lnrpc.Invoice, error) {
 			return &lnrpc.Invoice{
-				Memo:  "L402",
-				Value: price,
+				Memo:   "L402",
+				Value:  price,
+				Expiry: int64(a.cfg.InvoiceExpiry.Seconds()),
 			}, nil
 		}
 
@@ -369,9 +596,129 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 		}
 	}
 
-	// Create the proxy and connect it to lnd.
+	// In stateless mode and for L402s in the verification cache, verifying
+	// an L402 doesn't require a database round trip, so the revocation
+	// list is kept in memory too. It is reloaded as often as the denylist
+	// of revoked secrets or as configured for the cache, whichever is more
+	// often.
+	var revocationRefresh time.Duration
+	if a.cfg.StatelessSecrets.Enabled {
+		revocationRefresh = a.cfg.StatelessSecrets.DenylistRefresh
+	}
+	if a.cfg.L402Cache.Enabled && (revocationRefresh == 0 ||
+		a.cfg.L402Cache.RevocationRefresh < revocationRefresh) {
+
+		revocationRefresh = a.cfg.L402Cache.RevocationRefresh
+	}
+	if revocationRefresh > 0 {
+		revocations = mint.NewCachedRevocationStore(
+			revocations, revocationRefresh,
+		)
+	}
+
+	// L402s that were verified successfully are optionally cached by the
+	// authenticator. The admin server invalidates them on revocation, and
+	// the cache watches the root keys to notice their invalidation through
+	// other instances.
+	var verificationCache *auth.VerificationCache
+	if a.cfg.L402Cache.Enabled {
+		verificationCache = auth.NewVerificationCache(
+			a.cfg.L402Cache.Size, a.cfg.L402Cache.TTL, rootKeys,
+			a.cfg.L402Cache.RootKeyRefresh,
+		)
+	}
+
+	// If the admin API is enabled, the services that were added or changed
+	// through it are applied on top of the ones in the configuration file.
+	services := a.cfg.Services
+	if a.cfg.Admin.Enabled {
+		ctx := context.Background()
+		storedServices, err := serviceStore.Services(ctx)
+		if err != nil {
+			return fmt.Errorf("unable to load stored services: %w",
+				err)
+		}
+		services = mergeServices(a.cfg.Services, storedServices)
+
+		a.adminSrv, err = newAdminServer(ctx, adminServerConfig{
+			secrets:           secretStore,
+			store:             serviceStore,
+			staticServices:    a.cfg.Services,
+			services:          services,
+			updateServices:    a.UpdateServices,
+			revocations:       revocations,
+			tokens:            tokenStore,
+			rootKeys:          rootKeys,
+			verificationCache: verificationCache,
+		})
+		if err != nil {
+			return err
+		}
+
+		macaroonPath := a.cfg.Admin.MacaroonPath
+		if macaroonPath == "" {
+			apertureDir := apertureDataDir
+			if a.cfg.BaseDir != "" {
+				apertureDir = a.cfg.BaseDir
+			}
+			macaroonPath = filepath.Join(
+				apertureDir, defaultAdminMacaroonFilename,
+			)
+		}
+		err = a.adminSrv.writeMacaroon(ctx, macaroonPath)
+		if err != nil {
+			return fmt.Errorf("unable to write admin macaroon: %w",
+				err)
+		}
+
+		log.Infof("Admin API enabled, using admin macaroon %s",
+			macaroonPath)
+	}
+
+	// The expiry of secrets is only tracked if they're pruned, so that
+	// minting doesn't require another database write otherwise.
+	if !a.cfg.SecretPruning.Enabled {
+		secretExpiry = nil
+	}
+
+	// In stateless mode, the mint derives the secrets of L402s instead of
+	// storing them. The admin macaroon keeps its stored secret, so that
+	// it is renewed when the root keys are invalidated.
+	mintSecrets := secretStore
+	if a.cfg.StatelessSecrets.Enabled {
+		rootKeyPath := a.cfg.StatelessSecrets.RootKeyPath
+		if rootKeyPath == "" {
+			apertureDir := apertureDataDir
+			if a.cfg.BaseDir != "" {
+				apertureDir = a.cfg.BaseDir
+			}
+			rootKeyPath = filepath.Join(
+				apertureDir, defaultSecretsRootKeyFilename,
+			)
+		}
+
+		rootKey, err := loadSecretsRootKey(rootKeyPath)
+		if err != nil {
+			return err
+		}
+		mintSecrets = mint.NewDerivedSecretStore(
+			rootKey, denylist,
+			a.cfg.StatelessSecrets.DenylistRefresh,
+		)
+
+		log.Infof("Deriving L402 secrets from root key %s",
+			rootKeyPath)
+	}
+
+	// Create the proxy and connect it to lnd. The proxy prepares the
+	// services in place, so we hand it a copy to keep the configuration
+	// comparable when it is reloaded.
+	a.serviceLimiter = newStaticServiceLimiter(services)
 	a.proxy, a.proxyCleanup, err = createProxy(
-		a.cfg, a.challenger, secretStore,
+		a.cfg, a.challenger, mintSecrets, secretExpiry, freebieStore,
+		limiterStore, usageStore, topUpStore, revocations, tokenStore,
+		a.serviceLimiter, a.constraints, cloneServices(services),
+		a.adminSrv, verificationCache,
 	)
 	if err != nil {
 		return err
@@ -428,6 +775,18 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 		}
 	}()
 
+	// Whether the invoices of unsettled L402s and top-ups were paid is
+	// looked up with the challenger, so secrets and top-ups are only
+	// pruned if there is one.
+	if secretExpiry != nil && a.challenger != nil {
+		log.Infof("Pruning expired secrets and top-ups every %v, "+
+			"keeping them for %v", a.cfg.SecretPruning.Interval,
+			a.cfg.SecretPruning.Retention)
+
+		a.wg.Add(1)
+		go a.pruneSecrets(secretExpiry, topUpStore, a.challenger)
+	}
+
 	// If we need to listen over Tor as well, we'll set up the onion
 	// services now. We're not able to use TLS for onion services since they
 	// can't be verified, so we'll spin up an additional HTTP/2 server
@@ -462,11 +821,161 @@ func (a *Aperture) Start(errChan chan error, shutdown <-chan struct{}) error {
 	return nil
 }
 
+// newEncrypter loads the encrypter that sensitive values are encrypted with at
+// rest, using the data key of the given store. If encryption at rest isn't
+// configured, nil is returned so that the values are stored in plaintext.
+func (a *Aperture) newEncrypter(
+	store aperturedb.DataKeyStore) (*aperturedb.Encrypter, error) {
+
+	cfg := a.cfg.DBEncryption
+	if !cfg.enabled() {
+		return nil, nil
+	}
+
+	var masterKey aperturedb.MasterKey
+	if cfg.KeyFile != "" {
+		var err error
+		masterKey, err = aperturedb.MasterKeyFromFile(
+			lnd.CleanAndExpandPath(cfg.KeyFile),
+		)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		passphrase := os.Getenv(cfg.PassphraseEnv)
+		if passphrase == "" {
+			return nil, fmt.Errorf("db encryption passphrase env "+
+				"%s is not set", cfg.PassphraseEnv)
+		}
+		masterKey = aperturedb.MasterKeyFromPassphrase(
+			[]byte(passphrase),
+		)
+	}
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), aperturedb.DefaultStoreTimeout,
+	)
+	defer cancel()
+
+	encrypter, err := aperturedb.NewEncrypter(ctxt, store, masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("unable to set up db encryption: %w",
+			err)
+	}
+
+	return encrypter, nil
+}
+
+// loadSecretsRootKey reads the hex encoded root key the secrets of L402s are
+// derived from. If the file doesn't exist yet, a random root key is created
+// and written to it.
+func loadSecretsRootKey(path string) ([mint.RootKeySize]byte, error) {
+	var rootKey [mint.RootKeySize]byte
+
+	content, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		if _, err := rand.Read(rootKey[:]); err != nil {
+			return rootKey, err
+		}
+
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			return rootKey, err
+		}
+
+		err = os.WriteFile(
+			path, []byte(hex.EncodeToString(rootKey[:])), 0600,
+		)
+		if err != nil {
+			return rootKey, fmt.Errorf("unable to write secrets "+
+				"root key: %w", err)
+		}
+
+		return rootKey, nil
+
+	case err != nil:
+		return rootKey, fmt.Errorf("unable to read secrets root key: "+
+			"%w", err)
+	}
+
+	keyBytes, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return rootKey, fmt.Errorf("unable to decode secrets root "+
+			"key: %w", err)
+	}
+	if len(keyBytes) != mint.RootKeySize {
+		return rootKey, fmt.Errorf("secrets root key must be %d "+
+			"bytes, got %d", mint.RootKeySize, len(keyBytes))
+	}
+	copy(rootKey[:], keyBytes)
+
+	return rootKey, nil
+}
+
+// pruneSecrets periodically removes the secrets of L402s that can no longer be
+// used until the service is stopped. The L402s whose invoices expired are
+// settled instead if the invoice lookup reports their invoices as paid. The
+// top-ups whose invoices expired without being paid are removed as well.
+//
+// NOTE: This must be run as a goroutine.
+func (a *Aperture) pruneSecrets(store mint.SecretExpiryStore,
+	topUps mint.TopUpStore, invoices mint.InvoiceLookup) {
+
+	defer a.wg.Done()
+
+	ticker := time.NewTicker(a.cfg.SecretPruning.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cutoff := time.Now().Add(-a.cfg.SecretPruning.Retention)
+			pruned, err := mint.PruneSecrets(
+				context.Background(), store, invoices, cutoff,
+			)
+			if err != nil {
+				log.Errorf("Unable to prune secrets: %v", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Infof("Pruned %d expired secrets", pruned)
+			}
+
+			if topUps == nil {
+				continue
+			}
+
+			pruned, err = mint.PruneTopUps(
+				context.Background(), topUps, invoices, cutoff,
+			)
+			if err != nil {
+				log.Errorf("Unable to prune top-ups: %v", err)
+				continue
+			}
+
+			if pruned > 0 {
+				log.Infof("Pruned %d expired top-ups", pruned)
+			}
+
+		case <-a.quit:
+			return
+		}
+	}
+}
+
 // UpdateServices instructs the proxy to re-initialize its internal
 // configuration of backend services. This can be used to add or remove backends
 // at run time or enable/disable authentication on the fly.
 func (a *Aperture) UpdateServices(services []*proxy.Service) error {
-	return a.proxy.UpdateServices(services)
+	if err := a.proxy.UpdateServices(services); err != nil {
+		return err
+	}
+
+	a.serviceLimiter.update(services)
+
+	return nil
 }
 
 // Stop gracefully shuts down the Aperture service.
@@ -824,15 +1333,39 @@ func initTorListener(cfg *Config, store tor.OnionStore) (*tor.Controller,
 
 // createProxy creates the proxy with all the services it needs.
 func createProxy(cfg *Config, challenger challenger.Challenger,
-	store mint.SecretStore) (*proxy.Proxy, func(), error) {
+	store mint.SecretStore, secretExpiry mint.SecretExpiryStore,
+	freebieStore freebie.Store, limiterStore proxy.LimiterStore,
+	usageStore proxy.UsageStore, topUpStore mint.TopUpStore,
+	revocations mint.RevocationStore, tokenStore mint.TokenStore,
+	limiter *staticServiceLimiter, constraints *l402.ConstraintRegistry,
+	services []*proxy.Service, adminSrv *adminServer,
+	verificationCache *auth.VerificationCache) (*proxy.Proxy, func(),
+	error) {
 
 	minter := mint.New(&mint.Config{
-		Challenger:     challenger,
-		Secrets:        store,
-		ServiceLimiter: newStaticServiceLimiter(cfg.Services),
-		Now:            time.Now,
+		Challenger:      challenger,
+		Secrets:         store,
+		ServiceLimiter:  limiter,
+		Constraints:     constraints,
+		TopUps:          topUpStore,
+		Revocations:     revocations,
+		Tokens:          tokenStore,
+		SecretExpiry:    secretExpiry,
+		Pricing:         cfg.BundlePricing.pricingStrategy(),
+		StatelessVerify: cfg.StatelessSecrets.Enabled,
+		InvoiceExpiry:   cfg.InvoiceExpiry,
+		Now:             time.Now,
 	})
-	authenticator := auth.NewL402Authenticator(minter, challenger)
+
+	var authOpts []auth.L402AuthenticatorOption
+	if verificationCache != nil {
+		authOpts = append(
+			authOpts, auth.WithVerificationCache(verificationCache),
+		)
+	}
+	authenticator := auth.NewL402Authenticator(
+		minter, challenger, authOpts...,
+	)
 
 	// By default the static file server only returns 404 answers for
 	// security reasons. Serving files from the staticRoot directory has to
@@ -862,6 +1395,22 @@ func createProxy(cfg *Config, challenger challenger.Challenger,
 		proxyCleanup = cleanup
 	}
 
+	if adminSrv != nil {
+		adminServices, cleanup, err := createAdminServer(cfg, adminSrv)
+		if err != nil {
+			proxyCleanup()
+
+			return nil, nil, err
+		}
+
+		localServices = append(localServices, adminServices...)
+		hashMailCleanup := proxyCleanup
+		proxyCleanup = func() {
+			hashMailCleanup()
+			cleanup()
+		}
+	}
+
 	// The static file server must be last since it will match all calls
 	// that make it to it.
 	localServices = append(localServices, proxy.NewLocalService(
@@ -871,9 +1420,20 @@ func createProxy(cfg *Config, challenger challenger.Challenger,
 	))
 
 	prxy, err := proxy.New(
-		authenticator, cfg.Services, cfg.Blocklist, localServices...,
+		authenticator, services, cfg.Blocklist, freebieStore,
+		limiterStore, usageStore, localServices...,
 	)
-	return prxy, proxyCleanup, err
+	if err != nil {
+		return prxy, proxyCleanup, err
+	}
+
+	if err := prxy.UpdateBundles(cfg.Bundles); err != nil {
+		proxyCleanup()
+
+		return nil, nil, fmt.Errorf("invalid bundles: %w", err)
+	}
+
+	return prxy, proxyCleanup, nil
 }
 
 // createHashMailServer creates the gRPC server for the hash mail message
@@ -988,6 +1548,73 @@ func createHashMailServer(cfg *Config) ([]proxy.LocalService, func(), error) {
 	return localServices, proxyCleanup, nil
 }
 
+// createAdminServer creates the gRPC server for the admin API and an
+// additional REST proxy for that gRPC server.
+func createAdminServer(cfg *Config,
+	adminSrv *adminServer) ([]proxy.LocalService, func(), error) {
+
+	var localServices []proxy.LocalService
+
+	// Every call to the admin server must carry the admin macaroon.
+	adminGRPC := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(adminSrv.UnaryServerInterceptor()),
+	)
+	adminrpc.RegisterAdminServer(adminGRPC, adminSrv)
+	localServices = append(localServices, proxy.NewLocalService(
+		adminGRPC, func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, adminGRPCPrefix)
+		}),
+	)
+
+	customMarshalerOption := gateway.WithMarshalerOption(
+		gateway.MIMEWildcard, &gateway.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+		},
+	)
+
+	ctxc, cancel := context.WithCancel(context.Background())
+	proxyCleanup := func() {
+		adminGRPC.Stop()
+		cancel()
+	}
+
+	// The REST proxy connects to our main listen address, just like the
+	// one of the hashmail server. The admin macaroon is passed on to the
+	// gRPC server through the Grpc-Metadata-macaroon header.
+	restProxyTLSOpt := grpc.WithTransportCredentials(credentials.NewTLS(
+		&tls.Config{InsecureSkipVerify: true},
+	))
+	if cfg.Insecure {
+		restProxyTLSOpt = grpc.WithTransportCredentials(
+			insecure.NewCredentials(),
+		)
+	}
+
+	mux := gateway.NewServeMux(customMarshalerOption)
+	err := adminrpc.RegisterAdminHandlerFromEndpoint(
+		ctxc, mux, cfg.ListenAddr, []grpc.DialOption{
+			restProxyTLSOpt,
+		},
+	)
+	if err != nil {
+		proxyCleanup()
+
+		return nil, nil, err
+	}
+
+	corsHandler := allowCORS(mux, []string{"*"})
+	localServices = append(localServices, proxy.NewLocalService(
+		corsHandler, func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, adminRESTPrefix)
+		},
+	))
+
+	return localServices, proxyCleanup, nil
+}
+
 // cleanup closes the given server and shuts down the log rotator.
 func cleanup(server io.Closer, proxy io.Closer) {
 	if err := proxy.Close(); err != nil {
@@ -1031,7 +1658,7 @@ func allowCORS(handler http.Handler, origins []string) http.Handler {
 			allowHeaders,
 			"Content-Type, Accept, Grpc-Metadata-Macaroon",
 		)
-		w.Header().Set(allowMethods, "GET, POST, DELETE")
+		w.Header().Set(allowMethods, "GET, POST, PUT, DELETE")
 
 		// Either we allow all origins or the incoming request matches
 		// a specific origin in our list of allowed origins.
@@ -0,0 +1,138 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+type (
+	// NewDataKey is a struct that contains the parameters required to
+	// insert a new data key.
+	NewDataKey = sqlc.InsertDataKeyParams
+)
+
+// DataKeysDB is an interface that defines the set of operations that can be
+// executed against the data keys database.
+type DataKeysDB interface {
+	// InsertDataKey inserts a new data key into the database.
+	InsertDataKey(ctx context.Context, arg NewDataKey) error
+
+	// GetDataKey returns the first data key that was inserted.
+	GetDataKey(ctx context.Context) (sqlc.DataKey, error)
+}
+
+// DataKeysDBTxOptions defines the set of db txn options the DataKeysStore
+// understands.
+type DataKeysDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *DataKeysDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// NewDataKeysDBReadTx creates a new read transaction option set.
+func NewDataKeysDBReadTx() DataKeysDBTxOptions {
+	return DataKeysDBTxOptions{
+		readOnly: true,
+	}
+}
+
+// BatchedDataKeysDB is a version of the DataKeysDB that's capable of batched
+// database operations.
+type BatchedDataKeysDB interface {
+	DataKeysDB
+
+	BatchedTx[DataKeysDB]
+}
+
+// DataKeysStore represents a storage backend for the data key.
+type DataKeysStore struct {
+	db    BatchedDataKeysDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure DataKeysStore implements DataKeyStore.
+var _ DataKeyStore = (*DataKeysStore)(nil)
+
+// NewDataKeysStore creates a new DataKeysStore instance given a open
+// BatchedDataKeysDB storage backend.
+func NewDataKeysStore(db BatchedDataKeysDB) *DataKeysStore {
+	return &DataKeysStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// DataKey returns the stored data key.
+//
+// NOTE: This is part of the DataKeyStore interface.
+func (d *DataKeysStore) DataKey(ctx context.Context) (*EncryptedDataKey,
+	error) {
+
+	var (
+		key      *EncryptedDataKey
+		readOpts = NewDataKeysDBReadTx()
+	)
+	err := d.db.ExecTx(ctx, &readOpts, func(tx DataKeysDB) error {
+		row, err := tx.GetDataKey(ctx)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrDataKeyNotFound
+
+		case err != nil:
+			return err
+		}
+
+		key = &EncryptedDataKey{
+			Salt: row.Salt,
+			Key:  row.EncryptedKey,
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get data key: %w", err)
+	}
+
+	return key, nil
+}
+
+// AddDataKey stores the given data key unless there is one already.
+//
+// NOTE: This is part of the DataKeyStore interface.
+func (d *DataKeysStore) AddDataKey(ctx context.Context,
+	key *EncryptedDataKey) error {
+
+	var writeTxOpts DataKeysDBTxOptions
+	err := d.db.ExecTx(ctx, &writeTxOpts, func(tx DataKeysDB) error {
+		_, err := tx.GetDataKey(ctx)
+		switch {
+		case err == nil:
+			return ErrDataKeyExists
+
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		return tx.InsertDataKey(ctx, NewDataKey{
+			Salt:         key.Salt,
+			EncryptedKey: key.Key,
+			CreatedAt:    d.clock.Now().UTC(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add data key: %w", err)
+	}
+
+	return nil
+}
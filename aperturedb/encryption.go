@@ -0,0 +1,289 @@
+package aperturedb
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// EncryptionKeySize is the size of the master key and the data key in
+	// bytes.
+	EncryptionKeySize = 32
+
+	// saltSize is the size of the salt the master key is derived with
+	// from a passphrase.
+	saltSize = 16
+
+	// The scrypt parameters used to derive the master key from a
+	// passphrase.
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+)
+
+var (
+	// ErrDataKeyNotFound is returned if no data key is stored yet.
+	ErrDataKeyNotFound = errors.New("data key not found")
+
+	// ErrDataKeyExists is returned if a data key is added while another
+	// one is stored already.
+	ErrDataKeyExists = errors.New("data key already exists")
+
+	// ErrEncryptionKeyRequired is returned if an encrypted value is read
+	// without an encryption key being configured.
+	ErrEncryptionKeyRequired = errors.New("value is encrypted but no " +
+		"encryption key is configured")
+
+	// encryptedPrefix marks values that were encrypted with the data key,
+	// so that they can be told apart from values that were stored before
+	// encryption was enabled.
+	encryptedPrefix = []byte{0x00, 'a', 'e', 'n', 'c'}
+
+	// dataKeyAssociatedData is authenticated along with the data key
+	// when it is encrypted with the master key.
+	dataKeyAssociatedData = []byte("aperture data key")
+)
+
+// EncryptedDataKey is the data key as it is stored, encrypted with the master
+// key.
+type EncryptedDataKey struct {
+	// Salt is the salt the master key is derived with from a passphrase.
+	Salt []byte
+
+	// Key is the encrypted data key.
+	Key []byte
+}
+
+// DataKeyStore persists the data key that encrypts sensitive values at rest.
+type DataKeyStore interface {
+	// DataKey returns the stored data key. If there is none yet,
+	// ErrDataKeyNotFound is returned.
+	DataKey(ctx context.Context) (*EncryptedDataKey, error)
+
+	// AddDataKey stores the given data key. If there is one already,
+	// ErrDataKeyExists is returned.
+	AddDataKey(ctx context.Context, key *EncryptedDataKey) error
+}
+
+// MasterKey derives the master key that encrypts the data key from the given
+// salt.
+type MasterKey func(salt []byte) ([EncryptionKeySize]byte, error)
+
+// MasterKeyFromFile reads the hex encoded master key from the file at the
+// given path. The salt is ignored.
+func MasterKeyFromFile(path string) (MasterKey, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read master key file: %w",
+			err)
+	}
+
+	keyBytes, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode master key: %w", err)
+	}
+	if len(keyBytes) != EncryptionKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d",
+			EncryptionKeySize, len(keyBytes))
+	}
+
+	var key [EncryptionKeySize]byte
+	copy(key[:], keyBytes)
+
+	return func([]byte) ([EncryptionKeySize]byte, error) {
+		return key, nil
+	}, nil
+}
+
+// MasterKeyFromPassphrase derives the master key from the given passphrase
+// with scrypt.
+func MasterKeyFromPassphrase(passphrase []byte) MasterKey {
+	return func(salt []byte) ([EncryptionKeySize]byte, error) {
+		var key [EncryptionKeySize]byte
+		derived, err := scrypt.Key(
+			passphrase, salt, scryptN, scryptR, scryptP,
+			EncryptionKeySize,
+		)
+		if err != nil {
+			return key, err
+		}
+		copy(key[:], derived)
+
+		return key, nil
+	}
+}
+
+// Encrypter encrypts sensitive values before they're stored and decrypts them
+// when they're read. Values that were stored before encryption was enabled are
+// read as they are. A nil Encrypter stores values in plaintext.
+type Encrypter struct {
+	aead cipher.AEAD
+}
+
+// NewEncrypter loads the data key from the given store and decrypts it with
+// the master key. If there is no data key yet, a random one is created and
+// stored encrypted with the master key.
+func NewEncrypter(ctx context.Context, store DataKeyStore,
+	masterKey MasterKey) (*Encrypter, error) {
+
+	encryptedKey, err := store.DataKey(ctx)
+	if errors.Is(err, ErrDataKeyNotFound) {
+		encryptedKey, err = newDataKey(masterKey)
+		if err != nil {
+			return nil, err
+		}
+
+		err = store.AddDataKey(ctx, encryptedKey)
+
+		// If another instance added a data key in the meantime, we'll
+		// use that one instead.
+		if errors.Is(err, ErrDataKeyExists) {
+			encryptedKey, err = store.DataKey(ctx)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to load data key: %w", err)
+	}
+
+	key, err := masterKey(encryptedKey.Salt)
+	if err != nil {
+		return nil, err
+	}
+	masterAEAD, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(
+		masterAEAD, encryptedKey.Key, dataKeyAssociatedData,
+	)
+	if err != nil || len(dataKey) != EncryptionKeySize {
+		return nil, errors.New("unable to decrypt data key, wrong " +
+			"master key or passphrase")
+	}
+
+	copy(key[:], dataKey)
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Encrypter{aead: aead}, nil
+}
+
+// Encrypt encrypts the given value. The associated data is authenticated along
+// with the value, so that it can't be used in another place.
+func (e *Encrypter) Encrypt(plaintext, associatedData []byte) ([]byte,
+	error) {
+
+	if e == nil {
+		return plaintext, nil
+	}
+
+	sealed, err := seal(e.aead, plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(append([]byte{}, encryptedPrefix...), sealed...), nil
+}
+
+// Decrypt decrypts the given value with the associated data it was encrypted
+// with. Values that aren't encrypted are returned as they are.
+func (e *Encrypter) Decrypt(value, associatedData []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if e == nil {
+		return nil, ErrEncryptionKeyRequired
+	}
+
+	plaintext, err := open(
+		e.aead, value[len(encryptedPrefix):], associatedData,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt value: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// newDataKey creates a new random data key encrypted with the master key.
+func newDataKey(masterKey MasterKey) (*EncryptedDataKey, error) {
+	var dataKey [EncryptionKeySize]byte
+	if _, err := rand.Read(dataKey[:]); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	key, err := masterKey(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	encryptedKey, err := seal(aead, dataKey[:], dataKeyAssociatedData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EncryptedDataKey{
+		Salt: salt,
+		Key:  encryptedKey,
+	}, nil
+}
+
+// newAEAD returns the authenticated cipher of the given key.
+func newAEAD(key [EncryptionKeySize]byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a random nonce that is prepended to the
+// ciphertext.
+func seal(aead cipher.AEAD, plaintext, associatedData []byte) ([]byte,
+	error) {
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+
+		len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, associatedData), nil
+}
+
+// open decrypts a ciphertext that was encrypted with seal.
+func open(aead cipher.AEAD, ciphertext, associatedData []byte) ([]byte,
+	error) {
+
+	if len(ciphertext) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	nonce := ciphertext[:aead.NonceSize()]
+	return aead.Open(
+		nil, nonce, ciphertext[aead.NonceSize():], associatedData,
+	)
+}
@@ -0,0 +1,214 @@
+package aperturedb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/lightninglabs/aperture/lnc"
+	"github.com/lightninglabs/lightning-node-connect/mailbox"
+	"github.com/stretchr/testify/require"
+)
+
+func newDataKeysStoreWithDB(db *BaseDB) *DataKeysStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) DataKeysDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewDataKeysStore(dbTxer)
+}
+
+// TestEncrypter makes sure the data key is created once and can only be
+// decrypted with the right master key.
+func TestEncrypter(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	db := NewTestDB(t)
+	dataKeys := newDataKeysStoreWithDB(db.BaseDB)
+
+	_, err := dataKeys.DataKey(ctxt)
+	require.ErrorIs(t, err, ErrDataKeyNotFound)
+
+	// The data key is created when the encrypter is loaded for the first
+	// time.
+	masterKey := MasterKeyFromPassphrase([]byte("passphrase"))
+	encrypter, err := NewEncrypter(ctxt, dataKeys, masterKey)
+	require.NoError(t, err)
+
+	dataKey, err := dataKeys.DataKey(ctxt)
+	require.NoError(t, err)
+	require.ErrorIs(
+		t, dataKeys.AddDataKey(ctxt, dataKey), ErrDataKeyExists,
+	)
+
+	value := []byte("value")
+	encrypted, err := encrypter.Encrypt(value, []byte("a"))
+	require.NoError(t, err)
+	require.NotContains(t, string(encrypted), string(value))
+
+	// The value can only be decrypted with the data it is associated
+	// with.
+	decrypted, err := encrypter.Decrypt(encrypted, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, value, decrypted)
+
+	_, err = encrypter.Decrypt(encrypted, []byte("b"))
+	require.Error(t, err)
+
+	// Loading the encrypter again with the same passphrase uses the stored
+	// data key.
+	encrypter, err = NewEncrypter(ctxt, dataKeys, masterKey)
+	require.NoError(t, err)
+
+	decrypted, err = encrypter.Decrypt(encrypted, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, value, decrypted)
+
+	// Plaintext values that were stored before encryption was enabled are
+	// read as they are, but encrypted ones can't be read without a key.
+	decrypted, err = encrypter.Decrypt(value, []byte("a"))
+	require.NoError(t, err)
+	require.Equal(t, value, decrypted)
+
+	var noEncrypter *Encrypter
+	_, err = noEncrypter.Decrypt(encrypted, []byte("a"))
+	require.ErrorIs(t, err, ErrEncryptionKeyRequired)
+
+	// A wrong passphrase or key file is detected.
+	_, err = NewEncrypter(
+		ctxt, dataKeys, MasterKeyFromPassphrase([]byte("wrong")),
+	)
+	require.Error(t, err)
+
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	err = os.WriteFile(
+		keyFile, []byte(hex.EncodeToString(make([]byte, 32))+"\n"),
+		0600,
+	)
+	require.NoError(t, err)
+
+	fileKey, err := MasterKeyFromFile(keyFile)
+	require.NoError(t, err)
+
+	_, err = NewEncrypter(ctxt, dataKeys, fileKey)
+	require.Error(t, err)
+}
+
+// TestEncryptedStores makes sure the root keys, the onion private key and the
+// LNC session keys are stored encrypted.
+func TestEncryptedStores(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	db := NewTestDB(t)
+
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	err := os.WriteFile(
+		keyFile, []byte(strings.Repeat("ab", EncryptionKeySize)), 0600,
+	)
+	require.NoError(t, err)
+
+	masterKey, err := MasterKeyFromFile(keyFile)
+	require.NoError(t, err)
+
+	encrypter, err := NewEncrypter(
+		ctxt, newDataKeysStoreWithDB(db.BaseDB), masterKey,
+	)
+	require.NoError(t, err)
+
+	// The root keys are encrypted, but secrets can be read as before.
+	secrets := NewSecretsStore(NewTransactionExecutor(db.BaseDB,
+		func(tx *sql.Tx) SecretsDB {
+			return db.WithTx(tx)
+		},
+	), encrypter)
+
+	hash := [sha256.Size]byte{1}
+	secret, err := secrets.NewSecret(ctxt, hash)
+	require.NoError(t, err)
+
+	dbSecret, err := secrets.GetSecret(ctxt, hash)
+	require.NoError(t, err)
+	require.Equal(t, secret, dbSecret)
+
+	rootKeys, err := secrets.ListRootKeys(ctxt)
+	require.NoError(t, err)
+	require.Len(t, rootKeys, 1)
+
+	row, err := db.GetLatestRootKey(ctxt)
+	require.NoError(t, err)
+	require.NotEqual(t, rootKeys[0].Key[:], row.RootKey)
+
+	// Without the encryption key, the secret can't be read.
+	_, err = newSecretsStoreWithDB(db.BaseDB).GetSecret(ctxt, hash)
+	require.ErrorIs(t, err, ErrEncryptionKeyRequired)
+
+	// The onion private key is encrypted.
+	onion := NewOnionStore(NewTransactionExecutor(db.BaseDB,
+		func(tx *sql.Tx) OnionDB {
+			return db.WithTx(tx)
+		},
+	), encrypter)
+
+	privateKey := []byte("private key")
+	require.NoError(t, onion.StorePrivateKey(privateKey))
+	require.NoError(t, onion.StorePrivateKey(privateKey))
+	require.Error(t, onion.StorePrivateKey([]byte("other key")))
+
+	dbPrivateKey, err := onion.PrivateKey()
+	require.NoError(t, err)
+	require.Equal(t, privateKey, dbPrivateKey)
+
+	rawPrivateKey, err := db.SelectOnionPrivateKey(ctxt)
+	require.NoError(t, err)
+	require.NotEqual(t, privateKey, rawPrivateKey)
+
+	// The local static private key of LNC sessions is encrypted.
+	sessions := NewLNCSessionsStore(NewTransactionExecutor(db.BaseDB,
+		func(tx *sql.Tx) LNCSessionsDB {
+			return db.WithTx(tx)
+		},
+	), encrypter)
+
+	words, passphraseEntropy, err := mailbox.NewPassphraseEntropy()
+	require.NoError(t, err)
+
+	session, err := lnc.NewSession(
+		strings.Join(words[:], " "), "test-mailbox", true,
+	)
+	require.NoError(t, err)
+
+	session.LocalStaticPrivKey, err = btcec.NewPrivateKey()
+	require.NoError(t, err)
+	require.NoError(t, sessions.AddSession(ctxt, session))
+
+	dbSession, err := sessions.GetSession(ctxt, passphraseEntropy[:])
+	require.NoError(t, err)
+	require.Equal(
+		t, session.LocalStaticPrivKey, dbSession.LocalStaticPrivKey,
+	)
+
+	rawSession, err := db.GetSession(ctxt, passphraseEntropy[:])
+	require.NoError(t, err)
+	require.NotEqual(
+		t, session.LocalStaticPrivKey.Serialize(),
+		rawSession.LocalStaticPrivKey,
+	)
+}
@@ -0,0 +1,289 @@
+package aperturedb
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/freebie"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+type (
+	// FreebieKey is a struct that contains the parameters required to
+	// identify a client of a service in the database.
+	FreebieKey = sqlc.UpsertFreebieParams
+
+	// FreebieRequestsQuery is a struct that contains the parameters
+	// required to list the free requests of a client within its window.
+	FreebieRequestsQuery = sqlc.ListFreebieRequestsParams
+
+	// NewFreebieRequest is a struct that contains the parameters required
+	// to count a free request in the database.
+	NewFreebieRequest = sqlc.InsertFreebieRequestParams
+
+	// ExpiredFreebieRequests is a struct that contains the parameters
+	// required to delete the free requests of a client that left its
+	// window.
+	ExpiredFreebieRequests = sqlc.DeleteFreebieRequestsBeforeParams
+)
+
+// FreebieDB is an interface that defines the set of operations that can be
+// executed against the freebies database.
+type FreebieDB interface {
+	// UpsertFreebie inserts the client of a service if it doesn't exist
+	// yet and returns its ID. As the row of the client is written to, it
+	// stays locked until the transaction ends, which serializes the free
+	// requests of the client.
+	UpsertFreebie(ctx context.Context, arg FreebieKey) (int32, error)
+
+	// ListFreebieRequests returns the times of the free requests a client
+	// made to a service at or after the given window cutoff, oldest
+	// first.
+	ListFreebieRequests(ctx context.Context,
+		arg FreebieRequestsQuery) ([]time.Time, error)
+
+	// InsertFreebieRequest counts a free request of a client.
+	InsertFreebieRequest(ctx context.Context, arg NewFreebieRequest) error
+
+	// DeleteFreebieRequestsBefore deletes the free requests of a client
+	// that were made before the given window cutoff.
+	DeleteFreebieRequestsBefore(ctx context.Context,
+		arg ExpiredFreebieRequests) (int64, error)
+}
+
+// FreebieDBTxOptions defines the set of db txn options the FreebieStore
+// understands.
+type FreebieDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *FreebieDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// NewFreebieDBReadTx creates a new read transaction option set.
+func NewFreebieDBReadTx() FreebieDBTxOptions {
+	return FreebieDBTxOptions{
+		readOnly: true,
+	}
+}
+
+// BatchedFreebieDB is a version of the FreebieDB that's capable of batched
+// database operations.
+type BatchedFreebieDB interface {
+	FreebieDB
+
+	BatchedTx[FreebieDB]
+}
+
+// FreebieStore represents a storage backend for the free requests of all
+// services. As the counts are kept in the database, they survive restarts and
+// are shared between all instances that use the same database.
+type FreebieStore struct {
+	db    BatchedFreebieDB
+	clock clock.Clock
+
+	// resetWindow is the default duration of the rolling window over
+	// which the free requests of a client are counted. If it is zero,
+	// the free requests never leave the window.
+	resetWindow time.Duration
+}
+
+// A compile-time constraint to ensure FreebieStore implements freebie.Store.
+var _ freebie.Store = (*FreebieStore)(nil)
+
+// NewFreebieStore creates a new FreebieStore instance given a open
+// BatchedFreebieDB storage backend. Unless a service defines its own window,
+// the free requests of the clients are counted over the given rolling window. A
+// zero window means they are counted forever.
+func NewFreebieStore(db BatchedFreebieDB,
+	resetWindow time.Duration) *FreebieStore {
+
+	return &FreebieStore{
+		db:          db,
+		clock:       clock.NewDefaultClock(),
+		resetWindow: resetWindow,
+	}
+}
+
+// ServiceDB returns the freebie database of the service with the given name
+// that allows numFreebies free requests per client and window. If the window
+// is zero, the default reset window of the store is used. Clients are
+// identified by the given key strategy or by their masked IP address if it is
+// nil.
+//
+// NOTE: This is part of the freebie.Store interface.
+func (s *FreebieStore) ServiceDB(serviceName string, numFreebies freebie.Count,
+	window time.Duration, key *freebie.KeyStrategy) freebie.DB {
+
+	if window == 0 {
+		window = s.resetWindow
+	}
+
+	return &serviceFreebieDB{
+		store:       s,
+		serviceName: serviceName,
+		numFreebies: numFreebies,
+		window:      window,
+		key:         key,
+	}
+}
+
+// serviceFreebieDB is the freebie database of a single service backed by a
+// FreebieStore.
+type serviceFreebieDB struct {
+	store       *FreebieStore
+	serviceName string
+	numFreebies freebie.Count
+	window      time.Duration
+	key         *freebie.KeyStrategy
+}
+
+// A compile-time constraint to ensure serviceFreebieDB implements freebie.DB.
+var _ freebie.DB = (*serviceFreebieDB)(nil)
+
+// CanPass returns true if the client that sent the request hasn't used up the
+// free requests of its rolling window yet.
+//
+// NOTE: This is part of the freebie.DB interface.
+func (d *serviceFreebieDB) CanPass(r *http.Request, ip net.IP) (bool,
+	freebie.Quota, error) {
+
+	ctx := r.Context()
+	now := d.store.clock.Now().UTC()
+
+	var requests []time.Time
+	readOpts := NewFreebieDBReadTx()
+	err := d.store.db.ExecTx(ctx, &readOpts, func(tx FreebieDB) error {
+		var err error
+		requests, err = tx.ListFreebieRequests(
+			ctx, FreebieRequestsQuery{
+				ServiceName:  d.serviceName,
+				FreebieKey:   d.key.Key(r, ip),
+				WindowCutoff: d.windowCutoff(now),
+			},
+		)
+
+		return err
+	})
+	if err != nil {
+		return false, freebie.Quota{}, fmt.Errorf("unable to get "+
+			"freebies: %w", err)
+	}
+
+	return len(requests) < int(d.numFreebies), d.quota(requests), nil
+}
+
+// TallyFreebie counts a free request of the client that sent the request if
+// it hasn't used up the free requests of its rolling window yet. The row of
+// the client is locked before its free requests are counted, so concurrent
+// requests, even those served by other instances, can't exceed the limit.
+//
+// NOTE: This is part of the freebie.DB interface.
+func (d *serviceFreebieDB) TallyFreebie(r *http.Request,
+	ip net.IP) (bool, freebie.Quota, error) {
+
+	if d.numFreebies == 0 {
+		return false, d.quota(nil), nil
+	}
+
+	ctx := r.Context()
+	now := d.store.clock.Now().UTC()
+	key := d.key.Key(r, ip)
+	cutoff := d.windowCutoff(now)
+
+	var (
+		counted  bool
+		requests []time.Time
+	)
+	var writeTxOpts FreebieDBTxOptions
+	err := d.store.db.ExecTx(ctx, &writeTxOpts, func(tx FreebieDB) error {
+		// Reset the results in case the transaction is retried.
+		counted, requests = false, nil
+
+		freebieID, err := tx.UpsertFreebie(ctx, FreebieKey{
+			ServiceName: d.serviceName,
+			FreebieKey:  key,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The free requests that left the window aren't needed
+		// anymore.
+		_, err = tx.DeleteFreebieRequestsBefore(
+			ctx, ExpiredFreebieRequests{
+				FreebieID:    freebieID,
+				WindowCutoff: cutoff,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		requests, err = tx.ListFreebieRequests(
+			ctx, FreebieRequestsQuery{
+				ServiceName:  d.serviceName,
+				FreebieKey:   key,
+				WindowCutoff: cutoff,
+			},
+		)
+		if err != nil {
+			return err
+		}
+
+		if len(requests) >= int(d.numFreebies) {
+			return nil
+		}
+
+		err = tx.InsertFreebieRequest(ctx, NewFreebieRequest{
+			FreebieID:   freebieID,
+			RequestedAt: now,
+		})
+		if err != nil {
+			return err
+		}
+
+		counted = true
+		requests = append(requests, now)
+
+		return nil
+	})
+	if err != nil {
+		return false, freebie.Quota{}, fmt.Errorf("unable to tally "+
+			"freebie: %w", err)
+	}
+
+	return counted, d.quota(requests), nil
+}
+
+// quota returns the quota of a client that made the given free requests within
+// the window, oldest first.
+func (d *serviceFreebieDB) quota(requests []time.Time) freebie.Quota {
+	var oldest time.Time
+	if len(requests) > 0 {
+		oldest = requests[0]
+	}
+
+	return freebie.NewQuota(
+		d.numFreebies, int64(len(requests)), d.window, oldest,
+	)
+}
+
+// windowCutoff returns the time before which a free request must have been
+// made to have left the window.
+func (d *serviceFreebieDB) windowCutoff(now time.Time) time.Time {
+	if d.window == 0 {
+		return time.Time{}
+	}
+
+	return now.Add(-d.window)
+}
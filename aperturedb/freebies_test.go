@@ -0,0 +1,198 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/freebie"
+	"github.com/lightningnetwork/lnd/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func newFreebieStoreWithDB(db *BaseDB, resetWindow time.Duration,
+	testClock clock.Clock) *FreebieStore {
+
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) FreebieDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	store := NewFreebieStore(dbTxer, resetWindow)
+	store.clock = testClock
+
+	return store
+}
+
+func TestFreebieDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctxt, "GET", "/", nil)
+	require.NoError(t, err)
+
+	// First, create a new test database. We use two stores on top of it to
+	// simulate two aperture instances that share the database.
+	db := NewTestDB(t)
+	testClock := clock.NewTestClock(time.Unix(1_000_000, 0))
+	store1 := newFreebieStoreWithDB(db.BaseDB, time.Hour, testClock)
+	store2 := newFreebieStoreWithDB(db.BaseDB, time.Hour, testClock)
+
+	service1 := store1.ServiceDB("service1", 2, 0, nil)
+	service1Replica := store2.ServiceDB("service1", 2, 0, nil)
+	service2 := store1.ServiceDB("service2", 1, 0, nil)
+
+	ip := net.ParseIP("1.2.3.4")
+	sameSubnet := net.ParseIP("1.2.3.5")
+	otherIP := net.ParseIP("5.6.7.8")
+
+	canPass := func(db freebie.DB, ip net.IP) bool {
+		ok, _, err := db.CanPass(req, ip)
+		require.NoError(t, err)
+
+		return ok
+	}
+	tally := func(db freebie.DB, r *http.Request,
+		ip net.IP) freebie.Quota {
+
+		ok, quota, err := db.TallyFreebie(r, ip)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		return quota
+	}
+
+	// A new client can pass.
+	require.True(t, canPass(service1, ip))
+
+	// Use up both freebies, one through each instance. Addresses of the
+	// same subnet share their freebies.
+	quota := tally(service1, req, ip)
+	require.Equal(t, freebie.Quota{
+		Limit:     2,
+		Remaining: 1,
+		Window:    time.Hour,
+		Reset:     testClock.Now().Add(time.Hour).UTC(),
+	}, normalizeQuota(quota))
+
+	quota = tally(service1Replica, req, sameSubnet)
+	require.Zero(t, quota.Remaining)
+
+	require.False(t, canPass(service1, ip))
+	require.False(t, canPass(service1Replica, ip))
+
+	// Further free requests are rejected by both instances and don't
+	// change the count.
+	for _, db := range []freebie.DB{service1, service1Replica} {
+		ok, quota, err := db.TallyFreebie(req, ip)
+		require.NoError(t, err)
+		require.False(t, ok)
+		require.Equal(t, freebie.Quota{
+			Limit:  2,
+			Window: time.Hour,
+			Reset:  testClock.Now().Add(time.Hour).UTC(),
+		}, normalizeQuota(quota))
+	}
+
+	// Other clients and services are not affected.
+	require.True(t, canPass(service1, otherIP))
+	require.True(t, canPass(service2, ip))
+
+	// Once the window passed since its free requests, the client can pass
+	// again.
+	testClock.SetTime(testClock.Now().Add(time.Hour + time.Second))
+	require.True(t, canPass(service1, ip))
+
+	tally(service1, req, ip)
+	require.True(t, canPass(service1, ip))
+
+	tally(service1, req, ip)
+	require.False(t, canPass(service1, ip))
+
+	// The free requests are counted over a rolling window, so each of them
+	// is freed up on its own once the window passed since it was made.
+	service6 := store1.ServiceDB("service6", 2, 0, nil)
+	firstRequest := testClock.Now().UTC()
+	tally(service6, req, ip)
+
+	testClock.SetTime(testClock.Now().Add(30 * time.Minute))
+	secondRequest := testClock.Now().UTC()
+	tally(service6, req, ip)
+	require.False(t, canPass(service6, ip))
+
+	testClock.SetTime(firstRequest.Add(time.Hour + time.Second))
+	ok, quota, err := service6.CanPass(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, freebie.Quota{
+		Limit:     2,
+		Remaining: 1,
+		Window:    time.Hour,
+		Reset:     secondRequest.Add(time.Hour),
+	}, normalizeQuota(quota))
+
+	tally(service6, req, ip)
+	require.False(t, canPass(service6, ip))
+
+	testClock.SetTime(secondRequest.Add(time.Hour + time.Second))
+	quota = tally(service6, req, ip)
+	require.Zero(t, quota.Remaining)
+
+	// A service can define its own window that overrides the default one.
+	service4 := store1.ServiceDB("service4", 1, 24*time.Hour, nil)
+
+	tally(service4, req, ip)
+
+	testClock.SetTime(testClock.Now().Add(2 * time.Hour))
+	require.False(t, canPass(service4, ip))
+
+	testClock.SetTime(testClock.Now().Add(23 * time.Hour))
+	require.True(t, canPass(service4, ip))
+
+	// Clients can be identified by a header instead of their IP address.
+	headerKey, err := freebie.ParseKeyStrategy("header:X-Install-Id")
+	require.NoError(t, err)
+	service5 := store1.ServiceDB("service5", 1, 0, headerKey)
+
+	installReq := req.Clone(ctxt)
+	installReq.Header.Set("X-Install-Id", "install-1")
+	tally(service5, installReq, ip)
+
+	ok, _, err = service5.CanPass(installReq, otherIP)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	otherInstallReq := req.Clone(ctxt)
+	otherInstallReq.Header.Set("X-Install-Id", "install-2")
+	ok, _, err = service5.CanPass(otherInstallReq, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Without a reset window, the counts never expire.
+	noReset := newFreebieStoreWithDB(db.BaseDB, 0, testClock)
+	service3 := noReset.ServiceDB("service3", 1, 0, nil)
+
+	quota = tally(service3, req, ip)
+	require.Equal(t, freebie.Quota{Limit: 1}, quota)
+
+	testClock.SetTime(testClock.Now().Add(24 * 365 * time.Hour))
+	require.False(t, canPass(service3, ip))
+}
+
+// normalizeQuota converts the reset time of the given quota to UTC, as the
+// database might return it in a different location.
+func normalizeQuota(quota freebie.Quota) freebie.Quota {
+	if !quota.Reset.IsZero() {
+		quota.Reset = quota.Reset.UTC()
+	}
+
+	return quota
+}
@@ -70,16 +70,22 @@ type BatchedLNCSessionsDB interface {
 
 // LNCSessionsStore represents a storage backend.
 type LNCSessionsStore struct {
-	db    BatchedLNCSessionsDB
-	clock clock.Clock
+	db        BatchedLNCSessionsDB
+	encrypter *Encrypter
+	clock     clock.Clock
 }
 
 // NewSecretsStore creates a new SecretsStore instance given a open
-// BatchedSecretsDB storage backend.
-func NewLNCSessionsStore(db BatchedLNCSessionsDB) *LNCSessionsStore {
+// BatchedSecretsDB storage backend. The local static private keys of the
+// sessions are encrypted with the given encrypter, which may be nil to store
+// them in plaintext.
+func NewLNCSessionsStore(db BatchedLNCSessionsDB,
+	encrypter *Encrypter) *LNCSessionsStore {
+
 	return &LNCSessionsStore{
-		db:    db,
-		clock: clock.NewDefaultClock(),
+		db:        db,
+		encrypter: encrypter,
+		clock:     clock.NewDefaultClock(),
 	}
 }
 
@@ -91,11 +97,19 @@ func (l *LNCSessionsStore) AddSession(ctx context.Context,
 		return fmt.Errorf("local static private key is required")
 	}
 
-	localPrivKey := session.LocalStaticPrivKey.Serialize()
+	localPrivKey, err := l.encrypter.Encrypt(
+		session.LocalStaticPrivKey.Serialize(),
+		lncPrivKeyAssociatedData(session.PassphraseEntropy),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt local static private "+
+			"key: %w", err)
+	}
+
 	createdAt := l.clock.Now().UTC().Truncate(time.Microsecond)
 
 	var writeTxOpts LNCSessionsDBTxOptions
-	err := l.db.ExecTx(ctx, &writeTxOpts, func(tx LNCSessionsDB) error {
+	err = l.db.ExecTx(ctx, &writeTxOpts, func(tx LNCSessionsDB) error {
 		params := sqlc.InsertSessionParams{
 			PassphraseWords:    session.PassphraseWords,
 			PassphraseEntropy:  session.PassphraseEntropy,
@@ -134,9 +148,17 @@ func (l *LNCSessionsStore) GetSession(ctx context.Context,
 
 		}
 
-		privKey, _ := btcec.PrivKeyFromBytes(
+		localPrivKey, err := l.encrypter.Decrypt(
 			dbSession.LocalStaticPrivKey,
+			lncPrivKeyAssociatedData(dbSession.PassphraseEntropy),
 		)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt local static "+
+				"private key for session(%x): %w",
+				dbSession.PassphraseEntropy, err)
+		}
+
+		privKey, _ := btcec.PrivKeyFromBytes(localPrivKey)
 		session = &lnc.Session{
 			PassphraseWords:    dbSession.PassphraseWords,
 			PassphraseEntropy:  dbSession.PassphraseEntropy,
@@ -216,3 +238,10 @@ func (l *LNCSessionsStore) SetExpiry(ctx context.Context,
 
 	return nil
 }
+
+// lncPrivKeyAssociatedData returns the data that is authenticated along with
+// the local static private key of the session with the given passphrase
+// entropy when it is encrypted.
+func lncPrivKeyAssociatedData(passphraseEntropy []byte) []byte {
+	return append([]byte("lnc_sessions/"), passphraseEntropy...)
+}
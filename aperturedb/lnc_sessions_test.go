@@ -20,7 +20,7 @@ func newLNCSessionsStoreWithDB(db *BaseDB) *LNCSessionsStore {
 		},
 	)
 
-	return NewLNCSessionsStore(dbTxer)
+	return NewLNCSessionsStore(dbTxer, nil)
 }
 
 func TestLNCSessionsDB(t *testing.T) {
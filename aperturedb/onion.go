@@ -15,6 +15,12 @@ type (
 	NewOnionPrivateKey = sqlc.UpsertOnionParams
 )
 
+var (
+	// onionAssociatedData is authenticated along with the onion private
+	// key when it is encrypted.
+	onionAssociatedData = []byte("onion/private_key")
+)
+
 // OnionDB is an interface that defines the set of operations that can be
 // executed against the onion database.
 type OnionDB interface {
@@ -63,16 +69,19 @@ type BatchedOnionDB interface {
 
 // OnionStore represents a storage backend.
 type OnionStore struct {
-	db    BatchedOnionDB
-	clock clock.Clock
+	db        BatchedOnionDB
+	encrypter *Encrypter
+	clock     clock.Clock
 }
 
 // NewOnionStore creates a new OnionStore instance given a open BatchedOnionDB
-// storage backend.
-func NewOnionStore(db BatchedOnionDB) *OnionStore {
+// storage backend. The private key is encrypted with the given encrypter,
+// which may be nil to store it in plaintext.
+func NewOnionStore(db BatchedOnionDB, encrypter *Encrypter) *OnionStore {
 	return &OnionStore{
-		db:    db,
-		clock: clock.NewDefaultClock(),
+		db:        db,
+		encrypter: encrypter,
+		clock:     clock.NewDefaultClock(),
 	}
 }
 
@@ -89,17 +98,38 @@ func (o *OnionStore) StorePrivateKey(privateKey []byte) error {
 		// Only store the private key if it doesn't already exist.
 		dbPK, err := tx.SelectOnionPrivateKey(ctxt)
 		switch {
-		// If there is already a different private key stored in the
-		/// database, return an error.
-		case dbPK != nil && !bytes.Equal(dbPK, privateKey):
-			return fmt.Errorf("private key already exists")
+		// There is no private key yet, so we'll store the given one.
+		case err == sql.ErrNoRows:
 
-		case err != nil && err != sql.ErrNoRows:
+		case err != nil:
+			return err
+
+		default:
+			dbPK, err = o.encrypter.Decrypt(
+				dbPK, onionAssociatedData,
+			)
+			if err != nil {
+				return err
+			}
+
+			// If there is already a different private key stored
+			// in the database, return an error.
+			if !bytes.Equal(dbPK, privateKey) {
+				return fmt.Errorf("private key already exists")
+			}
+
+			return nil
+		}
+
+		encrypted, err := o.encrypter.Encrypt(
+			privateKey, onionAssociatedData,
+		)
+		if err != nil {
 			return err
 		}
 
 		params := NewOnionPrivateKey{
-			PrivateKey: privateKey,
+			PrivateKey: encrypted,
 			CreatedAt:  o.clock.Now().UTC(),
 		}
 
@@ -136,6 +166,11 @@ func (o *OnionStore) PrivateKey() ([]byte, error) {
 			return err
 		}
 
+		row, err = o.encrypter.Decrypt(row, onionAssociatedData)
+		if err != nil {
+			return err
+		}
+
 		privateKey = make([]byte, len(row))
 		copy(privateKey, row)
 
@@ -15,7 +15,7 @@ func newOnionStoreWithDB(db *BaseDB) *OnionStore {
 		},
 	)
 
-	return NewOnionStore(dbTxer)
+	return NewOnionStore(dbTxer, nil)
 }
 
 func TestOnionDB(t *testing.T) {
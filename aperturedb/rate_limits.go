@@ -0,0 +1,194 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+const (
+	// rateLimitCleanupInterval is the interval in which buckets that are
+	// full again are deleted from the database.
+	rateLimitCleanupInterval = 10 * time.Minute
+)
+
+type (
+	// RateLimitBucketParams is a struct that contains the parameters
+	// required to store the state of a token bucket in the database.
+	RateLimitBucketParams = sqlc.UpsertRateLimitBucketParams
+)
+
+// RateLimitDB is an interface that defines the set of operations that can be
+// executed against the rate limit database.
+type RateLimitDB interface {
+	// GetRateLimitBucket returns the token bucket with the given key.
+	GetRateLimitBucket(ctx context.Context,
+		bucketKey string) (sqlc.RateLimitBucket, error)
+
+	// UpsertRateLimitBucket stores the state of a token bucket.
+	UpsertRateLimitBucket(ctx context.Context,
+		arg RateLimitBucketParams) error
+
+	// DeleteFullRateLimitBuckets deletes all token buckets that were full
+	// before the given time.
+	DeleteFullRateLimitBuckets(ctx context.Context,
+		fullAt time.Time) (int64, error)
+}
+
+// RateLimitDBTxOptions defines the set of db txn options the RateLimitStore
+// understands.
+type RateLimitDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *RateLimitDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedRateLimitDB is a version of the RateLimitDB that's capable of batched
+// database operations.
+type BatchedRateLimitDB interface {
+	RateLimitDB
+
+	BatchedTx[RateLimitDB]
+}
+
+// RateLimitStore represents a storage backend for the token buckets of the
+// rate limits of all services. All aperture instances that use the same
+// database share the buckets, so the limits are enforced globally.
+type RateLimitStore struct {
+	db    BatchedRateLimitDB
+	clock clock.Clock
+
+	// cleanupMtx guards lastCleanup.
+	cleanupMtx  sync.Mutex
+	lastCleanup time.Time
+}
+
+// A compile-time constraint to ensure RateLimitStore implements
+// proxy.LimiterStore.
+var _ proxy.LimiterStore = (*RateLimitStore)(nil)
+
+// NewRateLimitStore creates a new RateLimitStore instance given a open
+// BatchedRateLimitDB storage backend.
+func NewRateLimitStore(db BatchedRateLimitDB) *RateLimitStore {
+	return &RateLimitStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// Take takes a token from each of the given buckets if all of them have one
+// available.
+//
+// NOTE: This is part of the proxy.LimiterStore interface.
+func (r *RateLimitStore) Take(ctx context.Context,
+	buckets []proxy.LimiterBucket) (bool, time.Duration, error) {
+
+	now := r.clock.Now().UTC()
+
+	var (
+		allowed bool
+		maxWait time.Duration
+	)
+	var writeTxOpts RateLimitDBTxOptions
+	err := r.db.ExecTx(ctx, &writeTxOpts, func(tx RateLimitDB) error {
+		allowed, maxWait = false, 0
+
+		states := make([]proxy.BucketState, len(buckets))
+		for i, bucket := range buckets {
+			var state proxy.BucketState
+			row, err := tx.GetRateLimitBucket(ctx, bucket.Key)
+			switch {
+			// A bucket we haven't seen yet starts out full.
+			case errors.Is(err, sql.ErrNoRows):
+
+			case err != nil:
+				return err
+
+			default:
+				state = proxy.BucketState{
+					Tokens:  row.Tokens,
+					Updated: row.UpdatedAt,
+				}
+			}
+
+			var wait time.Duration
+			states[i], wait = bucket.Take(state, now)
+			if wait > maxWait {
+				maxWait = wait
+			}
+		}
+
+		// If any of the buckets is empty, no tokens are taken at all.
+		if maxWait > 0 {
+			return nil
+		}
+
+		for i, bucket := range buckets {
+			err := tx.UpsertRateLimitBucket(
+				ctx, RateLimitBucketParams{
+					BucketKey: bucket.Key,
+					Tokens:    states[i].Tokens,
+					UpdatedAt: states[i].Updated,
+					FullAt:    bucket.FullAt(states[i]),
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+		allowed = true
+
+		return nil
+	})
+	if err != nil {
+		return false, 0, fmt.Errorf("unable to take rate limit "+
+			"tokens: %w", err)
+	}
+
+	r.maybeCleanup(ctx, now)
+
+	return allowed, maxWait, nil
+}
+
+// maybeCleanup deletes all buckets that are full again if the last cleanup
+// happened more than the cleanup interval ago. Full buckets are equivalent to
+// new ones, so deleting them doesn't affect the rate limits.
+func (r *RateLimitStore) maybeCleanup(ctx context.Context, now time.Time) {
+	r.cleanupMtx.Lock()
+	if now.Sub(r.lastCleanup) < rateLimitCleanupInterval {
+		r.cleanupMtx.Unlock()
+		return
+	}
+	r.lastCleanup = now
+	r.cleanupMtx.Unlock()
+
+	var (
+		deleted     int64
+		writeTxOpts RateLimitDBTxOptions
+	)
+	err := r.db.ExecTx(ctx, &writeTxOpts, func(tx RateLimitDB) error {
+		var err error
+		deleted, err = tx.DeleteFullRateLimitBuckets(ctx, now)
+
+		return err
+	})
+	if err != nil {
+		log.Warnf("Unable to delete full rate limit buckets: %v", err)
+		return
+	}
+
+	log.Debugf("Deleted %d full rate limit buckets", deleted)
+}
@@ -0,0 +1,100 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/clock"
+	"github.com/stretchr/testify/require"
+)
+
+func newRateLimitStoreWithDB(db *BaseDB,
+	testClock clock.Clock) *RateLimitStore {
+
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) RateLimitDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	store := NewRateLimitStore(dbTxer)
+	store.clock = testClock
+
+	return store
+}
+
+func TestRateLimitDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database. We use two stores on top of it to
+	// simulate two aperture instances that share the database.
+	db := NewTestDB(t)
+	testClock := clock.NewTestClock(time.Unix(1_000_000, 0))
+	store1 := newRateLimitStoreWithDB(db.BaseDB, testClock)
+	store2 := newRateLimitStoreWithDB(db.BaseDB, testClock)
+
+	// The bucket allows two requests at once and refills one token per
+	// second.
+	bucket := proxy.LimiterBucket{
+		Key:   "service/rule/ip:1.2.3.0",
+		Rate:  1,
+		Burst: 2,
+	}
+	other := proxy.LimiterBucket{
+		Key:   "service/rule/ip:5.6.7.0",
+		Rate:  1,
+		Burst: 1,
+	}
+
+	take := func(store *RateLimitStore,
+		buckets ...proxy.LimiterBucket) (bool, time.Duration) {
+
+		allowed, wait, err := store.Take(ctxt, buckets)
+		require.NoError(t, err)
+
+		return allowed, wait
+	}
+
+	// Use up both tokens of the bucket, one through each instance.
+	allowed, _ := take(store1, bucket)
+	require.True(t, allowed)
+	allowed, _ = take(store2, bucket)
+	require.True(t, allowed)
+
+	allowed, wait := take(store1, bucket)
+	require.False(t, allowed)
+	require.Equal(t, time.Second, wait)
+
+	// Tokens are only taken if all buckets have one available.
+	allowed, _ = take(store2, other, bucket)
+	require.False(t, allowed)
+	allowed, _ = take(store2, other)
+	require.True(t, allowed)
+
+	// After a second, a single token is available again.
+	testClock.SetTime(testClock.Now().Add(time.Second))
+	allowed, _ = take(store2, bucket)
+	require.True(t, allowed)
+	allowed, _ = take(store1, bucket)
+	require.False(t, allowed)
+
+	// Buckets that are full again are deleted by the next cleanup without
+	// affecting the limits.
+	testClock.SetTime(testClock.Now().Add(rateLimitCleanupInterval))
+	allowed, _ = take(store1, other)
+	require.True(t, allowed)
+
+	_, err := db.GetRateLimitBucket(ctxt, bucket.Key)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	allowed, _ = take(store1, other)
+	require.False(t, allowed)
+}
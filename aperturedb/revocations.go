@@ -0,0 +1,191 @@
+package aperturedb
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/clock"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+type (
+	// NewRevocation is a struct that contains the parameters required to
+	// insert a new entry into the revocation list.
+	NewRevocation = sqlc.InsertTokenRevocationParams
+
+	// CountRevocationsParams is a struct that contains the parameters
+	// required to look up whether an L402 was revoked.
+	CountRevocationsParams = sqlc.CountTokenRevocationsParams
+)
+
+// RevocationsDB is an interface that defines the set of operations that can be
+// executed against the revocation list database.
+type RevocationsDB interface {
+	// InsertTokenRevocation inserts a new entry into the revocation list
+	// unless it already exists.
+	InsertTokenRevocation(ctx context.Context, arg NewRevocation) error
+
+	// CountTokenRevocations returns the number of entries of the
+	// revocation list that match the given token ID or payment hash.
+	CountTokenRevocations(ctx context.Context,
+		arg CountRevocationsParams) (int64, error)
+
+	// ListTokenRevocations returns all entries of the revocation list in
+	// the order they were inserted.
+	ListTokenRevocations(ctx context.Context) ([]sqlc.TokenRevocation,
+		error)
+}
+
+// RevocationsDBTxOptions defines the set of db txn options the
+// RevocationStore understands.
+type RevocationsDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *RevocationsDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedRevocationsDB is a version of the RevocationsDB that's capable of
+// batched database operations.
+type BatchedRevocationsDB interface {
+	RevocationsDB
+
+	BatchedTx[RevocationsDB]
+}
+
+// RevocationStore represents a storage backend for the revocation list of
+// L402s.
+type RevocationStore struct {
+	db    BatchedRevocationsDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure RevocationStore implements
+// mint.RevocationStore.
+var _ mint.RevocationStore = (*RevocationStore)(nil)
+
+// NewRevocationStore creates a new RevocationStore instance given a open
+// BatchedRevocationsDB storage backend.
+func NewRevocationStore(db BatchedRevocationsDB) *RevocationStore {
+	return &RevocationStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// RevokeL402 adds the given revocation to the revocation list.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (r *RevocationStore) RevokeL402(ctx context.Context,
+	revocation *mint.Revocation) error {
+
+	var writeTxOpts RevocationsDBTxOptions
+	err := r.db.ExecTx(ctx, &writeTxOpts, func(tx RevocationsDB) error {
+		return tx.InsertTokenRevocation(ctx, NewRevocation{
+			TokenID:     revocationTokenID(revocation.TokenID),
+			PaymentHash: revocationHash(revocation.PaymentHash),
+			Reason:      revocation.Reason,
+			RevokedAt:   r.clock.Now().UTC(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to revoke L402: %w", err)
+	}
+
+	return nil
+}
+
+// IsRevoked returns true if the L402 with the given token ID or the given
+// payment hash was revoked.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (r *RevocationStore) IsRevoked(ctx context.Context, tokenID l402.TokenID,
+	paymentHash lntypes.Hash) (bool, error) {
+
+	var (
+		count      int64
+		readTxOpts = RevocationsDBTxOptions{readOnly: true}
+	)
+	err := r.db.ExecTx(ctx, &readTxOpts, func(tx RevocationsDB) error {
+		var err error
+		count, err = tx.CountTokenRevocations(
+			ctx, CountRevocationsParams{
+				TokenID:     tokenID[:],
+				PaymentHash: paymentHash[:],
+			},
+		)
+
+		return err
+	})
+	if err != nil {
+		return false, fmt.Errorf("unable to look up revocation: %w",
+			err)
+	}
+
+	return count > 0, nil
+}
+
+// Revocations returns all entries of the revocation list.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (r *RevocationStore) Revocations(
+	ctx context.Context) ([]*mint.Revocation, error) {
+
+	var (
+		revocations []*mint.Revocation
+		readTxOpts  = RevocationsDBTxOptions{readOnly: true}
+	)
+	err := r.db.ExecTx(ctx, &readTxOpts, func(tx RevocationsDB) error {
+		rows, err := tx.ListTokenRevocations(ctx)
+		if err != nil {
+			return err
+		}
+
+		revocations = make([]*mint.Revocation, 0, len(rows))
+		for _, row := range rows {
+			revocation := &mint.Revocation{
+				Reason:    row.Reason,
+				RevokedAt: row.RevokedAt,
+			}
+			copy(revocation.TokenID[:], row.TokenID)
+			copy(revocation.PaymentHash[:], row.PaymentHash)
+
+			revocations = append(revocations, revocation)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list revocations: %w", err)
+	}
+
+	return revocations, nil
+}
+
+// revocationTokenID returns the token ID to store for a revocation, which is
+// nil if the revocation doesn't revoke L402s by their token ID.
+func revocationTokenID(tokenID l402.TokenID) []byte {
+	if tokenID == (l402.TokenID{}) {
+		return nil
+	}
+
+	return tokenID[:]
+}
+
+// revocationHash returns the payment hash to store for a revocation, which is
+// nil if the revocation doesn't revoke L402s by their payment hash.
+func revocationHash(hash lntypes.Hash) []byte {
+	if hash == (lntypes.Hash{}) {
+		return nil
+	}
+
+	return hash[:]
+}
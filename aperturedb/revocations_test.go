@@ -0,0 +1,78 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+func newRevocationStoreWithDB(db *BaseDB) *RevocationStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) RevocationsDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewRevocationStore(dbTxer)
+}
+
+func TestRevocationsDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database.
+	db := NewTestDB(t)
+	store := newRevocationStoreWithDB(db.BaseDB)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	paymentHash := lntypes.Hash{4, 5, 6}
+
+	// Nothing is revoked yet.
+	revoked, err := store.IsRevoked(ctxt, tokenID, paymentHash)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	revocations, err := store.Revocations(ctxt)
+	require.NoError(t, err)
+	require.Empty(t, revocations)
+
+	// Revoke one L402 by its token ID and another one by its payment
+	// hash. Revoking an L402 twice is a NOP.
+	byTokenID := &mint.Revocation{TokenID: tokenID, Reason: "abuse"}
+	require.NoError(t, store.RevokeL402(ctxt, byTokenID))
+	require.NoError(t, store.RevokeL402(ctxt, byTokenID))
+
+	byHash := &mint.Revocation{PaymentHash: paymentHash}
+	require.NoError(t, store.RevokeL402(ctxt, byHash))
+
+	revoked, err = store.IsRevoked(ctxt, tokenID, lntypes.Hash{7})
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctxt, l402.TokenID{7}, paymentHash)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctxt, l402.TokenID{7}, lntypes.Hash{7})
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	revocations, err = store.Revocations(ctxt)
+	require.NoError(t, err)
+	require.Len(t, revocations, 2)
+	require.Equal(t, tokenID, revocations[0].TokenID)
+	require.Equal(t, lntypes.Hash{}, revocations[0].PaymentHash)
+	require.Equal(t, "abuse", revocations[0].Reason)
+	require.False(t, revocations[0].RevokedAt.IsZero())
+	require.Equal(t, l402.TokenID{}, revocations[1].TokenID)
+	require.Equal(t, paymentHash, revocations[1].PaymentHash)
+}
@@ -0,0 +1,126 @@
+package aperturedb
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+type (
+	// NewDeniedSecret is a struct that contains the parameters required
+	// to add a secret to the denylist.
+	NewDeniedSecret = sqlc.InsertDeniedSecretParams
+)
+
+// SecretDenylistDB is an interface that defines the set of operations that can
+// be executed against the secret denylist database.
+type SecretDenylistDB interface {
+	// InsertDeniedSecret adds a secret to the denylist unless it is on it
+	// already.
+	InsertDeniedSecret(ctx context.Context, arg NewDeniedSecret) error
+
+	// ListDeniedSecrets returns the hashes of all secrets on the denylist.
+	ListDeniedSecrets(ctx context.Context) ([][]byte, error)
+}
+
+// SecretDenylistDBTxOptions defines the set of db txn options the
+// SecretDenylistStore understands.
+type SecretDenylistDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *SecretDenylistDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedSecretDenylistDB is a version of the SecretDenylistDB that's capable
+// of batched database operations.
+type BatchedSecretDenylistDB interface {
+	SecretDenylistDB
+
+	BatchedTx[SecretDenylistDB]
+}
+
+// SecretDenylistStore represents a storage backend for the denylist of
+// revoked secrets.
+type SecretDenylistStore struct {
+	db    BatchedSecretDenylistDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure SecretDenylistStore implements
+// mint.SecretDenylist.
+var _ mint.SecretDenylist = (*SecretDenylistStore)(nil)
+
+// NewSecretDenylistStore creates a new SecretDenylistStore instance given a
+// open BatchedSecretDenylistDB storage backend.
+func NewSecretDenylistStore(
+	db BatchedSecretDenylistDB) *SecretDenylistStore {
+
+	return &SecretDenylistStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// DenySecret adds the secret keyed by the given hash to the denylist.
+//
+// NOTE: This is part of the mint.SecretDenylist interface.
+func (d *SecretDenylistStore) DenySecret(ctx context.Context,
+	hash [sha256.Size]byte) error {
+
+	var writeTxOpts SecretDenylistDBTxOptions
+	err := d.db.ExecTx(ctx, &writeTxOpts, func(tx SecretDenylistDB) error {
+		return tx.InsertDeniedSecret(ctx, NewDeniedSecret{
+			Hash:     hash[:],
+			DeniedAt: d.clock.Now().UTC(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to deny secret for hash(%x): %w",
+			hash, err)
+	}
+
+	return nil
+}
+
+// DeniedSecrets returns the hashes of all secrets on the denylist.
+//
+// NOTE: This is part of the mint.SecretDenylist interface.
+func (d *SecretDenylistStore) DeniedSecrets(
+	ctx context.Context) ([][sha256.Size]byte, error) {
+
+	var (
+		hashes     [][sha256.Size]byte
+		readTxOpts = SecretDenylistDBTxOptions{readOnly: true}
+	)
+	err := d.db.ExecTx(ctx, &readTxOpts, func(tx SecretDenylistDB) error {
+		rows, err := tx.ListDeniedSecrets(ctx)
+		if err != nil {
+			return err
+		}
+
+		hashes = make([][sha256.Size]byte, 0, len(rows))
+		for _, row := range rows {
+			var hash [sha256.Size]byte
+			copy(hash[:], row)
+			hashes = append(hashes, hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list denied secrets: %w",
+			err)
+	}
+
+	return hashes, nil
+}
@@ -0,0 +1,47 @@
+package aperturedb
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSecretDenylistStoreWithDB(db *BaseDB) *SecretDenylistStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) SecretDenylistDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewSecretDenylistStore(dbTxer)
+}
+
+func TestSecretDenylistDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database.
+	db := NewTestDB(t)
+	store := newSecretDenylistStoreWithDB(db.BaseDB)
+
+	hashes, err := store.DeniedSecrets(ctxt)
+	require.NoError(t, err)
+	require.Empty(t, hashes)
+
+	// Denying a secret twice only adds it once.
+	first, second := [sha256.Size]byte{1}, [sha256.Size]byte{2}
+	require.NoError(t, store.DenySecret(ctxt, first))
+	require.NoError(t, store.DenySecret(ctxt, second))
+	require.NoError(t, store.DenySecret(ctxt, first))
+
+	hashes, err = store.DeniedSecrets(ctxt)
+	require.NoError(t, err)
+	require.Equal(t, [][sha256.Size]byte{first, second}, hashes)
+}
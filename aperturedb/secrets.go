@@ -5,18 +5,37 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/lightninglabs/aperture/aperturedb/sqlc"
 	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/mint"
 	"github.com/lightningnetwork/lnd/clock"
+	"github.com/lightningnetwork/lnd/lntypes"
 )
 
 type (
 	// NewSecret is a struct that contains the parameters required to insert
 	// a new secret into the database.
 	NewSecret = sqlc.InsertSecretParams
+
+	// SetSecretExpiryParams is a struct that contains the parameters
+	// required to set the expiry of a secret.
+	SetSecretExpiryParams = sqlc.SetSecretExpiryParams
+
+	// ExtendSecretValidityParams is a struct that contains the parameters
+	// required to extend the time the L402 of a secret expires.
+	ExtendSecretValidityParams = sqlc.ExtendSecretValidityParams
+
+	// NewRootKey is a struct that contains the parameters required to
+	// insert a new root key into the database.
+	NewRootKey = sqlc.InsertRootKeyParams
+
+	// UpdateSecretKeyParams is a struct that contains the parameters
+	// required to wrap a secret with another root key.
+	UpdateSecretKeyParams = sqlc.UpdateSecretKeyParams
 )
 
 // SecretsDB is an interface that defines the set of operations that can be
@@ -26,12 +45,68 @@ type SecretsDB interface {
 	InsertSecret(ctx context.Context, arg NewSecret) (int32, error)
 
 	// GetSecretByHash returns the secret that corresponds to the given
-	// hash.
-	GetSecretByHash(ctx context.Context, hash []byte) ([]byte, error)
+	// hash along with the root key that wraps it.
+	GetSecretByHash(ctx context.Context,
+		hash []byte) (sqlc.GetSecretByHashRow, error)
 
 	// DeleteSecretByHash removes the secret that corresponds to the given
 	// hash.
 	DeleteSecretByHash(ctx context.Context, hash []byte) (int64, error)
+
+	// SetSecretExpiry sets the expiry of the secret that corresponds to
+	// the given hash.
+	SetSecretExpiry(ctx context.Context, arg SetSecretExpiryParams) (int64,
+		error)
+
+	// SettleSecret marks the secret that corresponds to the given hash as
+	// settled unless it already is.
+	SettleSecret(ctx context.Context, hash []byte) (int64, error)
+
+	// ExtendSecretValidity extends the time the L402 of the secret that
+	// corresponds to the given hash expires, unless it already expires
+	// later or never.
+	ExtendSecretValidity(ctx context.Context,
+		arg ExtendSecretValidityParams) (int64, error)
+
+	// ListUnsettledSecrets returns the hashes and payment hashes of all
+	// secrets that aren't settled and whose invoices expired before the
+	// given cutoff.
+	ListUnsettledSecrets(ctx context.Context,
+		cutoff sql.NullTime) ([]sqlc.ListUnsettledSecretsRow, error)
+
+	// DeleteExpiredSecrets removes all secrets that expired before the
+	// given cutoff.
+	DeleteExpiredSecrets(ctx context.Context, cutoff sql.NullTime) (int64,
+		error)
+
+	// InsertRootKey inserts a new root key into the database.
+	InsertRootKey(ctx context.Context, arg NewRootKey) error
+
+	// GetLatestRootKey returns the root key with the highest version.
+	GetLatestRootKey(ctx context.Context) (sqlc.RootKey, error)
+
+	// ListRootKeys returns all root keys in the order of their versions.
+	ListRootKeys(ctx context.Context) ([]sqlc.RootKey, error)
+
+	// DeleteRootKeysBefore removes all root keys with a version lower than
+	// the given one.
+	DeleteRootKeysBefore(ctx context.Context, version int32) (int64, error)
+
+	// ListSecretsToRewrap returns all secrets that are wrapped with a root
+	// key with a version lower than the given one, along with that root
+	// key.
+	ListSecretsToRewrap(ctx context.Context,
+		keyVersion int32) ([]sqlc.ListSecretsToRewrapRow, error)
+
+	// UpdateSecretKey replaces a secret with the same secret wrapped with
+	// another root key.
+	UpdateSecretKey(ctx context.Context, arg UpdateSecretKeyParams) error
+
+	// DeleteSecretsMintedBefore removes all secrets that were created
+	// while a root key with a version lower than the given one was the
+	// latest one.
+	DeleteSecretsMintedBefore(ctx context.Context,
+		mintedKeyVersion int32) (int64, error)
 }
 
 // SecretsTxOptions defines the set of db txn options the SecretsStore
@@ -65,21 +140,35 @@ type BatchedSecretsDB interface {
 
 // SecretsStore represents a storage backend.
 type SecretsStore struct {
-	db    BatchedSecretsDB
-	clock clock.Clock
+	db        BatchedSecretsDB
+	encrypter *Encrypter
+	clock     clock.Clock
 }
 
+// A compile-time constraint to ensure SecretsStore implements
+// mint.SecretExpiryStore.
+var _ mint.SecretExpiryStore = (*SecretsStore)(nil)
+
+// A compile-time constraint to ensure SecretsStore implements
+// mint.RootKeyStore.
+var _ mint.RootKeyStore = (*SecretsStore)(nil)
+
 // NewSecretsStore creates a new SecretsStore instance given a open
-// BatchedSecretsDB storage backend.
-func NewSecretsStore(db BatchedSecretsDB) *SecretsStore {
+// BatchedSecretsDB storage backend. The root keys are encrypted with the given
+// encrypter, which may be nil to store them in plaintext.
+func NewSecretsStore(db BatchedSecretsDB,
+	encrypter *Encrypter) *SecretsStore {
+
 	return &SecretsStore{
-		db:    db,
-		clock: clock.NewDefaultClock(),
+		db:        db,
+		encrypter: encrypter,
+		clock:     clock.NewDefaultClock(),
 	}
 }
 
 // NewSecret creates a new cryptographically random secret which is
-// keyed by the given hash.
+// keyed by the given hash. The secret is stored wrapped with the latest root
+// key.
 func (s *SecretsStore) NewSecret(ctx context.Context,
 	hash [sha256.Size]byte) ([l402.SecretSize]byte, error) {
 
@@ -90,10 +179,22 @@ func (s *SecretsStore) NewSecret(ctx context.Context,
 
 	var writeTxOpts SecretsDBTxOptions
 	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
-		_, err := tx.InsertSecret(ctx, NewSecret{
-			Hash:      hash[:],
-			Secret:    secret[:],
-			CreatedAt: s.clock.Now().UTC(),
+		rootKey, err := s.latestRootKey(ctx, tx)
+		if err != nil {
+			return err
+		}
+
+		wrapped, err := rootKey.WrapSecret(hash, secret)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.InsertSecret(ctx, NewSecret{
+			Hash:             hash[:],
+			Secret:           wrapped,
+			CreatedAt:        s.clock.Now().UTC(),
+			KeyVersion:       int32(rootKey.Version),
+			MintedKeyVersion: int32(rootKey.Version),
 		})
 		if err != nil {
 			return err
@@ -128,9 +229,12 @@ func (s *SecretsStore) GetSecret(ctx context.Context,
 			return err
 		}
 
-		copy(secret[:], secretRow)
+		secret, err = s.unwrapSecret(
+			hash, secretRow.Secret, secretRow.KeyVersion,
+			secretRow.RootKey,
+		)
 
-		return nil
+		return err
 	})
 
 	if err != nil {
@@ -169,3 +273,403 @@ func (s *SecretsStore) RevokeSecret(ctx context.Context,
 
 	return nil
 }
+
+// SetSecretExpiry sets the expiry of the secret keyed by the given hash.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *SecretsStore) SetSecretExpiry(ctx context.Context,
+	hash [sha256.Size]byte, expiry *mint.SecretExpiry) error {
+
+	params := SetSecretExpiryParams{
+		Hash:        hash[:],
+		PaymentHash: expiry.PaymentHash[:],
+		InvoiceExpiresAt: sql.NullTime{
+			Time:  expiry.InvoiceExpiry.UTC(),
+			Valid: true,
+		},
+	}
+	if !expiry.ValidUntil.IsZero() {
+		params.ValidUntil = sql.NullTime{
+			Time:  expiry.ValidUntil.UTC(),
+			Valid: true,
+		}
+	}
+
+	var writeTxOpts SecretsDBTxOptions
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		nRows, err := tx.SetSecretExpiry(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		if nRows != 1 {
+			return mint.ErrSecretNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to set expiry of secret for "+
+			"hash(%x): %w", hash, err)
+	}
+
+	return nil
+}
+
+// SettleSecret records that the L402 of the secret keyed by the given hash was
+// paid for. This acts as a NOP if it was already settled.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *SecretsStore) SettleSecret(ctx context.Context,
+	hash [sha256.Size]byte) error {
+
+	var writeTxOpts SecretsDBTxOptions
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		_, err := tx.SettleSecret(ctx, hash[:])
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to settle secret for hash(%x): %w",
+			hash, err)
+	}
+
+	return nil
+}
+
+// ExtendSecret extends the time the L402 of the secret keyed by the given hash
+// expires to the given time, unless it already expires later or never.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *SecretsStore) ExtendSecret(ctx context.Context,
+	hash [sha256.Size]byte, validUntil time.Time) error {
+
+	var writeTxOpts SecretsDBTxOptions
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		_, err := tx.ExtendSecretValidity(
+			ctx, ExtendSecretValidityParams{
+				Hash: hash[:],
+				ValidUntil: sql.NullTime{
+					Time:  validUntil.UTC(),
+					Valid: true,
+				},
+			},
+		)
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to extend secret for hash(%x): %w",
+			hash, err)
+	}
+
+	return nil
+}
+
+// UnsettledSecrets returns the payment hashes of the L402s that aren't settled
+// and whose invoices expired before the given time, keyed by the hash of their
+// secrets.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *SecretsStore) UnsettledSecrets(ctx context.Context,
+	before time.Time) (map[[sha256.Size]byte]lntypes.Hash, error) {
+
+	var (
+		unsettled map[[sha256.Size]byte]lntypes.Hash
+		readOpts  = NewSecretsDBReadTx()
+	)
+	err := s.db.ExecTx(ctx, &readOpts, func(tx SecretsDB) error {
+		unsettled = make(map[[sha256.Size]byte]lntypes.Hash)
+		rows, err := tx.ListUnsettledSecrets(ctx, sql.NullTime{
+			Time:  before.UTC(),
+			Valid: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			var hash [sha256.Size]byte
+			copy(hash[:], row.Hash)
+
+			var paymentHash lntypes.Hash
+			copy(paymentHash[:], row.PaymentHash)
+
+			unsettled[hash] = paymentHash
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list unsettled secrets: %w",
+			err)
+	}
+
+	return unsettled, nil
+}
+
+// PruneSecrets removes all secrets that expired before the given time and
+// returns the number of removed secrets.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *SecretsStore) PruneSecrets(ctx context.Context,
+	before time.Time) (int64, error) {
+
+	var (
+		nRows       int64
+		writeTxOpts SecretsDBTxOptions
+	)
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		var err error
+		nRows, err = tx.DeleteExpiredSecrets(ctx, sql.NullTime{
+			Time:  before.UTC(),
+			Valid: true,
+		})
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to prune secrets: %w", err)
+	}
+
+	return nRows, nil
+}
+
+// ListRootKeys returns all root keys in the order of their versions.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *SecretsStore) ListRootKeys(ctx context.Context) ([]*mint.RootKey,
+	error) {
+
+	var (
+		rootKeys []*mint.RootKey
+		readOpts = NewSecretsDBReadTx()
+	)
+	err := s.db.ExecTx(ctx, &readOpts, func(tx SecretsDB) error {
+		rows, err := tx.ListRootKeys(ctx)
+		if err != nil {
+			return err
+		}
+
+		rootKeys = make([]*mint.RootKey, 0, len(rows))
+		for _, row := range rows {
+			rootKey, err := s.unmarshalRootKey(row)
+			if err != nil {
+				return err
+			}
+			rootKeys = append(rootKeys, rootKey)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list root keys: %w", err)
+	}
+
+	return rootKeys, nil
+}
+
+// RotateRootKey creates a root key with the next version and wraps all stored
+// secrets with it.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *SecretsStore) RotateRootKey(ctx context.Context) (*mint.RootKey,
+	int64, error) {
+
+	var (
+		rootKey     *mint.RootKey
+		rewrapped   int64
+		writeTxOpts SecretsDBTxOptions
+	)
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		var version uint32 = 1
+		latest, err := tx.GetLatestRootKey(ctx)
+		switch {
+		case err == nil:
+			version = uint32(latest.Version) + 1
+
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		rootKey, err = s.addRootKey(ctx, tx, version)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.ListSecretsToRewrap(ctx, int32(version))
+		if err != nil {
+			return err
+		}
+
+		rewrapped = 0
+		for _, row := range rows {
+			var hash [sha256.Size]byte
+			copy(hash[:], row.Hash)
+
+			secret, err := s.unwrapSecret(
+				hash, row.Secret, row.KeyVersion, row.RootKey,
+			)
+			if err != nil {
+				return err
+			}
+
+			wrapped, err := rootKey.WrapSecret(hash, secret)
+			if err != nil {
+				return err
+			}
+
+			err = tx.UpdateSecretKey(ctx, UpdateSecretKeyParams{
+				ID:         row.ID,
+				Secret:     wrapped,
+				KeyVersion: int32(version),
+			})
+			if err != nil {
+				return err
+			}
+			rewrapped++
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("unable to rotate root key: %w", err)
+	}
+
+	return rootKey, rewrapped, nil
+}
+
+// InvalidateRootKeys removes all secrets that were created while a root key
+// older than the given version was the latest one, along with those root keys.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *SecretsStore) InvalidateRootKeys(ctx context.Context,
+	version uint32) (int64, error) {
+
+	var (
+		invalidated int64
+		writeTxOpts SecretsDBTxOptions
+	)
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx SecretsDB) error {
+		var err error
+		invalidated, err = tx.DeleteSecretsMintedBefore(
+			ctx, int32(version),
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.DeleteRootKeysBefore(ctx, int32(version))
+
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("unable to invalidate root keys before "+
+			"version %d: %w", version, err)
+	}
+
+	return invalidated, nil
+}
+
+// latestRootKey returns the root key with the highest version, creating the
+// first one if there is none yet.
+func (s *SecretsStore) latestRootKey(ctx context.Context,
+	tx SecretsDB) (*mint.RootKey, error) {
+
+	row, err := tx.GetLatestRootKey(ctx)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return s.addRootKey(ctx, tx, 1)
+
+	case err != nil:
+		return nil, err
+	}
+
+	return s.unmarshalRootKey(row)
+}
+
+// addRootKey creates and stores a new random root key with the given version.
+func (s *SecretsStore) addRootKey(ctx context.Context, tx SecretsDB,
+	version uint32) (*mint.RootKey, error) {
+
+	rootKey, err := mint.NewRootKey(version, s.clock.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	encrypted, err := s.encrypter.Encrypt(
+		rootKey.Key[:], rootKeyAssociatedData(version),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.InsertRootKey(ctx, NewRootKey{
+		Version:   int32(rootKey.Version),
+		RootKey:   encrypted,
+		CreatedAt: rootKey.CreatedAt,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return rootKey, nil
+}
+
+// unmarshalRootKey converts a root key row into the mint's representation of
+// a root key.
+func (s *SecretsStore) unmarshalRootKey(row sqlc.RootKey) (*mint.RootKey,
+	error) {
+
+	key, err := s.encrypter.Decrypt(
+		row.RootKey, rootKeyAssociatedData(uint32(row.Version)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt root key %d: %w",
+			row.Version, err)
+	}
+
+	rootKey := &mint.RootKey{
+		Version:   uint32(row.Version),
+		CreatedAt: row.CreatedAt,
+	}
+	copy(rootKey.Key[:], key)
+
+	return rootKey, nil
+}
+
+// unwrapSecret returns the plaintext of a stored secret that is wrapped with
+// the given root key. Secrets of version 0 were stored before root keys were
+// introduced and aren't wrapped.
+func (s *SecretsStore) unwrapSecret(hash [sha256.Size]byte, stored []byte,
+	keyVersion int32, key []byte) ([l402.SecretSize]byte, error) {
+
+	var secret [l402.SecretSize]byte
+	if keyVersion == 0 {
+		copy(secret[:], stored)
+		return secret, nil
+	}
+
+	key, err := s.encrypter.Decrypt(
+		key, rootKeyAssociatedData(uint32(keyVersion)),
+	)
+	if err != nil {
+		return secret, fmt.Errorf("unable to decrypt root key %d: %w",
+			keyVersion, err)
+	}
+
+	if len(key) != mint.RootKeySize {
+		return secret, fmt.Errorf("%w: version %d",
+			mint.ErrRootKeyNotFound, keyVersion)
+	}
+
+	rootKey := &mint.RootKey{Version: uint32(keyVersion)}
+	copy(rootKey.Key[:], key)
+
+	return rootKey.UnwrapSecret(hash, stored)
+}
+
+// rootKeyAssociatedData returns the data that is authenticated along with the
+// root key of the given version when it is encrypted.
+func rootKeyAssociatedData(version uint32) []byte {
+	return []byte(fmt.Sprintf("root_keys/%d", version))
+}
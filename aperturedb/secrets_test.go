@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/stretchr/testify/require"
 )
 
@@ -23,7 +24,7 @@ func newSecretsStoreWithDB(db *BaseDB) *SecretsStore {
 		},
 	)
 
-	return NewSecretsStore(dbTxer)
+	return NewSecretsStore(dbTxer, nil)
 }
 
 func TestSecretDB(t *testing.T) {
@@ -62,3 +63,190 @@ func TestSecretDB(t *testing.T) {
 	_, err = store.GetSecret(ctxt, hash)
 	require.ErrorIs(t, err, mint.ErrSecretNotFound)
 }
+
+// TestSecretExpiryDB ensures that only the secrets of L402s that can no longer
+// be used are pruned.
+func TestSecretExpiryDB(t *testing.T) {
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	db := NewTestDB(t)
+	store := newSecretsStoreWithDB(db.BaseDB)
+
+	// Create a secret without expiry, an unpaid one, a settled one that
+	// never expires and a settled one that expires.
+	var (
+		noExpiry  = [sha256.Size]byte{1}
+		unpaid    = [sha256.Size]byte{2}
+		forever   = [sha256.Size]byte{3}
+		expiring  = [sha256.Size]byte{4}
+		invoiceAt = time.Unix(1_000, 0)
+	)
+	for _, hash := range [][sha256.Size]byte{
+		noExpiry, unpaid, forever, expiring,
+	} {
+		_, err := store.NewSecret(ctxt, hash)
+		require.NoError(t, err)
+	}
+
+	expiry := &mint.SecretExpiry{
+		PaymentHash:   lntypes.Hash{7},
+		InvoiceExpiry: invoiceAt,
+	}
+	require.NoError(t, store.SetSecretExpiry(ctxt, unpaid, expiry))
+	require.NoError(t, store.SetSecretExpiry(ctxt, forever, expiry))
+
+	expiry.ValidUntil = time.Unix(2_000, 0)
+	require.NoError(t, store.SetSecretExpiry(ctxt, expiring, expiry))
+
+	// Setting the expiry of an unknown secret fails.
+	err := store.SetSecretExpiry(ctxt, [sha256.Size]byte{9}, expiry)
+	require.ErrorIs(t, err, mint.ErrSecretNotFound)
+
+	// All secrets with an expiry are unsettled until they're settled.
+	afterInvoice := invoiceAt.Add(time.Second)
+	unsettled, err := store.UnsettledSecrets(ctxt, invoiceAt)
+	require.NoError(t, err)
+	require.Empty(t, unsettled)
+
+	unsettled, err = store.UnsettledSecrets(ctxt, afterInvoice)
+	require.NoError(t, err)
+	require.Equal(t, map[[sha256.Size]byte]lntypes.Hash{
+		unpaid:   {7},
+		forever:  {7},
+		expiring: {7},
+	}, unsettled)
+
+	require.NoError(t, store.SettleSecret(ctxt, forever))
+	require.NoError(t, store.SettleSecret(ctxt, expiring))
+	require.NoError(t, store.SettleSecret(ctxt, expiring))
+
+	unsettled, err = store.UnsettledSecrets(ctxt, afterInvoice)
+	require.NoError(t, err)
+	require.Equal(t, map[[sha256.Size]byte]lntypes.Hash{
+		unpaid: {7},
+	}, unsettled)
+
+	// Extending never shortens the validity and never makes a secret that
+	// never expires expire.
+	require.NoError(t, store.ExtendSecret(
+		ctxt, expiring, time.Unix(3_000, 0),
+	))
+	require.NoError(t, store.ExtendSecret(
+		ctxt, expiring, time.Unix(2_500, 0),
+	))
+	require.NoError(t, store.ExtendSecret(
+		ctxt, forever, time.Unix(2_500, 0),
+	))
+
+	// Nothing expired before the invoices did.
+	pruned, err := store.PruneSecrets(ctxt, invoiceAt)
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	// Once the invoices expired, only the unpaid secret is pruned.
+	pruned, err = store.PruneSecrets(ctxt, time.Unix(2_900, 0))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+
+	_, err = store.GetSecret(ctxt, unpaid)
+	require.ErrorIs(t, err, mint.ErrSecretNotFound)
+
+	// Once the extended L402 expired, its secret is pruned as well.
+	pruned, err = store.PruneSecrets(ctxt, time.Unix(3_100, 0))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+
+	_, err = store.GetSecret(ctxt, expiring)
+	require.ErrorIs(t, err, mint.ErrSecretNotFound)
+
+	for _, hash := range [][sha256.Size]byte{noExpiry, forever} {
+		_, err := store.GetSecret(ctxt, hash)
+		require.NoError(t, err)
+	}
+}
+
+// TestRootKeysDB ensures that secrets are wrapped with the latest root key and
+// that they can be rotated and invalidated.
+func TestRootKeysDB(t *testing.T) {
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	db := NewTestDB(t)
+	store := newSecretsStoreWithDB(db.BaseDB)
+
+	// A secret that was stored before root keys were introduced isn't
+	// wrapped.
+	legacyHash := [sha256.Size]byte{1}
+	legacySecret := [32]byte{1, 2, 3}
+	_, err := db.InsertSecret(ctxt, NewSecret{
+		Hash:      legacyHash[:],
+		Secret:    legacySecret[:],
+		CreatedAt: time.Now().UTC(),
+	})
+	require.NoError(t, err)
+
+	// The first root key is created along with the first new secret.
+	firstHash := [sha256.Size]byte{2}
+	firstSecret, err := store.NewSecret(ctxt, firstHash)
+	require.NoError(t, err)
+
+	rootKeys, err := store.ListRootKeys(ctxt)
+	require.NoError(t, err)
+	require.Len(t, rootKeys, 1)
+	require.EqualValues(t, 1, rootKeys[0].Version)
+
+	// The secret is only stored wrapped.
+	row, err := db.GetSecretByHash(ctxt, firstHash[:])
+	require.NoError(t, err)
+	require.EqualValues(t, 1, row.KeyVersion)
+	require.NotEqual(t, firstSecret[:], row.Secret)
+
+	// Rotating wraps both secrets with the new root key.
+	rootKey, rewrapped, err := store.RotateRootKey(ctxt)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rootKey.Version)
+	require.EqualValues(t, 2, rewrapped)
+
+	secondHash := [sha256.Size]byte{3}
+	secondSecret, err := store.NewSecret(ctxt, secondHash)
+	require.NoError(t, err)
+
+	for hash, secret := range map[[sha256.Size]byte][32]byte{
+		legacyHash: legacySecret,
+		firstHash:  firstSecret,
+		secondHash: secondSecret,
+	} {
+		row, err := db.GetSecretByHash(ctxt, hash[:])
+		require.NoError(t, err)
+		require.EqualValues(t, 2, row.KeyVersion)
+
+		dbSecret, err := store.GetSecret(ctxt, hash)
+		require.NoError(t, err)
+		require.Equal(t, secret, dbSecret)
+	}
+
+	// Invalidating the first version removes the secrets that were
+	// created before the rotation, along with the old root key.
+	invalidated, err := store.InvalidateRootKeys(ctxt, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, invalidated)
+
+	for _, hash := range [][sha256.Size]byte{legacyHash, firstHash} {
+		_, err = store.GetSecret(ctxt, hash)
+		require.ErrorIs(t, err, mint.ErrSecretNotFound)
+	}
+
+	dbSecret, err := store.GetSecret(ctxt, secondHash)
+	require.NoError(t, err)
+	require.Equal(t, secondSecret, dbSecret)
+
+	rootKeys, err = store.ListRootKeys(ctxt)
+	require.NoError(t, err)
+	require.Len(t, rootKeys, 1)
+	require.EqualValues(t, 2, rootKeys[0].Version)
+}
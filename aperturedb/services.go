@@ -0,0 +1,168 @@
+package aperturedb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+type (
+	// NewService is a struct that contains the parameters required to
+	// insert or update a service in the database.
+	NewService = sqlc.UpsertServiceParams
+)
+
+// ServicesDB is an interface that defines the set of operations that can be
+// executed against the services database.
+type ServicesDB interface {
+	// UpsertService inserts a new service into the database or updates the
+	// configuration of the service with the same name.
+	UpsertService(ctx context.Context, arg NewService) error
+
+	// ListServices returns all services in the order they were inserted.
+	ListServices(ctx context.Context) ([]sqlc.Service, error)
+
+	// DeleteServiceByName removes the service with the given name.
+	DeleteServiceByName(ctx context.Context, name string) (int64, error)
+}
+
+// ServicesDBTxOptions defines the set of db txn options the ServicesStore
+// understands.
+type ServicesDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *ServicesDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// NewServicesDBReadTx creates a new read transaction option set.
+func NewServicesDBReadTx() ServicesDBTxOptions {
+	return ServicesDBTxOptions{
+		readOnly: true,
+	}
+}
+
+// BatchedServicesDB is a version of the ServicesDB that's capable of batched
+// database operations.
+type BatchedServicesDB interface {
+	ServicesDB
+
+	BatchedTx[ServicesDB]
+}
+
+// ServicesStore represents a storage backend.
+type ServicesStore struct {
+	db    BatchedServicesDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure ServicesStore implements
+// proxy.ServiceStore.
+var _ proxy.ServiceStore = (*ServicesStore)(nil)
+
+// NewServicesStore creates a new ServicesStore instance given a open
+// BatchedServicesDB storage backend.
+func NewServicesStore(db BatchedServicesDB) *ServicesStore {
+	return &ServicesStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// Services returns all stored services in the order they were first added.
+func (s *ServicesStore) Services(ctx context.Context) ([]*proxy.Service,
+	error) {
+
+	var services []*proxy.Service
+	readOpts := NewServicesDBReadTx()
+	err := s.db.ExecTx(ctx, &readOpts, func(tx ServicesDB) error {
+		rows, err := tx.ListServices(ctx)
+		if err != nil {
+			return err
+		}
+
+		services = make([]*proxy.Service, 0, len(rows))
+		for _, row := range rows {
+			var service proxy.Service
+			err := json.Unmarshal(row.Config, &service)
+			if err != nil {
+				return fmt.Errorf("unable to decode service "+
+					"%s: %w", row.Name, err)
+			}
+
+			services = append(services, &service)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to list services: %w", err)
+	}
+
+	return services, nil
+}
+
+// StoreService adds the given service to the store or replaces the
+// configuration of an existing service with the same name.
+func (s *ServicesStore) StoreService(ctx context.Context,
+	service *proxy.Service) error {
+
+	config, err := json.Marshal(service)
+	if err != nil {
+		return fmt.Errorf("unable to encode service %s: %w",
+			service.Name, err)
+	}
+
+	now := s.clock.Now().UTC()
+
+	var writeTxOpts ServicesDBTxOptions
+	err = s.db.ExecTx(ctx, &writeTxOpts, func(tx ServicesDB) error {
+		return tx.UpsertService(ctx, NewService{
+			Name:      service.Name,
+			Config:    config,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to store service %s: %w",
+			service.Name, err)
+	}
+
+	return nil
+}
+
+// DeleteService removes the service with the given name from the store. If
+// there is no such service, proxy.ErrServiceNotFound is returned.
+func (s *ServicesStore) DeleteService(ctx context.Context, name string) error {
+	var writeTxOpts ServicesDBTxOptions
+	err := s.db.ExecTx(ctx, &writeTxOpts, func(tx ServicesDB) error {
+		nRows, err := tx.DeleteServiceByName(ctx, name)
+		if err != nil {
+			return err
+		}
+
+		if nRows == 0 {
+			return proxy.ErrServiceNotFound
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return fmt.Errorf("unable to delete service %s: %w", name, err)
+	}
+
+	return nil
+}
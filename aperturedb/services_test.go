@@ -0,0 +1,98 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+func newServicesStoreWithDB(db *BaseDB) *ServicesStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) ServicesDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewServicesStore(dbTxer)
+}
+
+func TestServicesDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database.
+	db := NewTestDB(t)
+	store := newServicesStoreWithDB(db.BaseDB)
+
+	// An empty store doesn't return any services.
+	services, err := store.Services(ctxt)
+	require.NoError(t, err)
+	require.Empty(t, services)
+
+	// Removing a service that doesn't exist should fail.
+	err = store.DeleteService(ctxt, "unknown")
+	require.ErrorIs(t, err, proxy.ErrServiceNotFound)
+
+	service1 := &proxy.Service{
+		Name:       "service1",
+		Address:    "127.0.0.1:10009",
+		Protocol:   "https",
+		Auth:       auth.Level("freebie 3"),
+		HostRegexp: "^service1.com$",
+		Headers: map[string]string{
+			"Grpc-Metadata-Macaroon": "abcd",
+		},
+		Constraints: map[string]string{
+			"valid_until": "2030-01-01",
+		},
+		Price: 10,
+		RateLimits: []*proxy.RateLimitConfig{{
+			PathRegexp: "^/v1/.*$",
+			Requests:   5,
+			Per:        time.Minute,
+		}},
+	}
+	service2 := &proxy.Service{
+		Name:       "service2",
+		Address:    "127.0.0.1:8080",
+		Protocol:   "http",
+		HostRegexp: ".*",
+		PathRegexp: "^/service2/.*$",
+		Price:      20,
+	}
+
+	require.NoError(t, store.StoreService(ctxt, service1))
+	require.NoError(t, store.StoreService(ctxt, service2))
+
+	// Both services should be returned in the order they were added.
+	services, err = store.Services(ctxt)
+	require.NoError(t, err)
+	require.Equal(t, []*proxy.Service{service1, service2}, services)
+
+	// Updating the first service should replace its configuration but keep
+	// its position.
+	updated := service1.Clone()
+	updated.Price = 100
+	updated.Auth = auth.Level("on")
+	require.NoError(t, store.StoreService(ctxt, updated))
+
+	services, err = store.Services(ctxt)
+	require.NoError(t, err)
+	require.Equal(t, []*proxy.Service{updated, service2}, services)
+
+	// Finally, remove the first service.
+	require.NoError(t, store.DeleteService(ctxt, service1.Name))
+
+	services, err = store.Services(ctxt)
+	require.NoError(t, err)
+	require.Equal(t, []*proxy.Service{service2}, services)
+}
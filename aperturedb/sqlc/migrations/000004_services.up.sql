@@ -0,0 +1,17 @@
+-- services is the table used to store the backend services that were added
+-- or updated at run time through the admin API.
+CREATE TABLE IF NOT EXISTS services (
+    id INTEGER PRIMARY KEY,
+
+    -- The unique name of the service.
+    name TEXT UNIQUE NOT NULL,
+
+    -- The JSON encoded configuration of the service.
+    config BLOB NOT NULL,
+
+    -- created_at is the time the service was first stored.
+    created_at TIMESTAMP NOT NULL,
+
+    -- updated_at is the time the service configuration was last changed.
+    updated_at TIMESTAMP NOT NULL
+);
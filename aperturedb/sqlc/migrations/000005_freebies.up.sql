@@ -0,0 +1,20 @@
+-- freebies is the table used to keep track of the free requests each client
+-- has made to a backend service.
+CREATE TABLE IF NOT EXISTS freebies (
+    id INTEGER PRIMARY KEY,
+
+    -- The name of the service the free requests were made to.
+    service_name TEXT NOT NULL,
+
+    -- The key that identifies the client, for example its masked IP
+    -- address.
+    freebie_key TEXT NOT NULL,
+
+    -- The number of free requests made within the current window.
+    tally BIGINT NOT NULL,
+
+    -- window_start is the time the current window of free requests started.
+    window_start TIMESTAMP NOT NULL,
+
+    UNIQUE (service_name, freebie_key)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS rate_limit_buckets_full_at_idx;
+DROP TABLE IF EXISTS rate_limit_buckets;
@@ -0,0 +1,23 @@
+-- rate_limit_buckets is the table used to keep the token buckets of the rate
+-- limits of the backend services, so all aperture instances that share the
+-- database enforce the same limits.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    id INTEGER PRIMARY KEY,
+
+    -- The key that identifies the bucket. It is made up of the service, the
+    -- rate limit rule and the client the bucket belongs to.
+    bucket_key TEXT UNIQUE NOT NULL,
+
+    -- The number of tokens in the bucket at the time it was last updated.
+    tokens DOUBLE PRECISION NOT NULL,
+
+    -- updated_at is the time the bucket was last updated.
+    updated_at TIMESTAMP NOT NULL,
+
+    -- full_at is the time the bucket will be full again. From then on, the
+    -- bucket is equivalent to a new one and can be deleted.
+    full_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_full_at_idx
+ON rate_limit_buckets (full_at);
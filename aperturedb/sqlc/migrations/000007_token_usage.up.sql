@@ -0,0 +1,19 @@
+-- token_usage is the table used to count the requests made with L402s that
+-- are only valid for a limited number of requests to a service.
+CREATE TABLE IF NOT EXISTS token_usage (
+    id INTEGER PRIMARY KEY,
+
+    -- The ID of the token the requests were made with.
+    token_id BLOB NOT NULL,
+
+    -- The name of the service the requests were made to.
+    service_name TEXT NOT NULL,
+
+    -- The number of requests made with the token to the service.
+    used BIGINT NOT NULL,
+
+    -- updated_at is the time of the last request.
+    updated_at TIMESTAMP NOT NULL,
+
+    UNIQUE (token_id, service_name)
+);
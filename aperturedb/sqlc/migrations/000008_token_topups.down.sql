@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS token_topups_token_id_idx;
+DROP TABLE IF EXISTS token_topups;
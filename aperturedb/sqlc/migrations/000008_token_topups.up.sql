@@ -0,0 +1,32 @@
+-- token_topups is the table used to keep track of the top-ups of L402s, which
+-- extend existing L402s for a service instead of replacing them with new ones.
+CREATE TABLE IF NOT EXISTS token_topups (
+    id INTEGER PRIMARY KEY,
+
+    -- The payment hash of the invoice that pays for the top-up.
+    payment_hash BLOB NOT NULL UNIQUE,
+
+    -- The ID of the token that is topped up.
+    token_id BLOB NOT NULL,
+
+    -- The name of the service the token is topped up for.
+    service_name TEXT NOT NULL,
+
+    -- The number of additional requests the top-up grants.
+    requests BIGINT NOT NULL,
+
+    -- The number of seconds the top-up extends the validity of the token by.
+    validity_seconds BIGINT NOT NULL,
+
+    -- created_at is the time the top-up invoice was created.
+    created_at TIMESTAMP NOT NULL,
+
+    -- settled is true once the top-up is paid and applied to the token.
+    settled BOOLEAN NOT NULL DEFAULT FALSE,
+
+    -- valid_until is the time until which the settled top-up extends the
+    -- validity of the token, if it extends it at all.
+    valid_until TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS token_topups_token_id_idx ON token_topups (token_id);
@@ -0,0 +1,2 @@
+ALTER TABLE token_topups DROP COLUMN balance;
+ALTER TABLE token_usage DROP COLUMN spent;
@@ -0,0 +1,6 @@
+-- spent is the number of satoshis of its balance that a token spent on
+-- requests to a service in balance mode.
+ALTER TABLE token_usage ADD COLUMN spent BIGINT NOT NULL DEFAULT 0;
+
+-- balance is the number of satoshis a top-up adds to the balance of a token.
+ALTER TABLE token_topups ADD COLUMN balance BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,18 @@
+-- token_revocations is the revocation list of L402s. Each entry revokes the
+-- L402s with either the given token ID or the given payment hash.
+CREATE TABLE IF NOT EXISTS token_revocations (
+    id INTEGER PRIMARY KEY,
+
+    -- The ID of the revoked token, if it is revoked by its token ID.
+    token_id BLOB UNIQUE,
+
+    -- The payment hash of the revoked token, if it is revoked by its payment
+    -- hash.
+    payment_hash BLOB UNIQUE,
+
+    -- An optional description of why the token was revoked.
+    reason TEXT NOT NULL,
+
+    -- revoked_at is the time the token was revoked.
+    revoked_at TIMESTAMP NOT NULL
+);
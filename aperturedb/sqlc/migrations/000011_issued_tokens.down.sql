@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS issued_token_services_service_name_idx;
+DROP TABLE IF EXISTS issued_token_services;
+DROP INDEX IF EXISTS issued_tokens_created_at_idx;
+DROP INDEX IF EXISTS issued_tokens_payment_hash_idx;
+DROP TABLE IF EXISTS issued_tokens;
@@ -0,0 +1,48 @@
+-- issued_tokens is the inventory of the L402s that were issued by the mint.
+CREATE TABLE IF NOT EXISTS issued_tokens (
+    id INTEGER PRIMARY KEY,
+
+    -- The ID of the issued token.
+    token_id BLOB NOT NULL UNIQUE,
+
+    -- The payment hash of the invoice that pays for the token.
+    payment_hash BLOB NOT NULL,
+
+    -- The price of the token in satoshis.
+    price BIGINT NOT NULL,
+
+    -- created_at is the time the token was issued.
+    created_at TIMESTAMP NOT NULL,
+
+    -- settled_at is the time the token was first used with the preimage of
+    -- its paid invoice, if it was used at all.
+    settled_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS issued_tokens_payment_hash_idx
+    ON issued_tokens (payment_hash);
+CREATE INDEX IF NOT EXISTS issued_tokens_created_at_idx
+    ON issued_tokens (created_at);
+
+-- issued_token_services holds the services each issued token was issued for.
+CREATE TABLE IF NOT EXISTS issued_token_services (
+    id INTEGER PRIMARY KEY,
+
+    -- The issued token the service belongs to.
+    issued_token_id INTEGER NOT NULL REFERENCES issued_tokens (id)
+        ON DELETE CASCADE,
+
+    -- The name of the service.
+    service_name TEXT NOT NULL,
+
+    -- The tier of the service the token was issued for.
+    tier INTEGER NOT NULL,
+
+    -- The price of the service in satoshis.
+    price BIGINT NOT NULL,
+
+    UNIQUE (issued_token_id, service_name)
+);
+
+CREATE INDEX IF NOT EXISTS issued_token_services_service_name_idx
+    ON issued_token_services (service_name);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS secrets_invoice_expires_at_idx;
+ALTER TABLE secrets DROP COLUMN settled;
+ALTER TABLE secrets DROP COLUMN valid_until;
+ALTER TABLE secrets DROP COLUMN invoice_expires_at;
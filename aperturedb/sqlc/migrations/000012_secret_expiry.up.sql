@@ -0,0 +1,14 @@
+-- invoice_expires_at is the time the invoice that pays for the L402 of the
+-- secret expires. It is NULL for secrets that weren't created for L402s.
+ALTER TABLE secrets ADD COLUMN invoice_expires_at TIMESTAMP;
+
+-- valid_until is the time the L402 of the secret expires. It is NULL if the
+-- L402 never expires.
+ALTER TABLE secrets ADD COLUMN valid_until TIMESTAMP;
+
+-- settled is set once the invoice that pays for the L402 of the secret was
+-- found to be paid.
+ALTER TABLE secrets ADD COLUMN settled BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS secrets_invoice_expires_at_idx
+    ON secrets (invoice_expires_at);
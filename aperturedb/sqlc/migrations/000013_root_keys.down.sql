@@ -0,0 +1,3 @@
+ALTER TABLE secrets DROP COLUMN minted_key_version;
+ALTER TABLE secrets DROP COLUMN key_version;
+DROP TABLE IF EXISTS root_keys;
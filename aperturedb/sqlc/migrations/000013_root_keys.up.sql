@@ -0,0 +1,23 @@
+-- root_keys are the versioned keys that wrap the secrets of L402s.
+CREATE TABLE IF NOT EXISTS root_keys (
+    id INTEGER PRIMARY KEY,
+
+    -- The version of the root key, increasing with every rotation.
+    version INTEGER NOT NULL UNIQUE,
+
+    -- The key material of the root key.
+    root_key BLOB NOT NULL,
+
+    -- created_at is the time the root key was created.
+    created_at TIMESTAMP NOT NULL
+);
+
+-- key_version is the version of the root key that wraps the secret. Secrets
+-- with version 0 were stored before root keys were introduced and aren't
+-- wrapped.
+ALTER TABLE secrets ADD COLUMN key_version INTEGER NOT NULL DEFAULT 0;
+
+-- minted_key_version is the version of the latest root key at the time the
+-- secret was created. Unlike key_version, it doesn't change when the secret is
+-- wrapped with a new root key.
+ALTER TABLE secrets ADD COLUMN minted_key_version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,15 @@
+-- data_keys holds the key that encrypts sensitive values at rest, like the
+-- root keys, the onion private key and the LNC session keys. The data key
+-- itself is encrypted with the master key that is provided to aperture.
+CREATE TABLE IF NOT EXISTS data_keys (
+    id INTEGER PRIMARY KEY,
+
+    -- The salt the master key is derived with from a passphrase.
+    salt BLOB NOT NULL,
+
+    -- The data key encrypted with the master key.
+    encrypted_key BLOB NOT NULL,
+
+    -- created_at is the time the data key was created.
+    created_at TIMESTAMP NOT NULL
+);
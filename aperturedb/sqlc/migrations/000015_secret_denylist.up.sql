@@ -0,0 +1,11 @@
+-- secret_denylist holds the identifier hashes of revoked L402s whose secrets
+-- are derived from a root key instead of being stored.
+CREATE TABLE IF NOT EXISTS secret_denylist (
+    id INTEGER PRIMARY KEY,
+
+    -- The hash of the identifier of the revoked L402.
+    hash BLOB NOT NULL UNIQUE,
+
+    -- denied_at is the time the secret was revoked.
+    denied_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,4 @@
+-- payment_hash is the payment hash of the invoice that pays for the L402 of
+-- the secret. It is used to look up whether the invoice was paid before the
+-- secret is pruned. It is NULL for secrets that weren't created for L402s.
+ALTER TABLE secrets ADD COLUMN payment_hash BLOB;
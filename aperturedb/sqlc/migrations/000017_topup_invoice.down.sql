@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS token_topups_invoice_expires_at_idx;
+ALTER TABLE token_topups DROP COLUMN invoice_expires_at;
+ALTER TABLE token_topups DROP COLUMN payment_request;
@@ -0,0 +1,10 @@
+-- payment_request is the invoice that pays for the top-up. It is offered again
+-- for the token until it is paid or expires.
+ALTER TABLE token_topups ADD COLUMN payment_request TEXT NOT NULL DEFAULT '';
+
+-- invoice_expires_at is the time the invoice that pays for the top-up expires.
+-- Unsettled top-ups are pruned once their invoice expired without being paid.
+ALTER TABLE token_topups ADD COLUMN invoice_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS token_topups_invoice_expires_at_idx
+    ON token_topups (invoice_expires_at);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS freebie_requests_freebie_id_requested_at_idx;
+DROP TABLE IF EXISTS freebie_requests;
+ALTER TABLE freebies ADD COLUMN tally BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE freebies ADD COLUMN window_start TIMESTAMP NOT NULL
+    DEFAULT '1970-01-01 00:00:00';
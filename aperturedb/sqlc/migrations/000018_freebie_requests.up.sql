@@ -0,0 +1,21 @@
+-- freebie_requests holds the individual free requests of each client, so they
+-- can be counted over a rolling window. A request is deleted once it left the
+-- window.
+CREATE TABLE IF NOT EXISTS freebie_requests (
+    id INTEGER PRIMARY KEY,
+
+    -- The client that made the free request.
+    freebie_id INTEGER NOT NULL REFERENCES freebies (id)
+        ON DELETE CASCADE,
+
+    -- requested_at is the time the free request was made.
+    requested_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS freebie_requests_freebie_id_requested_at_idx
+    ON freebie_requests (freebie_id, requested_at);
+
+-- The free requests are now counted in freebie_requests, so the rows of the
+-- freebies table only identify the clients.
+ALTER TABLE freebies DROP COLUMN tally;
+ALTER TABLE freebies DROP COLUMN window_start;
@@ -9,6 +9,42 @@ import (
 	"time"
 )
 
+type DataKey struct {
+	ID           int32
+	Salt         []byte
+	EncryptedKey []byte
+	CreatedAt    time.Time
+}
+
+type Freebie struct {
+	ID          int32
+	ServiceName string
+	FreebieKey  string
+}
+
+type FreebieRequest struct {
+	ID          int32
+	FreebieID   int32
+	RequestedAt time.Time
+}
+
+type IssuedToken struct {
+	ID          int32
+	TokenID     []byte
+	PaymentHash []byte
+	Price       int64
+	CreatedAt   time.Time
+	SettledAt   sql.NullTime
+}
+
+type IssuedTokenService struct {
+	ID            int32
+	IssuedTokenID int32
+	ServiceName   string
+	Tier          int32
+	Price         int64
+}
+
 type LncSession struct {
 	ID                 int32
 	PassphraseWords    string
@@ -26,9 +62,76 @@ type Onion struct {
 	CreatedAt  time.Time
 }
 
+type RateLimitBucket struct {
+	ID        int32
+	BucketKey string
+	Tokens    float64
+	UpdatedAt time.Time
+	FullAt    time.Time
+}
+
+type RootKey struct {
+	ID        int32
+	Version   int32
+	RootKey   []byte
+	CreatedAt time.Time
+}
+
 type Secret struct {
+	ID               int32
+	Hash             []byte
+	Secret           []byte
+	CreatedAt        time.Time
+	InvoiceExpiresAt sql.NullTime
+	ValidUntil       sql.NullTime
+	Settled          bool
+	KeyVersion       int32
+	MintedKeyVersion int32
+	PaymentHash      []byte
+}
+
+type SecretDenylist struct {
+	ID       int32
+	Hash     []byte
+	DeniedAt time.Time
+}
+
+type Service struct {
 	ID        int32
-	Hash      []byte
-	Secret    []byte
+	Name      string
+	Config    []byte
 	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type TokenRevocation struct {
+	ID          int32
+	TokenID     []byte
+	PaymentHash []byte
+	Reason      string
+	RevokedAt   time.Time
+}
+
+type TokenTopup struct {
+	ID               int32
+	PaymentHash      []byte
+	TokenID          []byte
+	ServiceName      string
+	Requests         int64
+	ValiditySeconds  int64
+	CreatedAt        time.Time
+	Settled          bool
+	ValidUntil       sql.NullTime
+	Balance          int64
+	PaymentRequest   string
+	InvoiceExpiresAt sql.NullTime
+}
+
+type TokenUsage struct {
+	ID          int32
+	TokenID     []byte
+	ServiceName string
+	Used        int64
+	UpdatedAt   time.Time
+	Spent       int64
 }
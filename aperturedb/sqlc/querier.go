@@ -6,19 +6,68 @@ package sqlc
 
 import (
 	"context"
+	"database/sql"
+	"time"
 )
 
 type Querier interface {
+	AddTokenUsage(ctx context.Context, arg AddTokenUsageParams) error
+	CountTokenRevocations(ctx context.Context, arg CountTokenRevocationsParams) (int64, error)
+	DeleteExpiredSecrets(ctx context.Context, cutoff sql.NullTime) (int64, error)
+	DeleteFreebieRequestsBefore(ctx context.Context, arg DeleteFreebieRequestsBeforeParams) (int64, error)
+	DeleteFullRateLimitBuckets(ctx context.Context, fullAt time.Time) (int64, error)
 	DeleteOnionPrivateKey(ctx context.Context) error
+	DeleteRootKeysBefore(ctx context.Context, version int32) (int64, error)
 	DeleteSecretByHash(ctx context.Context, hash []byte) (int64, error)
-	GetSecretByHash(ctx context.Context, hash []byte) ([]byte, error)
+	DeleteSecretsMintedBefore(ctx context.Context, mintedKeyVersion int32) (int64, error)
+	DeleteServiceByName(ctx context.Context, name string) (int64, error)
+	DeleteUnsettledTokenTopUp(ctx context.Context, paymentHash []byte) error
+	ExtendSecretValidity(ctx context.Context, arg ExtendSecretValidityParams) (int64, error)
+	GetDataKey(ctx context.Context) (DataKey, error)
+	GetIssuedToken(ctx context.Context, tokenID []byte) (IssuedToken, error)
+	GetLatestRootKey(ctx context.Context) (RootKey, error)
+	GetLatestTokenTopUp(ctx context.Context, arg GetLatestTokenTopUpParams) (TokenTopup, error)
+	GetPendingTokenTopUp(ctx context.Context, arg GetPendingTokenTopUpParams) (TokenTopup, error)
+	GetRateLimitBucket(ctx context.Context, bucketKey string) (RateLimitBucket, error)
+	GetSecretByHash(ctx context.Context, hash []byte) (GetSecretByHashRow, error)
 	GetSession(ctx context.Context, passphraseEntropy []byte) (LncSession, error)
+	GetTokenTopUp(ctx context.Context, paymentHash []byte) (TokenTopup, error)
+	GetTokenUsage(ctx context.Context, arg GetTokenUsageParams) (TokenUsage, error)
+	IncrementTokenUsage(ctx context.Context, arg IncrementTokenUsageParams) (int64, error)
+	InsertDataKey(ctx context.Context, arg InsertDataKeyParams) error
+	InsertDeniedSecret(ctx context.Context, arg InsertDeniedSecretParams) error
+	InsertFreebieRequest(ctx context.Context, arg InsertFreebieRequestParams) error
+	InsertIssuedToken(ctx context.Context, arg InsertIssuedTokenParams) (int32, error)
+	InsertIssuedTokenService(ctx context.Context, arg InsertIssuedTokenServiceParams) error
+	InsertRootKey(ctx context.Context, arg InsertRootKeyParams) error
 	InsertSecret(ctx context.Context, arg InsertSecretParams) (int32, error)
 	InsertSession(ctx context.Context, arg InsertSessionParams) error
+	InsertTokenRevocation(ctx context.Context, arg InsertTokenRevocationParams) error
+	InsertTokenTopUp(ctx context.Context, arg InsertTokenTopUpParams) error
+	InsertTokenUsage(ctx context.Context, arg InsertTokenUsageParams) error
+	ListDeniedSecrets(ctx context.Context) ([][]byte, error)
+	ListExpiredTokenTopUps(ctx context.Context, cutoff sql.NullTime) ([][]byte, error)
+	ListFreebieRequests(ctx context.Context, arg ListFreebieRequestsParams) ([]time.Time, error)
+	ListIssuedTokenServices(ctx context.Context, issuedTokenID int32) ([]IssuedTokenService, error)
+	ListIssuedTokens(ctx context.Context, arg ListIssuedTokensParams) ([]IssuedToken, error)
+	ListRootKeys(ctx context.Context) ([]RootKey, error)
+	ListSecretsToRewrap(ctx context.Context, keyVersion int32) ([]ListSecretsToRewrapRow, error)
+	ListServices(ctx context.Context) ([]Service, error)
+	ListTokenRevocations(ctx context.Context) ([]TokenRevocation, error)
+	ListUnsettledSecrets(ctx context.Context, cutoff sql.NullTime) ([]ListUnsettledSecretsRow, error)
 	SelectOnionPrivateKey(ctx context.Context) ([]byte, error)
 	SetExpiry(ctx context.Context, arg SetExpiryParams) error
 	SetRemotePubKey(ctx context.Context, arg SetRemotePubKeyParams) error
+	SetSecretExpiry(ctx context.Context, arg SetSecretExpiryParams) (int64, error)
+	SettleIssuedToken(ctx context.Context, arg SettleIssuedTokenParams) (int64, error)
+	SettleSecret(ctx context.Context, hash []byte) (int64, error)
+	SettleTokenTopUp(ctx context.Context, arg SettleTokenTopUpParams) (int64, error)
+	SpendTokenBalance(ctx context.Context, arg SpendTokenBalanceParams) (int64, error)
+	UpdateSecretKey(ctx context.Context, arg UpdateSecretKeyParams) error
+	UpsertFreebie(ctx context.Context, arg UpsertFreebieParams) (int32, error)
 	UpsertOnion(ctx context.Context, arg UpsertOnionParams) error
+	UpsertRateLimitBucket(ctx context.Context, arg UpsertRateLimitBucketParams) error
+	UpsertService(ctx context.Context, arg UpsertServiceParams) error
 }
 
 var _ Querier = (*Queries)(nil)
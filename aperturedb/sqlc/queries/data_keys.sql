@@ -0,0 +1,12 @@
+-- name: InsertDataKey :exec
+INSERT INTO data_keys (
+    salt, encrypted_key, created_at
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: GetDataKey :one
+SELECT *
+FROM data_keys
+ORDER BY id
+LIMIT 1;
@@ -0,0 +1,30 @@
+-- name: UpsertFreebie :one
+INSERT INTO freebies (
+    service_name, freebie_key
+) VALUES (
+    $1, $2
+) ON CONFLICT (
+    service_name, freebie_key
+) DO UPDATE SET
+    freebie_key = EXCLUDED.freebie_key
+RETURNING id;
+
+-- name: ListFreebieRequests :many
+SELECT freebie_requests.requested_at
+FROM freebie_requests
+JOIN freebies
+    ON freebies.id = freebie_requests.freebie_id
+WHERE freebies.service_name = $1 AND freebies.freebie_key = $2
+    AND freebie_requests.requested_at >= sqlc.arg(window_cutoff)
+ORDER BY freebie_requests.requested_at;
+
+-- name: InsertFreebieRequest :exec
+INSERT INTO freebie_requests (
+    freebie_id, requested_at
+) VALUES (
+    $1, $2
+);
+
+-- name: DeleteFreebieRequestsBefore :execrows
+DELETE FROM freebie_requests
+WHERE freebie_id = $1 AND requested_at < sqlc.arg(window_cutoff);
@@ -0,0 +1,55 @@
+-- name: InsertIssuedToken :one
+INSERT INTO issued_tokens (
+    token_id, payment_hash, price, created_at
+) VALUES (
+    $1, $2, $3, $4
+) RETURNING id;
+
+-- name: InsertIssuedTokenService :exec
+INSERT INTO issued_token_services (
+    issued_token_id, service_name, tier, price
+) VALUES (
+    $1, $2, $3, $4
+);
+
+-- name: SettleIssuedToken :execrows
+UPDATE issued_tokens
+SET settled_at = $2
+WHERE token_id = $1 AND settled_at IS NULL;
+
+-- name: GetIssuedToken :one
+SELECT *
+FROM issued_tokens
+WHERE token_id = $1;
+
+-- name: ListIssuedTokens :many
+SELECT *
+FROM issued_tokens
+WHERE (
+    sqlc.narg(payment_hash) IS NULL OR
+    payment_hash = sqlc.narg(payment_hash)
+) AND (
+    sqlc.narg(created_after) IS NULL OR
+    created_at >= sqlc.narg(created_after)
+) AND (
+    sqlc.narg(created_before) IS NULL OR
+    created_at < sqlc.narg(created_before)
+) AND (
+    sqlc.narg(settled) IS NULL OR
+    (settled_at IS NOT NULL) = sqlc.narg(settled)
+) AND (
+    sqlc.narg(service_name) IS NULL OR EXISTS (
+        SELECT 1
+        FROM issued_token_services
+        WHERE issued_token_id = issued_tokens.id AND
+            service_name = sqlc.narg(service_name)
+    )
+)
+ORDER BY id
+LIMIT sqlc.arg(num_limit) OFFSET sqlc.arg(num_offset);
+
+-- name: ListIssuedTokenServices :many
+SELECT *
+FROM issued_token_services
+WHERE issued_token_id = $1
+ORDER BY id;
@@ -0,0 +1,20 @@
+-- name: GetRateLimitBucket :one
+SELECT *
+FROM rate_limit_buckets
+WHERE bucket_key = $1;
+
+-- name: UpsertRateLimitBucket :exec
+INSERT INTO rate_limit_buckets (
+    bucket_key, tokens, updated_at, full_at
+) VALUES (
+    $1, $2, $3, $4
+) ON CONFLICT (
+    bucket_key
+) DO UPDATE SET
+    tokens = EXCLUDED.tokens,
+    updated_at = EXCLUDED.updated_at,
+    full_at = EXCLUDED.full_at;
+
+-- name: DeleteFullRateLimitBuckets :execrows
+DELETE FROM rate_limit_buckets
+WHERE full_at < $1;
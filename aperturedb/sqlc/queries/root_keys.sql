@@ -0,0 +1,21 @@
+-- name: InsertRootKey :exec
+INSERT INTO root_keys (
+    version, root_key, created_at
+) VALUES (
+    $1, $2, $3
+);
+
+-- name: GetLatestRootKey :one
+SELECT *
+FROM root_keys
+ORDER BY version DESC
+LIMIT 1;
+
+-- name: ListRootKeys :many
+SELECT *
+FROM root_keys
+ORDER BY version;
+
+-- name: DeleteRootKeysBefore :execrows
+DELETE FROM root_keys
+WHERE version < $1;
@@ -0,0 +1,11 @@
+-- name: InsertDeniedSecret :exec
+INSERT INTO secret_denylist (
+    hash, denied_at
+) VALUES (
+    $1, $2
+) ON CONFLICT DO NOTHING;
+
+-- name: ListDeniedSecrets :many
+SELECT hash
+FROM secret_denylist
+ORDER BY id;
@@ -1,15 +1,57 @@
 -- name: InsertSecret :one
 INSERT INTO secrets (
-    hash, secret, created_at
+    hash, secret, created_at, key_version, minted_key_version
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 ) RETURNING id;
 
 -- name: GetSecretByHash :one
-SELECT secret 
+SELECT secrets.secret, secrets.key_version, root_keys.root_key
 FROM secrets
-WHERE hash = $1;
+LEFT JOIN root_keys ON root_keys.version = secrets.key_version
+WHERE secrets.hash = $1;
 
 -- name: DeleteSecretByHash :execrows
 DELETE FROM secrets
 WHERE hash = $1;
+
+-- name: SetSecretExpiry :execrows
+UPDATE secrets
+SET payment_hash = $2, invoice_expires_at = $3, valid_until = $4
+WHERE hash = $1;
+
+-- name: SettleSecret :execrows
+UPDATE secrets
+SET settled = TRUE
+WHERE hash = $1 AND NOT settled;
+
+-- name: ExtendSecretValidity :execrows
+UPDATE secrets
+SET valid_until = $2
+WHERE hash = $1 AND valid_until < $2;
+
+-- name: ListUnsettledSecrets :many
+SELECT hash, payment_hash
+FROM secrets
+WHERE NOT settled AND invoice_expires_at < sqlc.arg(cutoff);
+
+-- name: DeleteExpiredSecrets :execrows
+DELETE FROM secrets
+WHERE (NOT settled AND invoice_expires_at < sqlc.arg(cutoff))
+    OR (settled AND valid_until < sqlc.arg(cutoff));
+
+-- name: ListSecretsToRewrap :many
+SELECT secrets.id, secrets.hash, secrets.secret, secrets.key_version,
+    root_keys.root_key
+FROM secrets
+LEFT JOIN root_keys ON root_keys.version = secrets.key_version
+WHERE secrets.key_version < $1;
+
+-- name: UpdateSecretKey :exec
+UPDATE secrets
+SET secret = $2, key_version = $3
+WHERE id = $1;
+
+-- name: DeleteSecretsMintedBefore :execrows
+DELETE FROM secrets
+WHERE minted_key_version < $1;
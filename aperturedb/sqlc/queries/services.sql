@@ -0,0 +1,19 @@
+-- name: UpsertService :exec
+INSERT INTO services (
+    name, config, created_at, updated_at
+) VALUES (
+    $1, $2, $3, $4
+) ON CONFLICT (
+    name
+) DO UPDATE SET
+    config = EXCLUDED.config,
+    updated_at = EXCLUDED.updated_at;
+
+-- name: ListServices :many
+SELECT *
+FROM services
+ORDER BY id;
+
+-- name: DeleteServiceByName :execrows
+DELETE FROM services
+WHERE name = $1;
@@ -0,0 +1,16 @@
+-- name: InsertTokenRevocation :exec
+INSERT INTO token_revocations (
+    token_id, payment_hash, reason, revoked_at
+) VALUES (
+    $1, $2, $3, $4
+) ON CONFLICT DO NOTHING;
+
+-- name: CountTokenRevocations :one
+SELECT COUNT(*)
+FROM token_revocations
+WHERE token_id = $1 OR payment_hash = $2;
+
+-- name: ListTokenRevocations :many
+SELECT *
+FROM token_revocations
+ORDER BY id;
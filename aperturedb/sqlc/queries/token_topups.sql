@@ -0,0 +1,42 @@
+-- name: InsertTokenTopUp :exec
+INSERT INTO token_topups (
+    payment_hash, token_id, service_name, requests, balance,
+    validity_seconds, created_at, payment_request, invoice_expires_at
+) VALUES (
+    $1, $2, $3, $4, $5, $6, $7, $8, $9
+);
+
+-- name: GetTokenTopUp :one
+SELECT *
+FROM token_topups
+WHERE payment_hash = $1;
+
+-- name: SettleTokenTopUp :execrows
+UPDATE token_topups
+SET settled = TRUE, valid_until = $2
+WHERE payment_hash = $1 AND NOT settled;
+
+-- name: GetLatestTokenTopUp :one
+SELECT *
+FROM token_topups
+WHERE token_id = $1 AND service_name = $2 AND settled
+    AND valid_until IS NOT NULL
+ORDER BY valid_until DESC
+LIMIT 1;
+
+-- name: GetPendingTokenTopUp :one
+SELECT *
+FROM token_topups
+WHERE token_id = $1 AND service_name = $2 AND NOT settled
+    AND invoice_expires_at > $3
+ORDER BY invoice_expires_at DESC
+LIMIT 1;
+
+-- name: ListExpiredTokenTopUps :many
+SELECT payment_hash
+FROM token_topups
+WHERE NOT settled AND invoice_expires_at < sqlc.arg(cutoff);
+
+-- name: DeleteUnsettledTokenTopUp :exec
+DELETE FROM token_topups
+WHERE payment_hash = $1 AND NOT settled;
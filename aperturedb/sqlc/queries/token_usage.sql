@@ -0,0 +1,47 @@
+-- name: GetTokenUsage :one
+SELECT *
+FROM token_usage
+WHERE token_id = $1 AND service_name = $2;
+
+-- name: IncrementTokenUsage :one
+INSERT INTO token_usage (
+    token_id, service_name, used, updated_at
+) VALUES (
+    sqlc.arg(token_id), sqlc.arg(service_name), 1, sqlc.arg(now)
+) ON CONFLICT (
+    token_id, service_name
+) DO UPDATE SET
+    used = token_usage.used + 1,
+    updated_at = EXCLUDED.updated_at
+WHERE token_usage.used < sqlc.arg(max_requests)
+RETURNING used;
+
+-- name: AddTokenUsage :exec
+INSERT INTO token_usage (
+    token_id, service_name, used, spent, updated_at
+) VALUES (
+    $1, $2, $3, $4, $5
+) ON CONFLICT (
+    token_id, service_name
+) DO UPDATE SET
+    used = token_usage.used + EXCLUDED.used,
+    spent = token_usage.spent + EXCLUDED.spent,
+    updated_at = EXCLUDED.updated_at;
+
+-- name: InsertTokenUsage :exec
+INSERT INTO token_usage (
+    token_id, service_name, used, spent, updated_at
+) VALUES (
+    $1, $2, 0, 0, $3
+) ON CONFLICT (
+    token_id, service_name
+) DO NOTHING;
+
+-- name: SpendTokenBalance :one
+UPDATE token_usage
+SET spent = spent + sqlc.arg(price),
+    updated_at = sqlc.arg(now)
+WHERE token_id = sqlc.arg(token_id)
+    AND service_name = sqlc.arg(service_name)
+    AND spent + sqlc.arg(price) <= sqlc.arg(balance)
+RETURNING spent;
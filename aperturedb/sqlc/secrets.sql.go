@@ -7,9 +7,24 @@ package sqlc
 
 import (
 	"context"
+	"database/sql"
 	"time"
 )
 
+const deleteExpiredSecrets = `-- name: DeleteExpiredSecrets :execrows
+DELETE FROM secrets
+WHERE (NOT settled AND invoice_expires_at < $1)
+    OR (settled AND valid_until < $1)
+`
+
+func (q *Queries) DeleteExpiredSecrets(ctx context.Context, cutoff sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteExpiredSecrets, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const deleteSecretByHash = `-- name: DeleteSecretByHash :execrows
 DELETE FROM secrets
 WHERE hash = $1
@@ -23,36 +38,219 @@ func (q *Queries) DeleteSecretByHash(ctx context.Context, hash []byte) (int64, e
 	return result.RowsAffected()
 }
 
+const deleteSecretsMintedBefore = `-- name: DeleteSecretsMintedBefore :execrows
+DELETE FROM secrets
+WHERE minted_key_version < $1
+`
+
+func (q *Queries) DeleteSecretsMintedBefore(ctx context.Context, mintedKeyVersion int32) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSecretsMintedBefore, mintedKeyVersion)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const extendSecretValidity = `-- name: ExtendSecretValidity :execrows
+UPDATE secrets
+SET valid_until = $2
+WHERE hash = $1 AND valid_until < $2
+`
+
+type ExtendSecretValidityParams struct {
+	Hash       []byte
+	ValidUntil sql.NullTime
+}
+
+func (q *Queries) ExtendSecretValidity(ctx context.Context, arg ExtendSecretValidityParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, extendSecretValidity, arg.Hash, arg.ValidUntil)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getSecretByHash = `-- name: GetSecretByHash :one
-SELECT secret 
+SELECT secrets.secret, secrets.key_version, root_keys.root_key
 FROM secrets
-WHERE hash = $1
+LEFT JOIN root_keys ON root_keys.version = secrets.key_version
+WHERE secrets.hash = $1
 `
 
-func (q *Queries) GetSecretByHash(ctx context.Context, hash []byte) ([]byte, error) {
+type GetSecretByHashRow struct {
+	Secret     []byte
+	KeyVersion int32
+	RootKey    []byte
+}
+
+func (q *Queries) GetSecretByHash(ctx context.Context, hash []byte) (GetSecretByHashRow, error) {
 	row := q.db.QueryRowContext(ctx, getSecretByHash, hash)
-	var secret []byte
-	err := row.Scan(&secret)
-	return secret, err
+	var i GetSecretByHashRow
+	err := row.Scan(&i.Secret, &i.KeyVersion, &i.RootKey)
+	return i, err
 }
 
 const insertSecret = `-- name: InsertSecret :one
 INSERT INTO secrets (
-    hash, secret, created_at
+    hash, secret, created_at, key_version, minted_key_version
 ) VALUES (
-    $1, $2, $3
+    $1, $2, $3, $4, $5
 ) RETURNING id
 `
 
 type InsertSecretParams struct {
-	Hash      []byte
-	Secret    []byte
-	CreatedAt time.Time
+	Hash             []byte
+	Secret           []byte
+	CreatedAt        time.Time
+	KeyVersion       int32
+	MintedKeyVersion int32
 }
 
 func (q *Queries) InsertSecret(ctx context.Context, arg InsertSecretParams) (int32, error) {
-	row := q.db.QueryRowContext(ctx, insertSecret, arg.Hash, arg.Secret, arg.CreatedAt)
+	row := q.db.QueryRowContext(ctx, insertSecret,
+		arg.Hash,
+		arg.Secret,
+		arg.CreatedAt,
+		arg.KeyVersion,
+		arg.MintedKeyVersion,
+	)
 	var id int32
 	err := row.Scan(&id)
 	return id, err
 }
+
+const listSecretsToRewrap = `-- name: ListSecretsToRewrap :many
+SELECT secrets.id, secrets.hash, secrets.secret, secrets.key_version,
+    root_keys.root_key
+FROM secrets
+LEFT JOIN root_keys ON root_keys.version = secrets.key_version
+WHERE secrets.key_version < $1
+`
+
+type ListSecretsToRewrapRow struct {
+	ID         int32
+	Hash       []byte
+	Secret     []byte
+	KeyVersion int32
+	RootKey    []byte
+}
+
+func (q *Queries) ListSecretsToRewrap(ctx context.Context, keyVersion int32) ([]ListSecretsToRewrapRow, error) {
+	rows, err := q.db.QueryContext(ctx, listSecretsToRewrap, keyVersion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListSecretsToRewrapRow
+	for rows.Next() {
+		var i ListSecretsToRewrapRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Hash,
+			&i.Secret,
+			&i.KeyVersion,
+			&i.RootKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnsettledSecrets = `-- name: ListUnsettledSecrets :many
+SELECT hash, payment_hash
+FROM secrets
+WHERE NOT settled AND invoice_expires_at < $1
+`
+
+type ListUnsettledSecretsRow struct {
+	Hash        []byte
+	PaymentHash []byte
+}
+
+func (q *Queries) ListUnsettledSecrets(ctx context.Context, cutoff sql.NullTime) ([]ListUnsettledSecretsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUnsettledSecrets, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUnsettledSecretsRow
+	for rows.Next() {
+		var i ListUnsettledSecretsRow
+		if err := rows.Scan(&i.Hash, &i.PaymentHash); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setSecretExpiry = `-- name: SetSecretExpiry :execrows
+UPDATE secrets
+SET payment_hash = $2, invoice_expires_at = $3, valid_until = $4
+WHERE hash = $1
+`
+
+type SetSecretExpiryParams struct {
+	Hash             []byte
+	PaymentHash      []byte
+	InvoiceExpiresAt sql.NullTime
+	ValidUntil       sql.NullTime
+}
+
+func (q *Queries) SetSecretExpiry(ctx context.Context, arg SetSecretExpiryParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setSecretExpiry,
+		arg.Hash,
+		arg.PaymentHash,
+		arg.InvoiceExpiresAt,
+		arg.ValidUntil,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const settleSecret = `-- name: SettleSecret :execrows
+UPDATE secrets
+SET settled = TRUE
+WHERE hash = $1 AND NOT settled
+`
+
+func (q *Queries) SettleSecret(ctx context.Context, hash []byte) (int64, error) {
+	result, err := q.db.ExecContext(ctx, settleSecret, hash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateSecretKey = `-- name: UpdateSecretKey :exec
+UPDATE secrets
+SET secret = $2, key_version = $3
+WHERE id = $1
+`
+
+type UpdateSecretKeyParams struct {
+	ID         int32
+	Secret     []byte
+	KeyVersion int32
+}
+
+func (q *Queries) UpdateSecretKey(ctx context.Context, arg UpdateSecretKeyParams) error {
+	_, err := q.db.ExecContext(ctx, updateSecretKey, arg.ID, arg.Secret, arg.KeyVersion)
+	return err
+}
@@ -0,0 +1,301 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+type (
+	// NewIssuedToken is a struct that contains the parameters required to
+	// insert a newly issued token into the database.
+	NewIssuedToken = sqlc.InsertIssuedTokenParams
+
+	// NewIssuedTokenService is a struct that contains the parameters
+	// required to insert a service of an issued token into the database.
+	NewIssuedTokenService = sqlc.InsertIssuedTokenServiceParams
+
+	// SettleIssuedTokenParams is a struct that contains the parameters
+	// required to mark an issued token as settled.
+	SettleIssuedTokenParams = sqlc.SettleIssuedTokenParams
+
+	// ListIssuedTokensParams is a struct that contains the parameters
+	// required to list issued tokens.
+	ListIssuedTokensParams = sqlc.ListIssuedTokensParams
+)
+
+// TokensDB is an interface that defines the set of operations that can be
+// executed against the issued tokens database.
+type TokensDB interface {
+	// InsertIssuedToken inserts a newly issued token into the database and
+	// returns its primary key.
+	InsertIssuedToken(ctx context.Context, arg NewIssuedToken) (int32,
+		error)
+
+	// InsertIssuedTokenService inserts a service of an issued token into
+	// the database.
+	InsertIssuedTokenService(ctx context.Context,
+		arg NewIssuedTokenService) error
+
+	// SettleIssuedToken marks the issued token as settled unless it
+	// already is.
+	SettleIssuedToken(ctx context.Context,
+		arg SettleIssuedTokenParams) (int64, error)
+
+	// GetIssuedToken returns the issued token with the given token ID.
+	GetIssuedToken(ctx context.Context, tokenID []byte) (sqlc.IssuedToken,
+		error)
+
+	// ListIssuedTokens returns the issued tokens that match the given
+	// params in the order they were issued.
+	ListIssuedTokens(ctx context.Context,
+		arg ListIssuedTokensParams) ([]sqlc.IssuedToken, error)
+
+	// ListIssuedTokenServices returns the services of the issued token
+	// with the given primary key.
+	ListIssuedTokenServices(ctx context.Context,
+		issuedTokenID int32) ([]sqlc.IssuedTokenService, error)
+}
+
+// TokensDBTxOptions defines the set of db txn options the TokenStore
+// understands.
+type TokensDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *TokensDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedTokensDB is a version of the TokensDB that's capable of batched
+// database operations.
+type BatchedTokensDB interface {
+	TokensDB
+
+	BatchedTx[TokensDB]
+}
+
+// TokenStore represents a storage backend for the inventory of issued L402s.
+type TokenStore struct {
+	db BatchedTokensDB
+}
+
+// A compile-time constraint to ensure TokenStore implements mint.TokenStore.
+var _ mint.TokenStore = (*TokenStore)(nil)
+
+// NewTokenStore creates a new TokenStore instance given a open BatchedTokensDB
+// storage backend.
+func NewTokenStore(db BatchedTokensDB) *TokenStore {
+	return &TokenStore{
+		db: db,
+	}
+}
+
+// AddToken records a newly issued L402.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (t *TokenStore) AddToken(ctx context.Context, token *mint.Token) error {
+	var writeTxOpts TokensDBTxOptions
+	err := t.db.ExecTx(ctx, &writeTxOpts, func(tx TokensDB) error {
+		id, err := tx.InsertIssuedToken(ctx, NewIssuedToken{
+			TokenID:     token.TokenID[:],
+			PaymentHash: token.PaymentHash[:],
+			Price:       token.Price,
+			CreatedAt:   token.CreatedAt.UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, service := range token.Services {
+			err := tx.InsertIssuedTokenService(
+				ctx, NewIssuedTokenService{
+					IssuedTokenID: id,
+					ServiceName:   service.Name,
+					Tier:          int32(service.Tier),
+					Price:         service.Price,
+				},
+			)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to add token %v: %w", token.TokenID,
+			err)
+	}
+
+	return nil
+}
+
+// SettleToken records the given time as the time the L402 with the given
+// token ID was settled.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (t *TokenStore) SettleToken(ctx context.Context, tokenID l402.TokenID,
+	settledAt time.Time) error {
+
+	var writeTxOpts TokensDBTxOptions
+	err := t.db.ExecTx(ctx, &writeTxOpts, func(tx TokensDB) error {
+		_, err := tx.SettleIssuedToken(ctx, SettleIssuedTokenParams{
+			TokenID: tokenID[:],
+			SettledAt: sql.NullTime{
+				Time:  settledAt.UTC(),
+				Valid: true,
+			},
+		})
+
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to settle token %v: %w", tokenID, err)
+	}
+
+	return nil
+}
+
+// GetToken returns the issued L402 with the given token ID.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (t *TokenStore) GetToken(ctx context.Context,
+	tokenID l402.TokenID) (*mint.Token, error) {
+
+	var (
+		token      *mint.Token
+		readTxOpts = TokensDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TokensDB) error {
+		row, err := tx.GetIssuedToken(ctx, tokenID[:])
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return mint.ErrTokenNotFound
+
+		case err != nil:
+			return err
+		}
+
+		token, err = unmarshalToken(ctx, tx, row)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get token %v: %w", tokenID,
+			err)
+	}
+
+	return token, nil
+}
+
+// ListTokens returns the issued L402s that match the given filter in the order
+// they were issued.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (t *TokenStore) ListTokens(ctx context.Context,
+	filter *mint.TokenFilter) ([]*mint.Token, error) {
+
+	params := ListIssuedTokensParams{
+		NumLimit:  int32(filter.Limit),
+		NumOffset: int32(filter.Offset),
+	}
+	if filter.PaymentHash != (lntypes.Hash{}) {
+		params.PaymentHash = filter.PaymentHash[:]
+	}
+	if !filter.CreatedAfter.IsZero() {
+		params.CreatedAfter = sql.NullTime{
+			Time:  filter.CreatedAfter.UTC(),
+			Valid: true,
+		}
+	}
+	if !filter.CreatedBefore.IsZero() {
+		params.CreatedBefore = sql.NullTime{
+			Time:  filter.CreatedBefore.UTC(),
+			Valid: true,
+		}
+	}
+	if filter.Settled != nil {
+		params.Settled = sql.NullBool{
+			Bool:  *filter.Settled,
+			Valid: true,
+		}
+	}
+	if filter.Service != "" {
+		params.ServiceName = sql.NullString{
+			String: filter.Service,
+			Valid:  true,
+		}
+	}
+
+	var (
+		tokens     []*mint.Token
+		readTxOpts = TokensDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TokensDB) error {
+		rows, err := tx.ListIssuedTokens(ctx, params)
+		if err != nil {
+			return err
+		}
+
+		tokens = make([]*mint.Token, 0, len(rows))
+		for _, row := range rows {
+			token, err := unmarshalToken(ctx, tx, row)
+			if err != nil {
+				return err
+			}
+
+			tokens = append(tokens, token)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// unmarshalToken converts an issued token row, along with its services, into
+// the mint's representation of an issued L402.
+func unmarshalToken(ctx context.Context, tx TokensDB,
+	row sqlc.IssuedToken) (*mint.Token, error) {
+
+	serviceRows, err := tx.ListIssuedTokenServices(ctx, row.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	token := &mint.Token{
+		Price:     row.Price,
+		CreatedAt: row.CreatedAt,
+		Services:  make([]l402.Service, 0, len(serviceRows)),
+	}
+	copy(token.TokenID[:], row.TokenID)
+	copy(token.PaymentHash[:], row.PaymentHash)
+	if row.SettledAt.Valid {
+		token.SettledAt = row.SettledAt.Time
+	}
+
+	for _, serviceRow := range serviceRows {
+		token.Services = append(token.Services, l402.Service{
+			Name:  serviceRow.ServiceName,
+			Tier:  l402.ServiceTier(serviceRow.Tier),
+			Price: serviceRow.Price,
+		})
+	}
+
+	return token, nil
+}
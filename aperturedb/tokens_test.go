@@ -0,0 +1,152 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenStoreWithDB(db *BaseDB) *TokenStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) TokensDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewTokenStore(dbTxer)
+}
+
+func TestTokensDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database.
+	db := NewTestDB(t)
+	store := newTokenStoreWithDB(db.BaseDB)
+
+	_, err := store.GetToken(ctxt, l402.TokenID{1})
+	require.ErrorIs(t, err, mint.ErrTokenNotFound)
+
+	// Issue three tokens, the last one for two services.
+	foo := l402.Service{Name: "foo", Tier: l402.BaseTier, Price: 10}
+	bar := l402.Service{Name: "bar", Tier: 2, Price: 20}
+	tokens := []*mint.Token{{
+		TokenID:     l402.TokenID{1},
+		PaymentHash: lntypes.Hash{1},
+		Services:    []l402.Service{foo},
+		Price:       10,
+		CreatedAt:   time.Unix(1_000, 0),
+	}, {
+		TokenID:     l402.TokenID{2},
+		PaymentHash: lntypes.Hash{2},
+		Services:    []l402.Service{bar},
+		Price:       20,
+		CreatedAt:   time.Unix(2_000, 0),
+	}, {
+		TokenID:     l402.TokenID{3},
+		PaymentHash: lntypes.Hash{3},
+		Services:    []l402.Service{foo, bar},
+		Price:       20,
+		CreatedAt:   time.Unix(3_000, 0),
+	}}
+	for _, token := range tokens {
+		require.NoError(t, store.AddToken(ctxt, token))
+	}
+
+	// Token IDs are unique.
+	require.Error(t, store.AddToken(ctxt, tokens[0]))
+
+	token, err := store.GetToken(ctxt, l402.TokenID{3})
+	require.NoError(t, err)
+	require.Equal(t, tokens[2].PaymentHash, token.PaymentHash)
+	require.Equal(t, tokens[2].Services, token.Services)
+	require.EqualValues(t, 20, token.Price)
+	require.Equal(t, int64(3_000), token.CreatedAt.Unix())
+	require.True(t, token.SettledAt.IsZero())
+
+	// Only the first settlement of a token is recorded.
+	require.NoError(t, store.SettleToken(
+		ctxt, l402.TokenID{2}, time.Unix(2_500, 0),
+	))
+	require.NoError(t, store.SettleToken(
+		ctxt, l402.TokenID{2}, time.Unix(2_600, 0),
+	))
+	require.NoError(t, store.SettleToken(
+		ctxt, l402.TokenID{7}, time.Unix(2_600, 0),
+	))
+
+	token, err = store.GetToken(ctxt, l402.TokenID{2})
+	require.NoError(t, err)
+	require.Equal(t, int64(2_500), token.SettledAt.Unix())
+
+	settled, unsettled := true, false
+	testCases := []struct {
+		name     string
+		filter   mint.TokenFilter
+		expected []l402.TokenID
+	}{{
+		name:     "all",
+		filter:   mint.TokenFilter{Limit: 10},
+		expected: []l402.TokenID{{1}, {2}, {3}},
+	}, {
+		name:     "limit and offset",
+		filter:   mint.TokenFilter{Offset: 1, Limit: 1},
+		expected: []l402.TokenID{{2}},
+	}, {
+		name:     "service",
+		filter:   mint.TokenFilter{Service: "foo", Limit: 10},
+		expected: []l402.TokenID{{1}, {3}},
+	}, {
+		name: "payment hash",
+		filter: mint.TokenFilter{
+			PaymentHash: lntypes.Hash{3},
+			Limit:       10,
+		},
+		expected: []l402.TokenID{{3}},
+	}, {
+		name:     "settled",
+		filter:   mint.TokenFilter{Settled: &settled, Limit: 10},
+		expected: []l402.TokenID{{2}},
+	}, {
+		name:     "unsettled",
+		filter:   mint.TokenFilter{Settled: &unsettled, Limit: 10},
+		expected: []l402.TokenID{{1}, {3}},
+	}, {
+		name: "created between",
+		filter: mint.TokenFilter{
+			CreatedAfter:  time.Unix(2_000, 0),
+			CreatedBefore: time.Unix(3_000, 0),
+			Limit:         10,
+		},
+		expected: []l402.TokenID{{2}},
+	}, {
+		name: "no match",
+		filter: mint.TokenFilter{
+			Service:       "bar",
+			Settled:       &unsettled,
+			Limit:         10,
+			CreatedBefore: time.Unix(3_000, 0),
+		},
+		expected: []l402.TokenID{},
+	}}
+	for _, tc := range testCases {
+		tokens, err := store.ListTokens(ctxt, &tc.filter)
+		require.NoError(t, err, tc.name)
+
+		tokenIDs := make([]l402.TokenID, 0, len(tokens))
+		for _, token := range tokens {
+			tokenIDs = append(tokenIDs, token.TokenID)
+		}
+		require.Equal(t, tc.expected, tokenIDs, tc.name)
+	}
+}
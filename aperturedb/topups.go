@@ -0,0 +1,400 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/clock"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+type (
+	// NewTopUp is a struct that contains the parameters required to
+	// insert a new top-up into the database.
+	NewTopUp = sqlc.InsertTokenTopUpParams
+
+	// SettleTopUpParams is a struct that contains the parameters required
+	// to settle a top-up.
+	SettleTopUpParams = sqlc.SettleTokenTopUpParams
+
+	// LatestTopUpParams is a struct that contains the parameters required
+	// to look up the latest settled top-up of an L402 for a service.
+	LatestTopUpParams = sqlc.GetLatestTokenTopUpParams
+
+	// PendingTopUpParams is a struct that contains the parameters required
+	// to look up an unsettled top-up of an L402 for a service.
+	PendingTopUpParams = sqlc.GetPendingTokenTopUpParams
+
+	// AddUsageParams is a struct that contains the parameters required to
+	// add to the number of requests made and satoshis spent with an L402.
+	AddUsageParams = sqlc.AddTokenUsageParams
+)
+
+// TopUpsDB is an interface that defines the set of operations that can be
+// executed against the top-ups database.
+type TopUpsDB interface {
+	// InsertTokenTopUp inserts a new pending top-up into the database.
+	InsertTokenTopUp(ctx context.Context, arg NewTopUp) error
+
+	// GetTokenTopUp returns the top-up that is paid for with the invoice
+	// of the given payment hash.
+	GetTokenTopUp(ctx context.Context,
+		paymentHash []byte) (sqlc.TokenTopup, error)
+
+	// SettleTokenTopUp marks a pending top-up as settled and returns the
+	// number of affected rows.
+	SettleTokenTopUp(ctx context.Context,
+		arg SettleTopUpParams) (int64, error)
+
+	// GetLatestTokenTopUp returns the settled top-up of an L402 for a
+	// service that extends its validity the furthest.
+	GetLatestTokenTopUp(ctx context.Context,
+		arg LatestTopUpParams) (sqlc.TokenTopup, error)
+
+	// GetPendingTokenTopUp returns the unsettled top-up of an L402 for a
+	// service whose invoice expires the latest, if it expires after the
+	// given time.
+	GetPendingTokenTopUp(ctx context.Context,
+		arg PendingTopUpParams) (sqlc.TokenTopup, error)
+
+	// ListExpiredTokenTopUps returns the payment hashes of the unsettled
+	// top-ups whose invoices expired before the given time.
+	ListExpiredTokenTopUps(ctx context.Context,
+		cutoff sql.NullTime) ([][]byte, error)
+
+	// DeleteUnsettledTokenTopUp removes the top-up that is paid for with
+	// the invoice of the given payment hash unless it was settled.
+	DeleteUnsettledTokenTopUp(ctx context.Context,
+		paymentHash []byte) error
+
+	// AddTokenUsage adds to the number of requests made and satoshis
+	// spent with an L402 for a service. Negative numbers credit requests
+	// and satoshis to the L402.
+	AddTokenUsage(ctx context.Context, arg AddUsageParams) error
+}
+
+// TopUpsDBTxOptions defines the set of db txn options the TopUpStore
+// understands.
+type TopUpsDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *TopUpsDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedTopUpsDB is a version of the TopUpsDB that's capable of batched
+// database operations.
+type BatchedTopUpsDB interface {
+	TopUpsDB
+
+	BatchedTx[TopUpsDB]
+}
+
+// TopUpStore represents a storage backend for the top-ups of L402s. The
+// additional requests and balance of settled top-ups are credited to the usage
+// that is tracked by the UsageStore of the same database.
+type TopUpStore struct {
+	db    BatchedTopUpsDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure TopUpStore implements mint.TopUpStore.
+var _ mint.TopUpStore = (*TopUpStore)(nil)
+
+// NewTopUpStore creates a new TopUpStore instance given a open BatchedTopUpsDB
+// storage backend.
+func NewTopUpStore(db BatchedTopUpsDB) *TopUpStore {
+	return &TopUpStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// AddTopUp records a new pending top-up.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) AddTopUp(ctx context.Context, topUp *mint.TopUp) error {
+	var writeTxOpts TopUpsDBTxOptions
+	err := t.db.ExecTx(ctx, &writeTxOpts, func(tx TopUpsDB) error {
+		return tx.InsertTokenTopUp(ctx, NewTopUp{
+			PaymentHash:     topUp.PaymentHash[:],
+			TokenID:         topUp.TokenID[:],
+			ServiceName:     topUp.Service,
+			Requests:        topUp.Requests,
+			Balance:         topUp.Balance,
+			ValiditySeconds: int64(topUp.Validity / time.Second),
+			CreatedAt:       t.clock.Now().UTC(),
+			PaymentRequest:  topUp.PaymentRequest,
+			InvoiceExpiresAt: sql.NullTime{
+				Time:  topUp.InvoiceExpiry.UTC(),
+				Valid: !topUp.InvoiceExpiry.IsZero(),
+			},
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to insert top-up: %w", err)
+	}
+
+	return nil
+}
+
+// GetTopUp returns the top-up that is paid for with the invoice of the given
+// payment hash.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) GetTopUp(ctx context.Context,
+	hash lntypes.Hash) (*mint.TopUp, error) {
+
+	var (
+		topUp      *mint.TopUp
+		readTxOpts = TopUpsDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TopUpsDB) error {
+		row, err := tx.GetTokenTopUp(ctx, hash[:])
+		if err != nil {
+			return err
+		}
+
+		topUp, err = unmarshalTopUp(row)
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, mint.ErrTopUpNotFound
+
+	case err != nil:
+		return nil, fmt.Errorf("unable to get top-up: %w", err)
+	}
+
+	return topUp, nil
+}
+
+// SettleTopUp marks the top-up that is paid for with the invoice of the given
+// payment hash as settled. Its additional requests and balance are credited to
+// the usage of its L402 in the same transaction.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) SettleTopUp(ctx context.Context, hash lntypes.Hash,
+	validUntil time.Time) error {
+
+	var writeTxOpts TopUpsDBTxOptions
+	err := t.db.ExecTx(ctx, &writeTxOpts, func(tx TopUpsDB) error {
+		row, err := tx.GetTokenTopUp(ctx, hash[:])
+		if err != nil {
+			return err
+		}
+
+		// The top-up is only settled if it wasn't settled before.
+		nrRows, err := tx.SettleTokenTopUp(ctx, SettleTopUpParams{
+			PaymentHash: hash[:],
+			ValidUntil: sql.NullTime{
+				Time:  validUntil.UTC(),
+				Valid: !validUntil.IsZero(),
+			},
+		})
+		switch {
+		case err != nil:
+			return err
+
+		case nrRows == 0:
+			return mint.ErrTopUpSettled
+
+		case row.Requests == 0 && row.Balance == 0:
+			return nil
+		}
+
+		return tx.AddTokenUsage(ctx, AddUsageParams{
+			TokenID:     row.TokenID,
+			ServiceName: row.ServiceName,
+			Used:        -row.Requests,
+			Spent:       -row.Balance,
+			UpdatedAt:   t.clock.Now().UTC(),
+		})
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return mint.ErrTopUpNotFound
+
+	case errors.Is(err, mint.ErrTopUpSettled):
+		return err
+
+	case err != nil:
+		return fmt.Errorf("unable to settle top-up: %w", err)
+	}
+
+	return nil
+}
+
+// ValidUntil returns the time until which the settled top-ups of the L402 with
+// the given token ID extend its validity for a service.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) ValidUntil(ctx context.Context, tokenID l402.TokenID,
+	service string) (time.Time, error) {
+
+	var (
+		validUntil time.Time
+		readTxOpts = TopUpsDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TopUpsDB) error {
+		row, err := tx.GetLatestTokenTopUp(ctx, LatestTopUpParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+		})
+		switch {
+		// If no top-up extends the validity, the zero time is
+		// returned.
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+
+		case err != nil:
+			return err
+		}
+
+		validUntil = row.ValidUntil.Time
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to get top-up "+
+			"validity: %w", err)
+	}
+
+	return validUntil, nil
+}
+
+// PendingTopUp returns a top-up of the L402 with the given token ID for a
+// service that isn't settled and whose invoice expires after the given time.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) PendingTopUp(ctx context.Context, tokenID l402.TokenID,
+	service string, after time.Time) (*mint.TopUp, error) {
+
+	var (
+		topUp      *mint.TopUp
+		readTxOpts = TopUpsDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TopUpsDB) error {
+		row, err := tx.GetPendingTokenTopUp(ctx, PendingTopUpParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+			InvoiceExpiresAt: sql.NullTime{
+				Time:  after.UTC(),
+				Valid: true,
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		topUp, err = unmarshalTopUp(row)
+		return err
+	})
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return nil, mint.ErrTopUpNotFound
+
+	case err != nil:
+		return nil, fmt.Errorf("unable to get pending top-up: %w", err)
+	}
+
+	return topUp, nil
+}
+
+// ExpiredTopUps returns the payment hashes of the top-ups that aren't settled
+// and whose invoices expired before the given time.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) ExpiredTopUps(ctx context.Context,
+	before time.Time) ([]lntypes.Hash, error) {
+
+	var (
+		expired    []lntypes.Hash
+		readTxOpts = TopUpsDBTxOptions{readOnly: true}
+	)
+	err := t.db.ExecTx(ctx, &readTxOpts, func(tx TopUpsDB) error {
+		rows, err := tx.ListExpiredTokenTopUps(ctx, sql.NullTime{
+			Time:  before.UTC(),
+			Valid: true,
+		})
+		if err != nil {
+			return err
+		}
+
+		expired = make([]lntypes.Hash, 0, len(rows))
+		for _, row := range rows {
+			hash, err := lntypes.MakeHash(row)
+			if err != nil {
+				return err
+			}
+			expired = append(expired, hash)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to list expired top-ups: %w",
+			err)
+	}
+
+	return expired, nil
+}
+
+// RemoveTopUp removes the top-up that is paid for with the invoice of the
+// given payment hash unless it was settled.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (t *TopUpStore) RemoveTopUp(ctx context.Context,
+	hash lntypes.Hash) error {
+
+	var writeTxOpts TopUpsDBTxOptions
+	err := t.db.ExecTx(ctx, &writeTxOpts, func(tx TopUpsDB) error {
+		return tx.DeleteUnsettledTokenTopUp(ctx, hash[:])
+	})
+	if err != nil {
+		return fmt.Errorf("unable to remove top-up: %w", err)
+	}
+
+	return nil
+}
+
+// unmarshalTopUp converts a top-up row of the database into a mint.TopUp.
+func unmarshalTopUp(row sqlc.TokenTopup) (*mint.TopUp, error) {
+	hash, err := lntypes.MakeHash(row.PaymentHash)
+	if err != nil {
+		return nil, err
+	}
+
+	var tokenID l402.TokenID
+	if len(row.TokenID) != l402.TokenIDSize {
+		return nil, fmt.Errorf("invalid token ID length %d",
+			len(row.TokenID))
+	}
+	copy(tokenID[:], row.TokenID)
+
+	return &mint.TopUp{
+		TopUpGrant: mint.TopUpGrant{
+			Requests: row.Requests,
+			Balance:  row.Balance,
+			Validity: time.Duration(row.ValiditySeconds) *
+				time.Second,
+		},
+		TokenID:        tokenID,
+		Service:        row.ServiceName,
+		PaymentHash:    hash,
+		PaymentRequest: row.PaymentRequest,
+		InvoiceExpiry:  row.InvoiceExpiresAt.Time,
+		Settled:        row.Settled,
+		ValidUntil:     row.ValidUntil.Time,
+	}, nil
+}
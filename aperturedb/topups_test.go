@@ -0,0 +1,149 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+func newTopUpStoreWithDB(db *BaseDB) *TopUpStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) TopUpsDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewTopUpStore(dbTxer)
+}
+
+func TestTopUpsDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database with a top-up store and a usage
+	// store that share it.
+	db := NewTestDB(t)
+	store := newTopUpStoreWithDB(db.BaseDB)
+	usageStore := newUsageStoreWithDB(db.BaseDB)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	topUp := &mint.TopUp{
+		TopUpGrant: mint.TopUpGrant{
+			Requests: 2,
+			Balance:  10,
+			Validity: time.Hour,
+		},
+		TokenID:        tokenID,
+		Service:        "service",
+		PaymentHash:    lntypes.Hash{4, 5, 6},
+		PaymentRequest: "lnbc1topup",
+		InvoiceExpiry:  time.Unix(1000, 0).UTC(),
+	}
+	require.NoError(t, store.AddTopUp(ctxt, topUp))
+
+	_, err := store.GetTopUp(ctxt, lntypes.Hash{7})
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	pending, err := store.GetTopUp(ctxt, topUp.PaymentHash)
+	require.NoError(t, err)
+	require.Equal(t, topUp, pending)
+
+	// The top-up is pending until its invoice expires.
+	pending, err = store.PendingTopUp(
+		ctxt, tokenID, "service", time.Unix(999, 0),
+	)
+	require.NoError(t, err)
+	require.Equal(t, topUp, pending)
+
+	_, err = store.PendingTopUp(
+		ctxt, tokenID, "service", time.Unix(1000, 0),
+	)
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	_, err = store.PendingTopUp(ctxt, tokenID, "other", time.Unix(999, 0))
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	expired, err := store.ExpiredTopUps(ctxt, time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	expired, err = store.ExpiredTopUps(ctxt, time.Unix(1001, 0))
+	require.NoError(t, err)
+	require.Equal(t, []lntypes.Hash{topUp.PaymentHash}, expired)
+
+	// Use up the only request of the token.
+	_, err = usageStore.TakeUsage(ctxt, tokenID, "service", 1)
+	require.NoError(t, err)
+	_, err = usageStore.TakeUsage(ctxt, tokenID, "service", 1)
+	require.ErrorIs(t, err, proxy.ErrUsageExhausted)
+
+	// Spend the whole balance of the token as well.
+	_, err = usageStore.SpendBalance(ctxt, tokenID, "service", 10, 10)
+	require.NoError(t, err)
+	_, err = usageStore.SpendBalance(ctxt, tokenID, "service", 10, 10)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+
+	// Settling the top-up credits its requests and balance to the token
+	// and extends its validity.
+	validUntil := time.Unix(10_000, 0)
+	err = store.SettleTopUp(ctxt, topUp.PaymentHash, validUntil)
+	require.NoError(t, err)
+
+	remaining, err := usageStore.TakeUsage(ctxt, tokenID, "service", 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	remaining, err = usageStore.SpendBalance(
+		ctxt, tokenID, "service", 10, 10,
+	)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	settled, err := store.GetTopUp(ctxt, topUp.PaymentHash)
+	require.NoError(t, err)
+	require.True(t, settled.Settled)
+
+	extended, err := store.ValidUntil(ctxt, tokenID, "service")
+	require.NoError(t, err)
+	require.Equal(t, validUntil.Unix(), extended.Unix())
+
+	// A top-up can only be settled once.
+	err = store.SettleTopUp(ctxt, topUp.PaymentHash, validUntil)
+	require.ErrorIs(t, err, mint.ErrTopUpSettled)
+
+	err = store.SettleTopUp(ctxt, lntypes.Hash{7}, validUntil)
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	// The validity of other services isn't extended.
+	extended, err = store.ValidUntil(ctxt, tokenID, "other")
+	require.NoError(t, err)
+	require.True(t, extended.IsZero())
+
+	// Settled top-ups are neither reported as expired nor removed.
+	expired, err = store.ExpiredTopUps(ctxt, time.Unix(1001, 0))
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	require.NoError(t, store.RemoveTopUp(ctxt, topUp.PaymentHash))
+	_, err = store.GetTopUp(ctxt, topUp.PaymentHash)
+	require.NoError(t, err)
+
+	// Unsettled top-ups are removed.
+	unpaid := *topUp
+	unpaid.PaymentHash = lntypes.Hash{8}
+	require.NoError(t, store.AddTopUp(ctxt, &unpaid))
+	require.NoError(t, store.RemoveTopUp(ctxt, unpaid.PaymentHash))
+	_, err = store.GetTopUp(ctxt, unpaid.PaymentHash)
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+}
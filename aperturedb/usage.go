@@ -0,0 +1,231 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lightninglabs/aperture/aperturedb/sqlc"
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/clock"
+)
+
+type (
+	// TokenUsageParams is a struct that contains the parameters required
+	// to count a request made with an L402.
+	TokenUsageParams = sqlc.IncrementTokenUsageParams
+
+	// GetTokenUsageParams is a struct that contains the parameters
+	// required to look up the number of requests made with an L402.
+	GetTokenUsageParams = sqlc.GetTokenUsageParams
+
+	// SpendBalanceParams is a struct that contains the parameters required
+	// to spend the price of a request from the balance of an L402.
+	SpendBalanceParams = sqlc.SpendTokenBalanceParams
+
+	// InsertUsageParams is a struct that contains the parameters required
+	// to start tracking the usage of an L402.
+	InsertUsageParams = sqlc.InsertTokenUsageParams
+)
+
+// UsageDB is an interface that defines the set of operations that can be
+// executed against the token usage database.
+type UsageDB interface {
+	// GetTokenUsage returns the number of requests made with an L402 to a
+	// service.
+	GetTokenUsage(ctx context.Context,
+		arg GetTokenUsageParams) (sqlc.TokenUsage, error)
+
+	// IncrementTokenUsage counts a request made with an L402 to a service
+	// if the maximum number of requests isn't reached yet and returns the
+	// new number of requests. If the maximum is reached, sql.ErrNoRows is
+	// returned.
+	IncrementTokenUsage(ctx context.Context,
+		arg TokenUsageParams) (int64, error)
+
+	// InsertTokenUsage starts tracking the usage of an L402 for a service
+	// unless it is already tracked.
+	InsertTokenUsage(ctx context.Context, arg InsertUsageParams) error
+
+	// AddTokenUsage adds to the number of requests made and satoshis
+	// spent with an L402 for a service.
+	AddTokenUsage(ctx context.Context, arg AddUsageParams) error
+
+	// SpendTokenBalance spends the price of a request made with an L402 to
+	// a service if the balance covers it and returns the new number of
+	// satoshis spent. The satoshis spent can be negative if the L402 was
+	// topped up. If the balance doesn't cover the price or the usage of
+	// the L402 isn't tracked yet, sql.ErrNoRows is returned.
+	SpendTokenBalance(ctx context.Context,
+		arg SpendBalanceParams) (int64, error)
+}
+
+// UsageDBTxOptions defines the set of db txn options the UsageStore
+// understands.
+type UsageDBTxOptions struct {
+	// readOnly governs if a read only transaction is needed or not.
+	readOnly bool
+}
+
+// ReadOnly returns true if the transaction should be read only.
+//
+// NOTE: This implements the TxOptions
+func (a *UsageDBTxOptions) ReadOnly() bool {
+	return a.readOnly
+}
+
+// BatchedUsageDB is a version of the UsageDB that's capable of batched
+// database operations.
+type BatchedUsageDB interface {
+	UsageDB
+
+	BatchedTx[UsageDB]
+}
+
+// UsageStore represents a storage backend for the number of requests made
+// with L402s that are only valid for a limited number of requests and for the
+// satoshis spent by L402s that are funded with a balance.
+type UsageStore struct {
+	db    BatchedUsageDB
+	clock clock.Clock
+}
+
+// A compile-time constraint to ensure UsageStore implements proxy.UsageStore.
+var _ proxy.UsageStore = (*UsageStore)(nil)
+
+// NewUsageStore creates a new UsageStore instance given a open BatchedUsageDB
+// storage backend.
+func NewUsageStore(db BatchedUsageDB) *UsageStore {
+	return &UsageStore{
+		db:    db,
+		clock: clock.NewDefaultClock(),
+	}
+}
+
+// TakeUsage records a request that is made with the L402 of the given token ID
+// to the given service, unless the maximum number of requests was already
+// reached.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (u *UsageStore) TakeUsage(ctx context.Context, tokenID l402.TokenID,
+	service string, maxRequests int64) (int64, error) {
+
+	if maxRequests <= 0 {
+		return 0, proxy.ErrUsageExhausted
+	}
+
+	var (
+		used        int64
+		writeTxOpts UsageDBTxOptions
+	)
+	err := u.db.ExecTx(ctx, &writeTxOpts, func(tx UsageDB) error {
+		var err error
+		used, err = tx.IncrementTokenUsage(ctx, TokenUsageParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+			Now:         u.clock.Now().UTC(),
+			MaxRequests: maxRequests,
+		})
+
+		return err
+	})
+	switch {
+	// The row is only updated if the maximum number of requests isn't
+	// reached yet.
+	case errors.Is(err, sql.ErrNoRows):
+		return 0, proxy.ErrUsageExhausted
+
+	case err != nil:
+		return 0, fmt.Errorf("unable to count token usage: %w", err)
+	}
+
+	return maxRequests - used, nil
+}
+
+// ReturnUsage gives back a request that was recorded by TakeUsage for the L402
+// of the given token ID to the given service but wasn't served.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (u *UsageStore) ReturnUsage(ctx context.Context, tokenID l402.TokenID,
+	service string) error {
+
+	var writeTxOpts UsageDBTxOptions
+	err := u.db.ExecTx(ctx, &writeTxOpts, func(tx UsageDB) error {
+		return tx.AddTokenUsage(ctx, AddUsageParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+			Used:        -1,
+			UpdatedAt:   u.clock.Now().UTC(),
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("unable to return token usage: %w", err)
+	}
+
+	return nil
+}
+
+// SpendBalance deducts the price of a request that is made with the L402 of
+// the given token ID to the given service from its balance, unless the
+// remaining balance doesn't cover it.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (u *UsageStore) SpendBalance(ctx context.Context, tokenID l402.TokenID,
+	service string, price, balance int64) (int64, error) {
+
+	var (
+		spent       int64
+		writeTxOpts UsageDBTxOptions
+	)
+	err := u.db.ExecTx(ctx, &writeTxOpts, func(tx UsageDB) error {
+		now := u.clock.Now().UTC()
+
+		// The balance is only checked when the spent amount of an
+		// existing row is updated, so we make sure there is one.
+		err := tx.InsertTokenUsage(ctx, InsertUsageParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+			UpdatedAt:   now,
+		})
+		if err != nil {
+			return err
+		}
+
+		// The price is only spent if the balance, including any
+		// top-ups, covers it.
+		spent, err = tx.SpendTokenBalance(ctx, SpendBalanceParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+			Price:       price,
+			Now:         now,
+			Balance:     balance,
+		})
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		// The balance doesn't cover the price, so we look up how much
+		// of it remains.
+		row, err := tx.GetTokenUsage(ctx, GetTokenUsageParams{
+			TokenID:     tokenID[:],
+			ServiceName: service,
+		})
+		if err != nil {
+			return err
+		}
+		spent = row.Spent
+
+		return proxy.ErrInsufficientBalance
+	})
+	switch {
+	case errors.Is(err, proxy.ErrInsufficientBalance):
+		return balance - spent, err
+
+	case err != nil:
+		return 0, fmt.Errorf("unable to spend token balance: %w", err)
+	}
+
+	return balance - spent, nil
+}
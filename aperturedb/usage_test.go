@@ -0,0 +1,162 @@
+package aperturedb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+func newUsageStoreWithDB(db *BaseDB) *UsageStore {
+	dbTxer := NewTransactionExecutor(db,
+		func(tx *sql.Tx) UsageDB {
+			return db.WithTx(tx)
+		},
+	)
+
+	return NewUsageStore(dbTxer)
+}
+
+func TestUsageDB(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database. We use two stores on top of it to
+	// simulate two aperture instances that share the database.
+	db := NewTestDB(t)
+	store1 := newUsageStoreWithDB(db.BaseDB)
+	store2 := newUsageStoreWithDB(db.BaseDB)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	otherTokenID := l402.TokenID{4, 5, 6}
+
+	// The token can be used for two requests, one through each instance.
+	remaining, err := store1.TakeUsage(ctxt, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	remaining, err = store2.TakeUsage(ctxt, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	_, err = store1.TakeUsage(ctxt, tokenID, "service", 2)
+	require.ErrorIs(t, err, proxy.ErrUsageExhausted)
+
+	// Exhausted requests aren't counted.
+	usage, err := db.GetTokenUsage(ctxt, GetTokenUsageParams{
+		TokenID:     tokenID[:],
+		ServiceName: "service",
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 2, usage.Used)
+
+	// A request that is given back can be made again.
+	require.NoError(t, store2.ReturnUsage(ctxt, tokenID, "service"))
+
+	remaining, err = store1.TakeUsage(ctxt, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	// The usage is tracked separately for each token and service.
+	remaining, err = store1.TakeUsage(ctxt, tokenID, "other", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	remaining, err = store1.TakeUsage(ctxt, otherTokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	// If the limit is lowered by another caveat, the token is exhausted
+	// earlier.
+	_, err = store2.TakeUsage(ctxt, otherTokenID, "service", 1)
+	require.ErrorIs(t, err, proxy.ErrUsageExhausted)
+}
+
+func TestUsageDBBalance(t *testing.T) {
+	t.Parallel()
+
+	ctxt, cancel := context.WithTimeout(
+		context.Background(), defaultTestTimeout,
+	)
+	defer cancel()
+
+	// First, create a new test database. We use two stores on top of it to
+	// simulate two aperture instances that share the database.
+	db := NewTestDB(t)
+	store1 := newUsageStoreWithDB(db.BaseDB)
+	store2 := newUsageStoreWithDB(db.BaseDB)
+
+	tokenID := l402.TokenID{1, 2, 3}
+
+	// A price that exceeds the whole balance is never spent.
+	remaining, err := store1.SpendBalance(ctxt, tokenID, "service", 30, 25)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+	require.EqualValues(t, 25, remaining)
+
+	// The balance is spent through both instances.
+	remaining, err = store1.SpendBalance(ctxt, tokenID, "service", 10, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, remaining)
+
+	remaining, err = store2.SpendBalance(ctxt, tokenID, "service", 10, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, remaining)
+
+	// Once the balance doesn't cover the price anymore, nothing is spent.
+	remaining, err = store1.SpendBalance(ctxt, tokenID, "service", 10, 25)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+	require.EqualValues(t, 5, remaining)
+
+	remaining, err = store2.SpendBalance(ctxt, tokenID, "service", 5, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	// Spending the balance doesn't count any requests.
+	usage, err := db.GetTokenUsage(ctxt, GetTokenUsageParams{
+		TokenID:     tokenID[:],
+		ServiceName: "service",
+	})
+	require.NoError(t, err)
+	require.EqualValues(t, 0, usage.Used)
+	require.EqualValues(t, 25, usage.Spent)
+
+	// A top-up of a token that didn't spend anything yet credits the
+	// balance, so prices above the balance of its caveat can be spent.
+	toppedUp := l402.TokenID{4, 5, 6}
+	err = db.AddTokenUsage(ctxt, AddUsageParams{
+		TokenID:     toppedUp[:],
+		ServiceName: "service",
+		Spent:       -50,
+		UpdatedAt:   time.Now(),
+	})
+	require.NoError(t, err)
+
+	remaining, err = store1.SpendBalance(ctxt, toppedUp, "service", 60, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, remaining)
+
+	remaining, err = store2.SpendBalance(ctxt, toppedUp, "service", 20, 25)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+	require.EqualValues(t, 15, remaining)
+
+	// Topping up a token that spent its balance works the same.
+	err = db.AddTokenUsage(ctxt, AddUsageParams{
+		TokenID:     tokenID[:],
+		ServiceName: "service",
+		Spent:       -40,
+		UpdatedAt:   time.Now(),
+	})
+	require.NoError(t, err)
+
+	remaining, err = store2.SpendBalance(ctxt, tokenID, "service", 40, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+}
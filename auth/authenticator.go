@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/mint"
 	"github.com/lightningnetwork/lnd/lnrpc"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"gopkg.in/macaroon.v2"
 )
 
 // L402Authenticator is an authenticator that uses the L402 protocol to
@@ -16,32 +19,53 @@ import (
 type L402Authenticator struct {
 	minter  Minter
 	checker InvoiceChecker
+
+	// cache is the optional cache of L402s that were verified before.
+	cache *VerificationCache
 }
 
 // A compile time flag to ensure the L402Authenticator satisfies the
 // Authenticator interface.
 var _ Authenticator = (*L402Authenticator)(nil)
 
+// L402AuthenticatorOption is a functional option for configuring an
+// L402Authenticator.
+type L402AuthenticatorOption func(*L402Authenticator)
+
+// WithVerificationCache sets the cache of verified L402s. L402s found in the
+// cache only have their caveats verified.
+func WithVerificationCache(cache *VerificationCache) L402AuthenticatorOption {
+	return func(l *L402Authenticator) {
+		l.cache = cache
+	}
+}
+
 // NewL402Authenticator creates a new authenticator that authenticates requests
 // based on L402 tokens.
-func NewL402Authenticator(minter Minter,
-	checker InvoiceChecker) *L402Authenticator {
+func NewL402Authenticator(minter Minter, checker InvoiceChecker,
+	opts ...L402AuthenticatorOption) *L402Authenticator {
 
-	return &L402Authenticator{
+	l := &L402Authenticator{
 		minter:  minter,
 		checker: checker,
 	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+
+	return l
 }
 
-// Accept returns whether or not the header successfully authenticates the user
-// to a given backend service.
+// Accept returns whether or not the headers of the request successfully
+// authenticate the user to a given backend service.
 //
 // NOTE: This is part of the Authenticator interface.
-func (l *L402Authenticator) Accept(header *http.Header, serviceName string) bool {
+func (l *L402Authenticator) Accept(r *http.Request, serviceName string) bool {
 	// Try reading the macaroon and preimage from the HTTP header. This can
 	// be in different header fields depending on the implementation and/or
 	// protocol.
-	mac, preimage, err := l402.FromHeader(header)
+	mac, preimage, err := l402.FromHeader(&r.Header)
 	if err != nil {
 		log.Debugf("Deny: %v", err)
 		return false
@@ -51,7 +75,46 @@ func (l *L402Authenticator) Accept(header *http.Header, serviceName string) bool
 		Macaroon:      mac,
 		Preimage:      preimage,
 		TargetService: serviceName,
+		Request:       r,
+	}
+
+	// A paid top-up can be sent along with the L402 to extend it.
+	topUpPreimage, hasTopUp, err := l402.TopUpFromHeader(&r.Header)
+	if err != nil {
+		log.Debugf("Deny: %v", err)
+		return false
+	}
+	if hasTopUp {
+		verificationParams.TopUpPreimage = &topUpPreimage
+	}
+
+	// If the L402 was verified before, only its caveats need to be checked
+	// again. Top-ups always take the full path, so they're redeemed.
+	cacheKey, cacheable := l.verificationKey(mac, preimage, serviceName)
+	if cacheable && !hasTopUp {
+		if l.cache.verified(context.Background(), cacheKey) {
+			verificationCacheHits.WithLabelValues(serviceName).Inc()
+
+			err := l.minter.VerifyCaveats(
+				context.Background(), verificationParams,
+			)
+			if err != nil {
+				log.Debugf("Deny: L402 caveat validation "+
+					"failed: %v", err)
+				return false
+			}
+
+			return true
+		}
+
+		verificationCacheMisses.WithLabelValues(serviceName).Inc()
 	}
+
+	var generation uint64
+	if cacheable {
+		generation = l.cache.currentGeneration()
+	}
+
 	err = l.minter.VerifyL402(context.Background(), verificationParams)
 	if err != nil {
 		log.Debugf("Deny: L402 validation failed: %v", err)
@@ -68,36 +131,108 @@ func (l *L402Authenticator) Accept(header *http.Header, serviceName string) bool
 		return false
 	}
 
+	if cacheable {
+		id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+		if err == nil {
+			l.cache.add(
+				cacheKey, id.TokenID, id.PaymentHash,
+				generation,
+			)
+		}
+	}
+
 	return true
 }
 
+// verificationKey returns the key the L402 of the given macaroon and preimage
+// is kept under in the verification cache when used for the given service.
+// False is returned if there is no cache.
+func (l *L402Authenticator) verificationKey(mac *macaroon.Macaroon,
+	preimage lntypes.Preimage, serviceName string) (verificationKey, bool) {
+
+	if l.cache == nil {
+		return verificationKey{}, false
+	}
+
+	macBytes, err := mac.MarshalBinary()
+	if err != nil {
+		return verificationKey{}, false
+	}
+
+	return newVerificationKey(macBytes, preimage, serviceName), true
+}
+
 const (
 	// lsatAuthScheme is an outdated RFC 7235 auth-scheme used by aperture.
 	lsatAuthScheme = "LSAT"
 
 	// l402AuthScheme is the current RFC 7235 auth-scheme used by aperture.
 	l402AuthScheme = "L402"
+
+	// topUpParam is the auth-param of a challenge that contains the
+	// invoice to top up the L402 the request was made with.
+	topUpParam = "topup_invoice"
 )
 
 // FreshChallengeHeader returns a header containing a challenge for the user to
 // complete.
 //
 // NOTE: This is part of the Authenticator interface.
-func (l *L402Authenticator) FreshChallengeHeader(serviceName string,
-	servicePrice int64) (http.Header, error) {
+func (l *L402Authenticator) FreshChallengeHeader(r *http.Request,
+	service l402.Service, terms *mint.Terms,
+	exhausted bool) (http.Header, error) {
 
-	service := l402.Service{
-		Name:  serviceName,
-		Tier:  l402.BaseTier,
-		Price: servicePrice,
-	}
-	mac, paymentRequest, err := l.minter.MintL402(
-		context.Background(), service,
+	var (
+		mac            *macaroon.Macaroon
+		paymentRequest string
+		err            error
 	)
+	if terms != nil {
+		mac, paymentRequest, err = l.minter.MintL402WithTerms(
+			context.Background(), service, terms,
+		)
+	} else {
+		mac, paymentRequest, err = l.minter.MintL402(
+			context.Background(), service,
+		)
+	}
 	if err != nil {
 		log.Errorf("Error minting L402: %v", err)
 		return nil, err
 	}
+
+	// If the request was made with an L402 that is used up or expired and
+	// can be topped up, the user can pay the top-up invoice instead to
+	// keep using it.
+	topUpRequest := l.topUpInvoice(r, service, exhausted)
+
+	return challengeHeader(mac, paymentRequest, topUpRequest), nil
+}
+
+// FreshBundleChallengeHeader returns a header containing a challenge for an
+// L402 of the given bundle.
+//
+// NOTE: This is part of the Authenticator interface.
+func (l *L402Authenticator) FreshBundleChallengeHeader(_ *http.Request,
+	bundle *mint.Bundle) (http.Header, error) {
+
+	mac, paymentRequest, err := l.minter.MintBundleL402(
+		context.Background(), bundle,
+	)
+	if err != nil {
+		log.Errorf("Error minting L402 of bundle %s: %v", bundle.Name,
+			err)
+		return nil, err
+	}
+
+	return challengeHeader(mac, paymentRequest, ""), nil
+}
+
+// challengeHeader returns a header containing a challenge for the given
+// macaroon and invoice. If a top-up invoice is given, it is offered as well.
+func challengeHeader(mac *macaroon.Macaroon, paymentRequest,
+	topUpRequest string) http.Header {
+
 	macBytes, err := mac.MarshalBinary()
 	if err != nil {
 		log.Errorf("Error serializing L402: %v", err)
@@ -110,6 +245,10 @@ func (l *L402Authenticator) FreshChallengeHeader(serviceName string,
 	str := fmt.Sprintf("macaroon=\"%s\", invoice=\"%s\"",
 		base64.StdEncoding.EncodeToString(macBytes), paymentRequest)
 
+	if topUpRequest != "" {
+		str += fmt.Sprintf(", %s=\"%s\"", topUpParam, topUpRequest)
+	}
+
 	// Old loop software (via ClientInterceptor code of aperture) looks
 	// for "LSAT" in the first instance of WWW-Authenticate header, so
 	// legacy header must go first not to break backward compatibility.
@@ -120,5 +259,33 @@ func (l *L402Authenticator) FreshChallengeHeader(serviceName string,
 	header.Add("WWW-Authenticate", l402Value)
 	log.Debugf("Created new challenge header: [%s]", l402Value)
 
-	return header, nil
+	return header
+}
+
+// topUpInvoice returns an invoice that tops up the L402 the given request was
+// made with for the given service. An empty string is returned if the request
+// wasn't made with an L402 that can be topped up or that needs a top-up.
+func (l *L402Authenticator) topUpInvoice(r *http.Request,
+	service l402.Service, exhausted bool) string {
+
+	mac, preimage, err := l402.FromHeader(&r.Header)
+	if err != nil {
+		return ""
+	}
+
+	verificationParams := &mint.VerificationParams{
+		Macaroon:      mac,
+		Preimage:      preimage,
+		TargetService: service.Name,
+		Request:       r,
+	}
+	paymentRequest, err := l.minter.MintTopUp(
+		context.Background(), verificationParams, service, exhausted,
+	)
+	if err != nil {
+		log.Debugf("Not offering top-up: %v", err)
+		return ""
+	}
+
+	return paymentRequest
 }
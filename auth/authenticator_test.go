@@ -1,14 +1,20 @@
 package auth_test
 
 import (
+	"bytes"
+	"context"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/lightninglabs/aperture/auth"
 	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/macaroon.v2"
 )
 
@@ -148,6 +154,30 @@ func TestL402Authenticator(t *testing.T) {
 				},
 				result: true,
 			},
+			{
+				id: "valid auth header, invalid top-up",
+				header: &http.Header{
+					l402.HeaderAuthorization: []string{
+						"L402 " + testMacBase64 + ":" +
+							testPreimage,
+					},
+					l402.HeaderTopUp: []string{"foo"},
+				},
+				result: false,
+			},
+			{
+				id: "valid auth header, valid top-up",
+				header: &http.Header{
+					l402.HeaderAuthorization: []string{
+						"L402 " + testMacBase64 + ":" +
+							testPreimage,
+					},
+					l402.HeaderTopUp: []string{
+						testPreimage,
+					},
+				},
+				result: true,
+			},
 			{
 				id: "valid macaroon header, wrong invoice state",
 				header: &http.Header{
@@ -165,10 +195,286 @@ func TestL402Authenticator(t *testing.T) {
 	a := auth.NewL402Authenticator(&mockMint{}, c)
 	for _, testCase := range headerTests {
 		c.err = testCase.checkErr
-		result := a.Accept(testCase.header, "test")
+		r := &http.Request{Header: *testCase.header}
+		result := a.Accept(r, "test")
 		if result != testCase.result {
 			t.Fatalf("test case %s failed. got %v expected %v",
 				testCase.id, result, testCase.result)
 		}
 	}
 }
+
+// TestFreshChallengeHeaderTopUp tests that a top-up invoice is only added to
+// the challenge if the request was made with an L402 that can be topped up.
+func TestFreshChallengeHeaderTopUp(t *testing.T) {
+	var (
+		testPreimage = "49349dfea4abed3cd14f6d356afa83de" +
+			"9787b609f088c8df09bacc7b4bd21b39"
+		testMacHex = createDummyMacHex(testPreimage)
+	)
+
+	mac, err := macaroon.New(
+		[]byte("aabbccddeeff00112233445566778899"), []byte("AA=="),
+		"aperture", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+
+	minter := &mockMint{
+		mac:          mac,
+		topUpRequest: "lnbc1topup",
+	}
+	a := auth.NewL402Authenticator(minter, &mockChecker{})
+	service := l402.Service{Name: "test"}
+
+	// Requests without an L402 don't get a top-up invoice.
+	r := &http.Request{Header: http.Header{}}
+	header, err := a.FreshChallengeHeader(r, service, nil, false)
+	require.NoError(t, err)
+	for _, value := range header.Values("WWW-Authenticate") {
+		require.NotContains(t, value, "topup_invoice")
+	}
+
+	// Requests with an L402 get one for each auth scheme. Whether the
+	// L402 is exhausted is passed on to the minter.
+	r.Header.Set(l402.HeaderMacaroon, testMacHex)
+	header, err = a.FreshChallengeHeader(r, service, nil, true)
+	require.NoError(t, err)
+	require.True(t, minter.topUpExhausted)
+	values := header.Values("WWW-Authenticate")
+	require.Len(t, values, 2)
+	for _, value := range values {
+		require.Contains(t, value, `topup_invoice="lnbc1topup"`)
+	}
+
+	// If the L402 can't be topped up or doesn't need a top-up, the
+	// challenge only offers a new L402.
+	minter.topUpErr = mint.ErrTopUpNotNeeded
+	header, err = a.FreshChallengeHeader(r, service, nil, false)
+	require.NoError(t, err)
+	require.False(t, minter.topUpExhausted)
+	for _, value := range header.Values("WWW-Authenticate") {
+		require.NotContains(t, value, "topup_invoice")
+	}
+
+	minter.topUpErr = mint.ErrTopUpUnsupported
+	header, err = a.FreshChallengeHeader(r, service, nil, true)
+	require.NoError(t, err)
+	for _, value := range header.Values("WWW-Authenticate") {
+		require.NotContains(t, value, "topup_invoice")
+	}
+
+	// Terms are passed on to the minter.
+	terms := &mint.Terms{Capabilities: []string{"read"}}
+	_, err = a.FreshChallengeHeader(r, service, terms, false)
+	require.NoError(t, err)
+	require.Equal(t, terms, minter.terms)
+}
+
+// TestL402AuthenticatorCache tests that L402s are only verified in full on
+// their first use and again after they were invalidated in the cache.
+func TestL402AuthenticatorCache(t *testing.T) {
+	preimage := lntypes.Preimage{1, 2, 3}
+	tokenID := l402.TokenID{4, 5, 6}
+
+	var id bytes.Buffer
+	err := l402.EncodeIdentifier(&id, &l402.Identifier{
+		Version:     l402.LatestVersion,
+		PaymentHash: preimage.Hash(),
+		TokenID:     tokenID,
+	})
+	require.NoError(t, err)
+
+	mac, err := macaroon.New(
+		[]byte("aabbccddeeff00112233445566778899"), id.Bytes(),
+		"aperture", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+	macBytes, err := mac.MarshalBinary()
+	require.NoError(t, err)
+	macBase64 := base64.StdEncoding.EncodeToString(macBytes)
+
+	newRequest := func() *http.Request {
+		return &http.Request{Header: http.Header{
+			l402.HeaderAuthorization: []string{
+				"L402 " + macBase64 + ":" + preimage.String(),
+			},
+		}}
+	}
+
+	minter := &mockMint{}
+	checker := &mockChecker{}
+	cache := auth.NewVerificationCache(10, time.Hour, nil, 0)
+	a := auth.NewL402Authenticator(
+		minter, checker, auth.WithVerificationCache(cache),
+	)
+
+	// L402s that fail verification aren't cached.
+	checker.err = fmt.Errorf("nope")
+	require.False(t, a.Accept(newRequest(), "test"))
+	checker.err = nil
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 2, minter.numVerified)
+
+	// Once the L402 was verified, only its caveats are checked.
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 2, minter.numVerified)
+	require.Equal(t, 1, minter.numCaveatsChecks)
+
+	minter.caveatErr = fmt.Errorf("expired")
+	require.False(t, a.Accept(newRequest(), "test"))
+	minter.caveatErr = nil
+
+	// The L402 is cached for each service separately.
+	require.True(t, a.Accept(newRequest(), "other"))
+	require.Equal(t, 3, minter.numVerified)
+
+	// Requests with a top-up are always verified in full, so that the
+	// top-up is redeemed.
+	r := newRequest()
+	r.Header.Set(l402.HeaderTopUp, preimage.String())
+	require.True(t, a.Accept(r, "test"))
+	require.Equal(t, 4, minter.numVerified)
+
+	// A revoked L402 is verified in full again.
+	cache.InvalidateL402(tokenID, lntypes.Hash{})
+	minter.verifyErr = mint.ErrSecretNotFound
+	require.False(t, a.Accept(newRequest(), "test"))
+	require.False(t, a.Accept(newRequest(), "other"))
+	require.Equal(t, 6, minter.numVerified)
+
+	minter.verifyErr = nil
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 7, minter.numVerified)
+
+	cache.InvalidateL402(l402.TokenID{}, preimage.Hash())
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 8, minter.numVerified)
+
+	// Invalidating the whole cache removes every L402.
+	cache.InvalidateAll()
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 9, minter.numVerified)
+}
+
+// TestL402AuthenticatorCacheRootKeys tests that the cache of verified L402s is
+// cleared once root keys were invalidated, even if that happened through
+// another instance.
+func TestL402AuthenticatorCacheRootKeys(t *testing.T) {
+	preimage := lntypes.Preimage{1, 2, 3}
+
+	var id bytes.Buffer
+	err := l402.EncodeIdentifier(&id, &l402.Identifier{
+		Version:     l402.LatestVersion,
+		PaymentHash: preimage.Hash(),
+		TokenID:     l402.TokenID{4, 5, 6},
+	})
+	require.NoError(t, err)
+
+	mac, err := macaroon.New(
+		[]byte("aabbccddeeff00112233445566778899"), id.Bytes(),
+		"aperture", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+	macBytes, err := mac.MarshalBinary()
+	require.NoError(t, err)
+	macBase64 := base64.StdEncoding.EncodeToString(macBytes)
+
+	newRequest := func() *http.Request {
+		return &http.Request{Header: http.Header{
+			l402.HeaderAuthorization: []string{
+				"L402 " + macBase64 + ":" + preimage.String(),
+			},
+		}}
+	}
+
+	ctx := context.Background()
+	rootKeys := &mockRootKeyStore{}
+	_, _, err = rootKeys.RotateRootKey(ctx)
+	require.NoError(t, err)
+
+	minter := &mockMint{}
+	cache := auth.NewVerificationCache(10, time.Hour, rootKeys, 0)
+	a := auth.NewL402Authenticator(
+		minter, &mockChecker{}, auth.WithVerificationCache(cache),
+	)
+
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 1, minter.numVerified)
+
+	// Rotating the root keys keeps the cached L402s.
+	_, _, err = rootKeys.RotateRootKey(ctx)
+	require.NoError(t, err)
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 1, minter.numVerified)
+
+	// Invalidating the old root key, as another instance would, removes
+	// the cached L402s.
+	_, err = rootKeys.InvalidateRootKeys(ctx, 2)
+	require.NoError(t, err)
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 2, minter.numVerified)
+
+	// While the root keys are queried, cached L402s are still accepted
+	// without waiting for the query.
+	rootKeys.listing = make(chan struct{})
+	rootKeys.release = make(chan struct{})
+	checked := make(chan bool)
+	go func() {
+		checked <- a.Accept(newRequest(), "test")
+	}()
+	<-rootKeys.listing
+
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 2, minter.numVerified)
+
+	close(rootKeys.release)
+	require.True(t, <-checked)
+	require.Equal(t, 2, minter.numVerified)
+	rootKeys.listing, rootKeys.release = nil, nil
+
+	// If the root keys can't be checked, L402s are verified in full.
+	rootKeys.err = fmt.Errorf("unavailable")
+	require.True(t, a.Accept(newRequest(), "test"))
+	require.Equal(t, 3, minter.numVerified)
+}
+
+// TestFreshBundleChallengeHeader tests that challenges for a bundle contain an
+// L402 minted for the bundle and don't offer a top-up.
+func TestFreshBundleChallengeHeader(t *testing.T) {
+	mac, err := macaroon.New(
+		[]byte("aabbccddeeff00112233445566778899"), []byte("AA=="),
+		"aperture", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+
+	minter := &mockMint{
+		mac:          mac,
+		topUpRequest: "lnbc1topup",
+	}
+	a := auth.NewL402Authenticator(minter, &mockChecker{})
+
+	bundle := &mint.Bundle{
+		Name: "bundle",
+		Services: []l402.Service{
+			{Name: "service1"}, {Name: "service2"},
+		},
+		Price: 10,
+	}
+	r := &http.Request{Header: http.Header{}}
+	r.Header.Set(l402.HeaderMacaroon, createDummyMacHex(
+		"49349dfea4abed3cd14f6d356afa83de"+
+			"9787b609f088c8df09bacc7b4bd21b39",
+	))
+	header, err := a.FreshBundleChallengeHeader(r, bundle)
+	require.NoError(t, err)
+	require.Equal(t, bundle, minter.bundle)
+
+	values := header.Values("WWW-Authenticate")
+	require.Len(t, values, 2)
+	for _, value := range values {
+		require.Contains(t, value, "macaroon=")
+		require.NotContains(t, value, "topup_invoice")
+	}
+}
@@ -2,8 +2,10 @@ package auth
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lightninglabs/aperture/freebie"
 )
@@ -28,16 +30,69 @@ func (l Level) IsFreebie() bool {
 	return strings.HasPrefix(l.lower(), "freebie")
 }
 
-func (l Level) FreebieCount() freebie.Count {
+// Validate returns an error if the level is a freebie level with a malformed
+// freebie count or window.
+func (l Level) Validate() error {
+	if !l.IsFreebie() {
+		return nil
+	}
+
+	_, _, err := l.freebieParts()
+	return err
+}
+
+// freebieParts parses a freebie level of the form "freebie N" or
+// "freebie N/window", for example "freebie 10/24h".
+func (l Level) freebieParts() (freebie.Count, time.Duration, error) {
 	parts := strings.Split(l.lower(), " ")
 	if len(parts) != 2 {
-		panic(fmt.Errorf("invalid auth value: %s", l.lower()))
+		return 0, 0, fmt.Errorf("invalid auth value: %s", l.lower())
+	}
+
+	countStr, windowStr, hasWindow := strings.Cut(parts[1], "/")
+	count, err := strconv.Atoi(countStr)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid freebie count in auth value "+
+			"%s: %w", l.lower(), err)
+	}
+	if count < 0 || count > math.MaxUint16 {
+		return 0, 0, fmt.Errorf("freebie count in auth value %s out "+
+			"of range", l.lower())
+	}
+
+	var window time.Duration
+	if hasWindow {
+		window, err = time.ParseDuration(windowStr)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid freebie window in "+
+				"auth value %s: %w", l.lower(), err)
+		}
+		if window <= 0 {
+			return 0, 0, fmt.Errorf("freebie window in auth value "+
+				"%s must be positive", l.lower())
+		}
+	}
+
+	return freebie.Count(count), window, nil
+}
+
+// FreebieCount returns the number of free requests of a freebie level.
+func (l Level) FreebieCount() freebie.Count {
+	count, _, err := l.freebieParts()
+	if err != nil {
+		panic(err)
 	}
-	count, err := strconv.Atoi(parts[1])
+	return count
+}
+
+// FreebieWindow returns the rolling window over which the free requests of a
+// freebie level are counted. It is zero if the level doesn't define a window.
+func (l Level) FreebieWindow() time.Duration {
+	_, window, err := l.freebieParts()
 	if err != nil {
 		panic(err)
 	}
-	return freebie.Count(count)
+	return window
 }
 
 func (l Level) IsOff() bool {
@@ -0,0 +1,66 @@
+package auth_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/freebie"
+	"github.com/stretchr/testify/require"
+)
+
+// TestLevelFreebie tests the parsing of freebie auth levels.
+func TestLevelFreebie(t *testing.T) {
+	testCases := []struct {
+		level  auth.Level
+		valid  bool
+		count  freebie.Count
+		window time.Duration
+	}{{
+		level: "on",
+		valid: true,
+	}, {
+		level: "freebie 5",
+		valid: true,
+		count: 5,
+	}, {
+		level:  "freebie 10/24h",
+		valid:  true,
+		count:  10,
+		window: 24 * time.Hour,
+	}, {
+		level:  "Freebie 3/30M",
+		valid:  true,
+		count:  3,
+		window: 30 * time.Minute,
+	}, {
+		level: "freebie",
+	}, {
+		level: "freebie many",
+	}, {
+		level: "freebie 70000",
+	}, {
+		level: "freebie 10/",
+	}, {
+		level: "freebie 10/day",
+	}, {
+		level: "freebie 10/-1h",
+	}}
+
+	for _, tc := range testCases {
+		t.Run(string(tc.level), func(t *testing.T) {
+			err := tc.level.Validate()
+			if !tc.valid {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if !tc.level.IsFreebie() {
+				return
+			}
+			require.Equal(t, tc.count, tc.level.FreebieCount())
+			require.Equal(t, tc.window, tc.level.FreebieWindow())
+		})
+	}
+}
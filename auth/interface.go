@@ -21,13 +21,24 @@ const (
 // Authenticator is the generic interface for validating client headers and
 // returning new challenge headers.
 type Authenticator interface {
-	// Accept returns whether or not the header successfully authenticates
-	// the user to a given backend service.
-	Accept(*http.Header, string) bool
+	// Accept returns whether or not the headers of the request successfully
+	// authenticate the user to a given backend service.
+	Accept(*http.Request, string) bool
 
 	// FreshChallengeHeader returns a header containing a challenge for the
-	// user to complete.
-	FreshChallengeHeader(string, int64) (http.Header, error)
+	// user to complete. The challenge contains an L402 for the given
+	// service, tier and price, minted under the given terms if they aren't
+	// nil. If the request was made with an L402 that can be topped up and
+	// that expired or, as reported by the caller, whose requests or
+	// balance are exhausted, the challenge also contains a top-up invoice.
+	FreshChallengeHeader(*http.Request, l402.Service, *mint.Terms,
+		bool) (http.Header, error)
+
+	// FreshBundleChallengeHeader returns a header containing a challenge
+	// for the user to complete. The challenge contains an L402 for all
+	// services of the given bundle.
+	FreshBundleChallengeHeader(*http.Request, *mint.Bundle) (http.Header,
+		error)
 }
 
 // Minter is an entity that is able to mint and verify L402s for a set of
@@ -36,8 +47,28 @@ type Minter interface {
 	// MintL402 mints a new L402 for the target services.
 	MintL402(context.Context, ...l402.Service) (*macaroon.Macaroon, string, error)
 
+	// MintL402WithTerms mints a new L402 for the target service under the
+	// given terms.
+	MintL402WithTerms(context.Context, l402.Service,
+		*mint.Terms) (*macaroon.Macaroon, string, error)
+
 	// VerifyL402 attempts to verify an L402 with the given parameters.
 	VerifyL402(context.Context, *mint.VerificationParams) error
+
+	// VerifyCaveats verifies only the caveats and the revocation of an
+	// L402 that was verified with VerifyL402 before.
+	VerifyCaveats(context.Context, *mint.VerificationParams) error
+
+	// MintBundleL402 mints a new L402 for all services of the given
+	// bundle.
+	MintBundleL402(context.Context, *mint.Bundle) (*macaroon.Macaroon,
+		string, error)
+
+	// MintTopUp creates an invoice that tops up the L402 of the given
+	// parameters for the given service once it is paid. The L402 is only
+	// topped up if it expired or if it is reported as exhausted.
+	MintTopUp(context.Context, *mint.VerificationParams, l402.Service,
+		bool) (string, error)
 }
 
 // InvoiceChecker is an entity that is able to check the status of an invoice,
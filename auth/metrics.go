@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	// verificationCacheHits counts requests whose L402 was found in the
+	// verification cache.
+	verificationCacheHits = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "aperture",
+			Subsystem: "l402cache",
+			Name:      "hits_total",
+			Help:      "Total number of L402 verification cache hits",
+		},
+		[]string{"service"},
+	)
+
+	// verificationCacheMisses counts requests whose L402 wasn't found in
+	// the verification cache.
+	verificationCacheMisses = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "aperture",
+			Subsystem: "l402cache",
+			Name:      "misses_total",
+			Help:      "Total number of L402 verification cache misses",
+		},
+		[]string{"service"},
+	)
+)
@@ -1,6 +1,11 @@
 package auth
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+)
 
 // MockAuthenticator is a mock implementation of the authenticator.
 type MockAuthenticator struct{}
@@ -14,9 +19,10 @@ func NewMockAuthenticator() *MockAuthenticator {
 	return &MockAuthenticator{}
 }
 
-// Accept returns whether or not the header successfully authenticates the user
-// to a given backend service.
-func (a MockAuthenticator) Accept(header *http.Header, _ string) bool {
+// Accept returns whether or not the headers of the request successfully
+// authenticate the user to a given backend service.
+func (a MockAuthenticator) Accept(r *http.Request, _ string) bool {
+	header := r.Header
 	if header.Get("Authorization") != "" {
 		return true
 	}
@@ -31,8 +37,22 @@ func (a MockAuthenticator) Accept(header *http.Header, _ string) bool {
 
 // FreshChallengeHeader returns a header containing a challenge for the user to
 // complete.
-func (a MockAuthenticator) FreshChallengeHeader(string, int64) (http.Header,
-	error) {
+func (a MockAuthenticator) FreshChallengeHeader(*http.Request,
+	l402.Service, *mint.Terms, bool) (http.Header, error) {
+
+	return mockChallengeHeader(), nil
+}
+
+// FreshBundleChallengeHeader returns a header containing a challenge for the
+// user to complete.
+func (a MockAuthenticator) FreshBundleChallengeHeader(*http.Request,
+	*mint.Bundle) (http.Header, error) {
+
+	return mockChallengeHeader(), nil
+}
+
+// mockChallengeHeader returns a header containing a static challenge.
+func mockChallengeHeader() http.Header {
 
 	header := http.Header{
 		"Content-Type": []string{"application/grpc"},
@@ -48,5 +68,5 @@ func (a MockAuthenticator) FreshChallengeHeader(string, int64) (http.Header,
 	header.Set("WWW-Authenticate", lsatAuthScheme+" "+str)
 	header.Add("WWW-Authenticate", l402AuthScheme+" "+str)
 
-	return header, nil
+	return header
 }
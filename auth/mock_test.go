@@ -13,6 +13,17 @@ import (
 )
 
 type mockMint struct {
+	mac            *macaroon.Macaroon
+	topUpRequest   string
+	topUpErr       error
+	topUpExhausted bool
+	bundle         *mint.Bundle
+	terms          *mint.Terms
+
+	verifyErr        error
+	caveatErr        error
+	numVerified      int
+	numCaveatsChecks int
 }
 
 var _ auth.Minter = (*mockMint)(nil)
@@ -20,11 +31,40 @@ var _ auth.Minter = (*mockMint)(nil)
 func (m *mockMint) MintL402(_ context.Context,
 	services ...l402.Service) (*macaroon.Macaroon, string, error) {
 
-	return nil, "", nil
+	return m.mac, "", nil
+}
+
+func (m *mockMint) MintL402WithTerms(_ context.Context, _ l402.Service,
+	terms *mint.Terms) (*macaroon.Macaroon, string, error) {
+
+	m.terms = terms
+	return m.mac, "", nil
 }
 
 func (m *mockMint) VerifyL402(_ context.Context, p *mint.VerificationParams) error {
-	return nil
+	m.numVerified++
+	return m.verifyErr
+}
+
+func (m *mockMint) VerifyCaveats(_ context.Context,
+	_ *mint.VerificationParams) error {
+
+	m.numCaveatsChecks++
+	return m.caveatErr
+}
+
+func (m *mockMint) MintBundleL402(_ context.Context,
+	bundle *mint.Bundle) (*macaroon.Macaroon, string, error) {
+
+	m.bundle = bundle
+	return m.mac, "", nil
+}
+
+func (m *mockMint) MintTopUp(_ context.Context, _ *mint.VerificationParams,
+	_ l402.Service, exhausted bool) (string, error) {
+
+	m.topUpExhausted = exhausted
+	return m.topUpRequest, m.topUpErr
 }
 
 type mockChecker struct {
@@ -38,3 +78,44 @@ func (m *mockChecker) VerifyInvoiceStatus(lntypes.Hash,
 
 	return m.err
 }
+
+type mockRootKeyStore struct {
+	rootKeys []*mint.RootKey
+	err      error
+
+	// listing and release block ListRootKeys if set. A value is sent on
+	// listing once ListRootKeys is called, which then returns once
+	// release is closed.
+	listing chan struct{}
+	release chan struct{}
+}
+
+var _ mint.RootKeyStore = (*mockRootKeyStore)(nil)
+
+func (s *mockRootKeyStore) ListRootKeys(
+	context.Context) ([]*mint.RootKey, error) {
+
+	if s.listing != nil {
+		s.listing <- struct{}{}
+		<-s.release
+	}
+
+	return s.rootKeys, s.err
+}
+
+func (s *mockRootKeyStore) RotateRootKey(
+	context.Context) (*mint.RootKey, int64, error) {
+
+	rootKey := &mint.RootKey{Version: uint32(len(s.rootKeys) + 1)}
+	s.rootKeys = append(s.rootKeys, rootKey)
+	return rootKey, 0, nil
+}
+
+func (s *mockRootKeyStore) InvalidateRootKeys(_ context.Context,
+	version uint32) (int64, error) {
+
+	for len(s.rootKeys) > 0 && s.rootKeys[0].Version < version {
+		s.rootKeys = s.rootKeys[1:]
+	}
+	return 0, nil
+}
@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/neutrino/cache/lru"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+const (
+	// DefaultVerificationCacheSize is the default maximum number of
+	// verified L402s that are kept in the verification cache.
+	DefaultVerificationCacheSize = 10_000
+
+	// DefaultVerificationCacheTTL is the default duration a verified L402
+	// is kept in the verification cache.
+	DefaultVerificationCacheTTL = time.Minute
+
+	// DefaultRootKeyRefresh is the default interval at which the
+	// verification cache checks whether root keys were invalidated.
+	DefaultRootKeyRefresh = 5 * time.Second
+)
+
+// verificationKey identifies a verified L402. It is the hash of the serialized
+// macaroon, the preimage and the service the L402 was verified for.
+type verificationKey [sha256.Size]byte
+
+// newVerificationKey returns the key of the given macaroon, preimage and
+// service.
+func newVerificationKey(macBytes []byte, preimage lntypes.Preimage,
+	service string) verificationKey {
+
+	h := sha256.New()
+	_, _ = h.Write(macBytes)
+	_, _ = h.Write(preimage[:])
+	_, _ = h.Write([]byte(service))
+
+	var key verificationKey
+	copy(key[:], h.Sum(nil))
+
+	return key
+}
+
+// verifiedL402 is an entry of the verification cache. Implements the
+// cache.Value interface.
+type verifiedL402 struct {
+	// tokenID is the ID of the verified L402.
+	tokenID l402.TokenID
+
+	// paymentHash is the payment hash of the verified L402.
+	paymentHash lntypes.Hash
+
+	// expiry is the time the entry expires at.
+	expiry time.Time
+}
+
+// Size implements cache.Value. Returns 1 so the LRU cache counts entries
+// rather than bytes.
+func (v *verifiedL402) Size() (uint64, error) {
+	return 1, nil
+}
+
+// VerificationCache keeps the L402s that were verified successfully for a
+// limited time, so that the secret of an L402 doesn't have to be looked up and
+// its invoice doesn't have to be checked on every request. The caveats of a
+// cached L402 are still verified on every request.
+//
+// Revocations and root key invalidations made through this instance remove
+// the affected L402s right away. Revocations made through other instances are
+// caught by the revocation check of every cache hit, while root key
+// invalidations made through other instances are picked up by watching the
+// root keys. The root keys are queried without holding the cache mutex, so
+// that a slow database doesn't block the lookups of other requests.
+type VerificationCache struct {
+	// cacheMu protects the LRU cache which is not concurrency-safe.
+	cacheMu sync.Mutex
+
+	// cache is the LRU cache of verified L402s.
+	cache *lru.Cache[verificationKey, *verifiedL402]
+
+	// ttl is the duration a verified L402 is cached for.
+	ttl time.Duration
+
+	// generation is increased whenever L402s are invalidated, so that
+	// L402s that were being verified in the meantime aren't added.
+	generation uint64
+
+	// rootKeys is the optional store of the root keys that wrap the
+	// secrets of L402s. Once its oldest root key changed, root keys were
+	// invalidated and all L402s are removed from the cache.
+	rootKeys mint.RootKeyStore
+
+	// rootKeysMu protects the state of the root key checks below. It is
+	// acquired before cacheMu if both are needed.
+	rootKeysMu sync.Mutex
+
+	// checkingRootKeys is true while the root keys are queried, so that
+	// only one request queries them at a time.
+	checkingRootKeys bool
+
+	// rootKeyRefresh is the interval at which the root keys are checked.
+	rootKeyRefresh time.Duration
+
+	// oldestRootKey is the version of the oldest root key when the root
+	// keys were last checked.
+	oldestRootKey uint32
+
+	// rootKeysCheckedAt is the time the root keys were last checked.
+	rootKeysCheckedAt time.Time
+
+	// now returns the current time.
+	now func() time.Time
+}
+
+// NewVerificationCache creates a new cache that keeps at most size verified
+// L402s for the given duration. If a root key store is given, its root keys are
+// checked at most once per refresh interval, so that the invalidation of root
+// keys through another instance clears the cache.
+func NewVerificationCache(size int, ttl time.Duration,
+	rootKeys mint.RootKeyStore,
+	rootKeyRefresh time.Duration) *VerificationCache {
+
+	return &VerificationCache{
+		cache: lru.NewCache[verificationKey, *verifiedL402](
+			uint64(size),
+		),
+		ttl:            ttl,
+		rootKeys:       rootKeys,
+		rootKeyRefresh: rootKeyRefresh,
+		now:            time.Now,
+	}
+}
+
+// verified returns true if the L402 of the given key was verified and hasn't
+// expired yet.
+func (c *VerificationCache) verified(ctx context.Context,
+	key verificationKey) bool {
+
+	// If the root keys can't be checked, the L402 is verified in full,
+	// as it might have been invalidated.
+	if err := c.checkRootKeys(ctx); err != nil {
+		log.Warnf("Unable to check root keys: %v", err)
+		return false
+	}
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	entry, err := c.cache.Get(key)
+	if err != nil {
+		return false
+	}
+
+	if !c.now().Before(entry.expiry) {
+		c.cache.Delete(key)
+		return false
+	}
+
+	return true
+}
+
+// currentGeneration returns the generation L402s must be added with to be
+// cached.
+func (c *VerificationCache) currentGeneration() uint64 {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	return c.generation
+}
+
+// add adds the L402 of the given key to the cache, unless L402s were
+// invalidated since the given generation. The L402 could have been revoked
+// while it was verified otherwise.
+func (c *VerificationCache) add(key verificationKey, tokenID l402.TokenID,
+	paymentHash lntypes.Hash, generation uint64) {
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	_, _ = c.cache.Put(key, &verifiedL402{
+		tokenID:     tokenID,
+		paymentHash: paymentHash,
+		expiry:      c.now().Add(c.ttl),
+	})
+}
+
+// InvalidateL402 removes the L402 with the given token ID or payment hash from
+// the cache, so that it is verified in full on its next use.
+func (c *VerificationCache) InvalidateL402(tokenID l402.TokenID,
+	paymentHash lntypes.Hash) {
+
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.generation++
+
+	var keys []verificationKey
+	c.cache.Range(func(key verificationKey, entry *verifiedL402) bool {
+		if entry.tokenID == tokenID ||
+			entry.paymentHash == paymentHash {
+
+			keys = append(keys, key)
+		}
+
+		return true
+	})
+
+	for _, key := range keys {
+		c.cache.Delete(key)
+	}
+}
+
+// checkRootKeys removes all L402s from the cache if the oldest root key changed
+// since the root keys were last checked. Once the refresh interval passed, only
+// the first caller queries the root keys, while the others keep using the
+// cache until the query is done. The caller must not hold the cache mutex.
+func (c *VerificationCache) checkRootKeys(ctx context.Context) error {
+	if c.rootKeys == nil {
+		return nil
+	}
+
+	c.rootKeysMu.Lock()
+	now := c.now()
+	if c.checkingRootKeys ||
+		now.Sub(c.rootKeysCheckedAt) < c.rootKeyRefresh {
+
+		c.rootKeysMu.Unlock()
+		return nil
+	}
+	c.checkingRootKeys = true
+	c.rootKeysMu.Unlock()
+
+	rootKeys, err := c.rootKeys.ListRootKeys(ctx)
+
+	c.rootKeysMu.Lock()
+	defer c.rootKeysMu.Unlock()
+
+	c.checkingRootKeys = false
+	if err != nil {
+		return fmt.Errorf("unable to list root keys: %w", err)
+	}
+
+	var oldest uint32
+	if len(rootKeys) > 0 {
+		oldest = rootKeys[0].Version
+	}
+	if oldest != c.oldestRootKey {
+		c.InvalidateAll()
+		c.oldestRootKey = oldest
+	}
+	c.rootKeysCheckedAt = now
+
+	return nil
+}
+
+// InvalidateAll removes all L402s from the cache.
+func (c *VerificationCache) InvalidateAll() {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+
+	c.invalidateAll()
+}
+
+// invalidateAll removes all L402s from the cache. The caller must hold the
+// mutex.
+func (c *VerificationCache) invalidateAll() {
+	c.generation++
+
+	var keys []verificationKey
+	c.cache.Range(func(key verificationKey, _ *verifiedL402) bool {
+		keys = append(keys, key)
+		return true
+	})
+
+	for _, key := range keys {
+		c.cache.Delete(key)
+	}
+}
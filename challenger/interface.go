@@ -28,11 +28,16 @@ type InvoiceClient interface {
 	// AddInvoice adds a new invoice to lnd.
 	AddInvoice(ctx context.Context, in *lnrpc.Invoice,
 		opts ...grpc.CallOption) (*lnrpc.AddInvoiceResponse, error)
+
+	// LookupInvoice looks up an invoice by its payment hash.
+	LookupInvoice(ctx context.Context, in *lnrpc.PaymentHash,
+		opts ...grpc.CallOption) (*lnrpc.Invoice, error)
 }
 
-// Challenger is an interface that combines the mint.Challenger and the
-// auth.InvoiceChecker interfaces.
+// Challenger is an interface that combines the mint.Challenger,
+// mint.InvoiceLookup and auth.InvoiceChecker interfaces.
 type Challenger interface {
 	mint.Challenger
+	mint.InvoiceLookup
 	auth.InvoiceChecker
 }
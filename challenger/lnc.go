@@ -1,6 +1,7 @@
 package challenger
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -78,3 +79,13 @@ func (l *LNCChallenger) VerifyInvoiceStatus(hash lntypes.Hash,
 
 	return l.lndChallenger.VerifyInvoiceStatus(hash, state, timeout)
 }
+
+// InvoicePaid returns true if the invoice with the given payment hash was paid.
+// Invoices that lnd doesn't know about are reported as unpaid.
+//
+// NOTE: This is part of the mint.InvoiceLookup interface.
+func (l *LNCChallenger) InvoicePaid(ctx context.Context,
+	hash lntypes.Hash) (bool, error) {
+
+	return l.lndChallenger.InvoicePaid(ctx, hash)
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/lightningnetwork/lnd/lnrpc"
 	"github.com/lightningnetwork/lnd/lntypes"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // LndChallenger is a challenger that uses an lnd backend to create new L402
@@ -399,6 +401,26 @@ func (l *LndChallenger) VerifyInvoiceStatus(hash lntypes.Hash,
 	}
 }
 
+// InvoicePaid returns true if the invoice with the given payment hash was paid.
+// Invoices that lnd doesn't know about are reported as unpaid.
+//
+// NOTE: This is part of the mint.InvoiceLookup interface.
+func (l *LndChallenger) InvoicePaid(ctx context.Context,
+	hash lntypes.Hash) (bool, error) {
+
+	invoice, err := l.client.LookupInvoice(ctx, &lnrpc.PaymentHash{
+		RHash: hash[:],
+	})
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return invoice.State == lnrpc.Invoice_SETTLED, nil
+}
+
 // invoiceIrrelevant returns true if an invoice is nil, canceled or non-settled
 // and expired.
 func invoiceIrrelevant(invoice *lnrpc.Invoice) bool {
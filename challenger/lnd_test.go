@@ -1,6 +1,7 @@
 package challenger
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"sync"
@@ -11,6 +12,8 @@ import (
 	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 var (
@@ -94,6 +97,19 @@ func (m *mockInvoiceClient) AddInvoice(_ context.Context, in *lnrpc.Invoice,
 	}, nil
 }
 
+// LookupInvoice looks up an invoice by its payment hash.
+func (m *mockInvoiceClient) LookupInvoice(_ context.Context,
+	in *lnrpc.PaymentHash, _ ...grpc.CallOption) (*lnrpc.Invoice, error) {
+
+	for _, invoice := range m.invoices {
+		if bytes.Equal(invoice.RHash, in.RHash) {
+			return invoice, nil
+		}
+	}
+
+	return nil, status.Error(codes.NotFound, "unable to locate invoice")
+}
+
 func (m *mockInvoiceClient) stop() {
 	close(m.quit)
 }
@@ -264,3 +280,34 @@ func TestLndChallenger(t *testing.T) {
 	invoiceMock.stop()
 	c.Stop()
 }
+
+// TestLndChallengerInvoicePaid tests that only settled invoices are reported as
+// paid.
+func TestLndChallengerInvoicePaid(t *testing.T) {
+	t.Parallel()
+
+	c, invoiceMock, _ := newChallenger()
+
+	var (
+		ctx     = context.Background()
+		open    = lntypes.Hash{1}
+		settled = lntypes.Hash{2}
+		unknown = lntypes.Hash{3}
+	)
+	invoiceMock.invoices = []*lnrpc.Invoice{
+		newInvoice(open, 1, lnrpc.Invoice_OPEN),
+		newInvoice(settled, 2, lnrpc.Invoice_SETTLED),
+	}
+
+	paid, err := c.InvoicePaid(ctx, open)
+	require.NoError(t, err)
+	require.False(t, paid)
+
+	paid, err = c.InvoicePaid(ctx, settled)
+	require.NoError(t, err)
+	require.True(t, paid)
+
+	paid, err = c.InvoicePaid(ctx, unknown)
+	require.NoError(t, err)
+	require.False(t, paid)
+}
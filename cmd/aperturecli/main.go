@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/jessevdk/go-flags"
+	"github.com/lightninglabs/aperture/adminrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// defaultTLSCertFilename is the file name of aperture's self-signed
+	// TLS certificate within its base directory.
+	defaultTLSCertFilename = "tls.cert"
+
+	// defaultMacaroonFilename is the file name of the admin macaroon
+	// within aperture's base directory.
+	defaultMacaroonFilename = "admin.macaroon"
+
+	// macaroonMetadataKey is the gRPC metadata key the admin server
+	// expects the hex encoded admin macaroon under.
+	macaroonMetadataKey = "macaroon"
+)
+
+var (
+	// defaultBaseDir is the default base directory of aperture.
+	defaultBaseDir = btcutil.AppDataDir("aperture", false)
+)
+
+// globalOptions are the options that apply to all commands.
+type globalOptions struct {
+	RPCServer string `long:"rpcserver" default:"localhost:8081" description:"The host:port of the aperture instance to connect to"`
+
+	BaseDir string `long:"basedir" description:"The base directory of aperture the TLS certificate and admin macaroon are read from"`
+
+	TLSCertPath string `long:"tlscertpath" description:"Path to aperture's TLS certificate. Defaults to tls.cert in the base directory. If the file doesn't exist, the certificate is verified against the system's root certificates"`
+
+	MacaroonPath string `long:"macaroonpath" description:"Path to the admin macaroon. Defaults to admin.macaroon in the base directory"`
+
+	Insecure bool `long:"insecure" description:"Connect without TLS to an aperture instance that listens on an insecure connection"`
+}
+
+// opts holds the parsed global options.
+var opts globalOptions
+
+func main() {
+	parser := flags.NewParser(&opts, flags.Default)
+	parser.Name = "aperturecli"
+	parser.ShortDescription = "Manage an aperture instance through its " +
+		"admin API"
+
+	commands := []struct {
+		name, short, long string
+		data              interface{}
+	}{{
+		name:  "revoketoken",
+		short: "Revoke L402s by their token ID or payment hash",
+		long: "Adds L402s to the revocation list by their token ID " +
+			"or payment hash. The proxy rejects revoked L402s " +
+			"immediately.",
+		data: &revokeTokenCommand{},
+	}, {
+		name:  "listrevokedtokens",
+		short: "List the revocation list of L402s",
+		long:  "Lists all entries of the revocation list of L402s.",
+		data:  &listRevokedTokensCommand{},
+	}, {
+		name:  "listtokens",
+		short: "List the issued L402s",
+		long: "Lists the issued L402s that match the given filter " +
+			"in the order they were issued.",
+		data: &listTokensCommand{},
+	}, {
+		name:  "gettoken",
+		short: "Look up an issued L402 by its token ID",
+		long:  "Shows the services, price and payment state of an L402.",
+		data:  &getTokenCommand{},
+	}, {
+		name:  "listrootkeys",
+		short: "List the root keys that wrap the secrets of L402s",
+		long: "Lists the versions of all root keys. The latest one " +
+			"wraps the secrets of newly issued L402s.",
+		data: &listRootKeysCommand{},
+	}, {
+		name:  "rotaterootkey",
+		short: "Create a new root key",
+		long: "Creates a new root key that wraps the secrets of " +
+			"newly issued L402s and wraps all stored secrets " +
+			"with it.",
+		data: &rotateRootKeyCommand{},
+	}, {
+		name:  "invalidaterootkeys",
+		short: "Invalidate all L402s issued before a root key version",
+		long: "Removes the secrets of all L402s that were issued " +
+			"before the root key of the given version was " +
+			"created, along with the older root keys. These " +
+			"L402s can no longer be used.",
+		data: &invalidateRootKeysCommand{},
+	}}
+	for _, cmd := range commands {
+		_, err := parser.AddCommand(
+			cmd.name, cmd.short, cmd.long, cmd.data,
+		)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	// The parser already prints any error, including the ones returned by
+	// the executed command.
+	if _, err := parser.Parse(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// getClient connects to the admin API of aperture. The returned cleanup
+// function closes the connection.
+func getClient() (adminrpc.AdminClient, func(), error) {
+	baseDir := opts.BaseDir
+	if baseDir == "" {
+		baseDir = defaultBaseDir
+	}
+
+	macaroonPath := opts.MacaroonPath
+	if macaroonPath == "" {
+		macaroonPath = filepath.Join(baseDir, defaultMacaroonFilename)
+	}
+	macBytes, err := os.ReadFile(macaroonPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read admin macaroon: "+
+			"%w", err)
+	}
+
+	transportCreds := insecure.NewCredentials()
+	if !opts.Insecure {
+		transportCreds, err = tlsCredentials(baseDir)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	conn, err := grpc.Dial(
+		opts.RPCServer, grpc.WithTransportCredentials(transportCreds),
+		grpc.WithPerRPCCredentials(&macaroonCredential{
+			macaroon:   hex.EncodeToString(macBytes),
+			requireTLS: !opts.Insecure,
+		}),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to connect to aperture: "+
+			"%w", err)
+	}
+
+	cleanup := func() {
+		_ = conn.Close()
+	}
+
+	return adminrpc.NewAdminClient(conn), cleanup, nil
+}
+
+// tlsCredentials returns the transport credentials that verify aperture's TLS
+// certificate. A self-signed certificate is read from disk, otherwise the
+// system's root certificates are used, for example if aperture obtains its
+// certificate through Let's Encrypt.
+func tlsCredentials(baseDir string) (credentials.TransportCredentials,
+	error) {
+
+	certPath := opts.TLSCertPath
+	if certPath == "" {
+		certPath = filepath.Join(baseDir, defaultTLSCertFilename)
+	}
+
+	if _, err := os.Stat(certPath); os.IsNotExist(err) &&
+		opts.TLSCertPath == "" {
+
+		return credentials.NewTLS(&tls.Config{}), nil
+	}
+
+	creds, err := credentials.NewClientTLSFromFile(certPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read TLS certificate: %w",
+			err)
+	}
+
+	return creds, nil
+}
+
+// macaroonCredential sends the hex encoded admin macaroon with each call.
+type macaroonCredential struct {
+	macaroon   string
+	requireTLS bool
+}
+
+// GetRequestMetadata returns the metadata that carries the admin macaroon.
+//
+// NOTE: This is part of the credentials.PerRPCCredentials interface.
+func (m *macaroonCredential) GetRequestMetadata(context.Context,
+	...string) (map[string]string, error) {
+
+	return map[string]string{macaroonMetadataKey: m.macaroon}, nil
+}
+
+// RequireTransportSecurity returns true if the macaroon may only be sent over
+// a TLS connection.
+//
+// NOTE: This is part of the credentials.PerRPCCredentials interface.
+func (m *macaroonCredential) RequireTransportSecurity() bool {
+	return m.requireTLS
+}
+
+// printResponse prints the given response as JSON.
+func printResponse(resp proto.Message) error {
+	jsonBytes, err := protojson.MarshalOptions{
+		Multiline:       true,
+		UseProtoNames:   true,
+		EmitUnpopulated: true,
+	}.Marshal(resp)
+	if err != nil {
+		return fmt.Errorf("unable to encode response: %w", err)
+	}
+
+	fmt.Println(string(jsonBytes))
+
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+)
+
+// revokeTokenCommand revokes L402s by their token ID or payment hash.
+type revokeTokenCommand struct {
+	TokenID string `long:"token_id" description:"The hex encoded token ID of the L402s to revoke"`
+
+	PaymentHash string `long:"payment_hash" description:"The hex encoded payment hash of the L402s to revoke"`
+
+	Reason string `long:"reason" description:"An optional reason the L402s are revoked for"`
+}
+
+// Execute revokes the L402s.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *revokeTokenCommand) Execute(_ []string) error {
+	if (c.TokenID == "") == (c.PaymentHash == "") {
+		return errors.New("exactly one of --token_id and " +
+			"--payment_hash must be set")
+	}
+
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.RevokeToken(
+		context.Background(), &adminrpc.RevokeTokenRequest{
+			TokenId:     c.TokenID,
+			PaymentHash: c.PaymentHash,
+			Reason:      c.Reason,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
+
+// listRevokedTokensCommand lists the revocation list of L402s.
+type listRevokedTokensCommand struct{}
+
+// Execute lists the revocation list.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *listRevokedTokensCommand) Execute(_ []string) error {
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.ListRevokedTokens(
+		context.Background(), &adminrpc.ListRevokedTokensRequest{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+)
+
+// listRootKeysCommand lists the root keys that wrap the secrets of L402s.
+type listRootKeysCommand struct{}
+
+// Execute lists the root keys.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *listRootKeysCommand) Execute(_ []string) error {
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.ListRootKeys(
+		context.Background(), &adminrpc.ListRootKeysRequest{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
+
+// rotateRootKeyCommand creates a new root key and wraps all stored secrets
+// with it.
+type rotateRootKeyCommand struct{}
+
+// Execute rotates the root key.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *rotateRootKeyCommand) Execute(_ []string) error {
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.RotateRootKey(
+		context.Background(), &adminrpc.RotateRootKeyRequest{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
+
+// invalidateRootKeysCommand invalidates all L402s that were issued before a
+// root key was created.
+type invalidateRootKeysCommand struct {
+	Version uint32 `long:"version" description:"Invalidate all L402s issued before the root key of this version was created"`
+}
+
+// Execute invalidates the root keys.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *invalidateRootKeysCommand) Execute(_ []string) error {
+	if c.Version == 0 {
+		return errors.New("--version must be set")
+	}
+
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.InvalidateRootKeys(
+		context.Background(), &adminrpc.InvalidateRootKeysRequest{
+			Version: c.Version,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+)
+
+// listTokensCommand lists the issued L402s.
+type listTokensCommand struct {
+	Service string `long:"service" description:"Only list the L402s issued for the service of the given name"`
+
+	PaymentHash string `long:"payment_hash" description:"Only list the L402s paid for with the invoice of the given hex encoded payment hash"`
+
+	State string `long:"state" choice:"settled" choice:"unsettled" description:"Only list the L402s that were settled or the ones that weren't"`
+
+	CreatedAfter int64 `long:"created_after" description:"Only list the L402s issued at or after the given unix timestamp"`
+
+	CreatedBefore int64 `long:"created_before" description:"Only list the L402s issued before the given unix timestamp"`
+
+	Offset uint32 `long:"offset" description:"The number of matching L402s to skip"`
+
+	Limit uint32 `long:"limit" default:"100" description:"The maximum number of L402s to list"`
+}
+
+// Execute lists the issued L402s.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *listTokensCommand) Execute(_ []string) error {
+	state := adminrpc.TokenState_TOKEN_STATE_ANY
+	switch c.State {
+	case "settled":
+		state = adminrpc.TokenState_TOKEN_STATE_SETTLED
+
+	case "unsettled":
+		state = adminrpc.TokenState_TOKEN_STATE_UNSETTLED
+	}
+
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.ListTokens(
+		context.Background(), &adminrpc.ListTokensRequest{
+			Service:       c.Service,
+			PaymentHash:   c.PaymentHash,
+			State:         state,
+			CreatedAfter:  c.CreatedAfter,
+			CreatedBefore: c.CreatedBefore,
+			Offset:        c.Offset,
+			Limit:         c.Limit,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
+
+// getTokenCommand looks up an issued L402 by its token ID.
+type getTokenCommand struct {
+	TokenID string `long:"token_id" description:"The hex encoded token ID of the L402"`
+}
+
+// Execute looks up the issued L402.
+//
+// NOTE: This is part of the flags.Commander interface.
+func (c *getTokenCommand) Execute(_ []string) error {
+	if c.TokenID == "" {
+		return errors.New("--token_id must be set")
+	}
+
+	client, cleanup, err := getClient()
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	resp, err := client.GetToken(
+		context.Background(), &adminrpc.GetTokenRequest{
+			TokenId: c.TokenID,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	return printResponse(resp)
+}
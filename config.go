@@ -8,6 +8,8 @@ import (
 
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/lightninglabs/aperture/aperturedb"
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/mint"
 	"github.com/lightninglabs/aperture/proxy"
 	"github.com/lightningnetwork/lnd/build"
 )
@@ -21,6 +23,7 @@ var (
 	defaultLogFilename      = "aperture.log"
 	defaultInvoiceBatchSize = 100000
 	defaultStrictVerify     = false
+	defaultInvoiceExpiry    = 24 * time.Hour
 
 	defaultSqliteDatabaseFileName = "aperture.db"
 
@@ -35,6 +38,17 @@ const (
 	defaultIdleTimeout  = time.Minute * 2
 	defaultReadTimeout  = time.Second * 15
 	defaultWriteTimeout = time.Second * 30
+
+	defaultSecretPruningInterval  = time.Hour
+	defaultSecretPruningRetention = time.Hour * 24
+	defaultDenylistRefresh        = time.Minute
+	defaultRevocationRefresh      = time.Second * 5
+
+	// The strategies L402s of bundles can be priced with.
+	bundlePricingBundle   = "bundle"
+	bundlePricingSum      = "sum"
+	bundlePricingMax      = "max"
+	bundlePricingDiscount = "discount"
 )
 
 type EtcdConfig struct {
@@ -136,6 +150,152 @@ type HashMailConfig struct {
 	StaleTimeout          time.Duration `long:"staletimeout" description:"The time after the last activity that a mailbox should be removed. Set to -1s to disable. "`
 }
 
+type AdminConfig struct {
+	Enabled      bool   `long:"enabled" description:"Whether to enable the admin gRPC and REST API for managing services at run time."`
+	MacaroonPath string `long:"macaroonpath" description:"The path the admin macaroon is written to. Defaults to admin.macaroon in the base directory."`
+}
+
+type SecretPruningConfig struct {
+	Enabled   bool          `long:"enabled" description:"Whether to periodically remove the secrets of L402s that can no longer be used."`
+	Interval  time.Duration `long:"interval" description:"The interval at which expired secrets are removed."`
+	Retention time.Duration `long:"retention" description:"How long the secrets of L402s are kept after their invoice expired unpaid or the L402 itself expired."`
+}
+
+func (s *SecretPruningConfig) validate() error {
+	if !s.Enabled {
+		return nil
+	}
+
+	if s.Interval <= 0 {
+		return errors.New("secret pruning interval must be greater " +
+			"than 0")
+	}
+
+	if s.Retention < 0 {
+		return errors.New("secret pruning retention must not be " +
+			"negative")
+	}
+
+	return nil
+}
+
+type StatelessSecretsConfig struct {
+	Enabled         bool          `long:"enabled" description:"Whether to derive the secrets of L402s from a root key instead of storing them, so that minting and verifying L402s doesn't require a database round trip."`
+	RootKeyPath     string        `long:"rootkeypath" description:"The path to the file that holds the hex encoded root key the secrets are derived from. It is created if it doesn't exist. All instances must share the same root key. Defaults to secrets.key in the base directory."`
+	DenylistRefresh time.Duration `long:"denylistrefresh" description:"How often the denylist of revoked secrets and the revocation list are reloaded from the database to pick up the revocations of other instances."`
+}
+
+func (s *StatelessSecretsConfig) validate() error {
+	if !s.Enabled {
+		return nil
+	}
+
+	if s.DenylistRefresh <= 0 {
+		return errors.New("denylist refresh must be greater than 0")
+	}
+
+	return nil
+}
+
+type BundlePricingConfig struct {
+	Strategy string `long:"strategy" description:"How the L402s of bundles are priced: bundle charges the configured price of the bundle or the price of its most expensive service if it has none, sum charges the sum of the prices of its services, max the price of its most expensive service and discount the sum of the prices of its services reduced by the discount." choice:"bundle" choice:"sum" choice:"max" choice:"discount"`
+	Discount uint8  `long:"discount" description:"The percentage discount on the sum of the prices of the services of a bundle with the discount strategy."`
+}
+
+func (b *BundlePricingConfig) validate() error {
+	switch b.Strategy {
+	case bundlePricingBundle, bundlePricingSum, bundlePricingMax:
+		if b.Discount != 0 {
+			return errors.New("bundle pricing discount can only " +
+				"be set with the discount strategy")
+		}
+
+	case bundlePricingDiscount:
+		if b.Discount == 0 || b.Discount >= 100 {
+			return errors.New("bundle pricing discount must be " +
+				"between 1 and 99")
+		}
+
+	default:
+		return fmt.Errorf("unknown bundle pricing strategy %s",
+			b.Strategy)
+	}
+
+	return nil
+}
+
+// pricingStrategy returns the strategy the mint prices new L402s with.
+func (b *BundlePricingConfig) pricingStrategy() mint.PricingStrategy {
+	switch b.Strategy {
+	case bundlePricingSum:
+		return mint.NewSumPricing()
+
+	case bundlePricingMax:
+		return mint.NewMaxPricing()
+
+	case bundlePricingDiscount:
+		return mint.NewDiscountPricing(mint.NewSumPricing(), b.Discount)
+
+	default:
+		return mint.DefaultPricing()
+	}
+}
+
+type L402CacheConfig struct {
+	Enabled bool          `long:"enabled" description:"Whether to cache L402s that were verified successfully, so that their secret doesn't have to be looked up and their invoice doesn't have to be checked on every request. Their caveats are still verified on every request."`
+	Size    int           `long:"size" description:"The maximum number of verified L402s that are cached."`
+	TTL     time.Duration `long:"ttl" description:"How long a verified L402 is cached. Cached L402s are still checked against the revocation list on every request."`
+
+	RootKeyRefresh time.Duration `long:"rootkeyrefresh" description:"How often the root keys are checked, so that invalidating root keys through another instance removes all cached L402s."`
+
+	RevocationRefresh time.Duration `long:"revocationrefresh" description:"How often the revocation list, which is kept in memory while the cache is enabled, is reloaded to pick up the revocations of other instances."`
+}
+
+func (l *L402CacheConfig) validate() error {
+	if !l.Enabled {
+		return nil
+	}
+
+	if l.Size <= 0 {
+		return errors.New("l402 cache size must be greater than 0")
+	}
+
+	if l.TTL <= 0 {
+		return errors.New("l402 cache ttl must be greater than 0")
+	}
+
+	if l.RootKeyRefresh <= 0 {
+		return errors.New("l402 cache root key refresh must be " +
+			"greater than 0")
+	}
+
+	if l.RevocationRefresh <= 0 {
+		return errors.New("l402 cache revocation refresh must be " +
+			"greater than 0")
+	}
+
+	return nil
+}
+
+type DBEncryptionConfig struct {
+	KeyFile       string `long:"keyfile" description:"The path to a file that contains the hex encoded 32 byte master key that sensitive values like root keys and private keys are encrypted with at rest."`
+	PassphraseEnv string `long:"passphraseenv" description:"The name of the environment variable that holds the passphrase the master key is derived from, as an alternative to a key file."`
+}
+
+func (d *DBEncryptionConfig) validate() error {
+	if d.KeyFile != "" && d.PassphraseEnv != "" {
+		return errors.New("only one of the db encryption key file " +
+			"and passphrase env can be set")
+	}
+
+	return nil
+}
+
+// enabled returns true if sensitive values should be encrypted at rest.
+func (d *DBEncryptionConfig) enabled() bool {
+	return d.KeyFile != "" || d.PassphraseEnv != ""
+}
+
 type TorConfig struct {
 	Control     string `long:"control" description:"The host:port of the Tor instance."`
 	ListenPort  uint16 `long:"listenport" description:"The port we should listen on for client requests over Tor. Note that this port should not be exposed to the outside world, it is only intended to be reached by clients through the onion service."`
@@ -189,10 +349,38 @@ type Config struct {
 	// each backend service to Aperture.
 	Services []*proxy.Service `long:"service" description:"Configurations for each Aperture backend service."`
 
+	// Bundles is a list of named sets of backend services that can be
+	// bought together with a single L402.
+	Bundles []*proxy.Bundle `long:"bundle" description:"Configurations for bundles of backend services that can be bought together with a single L402."`
+
+	// BundlePricing is the configuration section for pricing the L402s of
+	// bundles.
+	BundlePricing *BundlePricingConfig `group:"bundlepricing" namespace:"bundlepricing" description:"Configuration for pricing the L402s of bundles."`
+
 	// HashMail is the configuration section for configuring the Lightning
 	// Node Connect mailbox server.
 	HashMail *HashMailConfig `group:"hashmail" namespace:"hashmail" description:"Configuration for the Lightning Node Connect mailbox server."`
 
+	// Admin is the configuration section for the admin API that allows
+	// backend services to be managed at run time.
+	Admin *AdminConfig `group:"admin" namespace:"admin" description:"Configuration for the admin API."`
+
+	// SecretPruning is the configuration section for removing the secrets
+	// of L402s that can no longer be used.
+	SecretPruning *SecretPruningConfig `group:"secretpruning" namespace:"secretpruning" description:"Configuration for removing the secrets of expired L402s."`
+
+	// StatelessSecrets is the configuration section for deriving the
+	// secrets of L402s instead of storing them.
+	StatelessSecrets *StatelessSecretsConfig `group:"statelesssecrets" namespace:"statelesssecrets" description:"Configuration for deriving the secrets of L402s from a root key."`
+
+	// L402Cache is the configuration section for caching L402s that were
+	// verified successfully.
+	L402Cache *L402CacheConfig `group:"l402cache" namespace:"l402cache" description:"Configuration for caching verified L402s."`
+
+	// DBEncryption is the configuration section for encrypting sensitive
+	// values at rest.
+	DBEncryption *DBEncryptionConfig `group:"dbencryption" namespace:"dbencryption" description:"Configuration for encrypting root keys and private keys in the database."`
+
 	// Prometheus is the config for setting up an endpoint for a Prometheus
 	// server to scrape metrics from.
 	Prometheus *PrometheusConfig `group:"prometheus" namespace:"prometheus" description:"Configuration setting up an endpoint that a Prometheus server can scrape."`
@@ -225,6 +413,17 @@ type Config struct {
 	// request.
 	InvoiceBatchSize int `long:"invoicebatchsize" description:"The number of invoices to fetch in a single request."`
 
+	// FreebieResetWindow is the rolling window over which the free
+	// requests of a client are counted if the auth level of a service
+	// doesn't define its own window. It only applies to the postgres and
+	// sqlite database backends, which keep the counts across restarts. If
+	// it is zero, the free requests never leave the window.
+	FreebieResetWindow time.Duration `long:"freebieresetwindow" description:"The default rolling window over which the free requests of a client are counted when using the postgres or sqlite backend. Zero means they never leave the window."`
+
+	// InvoiceExpiry is the time after which the invoices of L402s expire
+	// if they aren't paid.
+	InvoiceExpiry time.Duration `long:"invoiceexpiry" description:"The time after which the invoices of L402s expire if they aren't paid."`
+
 	// StrictVerify is a flag that indicates whether we should verify the
 	// invoice status strictly or not. If set to true, then this requires
 	// all invoices to be read from disk at start up.
@@ -252,9 +451,67 @@ func (c *Config) validate() error {
 		return fmt.Errorf("invoice batch size must be greater than 0")
 	}
 
+	if c.FreebieResetWindow < 0 {
+		return fmt.Errorf("freebie reset window must not be negative")
+	}
+
+	if c.InvoiceExpiry <= 0 {
+		return fmt.Errorf("invoice expiry must be greater than 0")
+	}
+
+	if err := c.SecretPruning.validate(); err != nil {
+		return err
+	}
+
+	if err := c.StatelessSecrets.validate(); err != nil {
+		return err
+	}
+
+	// Derived secrets aren't stored, so there is nothing to prune.
+	if c.StatelessSecrets.Enabled && c.SecretPruning.Enabled {
+		return errors.New("secret pruning can't be enabled along " +
+			"with stateless secrets")
+	}
+
+	if err := c.BundlePricing.validate(); err != nil {
+		return err
+	}
+
+	if err := c.L402Cache.validate(); err != nil {
+		return err
+	}
+
+	if err := c.DBEncryption.validate(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// setDefaults gives the configuration sections that weren't set their
+// defaults, for example if the configuration was built by hand instead of with
+// NewConfig.
+func (c *Config) setDefaults() {
+	if c.Admin == nil {
+		c.Admin = &AdminConfig{}
+	}
+	if c.SecretPruning == nil {
+		c.SecretPruning = DefaultSecretPruningConfig()
+	}
+	if c.DBEncryption == nil {
+		c.DBEncryption = &DBEncryptionConfig{}
+	}
+	if c.StatelessSecrets == nil {
+		c.StatelessSecrets = DefaultStatelessSecretsConfig()
+	}
+	if c.L402Cache == nil {
+		c.L402Cache = DefaultL402CacheConfig()
+	}
+	if c.BundlePricing == nil {
+		c.BundlePricing = DefaultBundlePricingConfig()
+	}
+}
+
 // DefaultSqliteConfig returns the default configuration for a sqlite backend.
 func DefaultSqliteConfig() *aperturedb.SqliteConfig {
 	return &aperturedb.SqliteConfig{
@@ -263,6 +520,42 @@ func DefaultSqliteConfig() *aperturedb.SqliteConfig {
 	}
 }
 
+// DefaultSecretPruningConfig returns the default configuration for pruning
+// the secrets of expired L402s.
+func DefaultSecretPruningConfig() *SecretPruningConfig {
+	return &SecretPruningConfig{
+		Interval:  defaultSecretPruningInterval,
+		Retention: defaultSecretPruningRetention,
+	}
+}
+
+// DefaultStatelessSecretsConfig returns the default configuration for deriving
+// the secrets of L402s.
+func DefaultStatelessSecretsConfig() *StatelessSecretsConfig {
+	return &StatelessSecretsConfig{
+		DenylistRefresh: defaultDenylistRefresh,
+	}
+}
+
+// DefaultBundlePricingConfig returns the default configuration for pricing the
+// L402s of bundles.
+func DefaultBundlePricingConfig() *BundlePricingConfig {
+	return &BundlePricingConfig{
+		Strategy: bundlePricingBundle,
+	}
+}
+
+// DefaultL402CacheConfig returns the default configuration for caching
+// verified L402s.
+func DefaultL402CacheConfig() *L402CacheConfig {
+	return &L402CacheConfig{
+		Size:              auth.DefaultVerificationCacheSize,
+		TTL:               auth.DefaultVerificationCacheTTL,
+		RootKeyRefresh:    auth.DefaultRootKeyRefresh,
+		RevocationRefresh: defaultRevocationRefresh,
+	}
+}
+
 // NewConfig initializes a new Config variable.
 func NewConfig() *Config {
 	return &Config{
@@ -273,11 +566,18 @@ func NewConfig() *Config {
 		Authenticator:    &AuthConfig{},
 		Tor:              &TorConfig{},
 		HashMail:         &HashMailConfig{},
+		Admin:            &AdminConfig{},
+		SecretPruning:    DefaultSecretPruningConfig(),
+		StatelessSecrets: DefaultStatelessSecretsConfig(),
+		L402Cache:        DefaultL402CacheConfig(),
+		BundlePricing:    DefaultBundlePricingConfig(),
+		DBEncryption:     &DBEncryptionConfig{},
 		Prometheus:       &PrometheusConfig{},
 		IdleTimeout:      defaultIdleTimeout,
 		ReadTimeout:      defaultReadTimeout,
 		WriteTimeout:     defaultWriteTimeout,
 		InvoiceBatchSize: defaultInvoiceBatchSize,
+		InvoiceExpiry:    defaultInvoiceExpiry,
 		Logging:          build.DefaultLogConfig(),
 		Blocklist:        []string{},
 		StrictVerify:     defaultStrictVerify,
@@ -0,0 +1,88 @@
+package aperture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lightninglabs/aperture/aperturedb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// dataKeyDir is the key we'll use to store the data key that encrypts
+	// sensitive values at rest.
+	dataKeyDir = "datakey"
+)
+
+// dataKeyPath is the full path to the data key.
+//
+// The resulting path within etcd would look like:
+// lsat/proxy/datakey
+var dataKeyPath = strings.Join(
+	[]string{topLevelKey, dataKeyDir}, etcdKeyDelimeter,
+)
+
+// dataKeyStore is an etcd-based implementation of aperturedb.DataKeyStore.
+type dataKeyStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure dataKeyStore implements
+// aperturedb.DataKeyStore.
+var _ aperturedb.DataKeyStore = (*dataKeyStore)(nil)
+
+// newDataKeyStore creates an etcd-based implementation of
+// aperturedb.DataKeyStore.
+func newDataKeyStore(client *clientv3.Client) *dataKeyStore {
+	return &dataKeyStore{Client: client}
+}
+
+// DataKey returns the stored data key.
+//
+// NOTE: This is part of the aperturedb.DataKeyStore interface.
+func (s *dataKeyStore) DataKey(
+	ctx context.Context) (*aperturedb.EncryptedDataKey, error) {
+
+	resp, err := s.Get(ctx, dataKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, aperturedb.ErrDataKeyNotFound
+	}
+
+	var key aperturedb.EncryptedDataKey
+	if err := json.Unmarshal(resp.Kvs[0].Value, &key); err != nil {
+		return nil, fmt.Errorf("unable to decode data key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// AddDataKey stores the given data key unless there is one already.
+//
+// NOTE: This is part of the aperturedb.DataKeyStore interface.
+func (s *dataKeyStore) AddDataKey(ctx context.Context,
+	key *aperturedb.EncryptedDataKey) error {
+
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	txnResp, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(dataKeyPath), "=", 0),
+	).Then(
+		clientv3.OpPut(dataKeyPath, string(value)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return aperturedb.ErrDataKeyExists
+	}
+
+	return nil
+}
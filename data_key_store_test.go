@@ -0,0 +1,73 @@
+package aperture
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/lightninglabs/aperture/aperturedb"
+	"github.com/stretchr/testify/require"
+)
+
+// TestDataKeyStore ensures the data key is only stored once and that the root
+// keys and the onion private key are stored encrypted with it.
+func TestDataKeyStore(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	dataKeys := newDataKeyStore(etcdClient)
+
+	_, err := dataKeys.DataKey(ctx)
+	require.ErrorIs(t, err, aperturedb.ErrDataKeyNotFound)
+
+	masterKey := aperturedb.MasterKeyFromPassphrase([]byte("passphrase"))
+	encrypter, err := aperturedb.NewEncrypter(ctx, dataKeys, masterKey)
+	require.NoError(t, err)
+
+	dataKey, err := dataKeys.DataKey(ctx)
+	require.NoError(t, err)
+	require.ErrorIs(
+		t, dataKeys.AddDataKey(ctx, dataKey),
+		aperturedb.ErrDataKeyExists,
+	)
+
+	// The same data key is used when the encrypter is loaded again, but
+	// only with the right passphrase.
+	_, err = aperturedb.NewEncrypter(ctx, dataKeys, masterKey)
+	require.NoError(t, err)
+
+	_, err = aperturedb.NewEncrypter(
+		ctx, dataKeys,
+		aperturedb.MasterKeyFromPassphrase([]byte("wrong")),
+	)
+	require.Error(t, err)
+
+	// Root keys are stored encrypted and can't be read without the data
+	// key.
+	secrets := newSecretStore(etcdClient, encrypter)
+	hash := [sha256.Size]byte{1}
+	secret, err := secrets.NewSecret(ctx, hash)
+	require.NoError(t, err)
+
+	storedSecret, err := secrets.GetSecret(ctx, hash)
+	require.NoError(t, err)
+	require.Equal(t, secret, storedSecret)
+
+	_, err = newSecretStore(etcdClient, nil).GetSecret(ctx, hash)
+	require.ErrorIs(t, err, aperturedb.ErrEncryptionKeyRequired)
+
+	// The onion private key is stored encrypted as well.
+	onion := newOnionStore(etcdClient, encrypter)
+	privateKey := []byte("hide_me_plz")
+	require.NoError(t, onion.StorePrivateKey(privateKey))
+
+	storedKey, err := onion.PrivateKey()
+	require.NoError(t, err)
+	require.Equal(t, privateKey, storedKey)
+
+	resp, err := etcdClient.Get(ctx, onionPath)
+	require.NoError(t, err)
+	require.NotContains(t, string(resp.Kvs[0].Value), string(privateKey))
+}
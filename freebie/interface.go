@@ -3,13 +3,75 @@ package freebie
 import (
 	"net"
 	"net/http"
+	"time"
 )
 
+// Quota describes how many free requests a client has left.
+type Quota struct {
+	// Limit is the number of free requests a client can make per window.
+	Limit Count
+
+	// Remaining is the number of free requests the client has left in
+	// the current window.
+	Remaining Count
+
+	// Window is the duration of the rolling window over which the free
+	// requests of a client are counted. Each free request is freed up
+	// again once the window has passed since it was made. If it is zero,
+	// the free requests are never freed up.
+	Window time.Duration
+
+	// Reset is the time at which the oldest free request of the client
+	// leaves the window, freeing up another free request. It is zero if
+	// there is no window or if the client didn't make any free requests
+	// within it.
+	Reset time.Time
+}
+
 // DB is the main interface of the package freebie. It represents a store that
-// keeps track of how many free requests a certain IP address can make to a
-// certain resource.
+// keeps track of how many free requests a certain client can make to a certain
+// resource. Clients are identified by their IP address unless the store uses a
+// different key strategy.
 type DB interface {
-	CanPass(*http.Request, net.IP) (bool, error)
+	// CanPass returns whether the client can make another free request
+	// and its current quota.
+	CanPass(*http.Request, net.IP) (bool, Quota, error)
+
+	// TallyFreebie counts a free request of the client if it hasn't used
+	// up its free requests yet. Checking and counting happen atomically,
+	// so concurrent requests can't exceed the limit. It returns whether
+	// the request was counted and the quota of the client after it.
+	TallyFreebie(*http.Request, net.IP) (bool, Quota, error)
+}
+
+// Store is a backend that creates the freebie databases of the individual
+// backend services. All databases created for the same service share their
+// counts.
+type Store interface {
+	// ServiceDB returns the freebie database of the service with the given
+	// name that allows numFreebies free requests per client and window.
+	// If window is zero, the default window of the store is used. Clients
+	// are identified by the given key strategy, or by their masked IP
+	// address if it is nil.
+	ServiceDB(serviceName string, numFreebies Count,
+		window time.Duration, key *KeyStrategy) DB
+}
+
+// NewQuota returns the quota of a client that made the given number of free
+// requests within the window, the oldest of which at the given time.
+func NewQuota(limit Count, used int64, window time.Duration,
+	oldest time.Time) Quota {
+
+	quota := Quota{
+		Limit:  limit,
+		Window: window,
+	}
+	if used < int64(limit) {
+		quota.Remaining = limit - Count(used)
+	}
+	if window > 0 && !oldest.IsZero() {
+		quota.Reset = oldest.Add(window)
+	}
 
-	TallyFreebie(*http.Request, net.IP) (bool, error)
+	return quota
 }
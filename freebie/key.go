@@ -0,0 +1,129 @@
+package freebie
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/lightninglabs/aperture/netutil"
+)
+
+const (
+	// KeyIP identifies clients by their masked IP address.
+	KeyIP = "ip"
+
+	// KeyHeader identifies clients by the value of a request header.
+	KeyHeader = "header"
+
+	// KeyCookie identifies clients by the value of a cookie.
+	KeyCookie = "cookie"
+
+	// KeyPath identifies clients by the first capture group of a regular
+	// expression that is matched against the URL path.
+	KeyPath = "path"
+)
+
+// KeyStrategy decides which key the free requests of a client are counted
+// under.
+type KeyStrategy struct {
+	// kind is the kind of the strategy, one of the Key* constants.
+	kind string
+
+	// name is the name of the header or cookie for the header and cookie
+	// strategies.
+	name string
+
+	// pathRegexp is the regular expression of the path strategy.
+	pathRegexp *regexp.Regexp
+}
+
+// ParseKeyStrategy parses a freebie key strategy. Valid values are "ip",
+// "header:<name>", "cookie:<name>" and "path:<regexp>", where the regular
+// expression must contain a capture group. An empty value results in the IP
+// strategy.
+func ParseKeyStrategy(strategy string) (*KeyStrategy, error) {
+	kind, param, _ := strings.Cut(strategy, ":")
+	kind = strings.ToLower(strings.TrimSpace(kind))
+
+	switch kind {
+	case "", KeyIP:
+		if param != "" {
+			return nil, fmt.Errorf("freebie key strategy %s takes "+
+				"no parameter", KeyIP)
+		}
+
+		return &KeyStrategy{kind: KeyIP}, nil
+
+	case KeyHeader, KeyCookie:
+		if param == "" {
+			return nil, fmt.Errorf("freebie key strategy %s "+
+				"requires a name", kind)
+		}
+
+		return &KeyStrategy{kind: kind, name: param}, nil
+
+	case KeyPath:
+		pathRegexp, err := regexp.Compile(param)
+		if err != nil {
+			return nil, fmt.Errorf("invalid freebie key path "+
+				"regexp: %w", err)
+		}
+		if pathRegexp.NumSubexp() == 0 {
+			return nil, fmt.Errorf("freebie key path regexp %s "+
+				"must contain a capture group", param)
+		}
+
+		return &KeyStrategy{kind: kind, pathRegexp: pathRegexp}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown freebie key strategy: %s",
+			strategy)
+	}
+}
+
+// Key returns the key the free requests of the client that sent the given
+// request are counted under. If the request doesn't contain the value the
+// strategy is looking for, the masked IP address of the client is used. Values
+// taken from the request are hashed, so secrets like API keys are never
+// stored.
+func (k *KeyStrategy) Key(r *http.Request, ip net.IP) string {
+	if k == nil {
+		return IPKey(ip)
+	}
+
+	var value string
+	switch k.kind {
+	case KeyHeader:
+		value = r.Header.Get(k.name)
+
+	case KeyCookie:
+		if cookie, err := r.Cookie(k.name); err == nil {
+			value = cookie.Value
+		}
+
+	case KeyPath:
+		matches := k.pathRegexp.FindStringSubmatch(r.URL.Path)
+		if len(matches) > 1 {
+			value = matches[1]
+		}
+	}
+
+	if value == "" {
+		return IPKey(ip)
+	}
+
+	hash := sha256.Sum256([]byte(value))
+	return k.kind + ":" + hex.EncodeToString(hash[:])
+}
+
+// IPKey returns the key the free requests of the given IP address are counted
+// under. IPv4 addresses are masked to /24 and IPv6 addresses to /48. This
+// reduces risk of abuse by users that have a whole range of IPs at their
+// disposal.
+func IPKey(ip net.IP) string {
+	return netutil.MaskIP(ip).String()
+}
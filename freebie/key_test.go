@@ -0,0 +1,105 @@
+package freebie
+
+import (
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestKeyStrategy tests that the different key strategies derive the expected
+// keys from a request.
+func TestKeyStrategy(t *testing.T) {
+	ip := net.ParseIP("1.2.3.4")
+	ipKey := "1.2.3.0"
+
+	newRequest := func(path string) *http.Request {
+		req, err := http.NewRequest("GET", path, nil)
+		require.NoError(t, err)
+
+		return req
+	}
+
+	withHeader := newRequest("/")
+	withHeader.Header.Set("X-Install-Id", "install-1")
+
+	withCookie := newRequest("/")
+	withCookie.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+
+	testCases := []struct {
+		name     string
+		strategy string
+		req      *http.Request
+		key      string
+		hashed   bool
+	}{{
+		name: "default",
+		req:  withHeader,
+		key:  ipKey,
+	}, {
+		name:     "ip",
+		strategy: "ip",
+		req:      withHeader,
+		key:      ipKey,
+	}, {
+		name:     "header",
+		strategy: "header:X-Install-Id",
+		req:      withHeader,
+		hashed:   true,
+	}, {
+		name:     "missing header",
+		strategy: "header:X-Install-Id",
+		req:      withCookie,
+		key:      ipKey,
+	}, {
+		name:     "cookie",
+		strategy: "cookie:session",
+		req:      withCookie,
+		hashed:   true,
+	}, {
+		name:     "path",
+		strategy: "path:^/apps/([^/]+)/",
+		req:      newRequest("/apps/foo/bar"),
+		hashed:   true,
+	}, {
+		name:     "path without match",
+		strategy: "path:^/apps/([^/]+)/",
+		req:      newRequest("/other"),
+		key:      ipKey,
+	}}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			strategy, err := ParseKeyStrategy(tc.strategy)
+			require.NoError(t, err)
+
+			key := strategy.Key(tc.req, ip)
+			if !tc.hashed {
+				require.Equal(t, tc.key, key)
+				return
+			}
+
+			require.NotEqual(t, ipKey, key)
+
+			// The same value must always result in the same key.
+			require.Equal(t, key, strategy.Key(tc.req, ip))
+		})
+	}
+
+	// Different values must result in different keys.
+	strategy, err := ParseKeyStrategy("path:^/apps/([^/]+)/")
+	require.NoError(t, err)
+	require.NotEqual(
+		t, strategy.Key(newRequest("/apps/foo/"), ip),
+		strategy.Key(newRequest("/apps/bar/"), ip),
+	)
+
+	// Invalid strategies are rejected.
+	for _, invalid := range []string{
+		"ip:foo", "header", "cookie:", "path:^/apps/", "path:(", "mac",
+	} {
+		_, err := ParseKeyStrategy(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -3,46 +3,107 @@ package freebie
 import (
 	"net"
 	"net/http"
-
-	"github.com/lightninglabs/aperture/netutil"
+	"sync"
+	"time"
 )
 
 type Count uint16
 
 type memStore struct {
-	numFreebies    Count
-	freebieCounter map[string]Count
+	numFreebies Count
+	window      time.Duration
+	key         *KeyStrategy
+	now         func() time.Time
+
+	// mu guards freebieRequests as requests are served concurrently.
+	mu sync.Mutex
+
+	// freebieRequests holds the times of the free requests of each client
+	// that are still within the window, oldest first.
+	freebieRequests map[string][]time.Time
 }
 
-func (m *memStore) getKey(ip net.IP) string {
-	return netutil.MaskIP(ip).String()
+// currentRequests returns the free requests of the given key that are still
+// within the window and forgets about the ones that left it.
+func (m *memStore) currentRequests(key string) []time.Time {
+	requests := m.freebieRequests[key]
+	if m.window == 0 {
+		return requests
+	}
+
+	now := m.now()
+	expired := 0
+	for expired < len(requests) &&
+		!now.Before(requests[expired].Add(m.window)) {
+
+		expired++
+	}
+	requests = requests[expired:]
+
+	if len(requests) == 0 {
+		delete(m.freebieRequests, key)
+	} else {
+		m.freebieRequests[key] = requests
+	}
+
+	return requests
 }
 
-func (m *memStore) currentCount(ip net.IP) Count {
-	counter, ok := m.freebieCounter[m.getKey(ip)]
-	if !ok {
-		return 0
+func (m *memStore) quota(requests []time.Time) Quota {
+	var oldest time.Time
+	if len(requests) > 0 {
+		oldest = requests[0]
 	}
-	return counter
+
+	return NewQuota(m.numFreebies, int64(len(requests)), m.window, oldest)
 }
 
-func (m *memStore) CanPass(r *http.Request, ip net.IP) (bool, error) {
-	return m.currentCount(ip) < m.numFreebies, nil
+func (m *memStore) CanPass(r *http.Request, ip net.IP) (bool, Quota, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	requests := m.currentRequests(m.key.Key(r, ip))
+	return len(requests) < int(m.numFreebies), m.quota(requests), nil
 }
 
-func (m *memStore) TallyFreebie(r *http.Request, ip net.IP) (bool, error) {
-	counter := m.currentCount(ip) + 1
-	m.freebieCounter[m.getKey(ip)] = counter
-	return true, nil
+func (m *memStore) TallyFreebie(r *http.Request, ip net.IP) (bool, Quota,
+	error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := m.key.Key(r, ip)
+	requests := m.currentRequests(key)
+	if len(requests) >= int(m.numFreebies) {
+		return false, m.quota(requests), nil
+	}
+	requests = append(requests, m.now())
+	m.freebieRequests[key] = requests
+	return true, m.quota(requests), nil
 }
 
 // NewMemIPMaskStore creates a new in-memory freebie store that masks IP
 // addresses to keep track of free requests. IPv4 addresses are masked to /24
 // and IPv6 addresses to /48. This reduces risk of abuse by users that have a
-// whole range of IPs at their disposal.
-func NewMemIPMaskStore(numFreebies Count) DB {
+// whole range of IPs at their disposal. The free requests of a client are
+// counted over a rolling window: each of them is freed up again once the given
+// window has passed since it was made. If the window is zero, they are never
+// freed up.
+func NewMemIPMaskStore(numFreebies Count, window time.Duration) DB {
+	return NewMemStore(numFreebies, window, nil)
+}
+
+// NewMemStore creates a new in-memory freebie store that counts the free
+// requests of the clients under the keys derived by the given strategy. If the
+// strategy is nil, clients are identified by their masked IP address.
+func NewMemStore(numFreebies Count, window time.Duration,
+	key *KeyStrategy) DB {
+
 	return &memStore{
-		numFreebies:    numFreebies,
-		freebieCounter: make(map[string]Count),
+		numFreebies:     numFreebies,
+		window:          window,
+		key:             key,
+		now:             time.Now,
+		freebieRequests: make(map[string][]time.Time),
 	}
 }
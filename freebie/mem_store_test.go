@@ -0,0 +1,92 @@
+package freebie
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestMemStoreWindow tests that the free requests of a client are counted over
+// the rolling window of the in-memory store.
+func TestMemStoreWindow(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	db := NewMemIPMaskStore(2, time.Hour).(*memStore)
+	db.now = func() time.Time {
+		return now
+	}
+
+	req, err := http.NewRequest("GET", "/", nil)
+	require.NoError(t, err)
+	ip := net.ParseIP("1.2.3.4")
+
+	ok, quota, err := db.CanPass(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Quota{
+		Limit:     2,
+		Remaining: 2,
+		Window:    time.Hour,
+	}, quota)
+
+	// The free request is counted until the window has passed since it
+	// was made.
+	ok, quota, err = db.TallyFreebie(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Quota{
+		Limit:     2,
+		Remaining: 1,
+		Window:    time.Hour,
+		Reset:     now.Add(time.Hour),
+	}, quota)
+
+	now = now.Add(30 * time.Minute)
+	ok, quota, err = db.TallyFreebie(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Zero(t, quota.Remaining)
+
+	ok, _, err = db.CanPass(req, ip)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Requests beyond the limit are not counted.
+	ok, quota, err = db.TallyFreebie(req, ip)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Zero(t, quota.Remaining)
+
+	// Once the window has passed since the first free request, only that
+	// one is freed up again.
+	now = now.Add(30 * time.Minute)
+	ok, quota, err = db.CanPass(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Quota{
+		Limit:     2,
+		Remaining: 1,
+		Window:    time.Hour,
+		Reset:     now.Add(30 * time.Minute),
+	}, quota)
+
+	ok, quota, err = db.TallyFreebie(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Zero(t, quota.Remaining)
+	require.Equal(t, now.Add(30*time.Minute), quota.Reset)
+
+	// Once the window has passed since all free requests, the client has
+	// all of them again.
+	now = now.Add(time.Hour)
+	ok, quota, err = db.CanPass(req, ip)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, Quota{
+		Limit:     2,
+		Remaining: 2,
+		Window:    time.Hour,
+	}, quota)
+}
@@ -140,3 +140,27 @@ func VerifyCaveats(caveats []Caveat, satisfiers ...Satisfier) error {
 
 	return nil
 }
+
+// VerifyCapability determines whether the caveats of an L402 authorize the
+// target capability of a service. Unlike VerifyCaveats, which ignores caveats
+// that are not present, an L402 without a capabilities caveat for the service
+// is rejected, as it was never granted any capability.
+func VerifyCapability(caveats []Caveat, service, capability string) error {
+	condition := service + CondCapabilitiesSuffix
+
+	var found bool
+	for _, caveat := range caveats {
+		if caveat.Condition == condition {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("target capability %v not authorized",
+			capability)
+	}
+
+	return VerifyCaveats(
+		caveats, NewCapabilitiesSatisfier(service, capability),
+	)
+}
@@ -198,3 +198,65 @@ func TestVerifyCaveats(t *testing.T) {
 		}
 	}
 }
+
+// TestVerifyCapability ensures that an L402 must explicitly grant a capability
+// for it to be authorized.
+func TestVerifyCapability(t *testing.T) {
+	t.Parallel()
+
+	condition := "svc" + CondCapabilitiesSuffix
+
+	tests := []struct {
+		name       string
+		caveats    []Caveat
+		shouldFail bool
+	}{
+		{
+			name:       "no capabilities caveat",
+			caveats:    nil,
+			shouldFail: true,
+		},
+		{
+			name: "other service",
+			caveats: []Caveat{
+				NewCaveat("other"+CondCapabilitiesSuffix, "a"),
+			},
+			shouldFail: true,
+		},
+		{
+			name:       "capability missing",
+			caveats:    []Caveat{NewCaveat(condition, "b,c")},
+			shouldFail: true,
+		},
+		{
+			name:       "capability granted",
+			caveats:    []Caveat{NewCaveat(condition, "a,b")},
+			shouldFail: false,
+		},
+		{
+			name: "capability removed",
+			caveats: []Caveat{
+				NewCaveat(condition, "a,b"),
+				NewCaveat(condition, "b"),
+			},
+			shouldFail: true,
+		},
+	}
+
+	for _, test := range tests {
+		success := t.Run(test.name, func(t *testing.T) {
+			err := VerifyCapability(test.caveats, "svc", "a")
+			if test.shouldFail && err == nil {
+				t.Fatal("expected capability verification " +
+					"to fail")
+			}
+			if !test.shouldFail && err != nil {
+				t.Fatalf("unexpected capability verification "+
+					"failure: %v", err)
+			}
+		})
+		if !success {
+			return
+		}
+	}
+}
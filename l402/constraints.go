@@ -0,0 +1,343 @@
+package l402
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// CondMaxBodySize is the condition of the constraint that limits the
+	// size in bytes of the body of requests made with an L402. Requests
+	// with a body of unknown size are rejected.
+	CondMaxBodySize = "max_body_size"
+
+	// CondAllowedMethods is the condition of the constraint that restricts
+	// the HTTP methods of requests made with an L402 to a comma-separated
+	// list.
+	CondAllowedMethods = "allowed_methods"
+
+	// CondIPAllowlist is the condition of the constraint that restricts
+	// the remote addresses of requests made with an L402 to a
+	// comma-separated list of IP addresses and CIDR prefixes.
+	CondIPAllowlist = "ip_allowlist"
+)
+
+var (
+	// ErrUnknownRequest is returned by request constraints if the request
+	// an L402 is used for is unknown.
+	ErrUnknownRequest = errors.New("request unknown")
+)
+
+// ConstraintSatisfier returns the satisfier of a constraint for the request an
+// L402 is used for. The request is nil if it is unknown, in which case the
+// satisfier should reject any constraint that depends on it.
+type ConstraintSatisfier func(r *http.Request) Satisfier
+
+// ConstraintRegistry holds the satisfiers of the constraints of services,
+// keyed by their condition. Constraint caveats without a registered satisfier
+// are not enforced.
+type ConstraintRegistry struct {
+	mu         sync.RWMutex
+	satisfiers map[string]ConstraintSatisfier
+}
+
+// NewConstraintRegistry creates a new registry that contains the satisfiers of
+// the built-in constraints.
+func NewConstraintRegistry() *ConstraintRegistry {
+	return &ConstraintRegistry{
+		satisfiers: map[string]ConstraintSatisfier{
+			CondMaxBodySize:    NewMaxBodySizeSatisfier,
+			CondAllowedMethods: NewAllowedMethodsSatisfier,
+			CondIPAllowlist:    NewIPAllowlistSatisfier,
+		},
+	}
+}
+
+// Register adds the satisfier of the constraint with the given condition. It
+// fails if a satisfier for the condition is already registered or the
+// condition is reserved for the restrictions aperture adds itself.
+func (c *ConstraintRegistry) Register(condition string,
+	satisfier ConstraintSatisfier) error {
+
+	switch {
+	case condition == "":
+		return errors.New("constraint condition must be set")
+
+	case IsReservedCondition(condition):
+		return fmt.Errorf("constraint condition %s is reserved",
+			condition)
+
+	case satisfier == nil:
+		return fmt.Errorf("satisfier of constraint %s must be set",
+			condition)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.satisfiers[condition]; ok {
+		return fmt.Errorf("satisfier of constraint %s already "+
+			"registered", condition)
+	}
+	c.satisfiers[condition] = satisfier
+
+	return nil
+}
+
+// RegisterSatisfier adds a satisfier that doesn't depend on the request an
+// L402 is used for. Its condition is the condition of the constraint.
+func (c *ConstraintRegistry) RegisterSatisfier(satisfier Satisfier) error {
+	if satisfier.SatisfyFinal == nil {
+		return fmt.Errorf("satisfier of constraint %s must satisfy "+
+			"the final caveat", satisfier.Condition)
+	}
+
+	return c.Register(satisfier.Condition, func(*http.Request) Satisfier {
+		return satisfier
+	})
+}
+
+// Satisfiers returns the satisfiers of all registered constraints for the
+// given request. Satisfiers without SatisfyPrevious accept caveats of their
+// condition in any order, so only the final caveat is satisfied.
+func (c *ConstraintRegistry) Satisfiers(r *http.Request) []Satisfier {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	satisfiers := make([]Satisfier, 0, len(c.satisfiers))
+	for condition, newSatisfier := range c.satisfiers {
+		satisfier := newSatisfier(r)
+
+		// Make sure a satisfier can't be applied to a different
+		// condition than it was registered for.
+		satisfier.Condition = condition
+
+		if satisfier.SatisfyPrevious == nil {
+			satisfier.SatisfyPrevious = func(_, _ Caveat) error {
+				return nil
+			}
+		}
+
+		satisfiers = append(satisfiers, satisfier)
+	}
+
+	return satisfiers
+}
+
+// NewMaxBodySizeSatisfier implements a satisfier that limits the size of the
+// request body to the number of bytes in the caveat. Each subsequent caveat
+// can only lower the limit.
+func NewMaxBodySizeSatisfier(r *http.Request) Satisfier {
+	return Satisfier{
+		Condition: CondMaxBodySize,
+		SatisfyPrevious: func(prev, cur Caveat) error {
+			prevSize, err := parseBodySize(prev.Value)
+			if err != nil {
+				return err
+			}
+			curSize, err := parseBodySize(cur.Value)
+			if err != nil {
+				return err
+			}
+
+			if curSize > prevSize {
+				return fmt.Errorf("%s caveat violates "+
+					"increasing restrictiveness",
+					CondMaxBodySize)
+			}
+
+			return nil
+		},
+		SatisfyFinal: func(c Caveat) error {
+			maxSize, err := parseBodySize(c.Value)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case r == nil:
+				return ErrUnknownRequest
+
+			case r.ContentLength < 0:
+				return errors.New("request body of unknown " +
+					"size not allowed")
+
+			case r.ContentLength > maxSize:
+				return fmt.Errorf("request body of %d bytes "+
+					"exceeds maximum of %d bytes",
+					r.ContentLength, maxSize)
+			}
+
+			return nil
+		},
+	}
+}
+
+// parseBodySize parses the value of a max_body_size caveat.
+func parseBodySize(value string) (int64, error) {
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s caveat value: %w",
+			CondMaxBodySize, err)
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("negative %s caveat value",
+			CondMaxBodySize)
+	}
+
+	return size, nil
+}
+
+// NewAllowedMethodsSatisfier implements a satisfier that restricts the HTTP
+// method of the request to the comma-separated list of methods in the caveat.
+// Each subsequent caveat can only remove methods from the list.
+func NewAllowedMethodsSatisfier(r *http.Request) Satisfier {
+	return Satisfier{
+		Condition: CondAllowedMethods,
+		SatisfyPrevious: func(prev, cur Caveat) error {
+			allowed := make(map[string]struct{})
+			for _, method := range splitList(prev.Value) {
+				allowed[strings.ToUpper(method)] = struct{}{}
+			}
+
+			for _, method := range splitList(cur.Value) {
+				method = strings.ToUpper(method)
+				if _, ok := allowed[method]; !ok {
+					return fmt.Errorf("method %v not "+
+						"previously allowed", method)
+				}
+			}
+
+			return nil
+		},
+		SatisfyFinal: func(c Caveat) error {
+			if r == nil {
+				return ErrUnknownRequest
+			}
+
+			for _, method := range splitList(c.Value) {
+				if strings.EqualFold(method, r.Method) {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("method %v not allowed", r.Method)
+		},
+	}
+}
+
+// NewIPAllowlistSatisfier implements a satisfier that restricts the remote
+// address of the request to the comma-separated list of IP addresses and CIDR
+// prefixes in the caveat. Each subsequent caveat can only narrow down the
+// prefixes of the previous one.
+func NewIPAllowlistSatisfier(r *http.Request) Satisfier {
+	return Satisfier{
+		Condition: CondIPAllowlist,
+		SatisfyPrevious: func(prev, cur Caveat) error {
+			prevPrefixes, err := parsePrefixes(prev.Value)
+			if err != nil {
+				return err
+			}
+			curPrefixes, err := parsePrefixes(cur.Value)
+			if err != nil {
+				return err
+			}
+
+			for _, prefix := range curPrefixes {
+				if !containsPrefix(prevPrefixes, prefix) {
+					return fmt.Errorf("prefix %v not "+
+						"previously allowed", prefix)
+				}
+			}
+
+			return nil
+		},
+		SatisfyFinal: func(c Caveat) error {
+			prefixes, err := parsePrefixes(c.Value)
+			if err != nil {
+				return err
+			}
+			if r == nil {
+				return ErrUnknownRequest
+			}
+
+			host, _, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			addr, err := netip.ParseAddr(host)
+			if err != nil {
+				return fmt.Errorf("invalid remote address %v: "+
+					"%w", r.RemoteAddr, err)
+			}
+			addr = addr.Unmap()
+
+			for _, prefix := range prefixes {
+				if prefix.Contains(addr) {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("remote address %v not allowed", addr)
+		},
+	}
+}
+
+// parsePrefixes parses the value of an ip_allowlist caveat. Single IP
+// addresses are turned into prefixes that only contain the address itself.
+func parsePrefixes(value string) ([]netip.Prefix, error) {
+	entries := splitList(value)
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s caveat "+
+					"value: %w", CondIPAllowlist, err)
+			}
+			addr = addr.Unmap()
+			entry = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s caveat value: %w",
+				CondIPAllowlist, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+
+	return prefixes, nil
+}
+
+// containsPrefix returns true if the given prefix is a subset of any of the
+// prefixes in the list.
+func containsPrefix(prefixes []netip.Prefix, prefix netip.Prefix) bool {
+	for _, p := range prefixes {
+		if p.Bits() <= prefix.Bits() && p.Contains(prefix.Addr()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitList splits a comma-separated caveat value into its trimmed, non-empty
+// entries.
+func splitList(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
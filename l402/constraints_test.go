@@ -0,0 +1,177 @@
+package l402
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestConstraintSatisfiers tests that the built-in constraints restrict the
+// requests made with an L402 and can only be made more restrictive.
+func TestConstraintSatisfiers(t *testing.T) {
+	t.Parallel()
+
+	newRequest := func(method, remoteAddr, body string) *http.Request {
+		r := httptest.NewRequest(method, "/", strings.NewReader(body))
+		r.RemoteAddr = remoteAddr
+
+		return r
+	}
+	defaultRequest := newRequest("GET", "10.0.0.1:1234", "hello")
+
+	tests := []struct {
+		name    string
+		request *http.Request
+		caveats []Caveat
+		err     string
+	}{{
+		name:    "body within limit",
+		request: defaultRequest,
+		caveats: []Caveat{NewCaveat(CondMaxBodySize, "5")},
+	}, {
+		name:    "body exceeds limit",
+		request: defaultRequest,
+		caveats: []Caveat{NewCaveat(CondMaxBodySize, "4")},
+		err:     "exceeds maximum of 4 bytes",
+	}, {
+		name: "body of unknown size",
+		request: func() *http.Request {
+			r := newRequest("POST", "10.0.0.1:1234", "")
+			r.ContentLength = -1
+
+			return r
+		}(),
+		caveats: []Caveat{NewCaveat(CondMaxBodySize, "4")},
+		err:     "unknown size",
+	}, {
+		name:    "body limit raised",
+		request: defaultRequest,
+		caveats: []Caveat{
+			NewCaveat(CondMaxBodySize, "4"),
+			NewCaveat(CondMaxBodySize, "5"),
+		},
+		err: "increasing restrictiveness",
+	}, {
+		name:    "method allowed",
+		request: defaultRequest,
+		caveats: []Caveat{NewCaveat(CondAllowedMethods, "get, head")},
+	}, {
+		name:    "method not allowed",
+		request: newRequest("DELETE", "10.0.0.1:1234", ""),
+		caveats: []Caveat{NewCaveat(CondAllowedMethods, "GET,HEAD")},
+		err:     "method DELETE not allowed",
+	}, {
+		name:    "method added",
+		request: defaultRequest,
+		caveats: []Caveat{
+			NewCaveat(CondAllowedMethods, "HEAD"),
+			NewCaveat(CondAllowedMethods, "GET,HEAD"),
+		},
+		err: "method GET not previously allowed",
+	}, {
+		name:    "address in prefix",
+		request: defaultRequest,
+		caveats: []Caveat{
+			NewCaveat(CondIPAllowlist, "192.168.1.1,10.0.0.0/8"),
+		},
+	}, {
+		name:    "address allowed",
+		request: newRequest("GET", "[::ffff:192.168.1.1]:1234", ""),
+		caveats: []Caveat{
+			NewCaveat(CondIPAllowlist, "192.168.1.1,10.0.0.0/8"),
+		},
+	}, {
+		name:    "address not allowed",
+		request: newRequest("GET", "[2001:db8::1]:1234", ""),
+		caveats: []Caveat{NewCaveat(CondIPAllowlist, "10.0.0.0/8")},
+		err:     "remote address 2001:db8::1 not allowed",
+	}, {
+		name:    "prefix narrowed",
+		request: defaultRequest,
+		caveats: []Caveat{
+			NewCaveat(CondIPAllowlist, "10.0.0.0/8"),
+			NewCaveat(CondIPAllowlist, "10.0.0.0/24,10.1.0.1"),
+		},
+	}, {
+		name:    "prefix widened",
+		request: defaultRequest,
+		caveats: []Caveat{
+			NewCaveat(CondIPAllowlist, "10.0.0.0/24"),
+			NewCaveat(CondIPAllowlist, "10.0.0.0/16"),
+		},
+		err: "prefix 10.0.0.0/16 not previously allowed",
+	}, {
+		name:    "invalid prefix",
+		request: defaultRequest,
+		caveats: []Caveat{NewCaveat(CondIPAllowlist, "10.0.0/8")},
+		err:     "invalid ip_allowlist caveat value",
+	}, {
+		name:    "unknown request",
+		request: nil,
+		caveats: []Caveat{NewCaveat(CondAllowedMethods, "GET")},
+		err:     ErrUnknownRequest.Error(),
+	}}
+
+	registry := NewConstraintRegistry()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			satisfiers := registry.Satisfiers(test.request)
+			err := VerifyCaveats(test.caveats, satisfiers...)
+			if test.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+// TestConstraintRegistry tests the registration of custom constraints.
+func TestConstraintRegistry(t *testing.T) {
+	t.Parallel()
+
+	registry := NewConstraintRegistry()
+	satisfier := Satisfier{
+		Condition:    "region",
+		SatisfyFinal: func(Caveat) error { return nil },
+	}
+	require.NoError(t, registry.RegisterSatisfier(satisfier))
+
+	// A condition can only be registered once and conditions of the
+	// built-in restrictions are reserved.
+	err := registry.RegisterSatisfier(satisfier)
+	require.ErrorContains(t, err, "already registered")
+
+	err = registry.RegisterSatisfier(Satisfier{
+		Condition:    CondMaxBodySize,
+		SatisfyFinal: func(Caveat) error { return nil },
+	})
+	require.ErrorContains(t, err, "already registered")
+
+	for _, condition := range []string{
+		"", CondServices, "svc" + CondCapabilitiesSuffix,
+		"svc" + CondTimeoutSuffix, "svc" + CondMaxRequestsSuffix,
+		"svc" + CondBalanceSuffix,
+	} {
+		err := registry.Register(condition, NewAllowedMethodsSatisfier)
+		require.Error(t, err)
+	}
+
+	err = registry.RegisterSatisfier(Satisfier{Condition: "zone"})
+	require.ErrorContains(t, err, "must satisfy the final caveat")
+
+	// The satisfier is applied to the condition it was registered for.
+	err = registry.Register("methods", NewAllowedMethodsSatisfier)
+	require.NoError(t, err)
+
+	r := httptest.NewRequest("POST", "/", nil)
+	err = VerifyCaveats(
+		[]Caveat{NewCaveat("methods", "GET")},
+		registry.Satisfiers(r)...,
+	)
+	require.ErrorContains(t, err, "method POST not allowed")
+}
@@ -24,6 +24,11 @@ const (
 	// HeaderMacaroon is the HTTP header field name that is used to send the
 	// L402 by our own gRPC clients.
 	HeaderMacaroon = "Macaroon"
+
+	// HeaderTopUp is the HTTP header field name that is used to send the
+	// hex encoded preimage of a paid top-up invoice along with the L402 it
+	// tops up.
+	HeaderTopUp = "X-L402-Top-Up"
 )
 
 var (
@@ -130,6 +135,23 @@ func FromHeader(header *http.Header) (*macaroon.Macaroon, lntypes.Preimage, erro
 	return mac, preimage, nil
 }
 
+// TopUpFromHeader extracts the preimage of a paid top-up invoice from HTTP
+// headers. False is returned if no top-up was sent.
+func TopUpFromHeader(header *http.Header) (lntypes.Preimage, bool, error) {
+	preimageHex := header.Get(HeaderTopUp)
+	if preimageHex == "" {
+		return lntypes.Preimage{}, false, nil
+	}
+
+	preimage, err := lntypes.MakePreimageFromStr(preimageHex)
+	if err != nil {
+		return lntypes.Preimage{}, false, fmt.Errorf("hex decode of "+
+			"top-up preimage failed: %v", err)
+	}
+
+	return preimage, true, nil
+}
+
 // SetHeader sets the provided authentication elements as the default/standard
 // HTTP header for the L402 protocol.
 func SetHeader(header *http.Header, mac *macaroon.Macaroon,
@@ -30,35 +30,44 @@ type Satisfier struct {
 }
 
 // NewServicesSatisfier implements a satisfier to determine whether the target
-// service is authorized for a given L402.
-//
-// TODO(wilmer): Add tier verification?
+// service is authorized for a given L402. The tier of a service is part of the
+// caveat the L402 was minted with and can't be changed by adding more caveats,
+// so the restrictions of the tier it was paid for apply to it.
 func NewServicesSatisfier(targetService string) Satisfier {
 	return Satisfier{
 		Condition: CondServices,
 		SatisfyPrevious: func(prev, cur Caveat) error {
 			// Construct a set of the services we were previously
-			// allowed to access.
+			// allowed to access and their tiers.
 			prevServices, err := decodeServicesCaveatValue(prev.Value)
 			if err != nil {
 				return err
 			}
-			prevAllowed := make(map[string]struct{}, len(prevServices))
+			prevAllowed := make(
+				map[string]ServiceTier, len(prevServices),
+			)
 			for _, service := range prevServices {
-				prevAllowed[service.Name] = struct{}{}
+				prevAllowed[service.Name] = service.Tier
 			}
 
 			// The caveat should not include any new services that
-			// weren't previously allowed.
+			// weren't previously allowed or change their tier.
 			currentServices, err := decodeServicesCaveatValue(cur.Value)
 			if err != nil {
 				return err
 			}
 			for _, service := range currentServices {
-				if _, ok := prevAllowed[service.Name]; !ok {
+				tier, ok := prevAllowed[service.Name]
+				if !ok {
 					return fmt.Errorf("service %v not "+
 						"previously allowed", service)
 				}
+				if service.Tier != tier {
+					return fmt.Errorf("tier of service "+
+						"%v changed from %d to %d",
+						service.Name, tier,
+						service.Tier)
+				}
 			}
 
 			return nil
@@ -120,6 +129,69 @@ func NewCapabilitiesSatisfier(service string,
 	}
 }
 
+// NewMaxRequestsSatisfier makes sure the max requests caveats of an L402 for
+// the given service are valid and that each subsequent caveat only lowers the
+// number of requests that can be made. The number of requests that were
+// actually made is tracked outside of the L402.
+func NewMaxRequestsSatisfier(service string) Satisfier {
+	return Satisfier{
+		Condition: service + CondMaxRequestsSuffix,
+		SatisfyPrevious: func(prev, cur Caveat) error {
+			prevValue, err := parseMaxRequests(prev.Value)
+			if err != nil {
+				return err
+			}
+			curValue, err := parseMaxRequests(cur.Value)
+			if err != nil {
+				return err
+			}
+
+			if curValue > prevValue {
+				return fmt.Errorf("%s caveat violates "+
+					"increasing restrictiveness",
+					service+CondMaxRequestsSuffix)
+			}
+
+			return nil
+		},
+		SatisfyFinal: func(c Caveat) error {
+			_, err := parseMaxRequests(c.Value)
+			return err
+		},
+	}
+}
+
+// NewBalanceSatisfier makes sure the balance caveats of an L402 for the given
+// service are valid and that each subsequent caveat only lowers the balance.
+// The satoshis that were actually spent are tracked outside of the L402.
+func NewBalanceSatisfier(service string) Satisfier {
+	return Satisfier{
+		Condition: service + CondBalanceSuffix,
+		SatisfyPrevious: func(prev, cur Caveat) error {
+			prevValue, err := parseBalance(prev.Value)
+			if err != nil {
+				return err
+			}
+			curValue, err := parseBalance(cur.Value)
+			if err != nil {
+				return err
+			}
+
+			if curValue > prevValue {
+				return fmt.Errorf("%s caveat violates "+
+					"increasing restrictiveness",
+					service+CondBalanceSuffix)
+			}
+
+			return nil
+		},
+		SatisfyFinal: func(c Caveat) error {
+			_, err := parseBalance(c.Value)
+			return err
+		},
+	}
+}
+
 // NewTimeoutSatisfier checks if an L402 is expired or not. The Satisfier takes
 // a service name to set as the condition prefix and currentTimestamp to
 // compare against the expiration(s) in the caveats. The expiration time is
@@ -84,3 +84,108 @@ func TestTimeoutSatisfier(t *testing.T) {
 		})
 	}
 }
+
+// TestServicesSatisfierTier tests that the tier of a service can't be changed
+// by adding another services caveat.
+func TestServicesSatisfierTier(t *testing.T) {
+	t.Parallel()
+
+	satisfier := NewServicesSatisfier("a")
+
+	newCaveat := func(services ...Service) Caveat {
+		caveat, err := NewServicesCaveat(services...)
+		require.NoError(t, err)
+
+		return caveat
+	}
+	premium := newCaveat(Service{Name: "a", Tier: 1}, Service{Name: "b"})
+
+	// Restricting an L402 to a subset of its services keeps their tiers.
+	err := satisfier.SatisfyPrevious(
+		premium, newCaveat(Service{Name: "a", Tier: 1}),
+	)
+	require.NoError(t, err)
+
+	// Neither upgrading nor downgrading the tier is allowed.
+	err = satisfier.SatisfyPrevious(
+		premium, newCaveat(Service{Name: "a", Tier: 2}),
+	)
+	require.ErrorContains(t, err, "tier of service a changed")
+
+	err = satisfier.SatisfyPrevious(
+		newCaveat(Service{Name: "a"}),
+		newCaveat(Service{Name: "a", Tier: 1}),
+	)
+	require.Error(t, err)
+}
+
+// TestMaxRequestsSatisfier tests that the number of requests an L402 can be
+// used for can only be lowered by adding more max requests caveats.
+func TestMaxRequestsSatisfier(t *testing.T) {
+	t.Parallel()
+
+	satisfier := NewMaxRequestsSatisfier("a")
+	caveat := NewMaxRequestsCaveat("a", 100)
+	require.Equal(t, "a_max_requests", caveat.Condition)
+
+	err := VerifyCaveats(
+		[]Caveat{caveat, NewMaxRequestsCaveat("a", 10)}, satisfier,
+	)
+	require.NoError(t, err)
+
+	err = VerifyCaveats(
+		[]Caveat{caveat, NewMaxRequestsCaveat("a", 101)}, satisfier,
+	)
+	require.ErrorContains(t, err, "increasing restrictiveness")
+
+	zero := NewCaveat(caveat.Condition, "0")
+	err = VerifyCaveats([]Caveat{zero}, satisfier)
+	require.ErrorContains(t, err, "must be positive")
+
+	// The last caveat determines the number of requests.
+	maxRequests, limited, err := MaxRequests(
+		[]Caveat{caveat, NewMaxRequestsCaveat("a", 10)}, "a",
+	)
+	require.NoError(t, err)
+	require.True(t, limited)
+	require.EqualValues(t, 10, maxRequests)
+
+	_, limited, err = MaxRequests([]Caveat{caveat}, "b")
+	require.NoError(t, err)
+	require.False(t, limited)
+}
+
+// TestBalanceSatisfier tests that the balance of an L402 can only be lowered.
+func TestBalanceSatisfier(t *testing.T) {
+	t.Parallel()
+
+	satisfier := NewBalanceSatisfier("a")
+	caveat := NewBalanceCaveat("a", 1000)
+	require.Equal(t, "a_balance", caveat.Condition)
+
+	err := VerifyCaveats(
+		[]Caveat{caveat, NewBalanceCaveat("a", 500)}, satisfier,
+	)
+	require.NoError(t, err)
+
+	err = VerifyCaveats(
+		[]Caveat{caveat, NewBalanceCaveat("a", 1001)}, satisfier,
+	)
+	require.ErrorContains(t, err, "increasing restrictiveness")
+
+	negative := NewCaveat(caveat.Condition, "-1")
+	err = VerifyCaveats([]Caveat{negative}, satisfier)
+	require.ErrorContains(t, err, "must be positive")
+
+	// The last caveat determines the balance.
+	balance, funded, err := Balance(
+		[]Caveat{caveat, NewBalanceCaveat("a", 500)}, "a",
+	)
+	require.NoError(t, err)
+	require.True(t, funded)
+	require.EqualValues(t, 500, balance)
+
+	_, funded, err = Balance([]Caveat{caveat}, "b")
+	require.NoError(t, err)
+	require.False(t, funded)
+}
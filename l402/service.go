@@ -20,6 +20,16 @@ const (
 	// CondTimeoutSuffix is the condition suffix used for a service's
 	// timeout caveat.
 	CondTimeoutSuffix = "_valid_until"
+
+	// CondMaxRequestsSuffix is the condition suffix used for a service's
+	// max requests caveat, which limits the number of requests that can be
+	// made with an L402 to the service.
+	CondMaxRequestsSuffix = "_max_requests"
+
+	// CondBalanceSuffix is the condition suffix used for a service's
+	// balance caveat, which holds the number of satoshis an L402 is funded
+	// with. The price of each request to the service is deducted from it.
+	CondBalanceSuffix = "_balance"
 )
 
 var (
@@ -126,6 +136,16 @@ func decodeServicesCaveatValue(s string) ([]Service, error) {
 	return services, nil
 }
 
+// IsReservedCondition returns true if the given caveat condition is reserved
+// for the restrictions aperture adds to the L402s it mints.
+func IsReservedCondition(condition string) bool {
+	return condition == CondServices ||
+		strings.HasSuffix(condition, CondCapabilitiesSuffix) ||
+		strings.HasSuffix(condition, CondTimeoutSuffix) ||
+		strings.HasSuffix(condition, CondMaxRequestsSuffix) ||
+		strings.HasSuffix(condition, CondBalanceSuffix)
+}
+
 // NewCapabilitiesCaveat creates a new capabilities caveat for the given
 // service.
 func NewCapabilitiesCaveat(serviceName string, capabilities string) Caveat {
@@ -150,3 +170,154 @@ func NewTimeoutCaveat(serviceName string, numSeconds int64,
 		Value:     strconv.FormatInt(requestTimeout.Unix(), 10),
 	}
 }
+
+// NewMaxRequestsCaveat creates a new caveat that limits the number of requests
+// that can be made with a macaroon to the given service.
+func NewMaxRequestsCaveat(serviceName string, maxRequests int64) Caveat {
+	return Caveat{
+		Condition: serviceName + CondMaxRequestsSuffix,
+		Value:     strconv.FormatInt(maxRequests, 10),
+	}
+}
+
+// MaxRequests returns the number of requests that can be made to the given
+// service according to the last max requests caveat of the service. False is
+// returned if the number of requests isn't limited.
+//
+// NOTE: The caveats should be verified with a max requests satisfier first to
+// make sure each caveat only lowers the limit of the previous one.
+func MaxRequests(caveats []Caveat, serviceName string) (int64, bool, error) {
+	value, found := lastCaveatValue(
+		caveats, serviceName+CondMaxRequestsSuffix,
+	)
+	if !found {
+		return 0, false, nil
+	}
+
+	maxRequests, err := parseMaxRequests(value)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return maxRequests, true, nil
+}
+
+// NewBalanceCaveat creates a new caveat that funds an L402 with the given
+// number of satoshis to spend on requests to the given service.
+func NewBalanceCaveat(serviceName string, balance int64) Caveat {
+	return Caveat{
+		Condition: serviceName + CondBalanceSuffix,
+		Value:     strconv.FormatInt(balance, 10),
+	}
+}
+
+// Balance returns the number of satoshis an L402 is funded with for requests to
+// the given service according to the last balance caveat of the service. False
+// is returned if the L402 isn't funded with a balance for the service.
+//
+// NOTE: The caveats should be verified with a balance satisfier first to make
+// sure each caveat only lowers the balance of the previous one.
+func Balance(caveats []Caveat, serviceName string) (int64, bool, error) {
+	value, found := lastCaveatValue(caveats, serviceName+CondBalanceSuffix)
+	if !found {
+		return 0, false, nil
+	}
+
+	balance, err := parseBalance(value)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return balance, true, nil
+}
+
+// parseBalance parses the value of a balance caveat.
+func parseBalance(value string) (int64, error) {
+	balance, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid balance caveat value: %w", err)
+	}
+	if balance <= 0 {
+		return 0, fmt.Errorf("balance caveat value must be positive")
+	}
+
+	return balance, nil
+}
+
+// lastCaveatValue returns the value of the last caveat with the given
+// condition. False is returned if there is no such caveat.
+func lastCaveatValue(caveats []Caveat, condition string) (string, bool) {
+	var (
+		value string
+		found bool
+	)
+	for _, caveat := range caveats {
+		if caveat.Condition == condition {
+			value, found = caveat.Value, true
+		}
+	}
+
+	return value, found
+}
+
+// parseMaxRequests parses the value of a max requests caveat.
+func parseMaxRequests(value string) (int64, error) {
+	maxRequests, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid max requests caveat value: %w",
+			err)
+	}
+	if maxRequests <= 0 {
+		return 0, fmt.Errorf("max requests caveat value must be " +
+			"positive")
+	}
+
+	return maxRequests, nil
+}
+
+// ValidUntil returns the time until which the given service can be accessed
+// according to the last timeout caveat of the service. False is returned if
+// access to the service doesn't expire.
+//
+// NOTE: The caveats should be verified with a timeout satisfier first to make
+// sure each caveat only shortens the validity of the previous one.
+func ValidUntil(caveats []Caveat, serviceName string) (time.Time, bool,
+	error) {
+
+	value, found := lastCaveatValue(caveats, serviceName+CondTimeoutSuffix)
+	if !found {
+		return time.Time{}, false, nil
+	}
+
+	timestamp, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid timeout caveat "+
+			"value: %w", err)
+	}
+
+	return time.Unix(timestamp, 0), true, nil
+}
+
+// GrantedTier returns the tier of the given service that the last services
+// caveat grants access to. False is returned if the caveats don't grant access
+// to the service.
+func GrantedTier(caveats []Caveat, serviceName string) (ServiceTier, bool,
+	error) {
+
+	value, found := lastCaveatValue(caveats, CondServices)
+	if !found {
+		return 0, false, nil
+	}
+
+	services, err := decodeServicesCaveatValue(value)
+	if err != nil {
+		return 0, false, err
+	}
+	for _, service := range services {
+		if service.Name == serviceName {
+			return service.Tier, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
@@ -80,3 +80,27 @@ func TestServicesCaveatSerialization(t *testing.T) {
 		}
 	}
 }
+
+// TestGrantedTier ensures the tier of a service is taken from the last services
+// caveat.
+func TestGrantedTier(t *testing.T) {
+	t.Parallel()
+
+	caveats := []Caveat{
+		NewCaveat(CondServices, "a:1,b:0"),
+		NewCaveat(CondServices, "a:2"),
+	}
+
+	tier, ok, err := GrantedTier(caveats, "a")
+	if err != nil || !ok || tier != 2 {
+		t.Fatalf("expected tier 2 of service a, got %v %v %v", tier,
+			ok, err)
+	}
+
+	// Service b was restricted by the last caveat.
+	_, ok, err = GrantedTier(caveats, "b")
+	if err != nil || ok {
+		t.Fatalf("expected service b not to be granted, got %v %v",
+			ok, err)
+	}
+}
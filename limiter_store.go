@@ -0,0 +1,182 @@
+package aperture
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/proxy"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// limiterTxRetries is the number of times taking tokens is retried if
+	// another instance modified the same buckets concurrently.
+	limiterTxRetries = 10
+)
+
+var (
+	// rateLimitsPrefix is the key we'll use to prefix all token buckets of
+	// rate limits with when storing them in an etcd cluster.
+	rateLimitsPrefix = "ratelimits"
+
+	// errLimiterRetriesExceeded is returned if the tokens couldn't be taken
+	// because of concurrent modifications within the allowed number of
+	// retries.
+	errLimiterRetriesExceeded = errors.New("rate limit tx retries " +
+		"exceeded")
+)
+
+// rateLimitKey returns the full key to store in the database for a token
+// bucket. The key of the bucket is hex-encoded in order to prevent conflicts
+// with the etcd key delimeter.
+//
+// The resulting path of the bucket "foo" within etcd would look like:
+// lsat/proxy/ratelimits/666f6f
+func rateLimitKey(bucketKey string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, rateLimitsPrefix,
+			hex.EncodeToString([]byte(bucketKey)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// limiterStore is a store of the token buckets of rate limits backed by an etcd
+// cluster. Buckets are stored with a lease that expires once they are full
+// again, so the cluster only holds the buckets of recently limited clients.
+type limiterStore struct {
+	*clientv3.Client
+
+	now func() time.Time
+}
+
+// A compile-time constraint to ensure limiterStore implements
+// proxy.LimiterStore.
+var _ proxy.LimiterStore = (*limiterStore)(nil)
+
+// newLimiterStore instantiates a new token bucket store backed by an etcd
+// cluster.
+func newLimiterStore(client *clientv3.Client) *limiterStore {
+	return &limiterStore{
+		Client: client,
+		now:    time.Now,
+	}
+}
+
+// Take takes a token from each of the given buckets if all of them have one
+// available. The buckets are updated in a transaction that only succeeds if
+// none of them was modified concurrently, otherwise the attempt is retried.
+//
+// NOTE: This is part of the proxy.LimiterStore interface.
+func (s *limiterStore) Take(ctx context.Context,
+	buckets []proxy.LimiterBucket) (bool, time.Duration, error) {
+
+	for i := 0; i < limiterTxRetries; i++ {
+		allowed, wait, ok, err := s.tryTake(ctx, buckets)
+		if err != nil {
+			return false, 0, err
+		}
+		if ok {
+			return allowed, wait, nil
+		}
+	}
+
+	return false, 0, errLimiterRetriesExceeded
+}
+
+// tryTake makes a single attempt at taking a token from each of the given
+// buckets. The last return value before the error is false if the attempt
+// failed because of a concurrent modification.
+func (s *limiterStore) tryTake(ctx context.Context,
+	buckets []proxy.LimiterBucket) (bool, time.Duration, bool, error) {
+
+	// Fetch all buckets at once.
+	gets := make([]clientv3.Op, len(buckets))
+	for i, bucket := range buckets {
+		gets[i] = clientv3.OpGet(rateLimitKey(bucket.Key))
+	}
+	resp, err := s.Txn(ctx).Then(gets...).Commit()
+	if err != nil {
+		return false, 0, false, err
+	}
+
+	now := s.now()
+	var (
+		cmps    = make([]clientv3.Cmp, len(buckets))
+		states  = make([]proxy.BucketState, len(buckets))
+		maxWait time.Duration
+		fullAt  = now
+	)
+	for i, bucket := range buckets {
+		key := rateLimitKey(bucket.Key)
+
+		// A bucket we haven't seen yet starts out full and must not be
+		// created by anyone else in the meantime.
+		var state proxy.BucketState
+		cmps[i] = clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+
+		kvs := resp.Responses[i].GetResponseRange().Kvs
+		if len(kvs) > 0 {
+			err := json.Unmarshal(kvs[0].Value, &state)
+			if err != nil {
+				return false, 0, false, fmt.Errorf("unable "+
+					"to decode rate limit bucket %s: %w",
+					bucket.Key, err)
+			}
+
+			cmps[i] = clientv3.Compare(
+				clientv3.ModRevision(key), "=",
+				kvs[0].ModRevision,
+			)
+		}
+
+		var wait time.Duration
+		states[i], wait = bucket.Take(state, now)
+		if wait > maxWait {
+			maxWait = wait
+		}
+
+		bucketFullAt := bucket.FullAt(states[i])
+		if bucketFullAt.After(fullAt) {
+			fullAt = bucketFullAt
+		}
+	}
+
+	// If any of the buckets is empty, no tokens are taken at all.
+	if maxWait > 0 {
+		return false, maxWait, true, nil
+	}
+
+	// The buckets expire once all of them are full again.
+	ttl := int64(math.Ceil(fullAt.Sub(now).Seconds())) + 1
+	lease, err := s.Grant(ctx, ttl)
+	if err != nil {
+		return false, 0, false, err
+	}
+
+	puts := make([]clientv3.Op, len(buckets))
+	for i, bucket := range buckets {
+		value, err := json.Marshal(states[i])
+		if err != nil {
+			return false, 0, false, err
+		}
+
+		puts[i] = clientv3.OpPut(
+			rateLimitKey(bucket.Key), string(value),
+			clientv3.WithLease(lease.ID),
+		)
+	}
+
+	txnResp, err := s.Txn(ctx).If(cmps...).Then(puts...).Commit()
+	if err != nil {
+		return false, 0, false, err
+	}
+
+	return true, 0, txnResp.Succeeded, nil
+}
@@ -0,0 +1,45 @@
+package mint
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lightninglabs/aperture/l402"
+	"gopkg.in/macaroon.v2"
+)
+
+var (
+	// ErrEmptyBundle is returned when an L402 is minted for a bundle
+	// without any services.
+	ErrEmptyBundle = errors.New("bundle has no services")
+)
+
+// Bundle is a named set of services that can be bought together with a single
+// L402.
+type Bundle struct {
+	// Name is the name of the bundle.
+	Name string
+
+	// Services are the services the L402s of the bundle grant access to.
+	Services []l402.Service
+
+	// Price is the configured price of the L402s of the bundle in
+	// satoshis. It is only charged if the pricing strategy of the mint
+	// takes bundle prices into account. If 0, the bundle has no price of
+	// its own.
+	Price int64
+}
+
+// MintBundleL402 mints a new L402 for all services of the given bundle. The
+// price of the L402 is determined by the pricing strategy of the mint.
+func (m *Mint) MintBundleL402(ctx context.Context,
+	bundle *Bundle) (*macaroon.Macaroon, string, error) {
+
+	if len(bundle.Services) == 0 {
+		return nil, "", ErrEmptyBundle
+	}
+
+	price := m.cfg.Pricing.Price(bundle.Services, bundle)
+
+	return m.mintL402(ctx, price, bundle.Services, nil)
+}
@@ -0,0 +1,145 @@
+package mint
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+)
+
+// SecretDenylist keeps the secrets that were revoked from a store that derives
+// secrets instead of storing them.
+type SecretDenylist interface {
+	// DenySecret adds the secret keyed by the given hash to the denylist.
+	// This acts as a NOP if it is on the denylist already.
+	DenySecret(context.Context, [sha256.Size]byte) error
+
+	// DeniedSecrets returns the hashes of all secrets on the denylist.
+	DeniedSecrets(context.Context) ([][sha256.Size]byte, error)
+}
+
+// DerivedSecretStore is a SecretStore that derives the secret of an L402 from a
+// root key and the hash of its identifier instead of storing it, so that
+// neither minting nor verifying an L402 requires a database round trip.
+// Revoked secrets are kept on a denylist that is cached in memory and reloaded
+// periodically, to pick up the revocations of other instances that share the
+// same root key.
+type DerivedSecretStore struct {
+	rootKey         [RootKeySize]byte
+	denylist        SecretDenylist
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu          sync.Mutex
+	denied      map[[sha256.Size]byte]struct{}
+	refreshedAt time.Time
+}
+
+// A compile-time constraint to ensure DerivedSecretStore implements
+// SecretStore.
+var _ SecretStore = (*DerivedSecretStore)(nil)
+
+// NewDerivedSecretStore creates a new store that derives secrets from the
+// given root key. The denylist is reloaded at most once per refresh interval.
+func NewDerivedSecretStore(rootKey [RootKeySize]byte, denylist SecretDenylist,
+	refreshInterval time.Duration) *DerivedSecretStore {
+
+	return &DerivedSecretStore{
+		rootKey:         rootKey,
+		denylist:        denylist,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+	}
+}
+
+// NewSecret derives the secret that is keyed by the given hash. Nothing is
+// stored.
+//
+// NOTE: This is part of the SecretStore interface.
+func (s *DerivedSecretStore) NewSecret(_ context.Context,
+	hash [sha256.Size]byte) ([l402.SecretSize]byte, error) {
+
+	return s.deriveSecret(hash), nil
+}
+
+// GetSecret derives the secret that is keyed by the given hash. If the secret
+// was revoked, ErrSecretNotFound is returned.
+//
+// NOTE: This is part of the SecretStore interface.
+func (s *DerivedSecretStore) GetSecret(ctx context.Context,
+	hash [sha256.Size]byte) ([l402.SecretSize]byte, error) {
+
+	denied, err := s.isDenied(ctx, hash)
+	if err != nil {
+		return [l402.SecretSize]byte{}, err
+	}
+	if denied {
+		return [l402.SecretSize]byte{}, ErrSecretNotFound
+	}
+
+	return s.deriveSecret(hash), nil
+}
+
+// RevokeSecret adds the secret that is keyed by the given hash to the
+// denylist.
+//
+// NOTE: This is part of the SecretStore interface.
+func (s *DerivedSecretStore) RevokeSecret(ctx context.Context,
+	hash [sha256.Size]byte) error {
+
+	if err := s.denylist.DenySecret(ctx, hash); err != nil {
+		return fmt.Errorf("unable to deny secret: %w", err)
+	}
+
+	s.mu.Lock()
+	if s.denied != nil {
+		s.denied[hash] = struct{}{}
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// deriveSecret returns the HMAC of the given hash under the root key.
+func (s *DerivedSecretStore) deriveSecret(
+	hash [sha256.Size]byte) [l402.SecretSize]byte {
+
+	var secret [l402.SecretSize]byte
+	mac := hmac.New(sha256.New, s.rootKey[:])
+	_, _ = mac.Write(hash[:])
+	copy(secret[:], mac.Sum(nil))
+
+	return secret
+}
+
+// isDenied returns true if the secret keyed by the given hash is on the
+// denylist, reloading the denylist first if it is stale.
+func (s *DerivedSecretStore) isDenied(ctx context.Context,
+	hash [sha256.Size]byte) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.denied == nil || now.Sub(s.refreshedAt) >= s.refreshInterval {
+		hashes, err := s.denylist.DeniedSecrets(ctx)
+		if err != nil {
+			return false, fmt.Errorf("unable to load secret "+
+				"denylist: %w", err)
+		}
+
+		s.denied = make(map[[sha256.Size]byte]struct{}, len(hashes))
+		for _, denied := range hashes {
+			s.denied[denied] = struct{}{}
+		}
+		s.refreshedAt = now
+	}
+
+	_, denied := s.denied[hash]
+
+	return denied, nil
+}
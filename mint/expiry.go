@@ -0,0 +1,133 @@
+package mint
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+// SecretExpiry describes when the secret of an L402 can be pruned because the
+// L402 can no longer be used.
+type SecretExpiry struct {
+	// PaymentHash is the payment hash of the invoice that pays for the
+	// L402. It is used to look up whether the invoice was paid before the
+	// secret is pruned.
+	PaymentHash lntypes.Hash
+
+	// InvoiceExpiry is the time the invoice that pays for the L402
+	// expires. As long as the L402 isn't settled, its secret can be pruned
+	// once the invoice expired.
+	InvoiceExpiry time.Time
+
+	// ValidUntil is the time the L402 expires. Once the L402 is settled,
+	// its secret can be pruned after that time. It is zero if the L402
+	// never expires.
+	ValidUntil time.Time
+}
+
+// SecretExpiryStore is implemented by secret stores that keep track of when
+// the secrets of L402s expire, so that the secrets of L402s that can no longer
+// be used don't accumulate forever. Secrets without an expiry, like the ones
+// that weren't created for L402s, are never pruned.
+type SecretExpiryStore interface {
+	// SetSecretExpiry sets the expiry of the secret keyed by the given
+	// hash.
+	SetSecretExpiry(context.Context, [sha256.Size]byte, *SecretExpiry) error
+
+	// SettleSecret records that the L402 of the secret keyed by the given
+	// hash was paid for, so that the secret is no longer pruned once the
+	// invoice expired. This acts as a NOP if it was already settled.
+	SettleSecret(context.Context, [sha256.Size]byte) error
+
+	// UnsettledSecrets returns the payment hashes of the L402s that aren't
+	// settled and whose invoices expired before the given time, keyed by
+	// the hash of their secrets.
+	UnsettledSecrets(context.Context, time.Time) (
+		map[[sha256.Size]byte]lntypes.Hash, error)
+
+	// ExtendSecret extends the time the L402 of the secret keyed by the
+	// given hash expires to the given time, unless it already expires
+	// later or never.
+	ExtendSecret(context.Context, [sha256.Size]byte, time.Time) error
+
+	// PruneSecrets removes all secrets that expired before the given time
+	// and returns the number of removed secrets.
+	PruneSecrets(context.Context, time.Time) (int64, error)
+}
+
+// InvoiceLookup looks up whether the invoices that pay for L402s were paid.
+type InvoiceLookup interface {
+	// InvoicePaid returns true if the invoice with the given payment hash
+	// was paid. Invoices that are unknown are reported as unpaid.
+	InvoicePaid(context.Context, lntypes.Hash) (bool, error)
+}
+
+// PruneSecrets removes all secrets of L402s that expired before the given time
+// and returns the number of removed secrets. The L402s whose invoices expired
+// without them being settled are only pruned if the invoice lookup reports
+// their invoices as unpaid, the others are settled instead.
+func PruneSecrets(ctx context.Context, store SecretExpiryStore,
+	invoices InvoiceLookup, before time.Time) (int64, error) {
+
+	unsettled, err := store.UnsettledSecrets(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list unsettled secrets: %w",
+			err)
+	}
+
+	for idHash, paymentHash := range unsettled {
+		paid, err := invoices.InvoicePaid(ctx, paymentHash)
+		if err != nil {
+			return 0, fmt.Errorf("unable to look up invoice %v: %w",
+				paymentHash, err)
+		}
+		if !paid {
+			continue
+		}
+
+		if err := store.SettleSecret(ctx, idHash); err != nil {
+			return 0, err
+		}
+	}
+
+	return store.PruneSecrets(ctx, before)
+}
+
+// secretExpiry returns the expiry of the secret of a new L402 with the given
+// caveats for the given services. The L402 expires once access to all of its
+// services expired.
+func (m *Mint) secretExpiry(paymentHash lntypes.Hash,
+	services []l402.Service, caveats []l402.Caveat) (*SecretExpiry, error) {
+
+	expiry := &SecretExpiry{
+		PaymentHash:   paymentHash,
+		InvoiceExpiry: m.cfg.Now().Add(m.cfg.InvoiceExpiry),
+	}
+	if len(services) == 0 {
+		return expiry, nil
+	}
+
+	var validUntil time.Time
+	for _, service := range services {
+		serviceExpiry, expires, err := l402.ValidUntil(
+			caveats, service.Name,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if !expires {
+			return expiry, nil
+		}
+
+		if serviceExpiry.After(validUntil) {
+			validUntil = serviceExpiry
+		}
+	}
+	expiry.ValidUntil = validUntil
+
+	return expiry, nil
+}
@@ -7,9 +7,12 @@ import (
 	"crypto/sha256"
 	"errors"
 	"fmt"
+	"net/http"
+	"sync"
 	"time"
 
 	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/neutrino/cache/lru"
 	"github.com/lightningnetwork/lnd/lntypes"
 	"gopkg.in/macaroon.v2"
 )
@@ -73,6 +76,21 @@ type ServiceLimiter interface {
 	// will determine if and when service access can expire.
 	ServiceTimeouts(context.Context, ...l402.Service) ([]l402.Caveat,
 		error)
+
+	// ServiceMaxRequests returns the max requests caveat for each service.
+	// This limits the number of requests that can be made to a service.
+	ServiceMaxRequests(context.Context, ...l402.Service) ([]l402.Caveat,
+		error)
+
+	// ServiceBalances returns the balance caveat for each service. This
+	// funds an L402 with satoshis that are spent by requests to a service.
+	ServiceBalances(context.Context, ...l402.Service) ([]l402.Caveat,
+		error)
+
+	// ServiceTopUp returns what a top-up of an L402 for the service
+	// grants. If it grants nothing, L402s for the service can't be topped
+	// up.
+	ServiceTopUp(context.Context, l402.Service) (TopUpGrant, error)
 }
 
 // Config packages all of the required dependencies to instantiate a new L402
@@ -90,6 +108,39 @@ type Config struct {
 	// on its target services.
 	ServiceLimiter ServiceLimiter
 
+	// Constraints holds the satisfiers of the constraints of services. If
+	// nil, constraint caveats are not enforced.
+	Constraints *l402.ConstraintRegistry
+
+	// TopUps keeps track of the top-ups that extend existing L402s. If
+	// nil, L402s can't be topped up.
+	TopUps TopUpStore
+
+	// Revocations is the list of revoked L402s, which are rejected during
+	// verification. If nil, L402s can only be revoked by their secret.
+	Revocations RevocationStore
+
+	// Tokens keeps the inventory of issued L402s. If nil, issued L402s
+	// aren't recorded.
+	Tokens TokenStore
+
+	// SecretExpiry keeps track of when the secrets of L402s expire so that
+	// they can be pruned. If nil, the secrets are kept forever.
+	SecretExpiry SecretExpiryStore
+
+	// Pricing determines the price of new L402s. If nil, DefaultPricing
+	// is used.
+	Pricing PricingStrategy
+
+	// StatelessVerify, if set, verifies L402s without writing to any
+	// store, so the L402s aren't recorded as settled in the token store.
+	StatelessVerify bool
+
+	// InvoiceExpiry is the duration after which the invoices of L402s
+	// expire. It is needed to determine when the secrets of unpaid L402s
+	// expire.
+	InvoiceExpiry time.Duration
+
 	// Now returns the current time.
 	Now func() time.Time
 }
@@ -98,20 +149,45 @@ type Config struct {
 // services.
 type Mint struct {
 	cfg Config
+
+	// settledMu protects the LRU cache which is not concurrency-safe.
+	settledMu sync.Mutex
+
+	// settled holds the token IDs of the L402s that were recorded as
+	// settled, so that the token store is only written to the first time
+	// an L402 is used.
+	settled *lru.Cache[l402.TokenID, settledToken]
 }
 
 // New creates a new L402 mint backed by its given dependencies.
 func New(cfg *Config) *Mint {
-	return &Mint{cfg: *cfg}
+	m := &Mint{
+		cfg: *cfg,
+		settled: lru.NewCache[l402.TokenID, settledToken](
+			settledTokensCacheSize,
+		),
+	}
+	if m.cfg.Pricing == nil {
+		m.cfg.Pricing = DefaultPricing()
+	}
+
+	return m
 }
 
 // MintL402 mints a new L402 for the target services.
 func (m *Mint) MintL402(ctx context.Context,
 	services ...l402.Service) (*macaroon.Macaroon, string, error) {
 
-	// Let the L402 value as the price of the most expensive of the
-	// services.
-	price := maximumPrice(services)
+	price := m.cfg.Pricing.Price(services, nil)
+
+	return m.mintL402(ctx, price, services, nil)
+}
+
+// mintL402 mints a new L402 for the target services at the given price. If
+// terms are given, they are applied to the L402.
+func (m *Mint) mintL402(ctx context.Context, price int64,
+	services []l402.Service, terms *Terms) (*macaroon.Macaroon, string,
+	error) {
 
 	// We'll start by retrieving a new challenge in the form of a Lightning
 	// payment request to present the requester of the L402 with.
@@ -124,7 +200,11 @@ func (m *Mint) MintL402(ctx context.Context,
 
 	// We can then proceed to mint the L402 with a unique identifier that is
 	// mapped to a unique secret.
-	id, err := createUniqueIdentifier(paymentHash)
+	tokenID, err := generateTokenID()
+	if err != nil {
+		return nil, "", err
+	}
+	id, err := createUniqueIdentifier(tokenID, paymentHash)
 	if err != nil {
 		return nil, "", err
 	}
@@ -147,7 +227,7 @@ func (m *Mint) MintL402(ctx context.Context,
 	var caveats []l402.Caveat
 	if len(services) > 0 {
 		var err error
-		caveats, err = m.caveatsForServices(ctx, services...)
+		caveats, err = m.caveatsForServices(ctx, terms, services...)
 		if err != nil {
 			// Attempt to revoke the secret to save space.
 			_ = m.cfg.Secrets.RevokeSecret(ctx, idHash)
@@ -160,6 +240,38 @@ func (m *Mint) MintL402(ctx context.Context,
 		return nil, "", err
 	}
 
+	if m.cfg.SecretExpiry != nil {
+		expiry, err := m.secretExpiry(paymentHash, services, caveats)
+		if err != nil {
+			_ = m.cfg.Secrets.RevokeSecret(ctx, idHash)
+			return nil, "", err
+		}
+
+		err = m.cfg.SecretExpiry.SetSecretExpiry(ctx, idHash, expiry)
+		if err != nil {
+			_ = m.cfg.Secrets.RevokeSecret(ctx, idHash)
+			return nil, "", fmt.Errorf("unable to set secret "+
+				"expiry: %w", err)
+		}
+	}
+
+	if m.cfg.Tokens != nil {
+		err := m.cfg.Tokens.AddToken(ctx, &Token{
+			TokenID:     tokenID,
+			PaymentHash: paymentHash,
+			Services:    services,
+			Price:       price,
+			CreatedAt:   m.cfg.Now(),
+		})
+		if err != nil {
+			// An L402 that isn't part of the inventory can't be
+			// looked up, so we won't hand it out.
+			_ = m.cfg.Secrets.RevokeSecret(ctx, idHash)
+			return nil, "", fmt.Errorf("unable to record L402: %w",
+				err)
+		}
+	}
+
 	return mac, paymentRequest, nil
 }
 
@@ -179,11 +291,8 @@ func maximumPrice(services []l402.Service) int64 {
 
 // createUniqueIdentifier creates a new L402 identifier bound to a payment hash
 // and a randomly generated ID.
-func createUniqueIdentifier(paymentHash lntypes.Hash) ([]byte, error) {
-	tokenID, err := generateTokenID()
-	if err != nil {
-		return nil, err
-	}
+func createUniqueIdentifier(tokenID l402.TokenID,
+	paymentHash lntypes.Hash) ([]byte, error) {
 
 	id := &l402.Identifier{
 		Version:     l402.LatestVersion,
@@ -206,8 +315,9 @@ func generateTokenID() ([l402.TokenIDSize]byte, error) {
 }
 
 // caveatsForServices returns all of the caveats that should be applied to an
-// L402 for the target services.
-func (m *Mint) caveatsForServices(ctx context.Context,
+// L402 for the target services. If terms are given, they take precedence over
+// the restrictions of the service limiter.
+func (m *Mint) caveatsForServices(ctx context.Context, terms *Terms,
 	services ...l402.Service) ([]l402.Caveat, error) {
 
 	servicesCaveat, err := l402.NewServicesCaveat(services...)
@@ -230,11 +340,34 @@ func (m *Mint) caveatsForServices(ctx context.Context,
 	if err != nil {
 		return nil, err
 	}
+	maxRequests, err := m.cfg.ServiceLimiter.ServiceMaxRequests(
+		ctx, services...,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	balances, err := m.cfg.ServiceLimiter.ServiceBalances(ctx, services...)
+	if err != nil {
+		return nil, err
+	}
+
+	if terms != nil {
+		capabilities, timeouts = terms.apply(
+			services, capabilities, timeouts, m.cfg.Now,
+		)
+	}
 
 	caveats := []l402.Caveat{servicesCaveat}
 	caveats = append(caveats, capabilities...)
 	caveats = append(caveats, constraints...)
 	caveats = append(caveats, timeouts...)
+	caveats = append(caveats, maxRequests...)
+	caveats = append(caveats, balances...)
+	if terms != nil {
+		caveats = append(caveats, terms.Caveats...)
+	}
+
 	return caveats, nil
 }
 
@@ -250,37 +383,129 @@ type VerificationParams struct {
 	// TargetService is the target service a user of an L402 is attempting
 	// to access.
 	TargetService string
+
+	// Request is the request the L402 is used for. It is needed to verify
+	// constraints that restrict the requests made with an L402.
+	Request *http.Request
+
+	// TopUpPreimage is the preimage of a paid top-up invoice that is sent
+	// along with the L402 to extend it. It is nil if no top-up was sent.
+	TopUpPreimage *lntypes.Preimage
 }
 
 // VerifyL402 attempts to verify an L402 with the given parameters.
 func (m *Mint) VerifyL402(ctx context.Context,
 	params *VerificationParams) error {
 
+	id, caveats, err := m.verifySignature(ctx, params)
+	if err != nil {
+		return err
+	}
+
+	// If a paid top-up was sent along with the L402, we'll redeem it
+	// before inspecting the caveats, so they're checked against the
+	// extended L402.
+	if params.TopUpPreimage != nil {
+		err := m.redeemTopUp(
+			ctx, id, sha256.Sum256(params.Macaroon.Id()), caveats,
+			params.TargetService, *params.TopUpPreimage,
+		)
+		if err != nil {
+			return fmt.Errorf("unable to redeem top-up: %w", err)
+		}
+	}
+
+	// With the L402 verified, we'll now inspect its caveats to ensure the
+	// target service is authorized.
+	return m.verifyCaveats(ctx, id, caveats, params)
+}
+
+// VerifyCaveats verifies the caveats of an L402 whose signature and payment
+// were verified before with VerifyL402, for example by a cache of verified
+// L402s. The secret of the L402 isn't looked up, but the L402 is still checked
+// against the revocation list, so that revocations made through other
+// instances take effect right away.
+func (m *Mint) VerifyCaveats(ctx context.Context,
+	params *VerificationParams) error {
+
+	id, err := l402.DecodeIdentifier(bytes.NewReader(params.Macaroon.Id()))
+	if err != nil {
+		return err
+	}
+	if err := m.checkRevocation(ctx, id); err != nil {
+		return err
+	}
+
+	caveats := make([]l402.Caveat, 0, len(params.Macaroon.Caveats()))
+	for _, rawCaveat := range params.Macaroon.Caveats() {
+		// Only first-party caveats are verified by us.
+		if len(rawCaveat.VerificationId) > 0 {
+			continue
+		}
+
+		caveat, err := l402.DecodeCaveat(string(rawCaveat.Id))
+		if err != nil {
+			continue
+		}
+		caveats = append(caveats, caveat)
+	}
+
+	return m.verifyCaveats(ctx, id, caveats, params)
+}
+
+// verifyCaveats makes sure the caveats of the L402 with the given identifier
+// authorize the request of the given parameters.
+func (m *Mint) verifyCaveats(ctx context.Context, id *l402.Identifier,
+	caveats []l402.Caveat, params *VerificationParams) error {
+
+	satisfiers := []l402.Satisfier{
+		l402.NewServicesSatisfier(params.TargetService),
+		m.timeoutSatisfier(ctx, id.TokenID, params.TargetService),
+		l402.NewMaxRequestsSatisfier(params.TargetService),
+		l402.NewBalanceSatisfier(params.TargetService),
+	}
+	if m.cfg.Constraints != nil {
+		constraints := m.cfg.Constraints.Satisfiers(params.Request)
+		satisfiers = append(satisfiers, constraints...)
+	}
+
+	return l402.VerifyCaveats(caveats, satisfiers...)
+}
+
+// verifySignature makes sure the L402 of the given parameters was paid for and
+// minted by us. Its identifier and first-party caveats are returned, which
+// still need to be verified.
+func (m *Mint) verifySignature(ctx context.Context,
+	params *VerificationParams) (*l402.Identifier, []l402.Caveat, error) {
+
 	// We'll first perform a quick check to determine if a valid preimage
 	// was provided.
 	id, err := l402.DecodeIdentifier(bytes.NewReader(params.Macaroon.Id()))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	if params.Preimage.Hash() != id.PaymentHash {
-		return fmt.Errorf("invalid preimage %v for %v", params.Preimage,
-			id.PaymentHash)
+		return nil, nil, fmt.Errorf("invalid preimage %v for %v",
+			params.Preimage, id.PaymentHash)
+	}
+
+	// Revoked L402s are rejected right away, no matter if they're still
+	// valid otherwise.
+	if err := m.checkRevocation(ctx, id); err != nil {
+		return nil, nil, err
 	}
 
 	// If there was, then we'll ensure the L402 was minted by us.
-	secret, err := m.cfg.Secrets.GetSecret(
-		ctx, sha256.Sum256(params.Macaroon.Id()),
-	)
+	idHash := sha256.Sum256(params.Macaroon.Id())
+	secret, err := m.cfg.Secrets.GetSecret(ctx, idHash)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 	rawCaveats, err := params.Macaroon.VerifySignature(secret[:], nil)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	// With the L402 verified, we'll now inspect its caveats to ensure the
-	// target service is authorized.
 	caveats := make([]l402.Caveat, 0, len(rawCaveats))
 	for _, rawCaveat := range rawCaveats {
 		// L402s can contain third-party caveats that we're not aware
@@ -291,9 +516,34 @@ func (m *Mint) VerifyL402(ctx context.Context,
 		}
 		caveats = append(caveats, caveat)
 	}
-	return l402.VerifyCaveats(
-		caveats,
-		l402.NewServicesSatisfier(params.TargetService),
-		l402.NewTimeoutSatisfier(params.TargetService, m.cfg.Now),
+
+	if m.cfg.Tokens != nil && !m.cfg.StatelessVerify {
+		err := m.settleToken(ctx, id.TokenID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("unable to settle L402: %w",
+				err)
+		}
+	}
+
+	return id, caveats, nil
+}
+
+// checkRevocation returns ErrL402Revoked if the L402 with the given identifier
+// is on the revocation list.
+func (m *Mint) checkRevocation(ctx context.Context, id *l402.Identifier) error {
+	if m.cfg.Revocations == nil {
+		return nil
+	}
+
+	revoked, err := m.cfg.Revocations.IsRevoked(
+		ctx, id.TokenID, id.PaymentHash,
 	)
+	if err != nil {
+		return fmt.Errorf("unable to check revocation: %w", err)
+	}
+	if revoked {
+		return ErrL402Revoked
+	}
+
+	return nil
 }
@@ -1,13 +1,17 @@
 package mint
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/macaroon.v2"
 )
@@ -54,6 +58,15 @@ func TestBasicL402(t *testing.T) {
 	if !strings.Contains(err.Error(), "not authorized") {
 		t.Fatal("expected L402 to not be authorized")
 	}
+
+	// The same holds when only its caveats are verified.
+	if err := mint.VerifyCaveats(ctx, &params); err != nil {
+		t.Fatalf("unable to verify L402 caveats: %v", err)
+	}
+	err = mint.VerifyCaveats(ctx, &unknownParams)
+	if !strings.Contains(err.Error(), "not authorized") {
+		t.Fatal("expected L402 to not be authorized")
+	}
 }
 
 // TestAdminL402 ensures that an admin L402 (one without a services caveat) is
@@ -123,6 +136,193 @@ func TestRevokedL402(t *testing.T) {
 	}
 }
 
+// TestRevocationList ensures that L402s on the revocation list can no longer be
+// verified, whether they're revoked by token ID or by payment hash.
+func TestRevocationList(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	revocations := &mockRevocationStore{}
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Revocations:    revocations,
+		Now:            time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+	id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+	require.NoError(t, err)
+
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	// Revoking an unrelated L402 doesn't affect ours.
+	err = revocations.RevokeL402(ctx, &Revocation{
+		TokenID:     l402.TokenID{1},
+		PaymentHash: lntypes.Hash{1},
+	})
+	require.NoError(t, err)
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	// Once revoked by its token ID, the L402 is rejected, even if only its
+	// caveats are verified.
+	err = revocations.RevokeL402(ctx, &Revocation{TokenID: id.TokenID})
+	require.NoError(t, err)
+	err = mint.VerifyL402(ctx, params)
+	require.ErrorIs(t, err, ErrL402Revoked)
+	err = mint.VerifyCaveats(ctx, params)
+	require.ErrorIs(t, err, ErrL402Revoked)
+
+	// The same holds for L402s revoked by their payment hash.
+	revocations.revocations = nil
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	err = revocations.RevokeL402(ctx, &Revocation{
+		PaymentHash: id.PaymentHash,
+	})
+	require.NoError(t, err)
+	err = mint.VerifyL402(ctx, params)
+	require.ErrorIs(t, err, ErrL402Revoked)
+}
+
+// TestTokenInventory ensures that minted L402s are recorded in the inventory
+// and marked as settled once they're used with the preimage of their invoice.
+func TestTokenInventory(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tokens := &mockTokenStore{}
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Tokens:         tokens,
+		Now:            time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+	id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+	require.NoError(t, err)
+
+	token, err := tokens.GetToken(ctx, id.TokenID)
+	require.NoError(t, err)
+	require.Equal(t, testHash, token.PaymentHash)
+	require.Equal(t, []l402.Service{testService}, token.Services)
+	require.Equal(t, testService.Price, token.Price)
+	require.False(t, token.CreatedAt.IsZero())
+	require.True(t, token.SettledAt.IsZero())
+
+	// An invalid preimage doesn't settle the L402.
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      lntypes.Preimage{},
+		TargetService: testService.Name,
+	}
+	require.Error(t, mint.VerifyL402(ctx, params))
+	require.True(t, token.SettledAt.IsZero())
+
+	// Using it with the preimage of its invoice does.
+	params.Preimage = testPreimage
+	require.NoError(t, mint.VerifyL402(ctx, params))
+	settledAt := token.SettledAt
+	require.False(t, settledAt.IsZero())
+
+	// Later uses don't change the time it was settled at and don't write
+	// to the token store again.
+	require.NoError(t, mint.VerifyL402(ctx, params))
+	require.Equal(t, settledAt, token.SettledAt)
+	require.Equal(t, 1, tokens.settles)
+}
+
+// TestSecretExpiry ensures that the mint records when the secrets of L402s
+// expire and that they're settled from the state of their invoices.
+func TestSecretExpiry(t *testing.T) {
+	t.Parallel()
+
+	mockTime := newMockTime(1000)
+	expiries := newMockSecretExpiryStore()
+	limiter := newMockServiceLimiter()
+	otherService := l402.Service{Name: "other", Tier: l402.BaseTier}
+
+	ctx := context.Background()
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: limiter,
+		SecretExpiry:   expiries,
+		InvoiceExpiry:  time.Hour,
+		Now:            mockTime.now,
+	})
+
+	// An L402 that never expires only has an invoice expiry.
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	idHash := sha256.Sum256(mac.Id())
+	expiry := expiries.expiries[idHash]
+	require.Equal(t, time.Unix(1000+3600, 0), expiry.InvoiceExpiry)
+	require.True(t, expiry.ValidUntil.IsZero())
+	require.False(t, expiries.settled[idHash])
+
+	// Verifying the L402 doesn't write anything, the secret is only
+	// settled from the state of its invoice when it is pruned.
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, params))
+	require.False(t, expiries.settled[idHash])
+	require.Equal(t, testHash, expiry.PaymentHash)
+
+	// An L402 expires once all of its services expired. As long as one of
+	// them doesn't expire, the L402 doesn't either.
+	limiter.timeouts[testService] = l402.NewTimeoutCaveat(
+		testService.Name, 100, mockTime.now,
+	)
+	mac, _, err = mint.MintL402(ctx, testService, otherService)
+	require.NoError(t, err)
+	expiry = expiries.expiries[sha256.Sum256(mac.Id())]
+	require.True(t, expiry.ValidUntil.IsZero())
+
+	limiter.timeouts[otherService] = l402.NewTimeoutCaveat(
+		otherService.Name, 200, mockTime.now,
+	)
+	mac, _, err = mint.MintL402(ctx, testService, otherService)
+	require.NoError(t, err)
+	expiry = expiries.expiries[sha256.Sum256(mac.Id())]
+	require.Equal(t, time.Unix(1000+200, 0), expiry.ValidUntil)
+
+	// Once their invoices expired, the secrets of paid L402s are settled
+	// instead of being pruned, so only the one that expired is pruned.
+	invoices := &mockInvoiceLookup{
+		paid: map[lntypes.Hash]bool{testHash: true},
+	}
+	pruneBefore := time.Unix(1000+3600+1, 0)
+	pruned, err := PruneSecrets(ctx, expiries, invoices, pruneBefore)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	require.True(t, expiries.settled[idHash])
+
+	// The secrets of L402s whose invoices expired unpaid are pruned.
+	_, _, err = mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	invoices.paid = nil
+	pruned, err = PruneSecrets(ctx, expiries, invoices, pruneBefore)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	require.Len(t, expiries.expiries, 2)
+}
+
 // TestTamperedL402 ensures that an L402 that has been tampered with by
 // modifying its signature results in its verification failing.
 func TestTamperedL402(t *testing.T) {
@@ -278,6 +478,265 @@ func TestExpiredServicesL402(t *testing.T) {
 	require.Contains(t, err.Error(), "not authorized")
 }
 
+// TestConstraintsL402 asserts that the constraints of a service are enforced
+// by their registered satisfiers.
+func TestConstraintsL402(t *testing.T) {
+	t.Parallel()
+
+	constraints := l402.NewConstraintRegistry()
+	err := constraints.RegisterSatisfier(l402.Satisfier{
+		Condition: "plan",
+		SatisfyFinal: func(c l402.Caveat) error {
+			if c.Value != "pro" {
+				return errors.New("plan not supported")
+			}
+
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	serviceLimiter := newMockServiceLimiter()
+	serviceLimiter.constraints[testService] = []l402.Caveat{
+		l402.NewCaveat(l402.CondAllowedMethods, "GET,HEAD"),
+		l402.NewCaveat("plan", "pro"),
+	}
+
+	ctx := context.Background()
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: serviceLimiter,
+		Constraints:    constraints,
+		Now:            time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	params := VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+		Request:       httptest.NewRequest("GET", "/", nil),
+	}
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+
+	// Requests with a method that isn't allowed are rejected.
+	params.Request = httptest.NewRequest("POST", "/", nil)
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "method POST not allowed")
+
+	// Constraints that depend on the request fail closed if it's unknown.
+	params.Request = nil
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorIs(t, err, l402.ErrUnknownRequest)
+
+	// Custom constraints without SatisfyPrevious are only satisfied by the
+	// final caveat of their condition.
+	params.Request = httptest.NewRequest("HEAD", "/", nil)
+	err = l402.AddFirstPartyCaveats(mac, l402.NewCaveat("plan", "free"))
+	require.NoError(t, err)
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "plan not supported")
+}
+
+// TestMaxRequestsL402 asserts that the max requests caveat of a service is
+// added to its L402s and can't be raised.
+func TestMaxRequestsL402(t *testing.T) {
+	t.Parallel()
+
+	serviceLimiter := newMockServiceLimiter()
+	serviceLimiter.maxRequests[testService] = l402.NewMaxRequestsCaveat(
+		testService.Name, 100,
+	)
+
+	ctx := context.Background()
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: serviceLimiter,
+		Now:            time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	value, ok := l402.HasCaveat(
+		mac, testService.Name+l402.CondMaxRequestsSuffix,
+	)
+	require.True(t, ok)
+	require.Equal(t, "100", value)
+
+	params := VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+
+	// Raising the number of requests invalidates the L402.
+	raised := l402.NewMaxRequestsCaveat(testService.Name, 1000)
+	require.NoError(t, l402.AddFirstPartyCaveats(mac, raised))
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "increasing restrictiveness")
+}
+
+// TestBalanceL402 asserts that the balance caveat of a service is added to its
+// L402s and can't be raised.
+func TestBalanceL402(t *testing.T) {
+	t.Parallel()
+
+	serviceLimiter := newMockServiceLimiter()
+	serviceLimiter.balances[testService] = l402.NewBalanceCaveat(
+		testService.Name, 5000,
+	)
+
+	ctx := context.Background()
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: serviceLimiter,
+		Now:            time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	value, ok := l402.HasCaveat(
+		mac, testService.Name+l402.CondBalanceSuffix,
+	)
+	require.True(t, ok)
+	require.Equal(t, "5000", value)
+
+	params := VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+
+	// Raising the balance invalidates the L402.
+	raised := l402.NewBalanceCaveat(testService.Name, 50000)
+	require.NoError(t, l402.AddFirstPartyCaveats(mac, raised))
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "increasing restrictiveness")
+}
+
+// TestTopUpL402 asserts that an L402 can be topped up to extend its validity
+// instead of replacing it with a new one.
+func TestTopUpL402(t *testing.T) {
+	t.Parallel()
+
+	initialTime := int64(1000)
+	mockTime := newMockTime(initialTime)
+
+	serviceLimiter := newMockServiceLimiter()
+	serviceLimiter.timeouts[testService] = l402.NewTimeoutCaveat(
+		testService.Name, 1000, mockTime.now,
+	)
+	serviceLimiter.topUps[testService] = TopUpGrant{
+		Validity: 1000 * time.Second,
+	}
+
+	ctx := context.Background()
+	topUps := newMockTopUpStore()
+	challenger := newMockChallenger()
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     challenger,
+		ServiceLimiter: serviceLimiter,
+		TopUps:         topUps,
+		InvoiceExpiry:  100 * time.Second,
+		Now:            mockTime.now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+	params := VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+
+	// A top-up can only be requested for the tier of the L402 and for
+	// services that support top-ups.
+	otherTier := testService
+	otherTier.Tier = 1
+	_, err = mint.MintTopUp(ctx, &params, otherTier, true)
+	require.ErrorIs(t, err, ErrTopUpUnsupported)
+
+	noTopUps := l402.Service{Name: "other"}
+	_, err = mint.MintTopUp(ctx, &params, noTopUps, true)
+	require.ErrorIs(t, err, ErrTopUpUnsupported)
+
+	// An L402 that is neither used up nor expired isn't offered a top-up.
+	_, err = mint.MintTopUp(ctx, &params, testService, false)
+	require.ErrorIs(t, err, ErrTopUpNotNeeded)
+
+	// Sending a preimage of an unknown top-up fails.
+	topUpParams := params
+	topUpParams.TopUpPreimage = &testPreimage
+	err = mint.VerifyL402(ctx, &topUpParams)
+	require.ErrorIs(t, err, ErrTopUpNotFound)
+
+	payReq, err := mint.MintTopUp(ctx, &params, testService, true)
+	require.NoError(t, err)
+	require.Equal(t, testPayReq, payReq)
+	require.Equal(t, 2, challenger.challenges)
+
+	// The invoice of the pending top-up is offered again instead of
+	// creating a new one.
+	payReq, err = mint.MintTopUp(ctx, &params, testService, true)
+	require.NoError(t, err)
+	require.Equal(t, testPayReq, payReq)
+	require.Equal(t, 2, challenger.challenges)
+
+	// Once the L402 expired, the top-up is still pending so the L402 is no
+	// longer valid.
+	mockTime.setTime(initialTime + 1500)
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "not authorized")
+
+	// The invoice of the top-up expired as well. It isn't pruned while
+	// its invoice is reported as paid, so it can still be redeemed.
+	invoices := &mockInvoiceLookup{
+		paid: map[lntypes.Hash]bool{testHash: true},
+	}
+	pruned, err := PruneTopUps(ctx, topUps, invoices, mockTime.now())
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	invoices.paid[testHash] = false
+	pruned, err = PruneTopUps(ctx, topUps, invoices, mockTime.now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	_, err = topUps.GetTopUp(ctx, testHash)
+	require.ErrorIs(t, err, ErrTopUpNotFound)
+
+	// The expired L402 is offered a new top-up.
+	payReq, err = mint.MintTopUp(ctx, &params, testService, false)
+	require.NoError(t, err)
+	require.Equal(t, testPayReq, payReq)
+	require.Equal(t, 3, challenger.challenges)
+
+	// Redeeming the top-up extends the L402 from now on.
+	require.NoError(t, mint.VerifyL402(ctx, &topUpParams))
+	topUp, err := topUps.GetTopUp(ctx, testHash)
+	require.NoError(t, err)
+	require.True(t, topUp.Settled)
+	require.Equal(t, time.Unix(initialTime+2500, 0), topUp.ValidUntil)
+
+	// The top-up can be sent again and the L402 stays valid without it
+	// until the extended validity is reached.
+	require.NoError(t, mint.VerifyL402(ctx, &topUpParams))
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+
+	mockTime.setTime(initialTime + 2500)
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorContains(t, err, "not authorized")
+}
+
 type mockTime struct {
 	time time.Time
 }
@@ -295,3 +754,389 @@ func (mt *mockTime) now() time.Time {
 func (mt *mockTime) setTime(timestamp int64) {
 	mt.time = time.Unix(timestamp, 0)
 }
+
+// TestRootKeyWrapSecret ensures that a wrapped secret can only be unwrapped
+// with the same root key and for the same hash.
+func TestRootKeyWrapSecret(t *testing.T) {
+	t.Parallel()
+
+	rootKey, err := NewRootKey(1, time.Unix(1000, 0))
+	require.NoError(t, err)
+	otherKey, err := NewRootKey(2, time.Unix(2000, 0))
+	require.NoError(t, err)
+
+	hash := [sha256.Size]byte{1}
+	secret := [l402.SecretSize]byte{2}
+	wrapped, err := rootKey.WrapSecret(hash, secret)
+	require.NoError(t, err)
+	require.NotContains(t, string(wrapped), string(secret[:]))
+
+	unwrapped, err := rootKey.UnwrapSecret(hash, wrapped)
+	require.NoError(t, err)
+	require.Equal(t, secret, unwrapped)
+
+	_, err = otherKey.UnwrapSecret(hash, wrapped)
+	require.Error(t, err)
+
+	_, err = rootKey.UnwrapSecret([sha256.Size]byte{3}, wrapped)
+	require.Error(t, err)
+
+	_, err = rootKey.UnwrapSecret(hash, wrapped[1:])
+	require.Error(t, err)
+}
+
+// TestDerivedSecretStore ensures that L402s minted with derived secrets can be
+// verified by every instance that shares the root key until they're revoked.
+func TestDerivedSecretStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mockTime := newMockTime(1000)
+	denylist := newMockSecretDenylist()
+
+	rootKey := [RootKeySize]byte{1}
+	secrets := NewDerivedSecretStore(rootKey, denylist, time.Minute)
+	secrets.now = mockTime.now
+	mint := New(&Config{
+		Secrets:        secrets,
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Now:            time.Now,
+	})
+
+	macaroon, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+
+	params := VerificationParams{
+		Macaroon:      macaroon,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+
+	// Another instance with the same root key derives the same secret,
+	// while one with a different root key doesn't.
+	other := NewDerivedSecretStore(rootKey, denylist, time.Minute)
+	other.now = mockTime.now
+	otherMint := New(&Config{
+		Secrets:        other,
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Now:            time.Now,
+	})
+	require.NoError(t, otherMint.VerifyL402(ctx, &params))
+
+	wrongMint := New(&Config{
+		Secrets: NewDerivedSecretStore(
+			[RootKeySize]byte{2}, denylist, time.Minute,
+		),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Now:            time.Now,
+	})
+	require.Error(t, wrongMint.VerifyL402(ctx, &params))
+
+	// The denylist is only loaded once per refresh interval.
+	loads := denylist.loads
+	require.NoError(t, mint.VerifyL402(ctx, &params))
+	require.Equal(t, loads, denylist.loads)
+
+	// Revoking the secret takes effect immediately for the instance that
+	// revoked it and after the next refresh for the other one.
+	idHash := sha256.Sum256(macaroon.Id())
+	require.NoError(t, secrets.RevokeSecret(ctx, idHash))
+
+	err = mint.VerifyL402(ctx, &params)
+	require.ErrorIs(t, err, ErrSecretNotFound)
+	require.NoError(t, otherMint.VerifyL402(ctx, &params))
+
+	mockTime.setTime(1000 + 60)
+	err = otherMint.VerifyL402(ctx, &params)
+	require.ErrorIs(t, err, ErrSecretNotFound)
+}
+
+// TestCachedRevocationStore ensures that the revocation list is served from
+// memory and reloaded once per refresh interval, and that stateless
+// verification doesn't record L402s as settled.
+func TestCachedRevocationStore(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	mockTime := newMockTime(1000)
+	store := &mockRevocationStore{}
+	tokens := &mockTokenStore{}
+
+	revocations := NewCachedRevocationStore(store, time.Minute)
+	revocations.now = mockTime.now
+	mint := New(&Config{
+		Secrets:         newMockSecretStore(),
+		Challenger:      newMockChallenger(),
+		ServiceLimiter:  newMockServiceLimiter(),
+		Revocations:     revocations,
+		Tokens:          tokens,
+		StatelessVerify: true,
+		Now:             time.Now,
+	})
+
+	mac, _, err := mint.MintL402(ctx, testService)
+	require.NoError(t, err)
+	id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+	require.NoError(t, err)
+
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, params))
+	require.Zero(t, tokens.settles)
+
+	// A revocation made through the cached store takes effect right away.
+	err = revocations.RevokeL402(ctx, &Revocation{TokenID: id.TokenID})
+	require.NoError(t, err)
+	err = mint.VerifyL402(ctx, params)
+	require.ErrorIs(t, err, ErrL402Revoked)
+
+	// A revocation made by another instance takes effect once the list
+	// was reloaded.
+	store.revocations = nil
+	mockTime.setTime(1000 + 60)
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	err = store.RevokeL402(ctx, &Revocation{PaymentHash: id.PaymentHash})
+	require.NoError(t, err)
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	mockTime.setTime(1000 + 120)
+	err = mint.VerifyL402(ctx, params)
+	require.ErrorIs(t, err, ErrL402Revoked)
+}
+
+// TestBundleL402 ensures that an L402 of a bundle grants access to all services
+// of the bundle and is priced at the price of the bundle.
+func TestBundleL402(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	tokens := &mockTokenStore{}
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Tokens:         tokens,
+		Now:            time.Now,
+	})
+
+	_, _, err := mint.MintBundleL402(ctx, &Bundle{Name: "empty"})
+	require.ErrorIs(t, err, ErrEmptyBundle)
+
+	otherService := l402.Service{Name: "other", Price: 2}
+	mac, _, err := mint.MintBundleL402(ctx, &Bundle{
+		Name:     "bundle",
+		Services: []l402.Service{testService, otherService},
+		Price:    5,
+	})
+	require.NoError(t, err)
+
+	require.Len(t, tokens.tokens, 1)
+	require.EqualValues(t, 5, tokens.tokens[0].Price)
+
+	for _, service := range []string{testService.Name, "other"} {
+		params := &VerificationParams{
+			Macaroon:      mac,
+			Preimage:      testPreimage,
+			TargetService: service,
+		}
+		require.NoError(t, mint.VerifyL402(ctx, params))
+	}
+
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: "unknown",
+	}
+	require.Error(t, mint.VerifyL402(ctx, params))
+}
+
+// TestPricingStrategies tests the strategies L402s for several services can be
+// priced with.
+func TestPricingStrategies(t *testing.T) {
+	t.Parallel()
+
+	services := []l402.Service{
+		{Name: "service1", Price: 10},
+		{Name: "service2", Price: 25},
+	}
+	single := services[:1]
+	bundle := &Bundle{Name: "bundle", Services: services, Price: 30}
+	noPrice := &Bundle{Name: "noprice", Services: services}
+
+	tests := []struct {
+		name     string
+		strategy PricingStrategy
+		services []l402.Service
+		bundle   *Bundle
+		price    int64
+	}{{
+		name:     "max",
+		strategy: NewMaxPricing(),
+		services: services,
+		bundle:   bundle,
+		price:    25,
+	}, {
+		name:     "sum",
+		strategy: NewSumPricing(),
+		services: services,
+		bundle:   bundle,
+		price:    35,
+	}, {
+		name:     "bundle price",
+		strategy: NewBundlePricing(NewSumPricing()),
+		services: services,
+		bundle:   bundle,
+		price:    30,
+	}, {
+		name:     "bundle without price",
+		strategy: NewBundlePricing(NewSumPricing()),
+		services: services,
+		bundle:   noPrice,
+		price:    35,
+	}, {
+		name:     "no bundle",
+		strategy: NewBundlePricing(NewMaxPricing()),
+		services: services,
+		price:    25,
+	}, {
+		name:     "default with bundle",
+		strategy: DefaultPricing(),
+		services: services,
+		bundle:   bundle,
+		price:    30,
+	}, {
+		name:     "default without bundle",
+		strategy: DefaultPricing(),
+		services: services,
+		price:    25,
+	}, {
+		name:     "discount",
+		strategy: NewDiscountPricing(NewSumPricing(), 10),
+		services: services,
+		bundle:   bundle,
+		price:    32,
+	}, {
+		name:     "discount of single service",
+		strategy: NewDiscountPricing(NewSumPricing(), 10),
+		services: single,
+		price:    10,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			price := test.strategy.Price(test.services, test.bundle)
+			require.Equal(t, test.price, price)
+		})
+	}
+
+	// The mint charges the price of its strategy for bundles.
+	ctx := context.Background()
+	tokens := &mockTokenStore{}
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Tokens:         tokens,
+		Pricing:        NewSumPricing(),
+		Now:            time.Now,
+	})
+
+	_, _, err := mint.MintBundleL402(ctx, bundle)
+	require.NoError(t, err)
+	require.Len(t, tokens.tokens, 1)
+	require.EqualValues(t, 35, tokens.tokens[0].Price)
+
+	// Without a strategy, the mint uses the default one, which is also
+	// the default of the configuration.
+	tokens = &mockTokenStore{}
+	mint = New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: newMockServiceLimiter(),
+		Tokens:         tokens,
+		Now:            time.Now,
+	})
+
+	_, _, err = mint.MintBundleL402(ctx, noPrice)
+	require.NoError(t, err)
+	require.Len(t, tokens.tokens, 1)
+	require.EqualValues(t, 25, tokens.tokens[0].Price)
+}
+
+// TestTermsL402 tests that the terms an L402 is minted under take precedence
+// over the restrictions of the service limiter.
+func TestTermsL402(t *testing.T) {
+	t.Parallel()
+
+	initialTime := int64(1000)
+	mockTime := newMockTime(initialTime)
+
+	ctx := context.Background()
+	limiter := newMockServiceLimiter()
+	limiter.capabilities[testService] = l402.NewCapabilitiesCaveat(
+		testService.Name, "read",
+	)
+	limiter.timeouts[testService] = l402.NewTimeoutCaveat(
+		testService.Name, 10_000, mockTime.now,
+	)
+	mint := New(&Config{
+		Secrets:        newMockSecretStore(),
+		Challenger:     newMockChallenger(),
+		ServiceLimiter: limiter,
+		Now:            mockTime.now,
+	})
+
+	// Custom caveats can't replace the restrictions aperture adds itself.
+	_, _, err := mint.MintL402WithTerms(ctx, testService, &Terms{
+		Caveats: []l402.Caveat{l402.NewCapabilitiesCaveat(
+			testService.Name, "admin",
+		)},
+	})
+	require.ErrorContains(t, err, "is reserved")
+
+	mac, _, err := mint.MintL402WithTerms(ctx, testService, &Terms{
+		Timeout:      100 * time.Second,
+		Capabilities: []string{"read", "write"},
+		Caveats:      []l402.Caveat{l402.NewCaveat("custom", "value")},
+	})
+	require.NoError(t, err)
+
+	conditions := make(map[string][]string)
+	for _, rawCaveat := range mac.Caveats() {
+		caveat, err := l402.DecodeCaveat(string(rawCaveat.Id))
+		require.NoError(t, err)
+
+		conditions[caveat.Condition] = append(
+			conditions[caveat.Condition], caveat.Value,
+		)
+	}
+	require.Equal(
+		t, []string{"read,write"},
+		conditions[testService.Name+l402.CondCapabilitiesSuffix],
+	)
+	require.Equal(
+		t, []string{"1100"},
+		conditions[testService.Name+l402.CondTimeoutSuffix],
+	)
+	require.Equal(t, []string{"value"}, conditions["custom"])
+
+	params := &VerificationParams{
+		Macaroon:      mac,
+		Preimage:      testPreimage,
+		TargetService: testService.Name,
+	}
+	require.NoError(t, mint.VerifyL402(ctx, params))
+
+	// The L402 expires after the timeout of the terms rather than the one
+	// of the service limiter.
+	mockTime.setTime(initialTime + 101)
+	require.ErrorContains(t, mint.VerifyL402(ctx, params), "not authorized")
+}
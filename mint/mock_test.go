@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/rand"
 	"crypto/sha256"
+	"time"
 
 	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightningnetwork/lnd/lntypes"
@@ -18,7 +19,9 @@ var (
 	testPayReq = "lnsb1..."
 )
 
-type mockChallenger struct{}
+type mockChallenger struct {
+	challenges int
+}
 
 var _ Challenger = (*mockChallenger)(nil)
 
@@ -37,6 +40,7 @@ func (d *mockChallenger) Stop() {
 func (d *mockChallenger) NewChallenge(price int64) (string, lntypes.Hash,
 	error) {
 
+	d.challenges++
 	return testPayReq, testHash, nil
 }
 
@@ -84,6 +88,10 @@ type mockServiceLimiter struct {
 	capabilities map[l402.Service]l402.Caveat
 	constraints  map[l402.Service][]l402.Caveat
 	timeouts     map[l402.Service]l402.Caveat
+	maxRequests  map[l402.Service]l402.Caveat
+
+	balances map[l402.Service]l402.Caveat
+	topUps   map[l402.Service]TopUpGrant
 }
 
 var _ ServiceLimiter = (*mockServiceLimiter)(nil)
@@ -93,6 +101,9 @@ func newMockServiceLimiter() *mockServiceLimiter {
 		capabilities: make(map[l402.Service]l402.Caveat),
 		constraints:  make(map[l402.Service][]l402.Caveat),
 		timeouts:     make(map[l402.Service]l402.Caveat),
+		maxRequests:  make(map[l402.Service]l402.Caveat),
+		balances:     make(map[l402.Service]l402.Caveat),
+		topUps:       make(map[l402.Service]TopUpGrant),
 	}
 }
 
@@ -137,3 +148,329 @@ func (l *mockServiceLimiter) ServiceTimeouts(ctx context.Context,
 	}
 	return res, nil
 }
+
+func (l *mockServiceLimiter) ServiceMaxRequests(ctx context.Context,
+	services ...l402.Service) ([]l402.Caveat, error) {
+
+	res := make([]l402.Caveat, 0, len(services))
+	for _, service := range services {
+		maxRequests, ok := l.maxRequests[service]
+		if !ok {
+			continue
+		}
+		res = append(res, maxRequests)
+	}
+	return res, nil
+}
+
+func (l *mockServiceLimiter) ServiceBalances(ctx context.Context,
+	services ...l402.Service) ([]l402.Caveat, error) {
+
+	res := make([]l402.Caveat, 0, len(services))
+	for _, service := range services {
+		balance, ok := l.balances[service]
+		if !ok {
+			continue
+		}
+		res = append(res, balance)
+	}
+	return res, nil
+}
+
+func (l *mockServiceLimiter) ServiceTopUp(ctx context.Context,
+	service l402.Service) (TopUpGrant, error) {
+
+	return l.topUps[service], nil
+}
+
+type mockTopUpStore struct {
+	topUps map[lntypes.Hash]*TopUp
+}
+
+var _ TopUpStore = (*mockTopUpStore)(nil)
+
+func newMockTopUpStore() *mockTopUpStore {
+	return &mockTopUpStore{
+		topUps: make(map[lntypes.Hash]*TopUp),
+	}
+}
+
+func (s *mockTopUpStore) AddTopUp(ctx context.Context, topUp *TopUp) error {
+	topUpCopy := *topUp
+	s.topUps[topUp.PaymentHash] = &topUpCopy
+	return nil
+}
+
+func (s *mockTopUpStore) GetTopUp(ctx context.Context,
+	hash lntypes.Hash) (*TopUp, error) {
+
+	topUp, ok := s.topUps[hash]
+	if !ok {
+		return nil, ErrTopUpNotFound
+	}
+	topUpCopy := *topUp
+	return &topUpCopy, nil
+}
+
+func (s *mockTopUpStore) SettleTopUp(ctx context.Context, hash lntypes.Hash,
+	validUntil time.Time) error {
+
+	topUp, ok := s.topUps[hash]
+	if !ok {
+		return ErrTopUpNotFound
+	}
+	if topUp.Settled {
+		return ErrTopUpSettled
+	}
+	topUp.Settled = true
+	topUp.ValidUntil = validUntil
+	return nil
+}
+
+func (s *mockTopUpStore) ValidUntil(ctx context.Context, tokenID l402.TokenID,
+	service string) (time.Time, error) {
+
+	var validUntil time.Time
+	for _, topUp := range s.topUps {
+		if topUp.TokenID != tokenID || topUp.Service != service ||
+			!topUp.Settled {
+
+			continue
+		}
+		if topUp.ValidUntil.After(validUntil) {
+			validUntil = topUp.ValidUntil
+		}
+	}
+	return validUntil, nil
+}
+
+func (s *mockTopUpStore) PendingTopUp(ctx context.Context,
+	tokenID l402.TokenID, service string, after time.Time) (*TopUp, error) {
+
+	for _, topUp := range s.topUps {
+		if topUp.TokenID != tokenID || topUp.Service != service ||
+			topUp.Settled || !topUp.InvoiceExpiry.After(after) {
+
+			continue
+		}
+		topUpCopy := *topUp
+		return &topUpCopy, nil
+	}
+	return nil, ErrTopUpNotFound
+}
+
+func (s *mockTopUpStore) ExpiredTopUps(ctx context.Context,
+	before time.Time) ([]lntypes.Hash, error) {
+
+	var expired []lntypes.Hash
+	for hash, topUp := range s.topUps {
+		if !topUp.Settled && topUp.InvoiceExpiry.Before(before) {
+			expired = append(expired, hash)
+		}
+	}
+	return expired, nil
+}
+
+func (s *mockTopUpStore) RemoveTopUp(ctx context.Context,
+	hash lntypes.Hash) error {
+
+	if topUp, ok := s.topUps[hash]; ok && !topUp.Settled {
+		delete(s.topUps, hash)
+	}
+	return nil
+}
+
+type mockRevocationStore struct {
+	revocations []*Revocation
+}
+
+var _ RevocationStore = (*mockRevocationStore)(nil)
+
+func (s *mockRevocationStore) RevokeL402(ctx context.Context,
+	revocation *Revocation) error {
+
+	revocationCopy := *revocation
+	s.revocations = append(s.revocations, &revocationCopy)
+	return nil
+}
+
+func (s *mockRevocationStore) IsRevoked(ctx context.Context,
+	tokenID l402.TokenID, paymentHash lntypes.Hash) (bool, error) {
+
+	for _, revocation := range s.revocations {
+		if revocation.TokenID == tokenID ||
+			revocation.PaymentHash == paymentHash {
+
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *mockRevocationStore) Revocations(
+	ctx context.Context) ([]*Revocation, error) {
+
+	return s.revocations, nil
+}
+
+type mockTokenStore struct {
+	tokens  []*Token
+	settles int
+}
+
+var _ TokenStore = (*mockTokenStore)(nil)
+
+func (s *mockTokenStore) AddToken(ctx context.Context, token *Token) error {
+	tokenCopy := *token
+	s.tokens = append(s.tokens, &tokenCopy)
+	return nil
+}
+
+func (s *mockTokenStore) SettleToken(ctx context.Context,
+	tokenID l402.TokenID, settledAt time.Time) error {
+
+	s.settles++
+	token, err := s.GetToken(ctx, tokenID)
+	if err != nil || !token.SettledAt.IsZero() {
+		return nil
+	}
+	token.SettledAt = settledAt
+	return nil
+}
+
+func (s *mockTokenStore) GetToken(ctx context.Context,
+	tokenID l402.TokenID) (*Token, error) {
+
+	for _, token := range s.tokens {
+		if token.TokenID == tokenID {
+			return token, nil
+		}
+	}
+	return nil, ErrTokenNotFound
+}
+
+func (s *mockTokenStore) ListTokens(ctx context.Context,
+	_ *TokenFilter) ([]*Token, error) {
+
+	return s.tokens, nil
+}
+
+type mockSecretExpiryStore struct {
+	expiries map[[sha256.Size]byte]SecretExpiry
+	settled  map[[sha256.Size]byte]bool
+}
+
+var _ SecretExpiryStore = (*mockSecretExpiryStore)(nil)
+
+func newMockSecretExpiryStore() *mockSecretExpiryStore {
+	return &mockSecretExpiryStore{
+		expiries: make(map[[sha256.Size]byte]SecretExpiry),
+		settled:  make(map[[sha256.Size]byte]bool),
+	}
+}
+
+func (s *mockSecretExpiryStore) SetSecretExpiry(ctx context.Context,
+	id [sha256.Size]byte, expiry *SecretExpiry) error {
+
+	s.expiries[id] = *expiry
+	return nil
+}
+
+func (s *mockSecretExpiryStore) SettleSecret(ctx context.Context,
+	id [sha256.Size]byte) error {
+
+	s.settled[id] = true
+	return nil
+}
+
+func (s *mockSecretExpiryStore) ExtendSecret(ctx context.Context,
+	id [sha256.Size]byte, validUntil time.Time) error {
+
+	expiry, ok := s.expiries[id]
+	if !ok || expiry.ValidUntil.IsZero() ||
+		!validUntil.After(expiry.ValidUntil) {
+
+		return nil
+	}
+	expiry.ValidUntil = validUntil
+	s.expiries[id] = expiry
+	return nil
+}
+
+func (s *mockSecretExpiryStore) UnsettledSecrets(ctx context.Context,
+	before time.Time) (map[[sha256.Size]byte]lntypes.Hash, error) {
+
+	unsettled := make(map[[sha256.Size]byte]lntypes.Hash)
+	for id, expiry := range s.expiries {
+		if !s.settled[id] && expiry.InvoiceExpiry.Before(before) {
+			unsettled[id] = expiry.PaymentHash
+		}
+	}
+
+	return unsettled, nil
+}
+
+func (s *mockSecretExpiryStore) PruneSecrets(ctx context.Context,
+	before time.Time) (int64, error) {
+
+	var pruned int64
+	for id, expiry := range s.expiries {
+		expired := expiry.InvoiceExpiry.Before(before)
+		if s.settled[id] {
+			expired = !expiry.ValidUntil.IsZero() &&
+				expiry.ValidUntil.Before(before)
+		}
+		if !expired {
+			continue
+		}
+
+		delete(s.expiries, id)
+		delete(s.settled, id)
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+type mockInvoiceLookup struct {
+	paid map[lntypes.Hash]bool
+}
+
+var _ InvoiceLookup = (*mockInvoiceLookup)(nil)
+
+func (l *mockInvoiceLookup) InvoicePaid(_ context.Context,
+	hash lntypes.Hash) (bool, error) {
+
+	return l.paid[hash], nil
+}
+
+type mockSecretDenylist struct {
+	denied map[[sha256.Size]byte]struct{}
+	loads  int
+}
+
+var _ SecretDenylist = (*mockSecretDenylist)(nil)
+
+func newMockSecretDenylist() *mockSecretDenylist {
+	return &mockSecretDenylist{
+		denied: make(map[[sha256.Size]byte]struct{}),
+	}
+}
+
+func (s *mockSecretDenylist) DenySecret(ctx context.Context,
+	id [sha256.Size]byte) error {
+
+	s.denied[id] = struct{}{}
+	return nil
+}
+
+func (s *mockSecretDenylist) DeniedSecrets(
+	ctx context.Context) ([][sha256.Size]byte, error) {
+
+	s.loads++
+	hashes := make([][sha256.Size]byte, 0, len(s.denied))
+	for id := range s.denied {
+		hashes = append(hashes, id)
+	}
+	return hashes, nil
+}
@@ -0,0 +1,122 @@
+package mint
+
+import (
+	"github.com/lightninglabs/aperture/l402"
+)
+
+// PricingStrategy determines the price of a new L402, which matters when it is
+// minted for several services at once.
+type PricingStrategy interface {
+	// Price returns the price in satoshis of an L402 that is minted for
+	// the given services. If the L402 is minted for a bundle, the bundle
+	// is given as well.
+	Price(services []l402.Service, bundle *Bundle) int64
+}
+
+// DefaultPricing returns the strategy new L402s are priced with unless another
+// one is configured. It prices the L402s of bundles at the price of the bundle
+// and all other L402s at the price of their most expensive service, as they
+// always were. Summing up the prices of the services is opt-in.
+func DefaultPricing() PricingStrategy {
+	return NewBundlePricing(NewMaxPricing())
+}
+
+// maxPricing prices L402s at the price of their most expensive service.
+type maxPricing struct{}
+
+// NewMaxPricing returns a strategy that prices L402s at the price of their
+// most expensive service.
+func NewMaxPricing() PricingStrategy {
+	return maxPricing{}
+}
+
+// Price returns the price of the most expensive of the given services.
+//
+// NOTE: This is part of the PricingStrategy interface.
+func (maxPricing) Price(services []l402.Service, _ *Bundle) int64 {
+	return maximumPrice(services)
+}
+
+// sumPricing prices L402s at the sum of the prices of their services.
+type sumPricing struct{}
+
+// NewSumPricing returns a strategy that prices L402s at the sum of the prices
+// of their services.
+func NewSumPricing() PricingStrategy {
+	return sumPricing{}
+}
+
+// Price returns the sum of the prices of the given services.
+//
+// NOTE: This is part of the PricingStrategy interface.
+func (sumPricing) Price(services []l402.Service, _ *Bundle) int64 {
+	var sum int64
+	for _, service := range services {
+		sum += service.Price
+	}
+
+	return sum
+}
+
+// bundlePricing prices the L402s of bundles at the configured price of the
+// bundle and all other L402s with a fallback strategy.
+type bundlePricing struct {
+	fallback PricingStrategy
+}
+
+// NewBundlePricing returns a strategy that prices the L402s of bundles at the
+// configured price of the bundle. L402s that aren't minted for a bundle or
+// whose bundle has no price are priced with the given fallback strategy.
+func NewBundlePricing(fallback PricingStrategy) PricingStrategy {
+	return &bundlePricing{fallback: fallback}
+}
+
+// Price returns the price of the given bundle if it has one, or the price of
+// the fallback strategy otherwise.
+//
+// NOTE: This is part of the PricingStrategy interface.
+func (b *bundlePricing) Price(services []l402.Service, bundle *Bundle) int64 {
+	if bundle != nil && bundle.Price > 0 {
+		return bundle.Price
+	}
+
+	return b.fallback.Price(services, bundle)
+}
+
+// discountPricing grants a percentage discount on the price of L402s for
+// several services.
+type discountPricing struct {
+	base    PricingStrategy
+	percent int64
+}
+
+// NewDiscountPricing returns a strategy that grants the given percentage
+// discount on the price the base strategy determines for L402s of several
+// services. L402s of a single service are priced by the base strategy alone.
+func NewDiscountPricing(base PricingStrategy,
+	percent uint8) PricingStrategy {
+
+	return &discountPricing{
+		base:    base,
+		percent: int64(percent),
+	}
+}
+
+// Price returns the price of the base strategy reduced by the discount. The
+// discounted price is rounded up, so it is at least 1 satoshi unless the base
+// price is 0.
+//
+// NOTE: This is part of the PricingStrategy interface.
+func (d *discountPricing) Price(services []l402.Service,
+	bundle *Bundle) int64 {
+
+	price := d.base.Price(services, bundle)
+	if len(services) < 2 || d.percent <= 0 {
+		return price
+	}
+	if d.percent >= 100 {
+		return 0
+	}
+
+	return (price*(100-d.percent) + 99) / 100
+}
@@ -0,0 +1,158 @@
+package mint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+var (
+	// ErrL402Revoked is an error returned when we attempt to verify an
+	// L402 that was revoked.
+	ErrL402Revoked = errors.New("L402 revoked")
+)
+
+// Revocation is an entry of the revocation list. It revokes all L402s with
+// either the given token ID or the given payment hash, whichever is set.
+type Revocation struct {
+	// TokenID is the token ID of the revoked L402s. It is zero if the
+	// L402s are revoked by their payment hash.
+	TokenID l402.TokenID
+
+	// PaymentHash is the payment hash of the revoked L402s. It is zero if
+	// the L402s are revoked by their token ID.
+	PaymentHash lntypes.Hash
+
+	// Reason is an optional description of why the L402s were revoked.
+	Reason string
+
+	// RevokedAt is the time the L402s were revoked.
+	RevokedAt time.Time
+}
+
+// RevocationStore is the store responsible for keeping the list of revoked
+// L402s. Unlike revoking the secret of an L402, which requires knowing its full
+// identifier, an L402 can be revoked by its token ID or payment hash alone.
+type RevocationStore interface {
+	// RevokeL402 adds the given revocation to the revocation list and
+	// records the current time as the time of the revocation. This acts
+	// as a NOP if the L402s are already revoked.
+	RevokeL402(context.Context, *Revocation) error
+
+	// IsRevoked returns true if the L402 with the given token ID or the
+	// given payment hash was revoked.
+	IsRevoked(context.Context, l402.TokenID, lntypes.Hash) (bool, error)
+
+	// Revocations returns all entries of the revocation list.
+	Revocations(context.Context) ([]*Revocation, error)
+}
+
+// CachedRevocationStore is a RevocationStore that keeps the revocation list in
+// memory, so that checking whether an L402 was revoked doesn't require a
+// database round trip. The list is reloaded periodically, to pick up the
+// revocations of other instances that share the same store.
+type CachedRevocationStore struct {
+	store           RevocationStore
+	refreshInterval time.Duration
+	now             func() time.Time
+
+	mu          sync.Mutex
+	tokenIDs    map[l402.TokenID]struct{}
+	hashes      map[lntypes.Hash]struct{}
+	refreshedAt time.Time
+}
+
+// A compile-time constraint to ensure CachedRevocationStore implements
+// RevocationStore.
+var _ RevocationStore = (*CachedRevocationStore)(nil)
+
+// NewCachedRevocationStore creates a new store that caches the revocation list
+// of the given store. The list is reloaded at most once per refresh interval.
+func NewCachedRevocationStore(store RevocationStore,
+	refreshInterval time.Duration) *CachedRevocationStore {
+
+	return &CachedRevocationStore{
+		store:           store,
+		refreshInterval: refreshInterval,
+		now:             time.Now,
+	}
+}
+
+// RevokeL402 adds the given revocation to the revocation list of the
+// underlying store and to the cached list.
+//
+// NOTE: This is part of the RevocationStore interface.
+func (s *CachedRevocationStore) RevokeL402(ctx context.Context,
+	revocation *Revocation) error {
+
+	if err := s.store.RevokeL402(ctx, revocation); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.tokenIDs != nil {
+		s.add(revocation)
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// IsRevoked returns true if the L402 with the given token ID or the given
+// payment hash is on the cached revocation list, reloading the list first if it
+// is stale.
+//
+// NOTE: This is part of the RevocationStore interface.
+func (s *CachedRevocationStore) IsRevoked(ctx context.Context,
+	tokenID l402.TokenID, paymentHash lntypes.Hash) (bool, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if s.tokenIDs == nil || now.Sub(s.refreshedAt) >= s.refreshInterval {
+		revocations, err := s.store.Revocations(ctx)
+		if err != nil {
+			return false, fmt.Errorf("unable to load revocation "+
+				"list: %w", err)
+		}
+
+		s.tokenIDs = make(map[l402.TokenID]struct{})
+		s.hashes = make(map[lntypes.Hash]struct{})
+		for _, revocation := range revocations {
+			s.add(revocation)
+		}
+		s.refreshedAt = now
+	}
+
+	_, revokedToken := s.tokenIDs[tokenID]
+	_, revokedHash := s.hashes[paymentHash]
+
+	return revokedToken || revokedHash, nil
+}
+
+// Revocations returns all entries of the revocation list of the underlying
+// store.
+//
+// NOTE: This is part of the RevocationStore interface.
+func (s *CachedRevocationStore) Revocations(
+	ctx context.Context) ([]*Revocation, error) {
+
+	return s.store.Revocations(ctx)
+}
+
+// add adds the given revocation to the cached list. The caller must hold the
+// mutex.
+func (s *CachedRevocationStore) add(revocation *Revocation) {
+	if revocation.TokenID != (l402.TokenID{}) {
+		s.tokenIDs[revocation.TokenID] = struct{}{}
+	}
+	if revocation.PaymentHash != lntypes.ZeroHash {
+		s.hashes[revocation.PaymentHash] = struct{}{}
+	}
+}
@@ -0,0 +1,131 @@
+package mint
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+)
+
+const (
+	// RootKeySize is the size of a root key in bytes.
+	RootKeySize = 32
+)
+
+var (
+	// ErrRootKeyNotFound is an error returned when we attempt to retrieve
+	// a root key by its version but it is not found.
+	ErrRootKeyNotFound = errors.New("root key not found")
+)
+
+// RootKey is a versioned key that wraps the secrets of L402s, so that the
+// secrets can be rotated to a new key or invalidated in bulk.
+type RootKey struct {
+	// Version is the version of the root key. Versions start at 1 and
+	// increase with every rotation. Secrets that were stored before root
+	// keys were introduced aren't wrapped and count as version 0.
+	Version uint32
+
+	// Key is the key material that wraps the secrets.
+	Key [RootKeySize]byte
+
+	// CreatedAt is the time the root key was created.
+	CreatedAt time.Time
+}
+
+// NewRootKey creates a new random root key with the given version.
+func NewRootKey(version uint32, createdAt time.Time) (*RootKey, error) {
+	rootKey := &RootKey{
+		Version:   version,
+		CreatedAt: createdAt,
+	}
+	if _, err := rand.Read(rootKey.Key[:]); err != nil {
+		return nil, err
+	}
+
+	return rootKey, nil
+}
+
+// WrapSecret encrypts the secret keyed by the given hash with the root key. The
+// hash is authenticated as well, so that a wrapped secret can't be used for
+// another hash.
+func (k *RootKey) WrapSecret(hash [sha256.Size]byte,
+	secret [l402.SecretSize]byte) ([]byte, error) {
+
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+
+		l402.SecretSize+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, secret[:], hash[:]), nil
+}
+
+// UnwrapSecret decrypts the secret keyed by the given hash that was wrapped
+// with the root key.
+func (k *RootKey) UnwrapSecret(hash [sha256.Size]byte,
+	wrapped []byte) ([l402.SecretSize]byte, error) {
+
+	var secret [l402.SecretSize]byte
+
+	aead, err := k.aead()
+	if err != nil {
+		return secret, err
+	}
+
+	if len(wrapped) != aead.NonceSize()+l402.SecretSize+aead.Overhead() {
+		return secret, fmt.Errorf("invalid wrapped secret size %d",
+			len(wrapped))
+	}
+
+	nonce, ciphertext := wrapped[:aead.NonceSize()],
+		wrapped[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, hash[:])
+	if err != nil {
+		return secret, fmt.Errorf("unable to unwrap secret with root "+
+			"key %d: %w", k.Version, err)
+	}
+	copy(secret[:], plaintext)
+
+	return secret, nil
+}
+
+// aead returns the authenticated cipher of the root key.
+func (k *RootKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.Key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// RootKeyStore is implemented by secret stores that wrap the secrets of L402s
+// with versioned root keys. New secrets are always wrapped with the latest
+// root key, which is created when the first secret is stored.
+type RootKeyStore interface {
+	// ListRootKeys returns all root keys in the order of their versions.
+	ListRootKeys(context.Context) ([]*RootKey, error)
+
+	// RotateRootKey creates a root key with the next version and wraps
+	// all stored secrets with it. It returns the new root key and the
+	// number of secrets that were wrapped again.
+	RotateRootKey(context.Context) (*RootKey, int64, error)
+
+	// InvalidateRootKeys removes all secrets that were created while a
+	// root key older than the given version was the latest one, along
+	// with those root keys. The L402s of these secrets can no longer be
+	// verified. It returns the number of removed secrets.
+	InvalidateRootKeys(context.Context, uint32) (int64, error)
+}
@@ -0,0 +1,97 @@
+package mint
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"gopkg.in/macaroon.v2"
+)
+
+// Terms are the terms of a new L402 that were determined for a single request,
+// for example by the pricer of its service, rather than configured for the
+// service. The terms that are set take precedence over the restrictions of the
+// service limiter.
+type Terms struct {
+	// Timeout is the duration a new L402 is valid for. If it is zero, the
+	// timeout of the service limiter applies.
+	Timeout time.Duration
+
+	// Capabilities are the capabilities a new L402 grants. If empty, the
+	// capabilities of the service limiter apply.
+	Capabilities []string
+
+	// Caveats are custom caveats that are added to a new L402. They are
+	// only enforced by aperture if a constraint with their condition is
+	// registered.
+	Caveats []l402.Caveat
+}
+
+// validate makes sure the terms can be applied to a new L402.
+func (t *Terms) validate() error {
+	if t.Timeout < 0 {
+		return errors.New("negative timeout")
+	}
+
+	for _, caveat := range t.Caveats {
+		switch {
+		case caveat.Condition == "":
+			return errors.New("caveat condition must be set")
+
+		case l402.IsReservedCondition(caveat.Condition):
+			return fmt.Errorf("caveat condition %s is reserved",
+				caveat.Condition)
+		}
+	}
+
+	return nil
+}
+
+// apply replaces the given capabilities and timeout caveats of the service
+// limiter for the given services with the ones of the terms, if they are set.
+func (t *Terms) apply(services []l402.Service, capabilities,
+	timeouts []l402.Caveat, now func() time.Time) ([]l402.Caveat,
+	[]l402.Caveat) {
+
+	if len(t.Capabilities) > 0 {
+		capabilities = make([]l402.Caveat, 0, len(services))
+		for _, service := range services {
+			capabilities = append(
+				capabilities, l402.NewCapabilitiesCaveat(
+					service.Name,
+					strings.Join(t.Capabilities, ","),
+				),
+			)
+		}
+	}
+
+	if t.Timeout > 0 {
+		timeouts = make([]l402.Caveat, 0, len(services))
+		for _, service := range services {
+			timeouts = append(timeouts, l402.NewTimeoutCaveat(
+				service.Name, int64(t.Timeout/time.Second), now,
+			))
+		}
+	}
+
+	return capabilities, timeouts
+}
+
+// MintL402WithTerms mints a new L402 for the target service under the given
+// terms, which take precedence over the restrictions configured for the
+// service.
+func (m *Mint) MintL402WithTerms(ctx context.Context, service l402.Service,
+	terms *Terms) (*macaroon.Macaroon, string, error) {
+
+	if err := terms.validate(); err != nil {
+		return nil, "", fmt.Errorf("invalid terms: %w", err)
+	}
+
+	services := []l402.Service{service}
+	price := m.cfg.Pricing.Price(services, nil)
+
+	return m.mintL402(ctx, price, services, terms)
+}
@@ -0,0 +1,129 @@
+package mint
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+const (
+	// settledTokensCacheSize is the maximum number of token IDs of settled
+	// L402s that the mint remembers.
+	settledTokensCacheSize = 100_000
+)
+
+var (
+	// ErrTokenNotFound is an error returned when we attempt to retrieve an
+	// issued L402 by its token ID but it is not found.
+	ErrTokenNotFound = errors.New("token not found")
+)
+
+// Token is the metadata of an L402 that was issued by the mint.
+type Token struct {
+	// TokenID is the token ID of the L402.
+	TokenID l402.TokenID
+
+	// PaymentHash is the payment hash of the invoice that pays for the
+	// L402.
+	PaymentHash lntypes.Hash
+
+	// Services are the services the L402 was issued for.
+	Services []l402.Service
+
+	// Price is the price of the L402 in satoshis.
+	Price int64
+
+	// CreatedAt is the time the L402 was issued.
+	CreatedAt time.Time
+
+	// SettledAt is the time the L402 was first used with the preimage of
+	// its paid invoice. It is zero if the L402 wasn't used since it was
+	// paid.
+	SettledAt time.Time
+}
+
+// TokenFilter restricts the issued L402s that are listed. The zero value of
+// each field matches all L402s.
+type TokenFilter struct {
+	// Service only matches the L402s that were issued for the service of
+	// the given name.
+	Service string
+
+	// PaymentHash only matches the L402s that are paid for with the
+	// invoice of the given payment hash.
+	PaymentHash lntypes.Hash
+
+	// Settled, if set, only matches the L402s that were settled if true or
+	// the ones that weren't if false.
+	Settled *bool
+
+	// CreatedAfter only matches the L402s that were issued at or after the
+	// given time.
+	CreatedAfter time.Time
+
+	// CreatedBefore only matches the L402s that were issued before the
+	// given time.
+	CreatedBefore time.Time
+
+	// Offset is the number of matching L402s to skip.
+	Offset int
+
+	// Limit is the maximum number of L402s to return. It must be positive.
+	Limit int
+}
+
+// TokenStore is the store responsible for keeping the inventory of issued
+// L402s, which allows looking up which L402s were issued, for which services
+// and whether they were paid for.
+type TokenStore interface {
+	// AddToken records a newly issued L402.
+	AddToken(context.Context, *Token) error
+
+	// SettleToken records the given time as the time the L402 with the
+	// given token ID was settled. This acts as a NOP if the L402 was
+	// already settled or isn't known.
+	SettleToken(context.Context, l402.TokenID, time.Time) error
+
+	// GetToken returns the issued L402 with the given token ID. If there is
+	// no such L402, then ErrTokenNotFound is returned.
+	GetToken(context.Context, l402.TokenID) (*Token, error)
+
+	// ListTokens returns the issued L402s that match the given filter in
+	// the order they were issued.
+	ListTokens(context.Context, *TokenFilter) ([]*Token, error)
+}
+
+// settledToken is an entry of the cache of settled L402s. Implements the
+// cache.Value interface.
+type settledToken struct{}
+
+// Size implements cache.Value. Returns 1 so the LRU cache counts entries
+// rather than bytes.
+func (settledToken) Size() (uint64, error) {
+	return 1, nil
+}
+
+// settleToken records the L402 with the given token ID as settled in the token
+// store, unless the mint already did so before.
+func (m *Mint) settleToken(ctx context.Context, tokenID l402.TokenID) error {
+	m.settledMu.Lock()
+	_, err := m.settled.Get(tokenID)
+	m.settledMu.Unlock()
+	if err == nil {
+		return nil
+	}
+
+	err = m.cfg.Tokens.SettleToken(ctx, tokenID, m.cfg.Now())
+	if err != nil {
+		return err
+	}
+
+	m.settledMu.Lock()
+	_, _ = m.settled.Put(tokenID, settledToken{})
+	m.settledMu.Unlock()
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package mint
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
+)
+
+var (
+	// ErrTopUpNotFound is an error returned when we attempt to retrieve a
+	// top-up by the payment hash of its invoice but it is not found.
+	ErrTopUpNotFound = errors.New("top-up not found")
+
+	// ErrTopUpSettled is an error returned when we attempt to settle a
+	// top-up that was already settled.
+	ErrTopUpSettled = errors.New("top-up already settled")
+
+	// ErrTopUpUnsupported is an error returned when a top-up is requested
+	// for an L402 that can't be topped up.
+	ErrTopUpUnsupported = errors.New("L402 can't be topped up")
+
+	// ErrTopUpNotNeeded is an error returned when a top-up is requested
+	// for an L402 that is neither used up nor expired.
+	ErrTopUpNotNeeded = errors.New("L402 doesn't need a top-up")
+)
+
+// TopUpGrant is what a top-up grants to the L402 it extends.
+type TopUpGrant struct {
+	// Requests is the number of additional requests the top-up grants.
+	Requests int64
+
+	// Balance is the number of satoshis the top-up adds to the balance of
+	// the L402.
+	Balance int64
+
+	// Validity is the duration the top-up extends the validity of the
+	// L402 by.
+	Validity time.Duration
+}
+
+// TopUp is a payment that extends an existing L402 for a service instead of
+// replacing it with a new one, so that its token ID is preserved.
+type TopUp struct {
+	TopUpGrant
+
+	// TokenID is the ID of the L402 that is topped up.
+	TokenID l402.TokenID
+
+	// Service is the name of the service the L402 is topped up for.
+	Service string
+
+	// PaymentHash is the payment hash of the invoice that pays for the
+	// top-up.
+	PaymentHash lntypes.Hash
+
+	// PaymentRequest is the invoice that pays for the top-up. It is
+	// offered again for the L402 until it is paid or expires.
+	PaymentRequest string
+
+	// InvoiceExpiry is the time the invoice that pays for the top-up
+	// expires.
+	InvoiceExpiry time.Time
+
+	// Settled is true once the top-up is paid and applied to the L402.
+	Settled bool
+
+	// ValidUntil is the time until which the settled top-up extends the
+	// validity of the L402. It is zero if the validity isn't extended.
+	ValidUntil time.Time
+}
+
+// TopUpStore is the store responsible for keeping track of the top-ups of
+// L402s. The additional requests and balance of a settled top-up are credited
+// to the usage of its L402 that is tracked in the same backend.
+type TopUpStore interface {
+	// AddTopUp records a new pending top-up.
+	AddTopUp(context.Context, *TopUp) error
+
+	// GetTopUp returns the top-up that is paid for with the invoice of the
+	// given payment hash. If there is no top-up, then ErrTopUpNotFound is
+	// returned.
+	GetTopUp(context.Context, lntypes.Hash) (*TopUp, error)
+
+	// SettleTopUp marks the top-up that is paid for with the invoice of the
+	// given payment hash as settled. Its additional requests and balance
+	// are credited to its L402 and its validity is extended until the
+	// given time. If the top-up was already settled, then ErrTopUpSettled
+	// is returned.
+	SettleTopUp(context.Context, lntypes.Hash, time.Time) error
+
+	// ValidUntil returns the time until which the settled top-ups of the
+	// L402 with the given token ID extend its validity for a service. The
+	// zero time is returned if its validity wasn't extended.
+	ValidUntil(context.Context, l402.TokenID, string) (time.Time, error)
+
+	// PendingTopUp returns a top-up of the L402 with the given token ID
+	// for a service that isn't settled and whose invoice expires after
+	// the given time. If there is none, then ErrTopUpNotFound is returned.
+	PendingTopUp(context.Context, l402.TokenID, string,
+		time.Time) (*TopUp, error)
+
+	// ExpiredTopUps returns the payment hashes of the top-ups that aren't
+	// settled and whose invoices expired before the given time.
+	ExpiredTopUps(context.Context, time.Time) ([]lntypes.Hash, error)
+
+	// RemoveTopUp removes the top-up that is paid for with the invoice of
+	// the given payment hash unless it was settled. This acts as a NOP if
+	// there is no such top-up.
+	RemoveTopUp(context.Context, lntypes.Hash) error
+}
+
+// PruneTopUps removes the top-ups whose invoices expired before the given time
+// without being paid and returns the number of removed top-ups. Top-ups whose
+// invoices were paid are kept, so that they can still be redeemed.
+func PruneTopUps(ctx context.Context, store TopUpStore,
+	invoices InvoiceLookup, before time.Time) (int64, error) {
+
+	expired, err := store.ExpiredTopUps(ctx, before)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list expired top-ups: %w", err)
+	}
+
+	var pruned int64
+	for _, paymentHash := range expired {
+		paid, err := invoices.InvoicePaid(ctx, paymentHash)
+		if err != nil {
+			return pruned, fmt.Errorf("unable to look up invoice "+
+				"%v: %w", paymentHash, err)
+		}
+		if paid {
+			continue
+		}
+
+		if err := store.RemoveTopUp(ctx, paymentHash); err != nil {
+			return pruned, fmt.Errorf("unable to remove top-up "+
+				"%v: %w", paymentHash, err)
+		}
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// MintTopUp creates an invoice that tops up the L402 of the given verification
+// params once it is paid. The top-up is priced like a new L402 for the given
+// service, which must be of the same tier as the L402. Top-ups are only offered
+// for L402s that expired or, as reported by the caller, whose requests or
+// balance are used up. If an earlier top-up of the L402 wasn't paid yet, its
+// invoice is returned instead of creating a new one.
+func (m *Mint) MintTopUp(ctx context.Context, params *VerificationParams,
+	service l402.Service, exhausted bool) (string, error) {
+
+	if m.cfg.TopUps == nil {
+		return "", ErrTopUpUnsupported
+	}
+
+	// Only L402s that were minted by us and paid for can be topped up.
+	// Their caveats aren't verified as expired or used up L402s are the
+	// ones that need to be topped up.
+	id, caveats, err := m.verifySignature(ctx, params)
+	if err != nil {
+		return "", err
+	}
+
+	tier, ok, err := l402.GrantedTier(caveats, service.Name)
+	switch {
+	case err != nil:
+		return "", err
+
+	case !ok || tier != service.Tier:
+		return "", fmt.Errorf("%w: L402 not valid for tier %d of "+
+			"service %s", ErrTopUpUnsupported, service.Tier,
+			service.Name)
+	}
+
+	grant, err := m.cfg.ServiceLimiter.ServiceTopUp(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	if grant == (TopUpGrant{}) {
+		return "", fmt.Errorf("%w: service %s has no top-ups",
+			ErrTopUpUnsupported, service.Name)
+	}
+
+	// L402s that are still usable aren't offered a top-up, for example if
+	// they were rejected because they lack a capability.
+	if !exhausted {
+		timeout := m.timeoutSatisfier(ctx, id.TokenID, service.Name)
+		err := l402.VerifyCaveats(caveats, timeout)
+		if err == nil {
+			return "", ErrTopUpNotNeeded
+		}
+	}
+
+	// An unpaid top-up is offered again as long as its invoice leaves the
+	// client enough time to pay it, so that repeated challenges don't
+	// create a new invoice each.
+	now := m.cfg.Now()
+	pending, err := m.cfg.TopUps.PendingTopUp(
+		ctx, id.TokenID, service.Name, now.Add(m.cfg.InvoiceExpiry/2),
+	)
+	switch {
+	case err == nil:
+		return pending.PaymentRequest, nil
+
+	case !errors.Is(err, ErrTopUpNotFound):
+		return "", fmt.Errorf("unable to look up pending top-up: %w",
+			err)
+	}
+
+	paymentRequest, paymentHash, err := m.cfg.Challenger.NewChallenge(
+		service.Price,
+	)
+	if err != nil {
+		return "", err
+	}
+
+	err = m.cfg.TopUps.AddTopUp(ctx, &TopUp{
+		TokenID:        id.TokenID,
+		Service:        service.Name,
+		PaymentHash:    paymentHash,
+		PaymentRequest: paymentRequest,
+		InvoiceExpiry:  now.Add(m.cfg.InvoiceExpiry),
+		TopUpGrant:     grant,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return paymentRequest, nil
+}
+
+// redeemTopUp settles the top-up that was paid for with the given preimage, if
+// it wasn't settled yet, and thereby extends the L402 with the given
+// identifier and caveats. The secret of the L402 is keyed by the given hash.
+func (m *Mint) redeemTopUp(ctx context.Context, id *l402.Identifier,
+	idHash [sha256.Size]byte, caveats []l402.Caveat, service string,
+	preimage lntypes.Preimage) error {
+
+	if m.cfg.TopUps == nil {
+		return ErrTopUpUnsupported
+	}
+
+	topUp, err := m.cfg.TopUps.GetTopUp(ctx, preimage.Hash())
+	if err != nil {
+		return err
+	}
+	if topUp.TokenID != id.TokenID || topUp.Service != service {
+		return fmt.Errorf("top-up %v is not valid for L402 %v and "+
+			"service %s", topUp.PaymentHash, id.TokenID, service)
+	}
+
+	// Clients may keep sending the preimage of a top-up that was already
+	// redeemed.
+	if topUp.Settled {
+		return nil
+	}
+
+	// The validity of the L402 is only extended if it expires at all. It
+	// is extended from the time it currently expires or, if it already
+	// expired, from now.
+	var validUntil time.Time
+	expiry, expires, err := l402.ValidUntil(caveats, service)
+	if err != nil {
+		return err
+	}
+	if expires && topUp.Validity > 0 {
+		extended, err := m.cfg.TopUps.ValidUntil(
+			ctx, id.TokenID, service,
+		)
+		if err != nil {
+			return err
+		}
+
+		validUntil = m.cfg.Now()
+		if expiry.After(validUntil) {
+			validUntil = expiry
+		}
+		if extended.After(validUntil) {
+			validUntil = extended
+		}
+		validUntil = validUntil.Add(topUp.Validity)
+	}
+
+	err = m.cfg.TopUps.SettleTopUp(ctx, topUp.PaymentHash, validUntil)
+	switch {
+	case errors.Is(err, ErrTopUpSettled):
+		// The top-up was redeemed concurrently.
+		return nil
+
+	case err != nil:
+		return err
+	}
+
+	// The secret of the L402 must be kept for as long as the top-up
+	// extends its validity.
+	if m.cfg.SecretExpiry != nil && !validUntil.IsZero() {
+		err := m.cfg.SecretExpiry.ExtendSecret(ctx, idHash, validUntil)
+		if err != nil {
+			return fmt.Errorf("unable to extend secret: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// timeoutSatisfier returns a timeout satisfier for the L402 with the given
+// token ID that also accepts expired L402s if top-ups extended their validity.
+func (m *Mint) timeoutSatisfier(ctx context.Context, tokenID l402.TokenID,
+	service string) l402.Satisfier {
+
+	satisfier := l402.NewTimeoutSatisfier(service, m.cfg.Now)
+	if m.cfg.TopUps == nil {
+		return satisfier
+	}
+
+	// The top-ups are only looked up if the L402 itself expired.
+	satisfyFinal := satisfier.SatisfyFinal
+	satisfier.SatisfyFinal = func(c l402.Caveat) error {
+		err := satisfyFinal(c)
+		if err == nil {
+			return nil
+		}
+
+		validUntil, topUpErr := m.cfg.TopUps.ValidUntil(
+			ctx, tokenID, service,
+		)
+		if topUpErr != nil {
+			return fmt.Errorf("unable to look up top-ups: %w",
+				topUpErr)
+		}
+		if m.cfg.Now().Before(validUntil) {
+			return nil
+		}
+
+		return err
+	}
+
+	return satisfier
+}
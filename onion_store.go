@@ -4,6 +4,7 @@ import (
 	"context"
 	"strings"
 
+	"github.com/lightninglabs/aperture/aperturedb"
 	"github.com/lightningnetwork/lnd/tor"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
@@ -26,19 +27,32 @@ var onionPath = strings.Join(
 // onionStore is an etcd-based implementation of tor.OnionStore.
 type onionStore struct {
 	*clientv3.Client
+
+	// encrypter encrypts the private key. It may be nil to store it in
+	// plaintext.
+	encrypter *aperturedb.Encrypter
 }
 
 // A compile-time constraint to ensure onionStore implements tor.OnionStore.
 var _ tor.OnionStore = (*onionStore)(nil)
 
-// newOnionStore creates an etcd-based implementation of tor.OnionStore.
-func newOnionStore(client *clientv3.Client) *onionStore {
-	return &onionStore{Client: client}
+// newOnionStore creates an etcd-based implementation of tor.OnionStore. The
+// private key is encrypted with the given encrypter, which may be nil to store
+// it in plaintext.
+func newOnionStore(client *clientv3.Client,
+	encrypter *aperturedb.Encrypter) *onionStore {
+
+	return &onionStore{Client: client, encrypter: encrypter}
 }
 
 // StorePrivateKey stores the given private key.
 func (s *onionStore) StorePrivateKey(privateKey []byte) error {
-	_, err := s.Put(context.Background(), onionPath, string(privateKey))
+	value, err := s.encrypter.Encrypt(privateKey, []byte(onionPath))
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Put(context.Background(), onionPath, string(value))
 	return err
 }
 
@@ -53,7 +67,7 @@ func (s *onionStore) PrivateKey() ([]byte, error) {
 		return nil, tor.ErrNoPrivateKey
 	}
 
-	return resp.Kvs[0].Value, nil
+	return s.encrypter.Decrypt(resp.Kvs[0].Value, []byte(onionPath))
 }
 
 // DeletePrivateKey securely removes the private key from the store.
@@ -41,7 +41,7 @@ func TestOnionStore(t *testing.T) {
 
 	// Upon a fresh initialization of the store, no private keys should
 	// exist for any onion service type.
-	store := newOnionStore(etcdClient)
+	store := newOnionStore(etcdClient, nil)
 	assertPrivateKeyExists(t, store, nil)
 
 	// Store a private key for an onion service and check it was stored
@@ -0,0 +1,97 @@
+package pricer
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBreakerCooldown is the default duration no requests are made
+	// to a pricer once its circuit breaker opened.
+	DefaultBreakerCooldown = 30 * time.Second
+)
+
+var (
+	// ErrCircuitOpen is returned if a pricer isn't queried because too
+	// many of the previous requests to it failed.
+	ErrCircuitOpen = errors.New("pricer circuit breaker open")
+)
+
+// circuitBreaker stops requests to a failing pricer once a number of
+// consecutive requests failed. After a cooldown, a single request is let
+// through to probe the pricer. If it succeeds, the breaker closes again,
+// otherwise it stays open for another cooldown.
+type circuitBreaker struct {
+	threshold uint32
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu        sync.Mutex
+	failures  uint32
+	openUntil time.Time
+	probing   bool
+}
+
+// newCircuitBreaker creates a breaker that opens after the given number of
+// consecutive failures for the given cooldown.
+func newCircuitBreaker(threshold uint32,
+	cooldown time.Duration) *circuitBreaker {
+
+	return &circuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// allow returns true if a request may be made to the pricer. Once the cooldown
+// of an open breaker passed, only a single request is allowed until its result
+// is reported.
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.failures < b.threshold:
+		return true
+
+	case b.probing || b.now().Before(b.openUntil):
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+// success reports a successful request, which closes the breaker.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+// abort reports a request whose result doesn't tell whether the pricer is
+// available, so another request may probe it.
+func (b *circuitBreaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+// failure reports a failed request. The breaker opens for another cooldown if
+// the threshold of consecutive failures is reached.
+func (b *circuitBreaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = b.now().Add(b.cooldown)
+	}
+}
@@ -3,13 +3,20 @@ package pricer
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sync/atomic"
+	"time"
 
+	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/pricesrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
 )
 
 // Config holds all the config values required to initialise the GRPCPricer.
@@ -26,16 +33,65 @@ type Config struct {
 
 	// TLSCertPath is the path the the tls cert used by the price server.
 	TLSCertPath string `long:"tlscertpath" description:"Path to the servers tls cert"`
+
+	// Timeout is the maximum duration of a request to the gRPC server. If
+	// it is zero, DefaultRequestTimeout is used.
+	Timeout time.Duration `long:"timeout" description:"Maximum duration of a request to the gRPC server"`
+
+	// CacheTTL is the duration quotes are cached for. If it is zero,
+	// quotes aren't cached.
+	CacheTTL time.Duration `long:"cachettl" description:"Duration quotes of the gRPC server are cached for, 0 disables caching"`
+
+	// BreakerThreshold is the number of consecutive failed requests after
+	// which no more requests are made to the gRPC server until the breaker
+	// cooldown passed. If it is zero, the circuit breaker is disabled.
+	BreakerThreshold uint32 `long:"breakerthreshold" description:"Number of consecutive failed requests after which the gRPC server isn't queried for the breaker cooldown, 0 disables the circuit breaker"`
+
+	// BreakerCooldown is the duration no requests are made to the gRPC
+	// server once the circuit breaker opened. If it is zero,
+	// DefaultBreakerCooldown is used.
+	BreakerCooldown time.Duration `long:"breakercooldown" description:"Duration the gRPC server isn't queried for once the circuit breaker opened"`
+
+	// FallbackPrice is the price in satoshis that is charged while the
+	// gRPC server is unavailable. If it is zero, requests fail instead.
+	FallbackPrice int64 `long:"fallbackprice" description:"Static price in satoshis that is charged while the gRPC server is unavailable, 0 fails requests instead"`
+}
+
+// validate makes sure the config values are valid.
+func (c *Config) validate() error {
+	switch {
+	case c.Timeout < 0:
+		return errors.New("negative timeout")
+
+	case c.CacheTTL < 0:
+		return errors.New("negative cache TTL")
+
+	case c.BreakerCooldown < 0:
+		return errors.New("negative breaker cooldown")
+
+	case c.FallbackPrice < 0:
+		return errors.New("negative fallback price")
+	}
+
+	return nil
 }
 
 // GRPCPricer uses the pricesrpc PricesClient to query a backend server for
 // the price of a service resource given the resource path. It implements the
-// Pricer interface.
+// QuotePricer interface.
 type GRPCPricer struct {
 	rpcConn   *grpc.ClientConn
 	rpcClient pricesrpc.PricesClient
+
+	// v1Only is set once the server turned out to not implement
+	// GetPriceV2, so that quotes are only requested with GetPrice from then
+	// on.
+	v1Only atomic.Bool
 }
 
+// A compile-time constraint to ensure GRPCPricer implements QuotePricer.
+var _ QuotePricer = (*GRPCPricer)(nil)
+
 // NewGRPCPricer initialises a Pricer backed by a gRPC backend server.
 func NewGRPCPricer(cfg *Config) (*GRPCPricer, error) {
 	var (
@@ -71,17 +127,17 @@ func NewGRPCPricer(cfg *Config) (*GRPCPricer, error) {
 
 // GetPrice queries the server for the price of a resource path and returns the
 // price. GetPrice is part of the Pricer interface.
-func (c GRPCPricer) GetPrice(ctx context.Context,
+func (c *GRPCPricer) GetPrice(ctx context.Context,
 	r *http.Request) (int64, error) {
 
-	var b bytes.Buffer
-	if err := r.Write(&b); err != nil {
-		return 0, nil
+	requestText, err := httpRequestText(r)
+	if err != nil {
+		return 0, err
 	}
 
 	resp, err := c.rpcClient.GetPrice(ctx, &pricesrpc.GetPriceRequest{
 		Path:            r.URL.Path,
-		HttpRequestText: b.String(),
+		HttpRequestText: requestText,
 	})
 	if err != nil {
 		return 0, err
@@ -90,7 +146,114 @@ func (c GRPCPricer) GetPrice(ctx context.Context,
 	return resp.PriceSats, nil
 }
 
+// GetQuote queries the server for the price and the restrictions of a new L402
+// for the given request with GetPriceV2. Servers that don't implement
+// GetPriceV2 are queried with GetPrice instead, which only returns the price.
+// GetQuote is part of the QuotePricer interface.
+func (c *GRPCPricer) GetQuote(ctx context.Context, r *http.Request,
+	info *RequestInfo) (*Quote, error) {
+
+	if c.v1Only.Load() {
+		return c.quoteV1(ctx, r)
+	}
+
+	requestText, err := httpRequestText(r)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &pricesrpc.GetPriceV2Request{
+		ServiceName:     info.ServiceName,
+		Path:            r.URL.Path,
+		HttpMethod:      r.Method,
+		HttpRequestText: requestText,
+	}
+	if info.RemoteIP != nil {
+		req.RemoteIp = info.RemoteIP.String()
+	}
+	if info.TokenID != nil {
+		req.TokenId = info.TokenID.String()
+		req.Tier = uint32(info.Tier)
+	}
+
+	resp, err := c.rpcClient.GetPriceV2(ctx, req)
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		c.v1Only.Store(true)
+
+		return c.quoteV1(ctx, r)
+
+	case err != nil:
+		return nil, err
+
+	case resp.TimeoutSeconds < 0:
+		return nil, fmt.Errorf("negative timeout %d returned by "+
+			"pricer", resp.TimeoutSeconds)
+	}
+
+	quote := &Quote{
+		Price:        resp.PriceSats,
+		Timeout:      time.Duration(resp.TimeoutSeconds) * time.Second,
+		Capabilities: resp.Capabilities,
+	}
+	for _, caveat := range resp.Caveats {
+		quote.Caveats = append(quote.Caveats, l402.NewCaveat(
+			caveat.Condition, caveat.Value,
+		))
+	}
+
+	return quote, nil
+}
+
+// quoteV1 returns a quote that only contains the price GetPrice returns for the
+// given request.
+func (c *GRPCPricer) quoteV1(ctx context.Context,
+	r *http.Request) (*Quote, error) {
+
+	price, err := c.GetPrice(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{Price: price}, nil
+}
+
 // Close closes the gRPC connection. It is part of the Pricer interface.
-func (c GRPCPricer) Close() error {
+func (c *GRPCPricer) Close() error {
 	return c.rpcConn.Close()
 }
+
+// httpRequestText returns the given request in its HTTP/1.x wire format.
+// Writing a request consumes its body, so the body is buffered and restored,
+// as the request is still proxied to the backend afterwards.
+func httpRequestText(r *http.Request) (string, error) {
+	var body []byte
+	if r.Body != nil && r.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return "", fmt.Errorf("unable to read request body: %w",
+				err)
+		}
+		if err := r.Body.Close(); err != nil {
+			return "", fmt.Errorf("unable to close request body: "+
+				"%w", err)
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	// We write a copy of the request with its own reader of the buffered
+	// body, so the body of the original request is left untouched.
+	clone := r.Clone(r.Context())
+	if body != nil {
+		clone.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	var b bytes.Buffer
+	if err := clone.Write(&b); err != nil {
+		return "", fmt.Errorf("unable to serialize request: %w", err)
+	}
+
+	return b.String(), nil
+}
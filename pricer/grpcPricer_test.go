@@ -0,0 +1,104 @@
+package pricer
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/lightninglabs/aperture/pricesrpc"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+// mockPricesServer is a price server that records the request texts it is sent.
+type mockPricesServer struct {
+	pricesrpc.UnimplementedPricesServer
+
+	mu           sync.Mutex
+	requestTexts []string
+}
+
+// record records the given request text.
+func (m *mockPricesServer) record(requestText string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requestTexts = append(m.requestTexts, requestText)
+}
+
+// GetPrice records the request text and returns a static price.
+func (m *mockPricesServer) GetPrice(_ context.Context,
+	req *pricesrpc.GetPriceRequest) (*pricesrpc.GetPriceResponse, error) {
+
+	m.record(req.HttpRequestText)
+
+	return &pricesrpc.GetPriceResponse{PriceSats: 10}, nil
+}
+
+// GetPriceV2 records the request text and returns a static price.
+func (m *mockPricesServer) GetPriceV2(_ context.Context,
+	req *pricesrpc.GetPriceV2Request) (*pricesrpc.GetPriceV2Response,
+	error) {
+
+	m.record(req.HttpRequestText)
+
+	return &pricesrpc.GetPriceV2Response{PriceSats: 20}, nil
+}
+
+// TestGRPCPricerRequestBody tests that the body of a priced request is sent to
+// the price server and can still be read afterwards, so it can be proxied to
+// the backend.
+func TestGRPCPricerRequestBody(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	server := grpc.NewServer()
+	mockServer := &mockPricesServer{}
+	pricesrpc.RegisterPricesServer(server, mockServer)
+	go func() { _ = server.Serve(lis) }()
+	defer server.Stop()
+
+	p, err := NewGRPCPricer(&Config{
+		GRPCAddress: lis.Addr().String(),
+		Insecure:    true,
+	})
+	require.NoError(t, err)
+	defer func() { require.NoError(t, p.Close()) }()
+
+	ctx := context.Background()
+	body := `{"query":"data"}`
+
+	r := httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+	price, err := p.GetPrice(ctx, r)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, price)
+
+	proxied, err := io.ReadAll(r.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(proxied))
+
+	r = httptest.NewRequest("POST", "/upload", strings.NewReader(body))
+	quote, err := p.GetQuote(ctx, r, &RequestInfo{})
+	require.NoError(t, err)
+	require.EqualValues(t, 20, quote.Price)
+
+	proxied, err = io.ReadAll(r.Body)
+	require.NoError(t, err)
+	require.Equal(t, body, string(proxied))
+
+	// The price server was sent the whole request including its body.
+	mockServer.mu.Lock()
+	defer mockServer.mu.Unlock()
+
+	require.Len(t, mockServer.requestTexts, 2)
+	for _, requestText := range mockServer.requestTexts {
+		require.True(t, strings.HasPrefix(
+			requestText, "POST /upload HTTP/1.1",
+		))
+		require.True(t, strings.HasSuffix(requestText, body))
+	}
+}
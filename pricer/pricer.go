@@ -2,7 +2,11 @@ package pricer
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
 )
 
 // Pricer is an interface used to query price data from a price provider.
@@ -14,3 +18,72 @@ type Pricer interface {
 	// Close should clean up the Pricer implementation if needed.
 	Close() error
 }
+
+// RequestInfo is the context aperture has about a request that is priced.
+type RequestInfo struct {
+	// ServiceName is the name of the service the request was made for.
+	ServiceName string
+
+	// RemoteIP is the IP address of the client that made the request.
+	RemoteIP net.IP
+
+	// TokenID is the token ID of the L402 the request was made with, if
+	// it was validated. It is nil if the request isn't authenticated.
+	TokenID *l402.TokenID
+
+	// Tier is the tier of the service the validated L402 grants access
+	// to. It is only set if TokenID is set.
+	Tier l402.ServiceTier
+}
+
+// Quote is the price of a request together with the restrictions of a new L402
+// that is minted for it.
+type Quote struct {
+	// Price is the price of the request in satoshis. Zero means the
+	// requested resource is free.
+	Price int64
+
+	// Timeout is the duration a new L402 is valid for. If it is zero, the
+	// timeout configured for the service applies.
+	Timeout time.Duration
+
+	// Capabilities are the capabilities a new L402 grants. If empty, the
+	// capabilities configured for the service apply.
+	Capabilities []string
+
+	// Caveats are custom caveats that are added to a new L402.
+	Caveats []l402.Caveat
+}
+
+// HasTerms returns true if the quote sets any of the restrictions of a new
+// L402.
+func (q *Quote) HasTerms() bool {
+	return q.Timeout > 0 || len(q.Capabilities) > 0 || len(q.Caveats) > 0
+}
+
+// QuotePricer is a Pricer that can take the context of a request into account
+// and determine the restrictions of a new L402 besides its price.
+type QuotePricer interface {
+	Pricer
+
+	// GetQuote returns the quote for the given request.
+	GetQuote(ctx context.Context, req *http.Request,
+		info *RequestInfo) (*Quote, error)
+}
+
+// GetQuote returns the quote of the given pricer for the given request. If the
+// pricer doesn't implement QuotePricer, the quote only contains the price.
+func GetQuote(ctx context.Context, p Pricer, req *http.Request,
+	info *RequestInfo) (*Quote, error) {
+
+	if quotePricer, ok := p.(QuotePricer); ok {
+		return quotePricer.GetQuote(ctx, req, info)
+	}
+
+	price, err := p.GetPrice(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{Price: price}, nil
+}
@@ -0,0 +1,254 @@
+package pricer
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/neutrino/cache/lru"
+)
+
+const (
+	// DefaultRequestTimeout is the default maximum duration of a request
+	// to a pricer.
+	DefaultRequestTimeout = 5 * time.Second
+
+	// quoteCacheSize is the maximum number of quotes that are cached.
+	quoteCacheSize = 10_000
+)
+
+// cachedQuote is an entry of the quote cache. Implements the cache.Value
+// interface.
+type cachedQuote struct {
+	// quote is the cached quote.
+	quote *Quote
+
+	// expiry is the time the entry expires at.
+	expiry time.Time
+}
+
+// Size implements cache.Value. Returns 1 so the LRU cache counts entries
+// rather than bytes.
+func (c *cachedQuote) Size() (uint64, error) {
+	return 1, nil
+}
+
+// ResilientPricer wraps a QuotePricer so that a slow or unavailable pricer
+// doesn't stall or fail the requests that are priced. Requests to the pricer
+// are bounded by a timeout, quotes are cached and a circuit breaker stops
+// querying a failing pricer for a while. While the pricer is
+// unavailable, a static fallback price is charged if one is configured. It
+// implements the QuotePricer interface.
+type ResilientPricer struct {
+	pricer        QuotePricer
+	timeout       time.Duration
+	cacheTTL      time.Duration
+	fallbackPrice int64
+	breaker       *circuitBreaker
+	now           func() time.Time
+
+	// cacheMu protects the LRU cache which is not concurrency-safe.
+	cacheMu sync.Mutex
+	cache   *lru.Cache[string, *cachedQuote]
+}
+
+// A compile-time constraint to ensure ResilientPricer implements QuotePricer.
+var _ QuotePricer = (*ResilientPricer)(nil)
+
+// NewResilientPricer wraps the given pricer with the timeout, cache, circuit
+// breaker and fallback price of the given config.
+func NewResilientPricer(pricer QuotePricer,
+	cfg *Config) (*ResilientPricer, error) {
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	r := &ResilientPricer{
+		pricer:        pricer,
+		timeout:       cfg.Timeout,
+		cacheTTL:      cfg.CacheTTL,
+		fallbackPrice: cfg.FallbackPrice,
+		now:           time.Now,
+	}
+	if r.timeout == 0 {
+		r.timeout = DefaultRequestTimeout
+	}
+	if r.cacheTTL > 0 {
+		r.cache = lru.NewCache[string, *cachedQuote](quoteCacheSize)
+	}
+	if cfg.BreakerThreshold > 0 {
+		cooldown := cfg.BreakerCooldown
+		if cooldown == 0 {
+			cooldown = DefaultBreakerCooldown
+		}
+		r.breaker = newCircuitBreaker(cfg.BreakerThreshold, cooldown)
+	}
+
+	return r, nil
+}
+
+// GetPrice returns the price of the given request. Cached prices only depend on
+// the resource path of the request.
+//
+// NOTE: This is part of the Pricer interface.
+func (r *ResilientPricer) GetPrice(ctx context.Context,
+	req *http.Request) (int64, error) {
+
+	key := fmt.Sprintf("price %q", req.URL.Path)
+	quote, err := r.quote(
+		ctx, key, func(ctx context.Context) (*Quote, error) {
+			price, err := r.pricer.GetPrice(ctx, req)
+			if err != nil {
+				return nil, err
+			}
+
+			return &Quote{Price: price}, nil
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return quote.Price, nil
+}
+
+// GetQuote returns the quote for the given request. Quotes are cached per
+// service, method, resource path, client IP, L402 and tier, as the pricer can
+// quote different prices and restrictions for each of them. The returned quote
+// must not be modified.
+//
+// NOTE: This is part of the QuotePricer interface.
+func (r *ResilientPricer) GetQuote(ctx context.Context, req *http.Request,
+	info *RequestInfo) (*Quote, error) {
+
+	return r.quote(
+		ctx, quoteCacheKey(req, info),
+		func(ctx context.Context) (*Quote, error) {
+			return r.pricer.GetQuote(ctx, req, info)
+		},
+	)
+}
+
+// quoteCacheKey returns the key the quote for the given request is cached
+// under.
+func quoteCacheKey(req *http.Request, info *RequestInfo) string {
+	var remoteIP, tokenID string
+	if info.RemoteIP != nil {
+		remoteIP = info.RemoteIP.String()
+	}
+	if info.TokenID != nil {
+		tokenID = info.TokenID.String()
+	}
+
+	return fmt.Sprintf("quote %q %q %q %q %q %d", info.ServiceName,
+		req.Method, req.URL.Path, remoteIP, tokenID, info.Tier)
+}
+
+// Close closes the wrapped pricer.
+//
+// NOTE: This is part of the Pricer interface.
+func (r *ResilientPricer) Close() error {
+	return r.pricer.Close()
+}
+
+// quote returns the quote cached under the given key or fetches a new one from
+// the pricer. If the pricer fails, the fallback quote is returned if a
+// fallback price is configured.
+func (r *ResilientPricer) quote(ctx context.Context, key string,
+	fetch func(context.Context) (*Quote, error)) (*Quote, error) {
+
+	if quote, ok := r.cached(key); ok {
+		return quote, nil
+	}
+
+	quote, err := r.fetch(ctx, fetch)
+	if err != nil {
+		if r.fallbackPrice == 0 {
+			return nil, err
+		}
+
+		log.Warnf("Using fallback price %d for %s: %v",
+			r.fallbackPrice, key, err)
+
+		return &Quote{Price: r.fallbackPrice}, nil
+	}
+
+	r.store(key, quote)
+
+	return quote, nil
+}
+
+// fetch fetches a new quote from the pricer unless its circuit breaker is
+// open. The request is canceled once the timeout passed.
+func (r *ResilientPricer) fetch(ctx context.Context,
+	fetch func(context.Context) (*Quote, error)) (*Quote, error) {
+
+	if r.breaker != nil && !r.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	fetchCtx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	quote, err := fetch(fetchCtx)
+	switch {
+	case r.breaker == nil:
+
+	// Requests the client gave up on don't say anything about the
+	// availability of the pricer.
+	case err != nil && ctx.Err() != nil:
+		r.breaker.abort()
+
+	case err != nil:
+		r.breaker.failure()
+
+	default:
+		r.breaker.success()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query pricer: %w", err)
+	}
+
+	return quote, nil
+}
+
+// cached returns the quote cached under the given key if it hasn't expired
+// yet.
+func (r *ResilientPricer) cached(key string) (*Quote, bool) {
+	if r.cache == nil {
+		return nil, false
+	}
+
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+
+	entry, err := r.cache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+
+	if !r.now().Before(entry.expiry) {
+		r.cache.Delete(key)
+		return nil, false
+	}
+
+	return entry.quote, true
+}
+
+// store caches the given quote under the given key.
+func (r *ResilientPricer) store(key string, quote *Quote) {
+	if r.cache == nil {
+		return
+	}
+
+	r.cacheMu.Lock()
+	defer r.cacheMu.Unlock()
+
+	_, _ = r.cache.Put(key, &cachedQuote{
+		quote:  quote,
+		expiry: r.now().Add(r.cacheTTL),
+	})
+}
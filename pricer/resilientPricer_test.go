@@ -0,0 +1,170 @@
+package pricer
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/stretchr/testify/require"
+)
+
+// mockQuotePricer is a pricer that returns a static price or error and counts
+// the requests made to it.
+type mockQuotePricer struct {
+	price    int64
+	err      error
+	block    bool
+	requests int
+}
+
+// GetPrice returns the static price or error.
+func (m *mockQuotePricer) GetPrice(ctx context.Context,
+	_ *http.Request) (int64, error) {
+
+	m.requests++
+	if m.block {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+
+	return m.price, m.err
+}
+
+// GetQuote returns a quote of the static price or the error.
+func (m *mockQuotePricer) GetQuote(ctx context.Context, r *http.Request,
+	_ *RequestInfo) (*Quote, error) {
+
+	price, err := m.GetPrice(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Quote{Price: price}, nil
+}
+
+// Close does nothing.
+func (m *mockQuotePricer) Close() error {
+	return nil
+}
+
+// TestResilientPricerCache tests that prices are cached per resource path and
+// quotes per request context until they expire.
+func TestResilientPricerCache(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockQuotePricer{price: 10}
+	p, err := NewResilientPricer(mock, &Config{CacheTTL: time.Minute})
+	require.NoError(t, err)
+
+	now := time.Now()
+	p.now = func() time.Time { return now }
+
+	quote := func(path string) int64 {
+		r := httptest.NewRequest("GET", path, nil)
+		quote, err := p.GetQuote(ctx, r, &RequestInfo{})
+		require.NoError(t, err)
+
+		return quote.Price
+	}
+
+	require.EqualValues(t, 10, quote("/a"))
+	mock.price = 20
+	require.EqualValues(t, 10, quote("/a"))
+	require.EqualValues(t, 20, quote("/b"))
+	require.Equal(t, 2, mock.requests)
+
+	// Once the cached quote expired, the pricer is queried again.
+	now = now.Add(time.Minute)
+	require.EqualValues(t, 20, quote("/a"))
+	require.Equal(t, 3, mock.requests)
+
+	// Quotes for other clients, L402s, tiers or methods are cached
+	// separately, as they can differ.
+	tokenID := l402.TokenID{1}
+	infos := []*RequestInfo{
+		{RemoteIP: net.ParseIP("1.2.3.4")},
+		{TokenID: &tokenID},
+		{TokenID: &tokenID, Tier: 1},
+		{ServiceName: "other"},
+	}
+	mock.price = 30
+	for i, info := range infos {
+		r := httptest.NewRequest("GET", "/a", nil)
+		q, err := p.GetQuote(ctx, r, info)
+		require.NoError(t, err)
+		require.EqualValues(t, 30, q.Price)
+		require.Equal(t, 4+i, mock.requests)
+	}
+
+	r := httptest.NewRequest("POST", "/a", nil)
+	q, err := p.GetQuote(ctx, r, &RequestInfo{})
+	require.NoError(t, err)
+	require.EqualValues(t, 30, q.Price)
+	require.Equal(t, 8, mock.requests)
+
+	// Cached quotes are only served to the same client.
+	r = httptest.NewRequest("GET", "/a", nil)
+	q, err = p.GetQuote(ctx, r, &RequestInfo{TokenID: &tokenID})
+	require.NoError(t, err)
+	require.EqualValues(t, 30, q.Price)
+	require.Equal(t, 8, mock.requests)
+}
+
+// TestResilientPricerFallback tests that the fallback price is charged while
+// the pricer fails, and that the circuit breaker stops querying it for the
+// cooldown.
+func TestResilientPricerFallback(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockQuotePricer{err: errors.New("unavailable")}
+	p, err := NewResilientPricer(mock, &Config{
+		Timeout:          time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Minute,
+		FallbackPrice:    5,
+	})
+	require.NoError(t, err)
+
+	now := time.Now()
+	p.breaker.now = func() time.Time { return now }
+
+	r := httptest.NewRequest("GET", "/", nil)
+	for i := 0; i < 3; i++ {
+		price, err := p.GetPrice(ctx, r)
+		require.NoError(t, err)
+		require.EqualValues(t, 5, price)
+	}
+
+	// The breaker opened after two failures.
+	require.Equal(t, 2, mock.requests)
+
+	// Once the cooldown passed, a single request probes the pricer. Slow
+	// requests are timed out and count as failures.
+	now = now.Add(time.Minute)
+	mock.err = nil
+	mock.block = true
+	price, err := p.GetPrice(ctx, r)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, price)
+	require.Equal(t, 3, mock.requests)
+
+	now = now.Add(time.Minute)
+	mock.block = false
+	mock.price = 10
+	price, err = p.GetPrice(ctx, r)
+	require.NoError(t, err)
+	require.EqualValues(t, 10, price)
+	require.Equal(t, 4, mock.requests)
+
+	// Without a fallback price, failures are returned.
+	p.fallbackPrice = 0
+	mock.err = errors.New("unavailable")
+	_, err = p.GetPrice(ctx, r)
+	require.ErrorContains(t, err, "unavailable")
+
+	_, err = NewResilientPricer(mock, &Config{FallbackPrice: -1})
+	require.ErrorContains(t, err, "negative fallback price")
+}
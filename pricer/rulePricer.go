@@ -0,0 +1,242 @@
+package pricer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// PriceRule prices the requests that match all of its conditions. Conditions
+// that aren't set match any request. Regular expressions match if they match
+// any part of the value, unless they are anchored.
+type PriceRule struct {
+	// Method is the HTTP method of the matching requests. If empty, all
+	// methods match.
+	Method string `long:"method" description:"HTTP method of the requests the rule matches, any method if empty"`
+
+	// PathRegexp is a regular expression that is matched against the URL
+	// path of a request. If empty, all paths match.
+	PathRegexp string `long:"pathregexp" description:"Regular expression to match the path of the URL against"`
+
+	// Query maps the names of query parameters to regular expressions.
+	// Each parameter must be present with a value that matches its
+	// regular expression.
+	Query map[string]string `long:"query" description:"Query parameters mapped to regular expressions their value must match"`
+
+	// Headers maps the names of header fields to regular expressions. Each
+	// header field must be present with a value that matches its regular
+	// expression.
+	Headers map[string]string `long:"headers" description:"Header fields mapped to regular expressions their value must match"`
+
+	// MinBodySize is the minimum size of the request body in bytes.
+	MinBodySize int64 `long:"minbodysize" description:"Minimum size of the request body in bytes"`
+
+	// MaxBodySize is the maximum size of the request body in bytes. If it
+	// is zero, the size is not limited. Requests with a body of unknown
+	// size, like chunked ones, are treated as larger than any limit, so
+	// they only match rules without a maximum size.
+	MaxBodySize int64 `long:"maxbodysize" description:"Maximum size of the request body in bytes, not limited if 0"`
+
+	// Price is the price in satoshis of the matching requests. Zero means
+	// they are free.
+	Price int64 `long:"price" description:"Price in satoshis of the requests the rule matches, free if 0"`
+
+	// compiledPathRegexp is the compiled version of PathRegexp.
+	compiledPathRegexp *regexp.Regexp
+
+	// compiledQuery holds the compiled regular expressions of Query.
+	compiledQuery map[string]*regexp.Regexp
+
+	// compiledHeaders holds the compiled regular expressions of Headers.
+	compiledHeaders map[string]*regexp.Regexp
+}
+
+// Clone returns a deep copy of the rule.
+func (p *PriceRule) Clone() *PriceRule {
+	clone := &PriceRule{
+		Method:      p.Method,
+		PathRegexp:  p.PathRegexp,
+		MinBodySize: p.MinBodySize,
+		MaxBodySize: p.MaxBodySize,
+		Price:       p.Price,
+	}
+
+	if p.Query != nil {
+		clone.Query = make(map[string]string, len(p.Query))
+		for name, value := range p.Query {
+			clone.Query[name] = value
+		}
+	}
+
+	if p.Headers != nil {
+		clone.Headers = make(map[string]string, len(p.Headers))
+		for name, value := range p.Headers {
+			clone.Headers[name] = value
+		}
+	}
+
+	return clone
+}
+
+// compile validates the rule and compiles its regular expressions.
+func (p *PriceRule) compile() error {
+	switch {
+	case p.Price < 0:
+		return errors.New("negative price")
+
+	case p.MinBodySize < 0 || p.MaxBodySize < 0:
+		return errors.New("negative body size")
+
+	case p.MaxBodySize > 0 && p.MaxBodySize < p.MinBodySize:
+		return errors.New("max body size below min body size")
+	}
+
+	p.compiledPathRegexp = nil
+	if p.PathRegexp != "" {
+		compiled, err := regexp.Compile(p.PathRegexp)
+		if err != nil {
+			return fmt.Errorf("error compiling path regex: %w", err)
+		}
+		p.compiledPathRegexp = compiled
+	}
+
+	var err error
+	p.compiledQuery, err = compileValueRegexps(p.Query)
+	if err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+
+	p.compiledHeaders, err = compileValueRegexps(p.Headers)
+	if err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
+
+	return nil
+}
+
+// compileValueRegexps compiles the regular expressions of the given names.
+func compileValueRegexps(
+	values map[string]string) (map[string]*regexp.Regexp, error) {
+
+	compiled := make(map[string]*regexp.Regexp, len(values))
+	for name, value := range values {
+		regExp, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("error compiling regex of "+
+				"%s: %w", name, err)
+		}
+		compiled[name] = regExp
+	}
+
+	return compiled, nil
+}
+
+// matches returns true if the given request matches all conditions of the
+// rule.
+func (p *PriceRule) matches(r *http.Request) bool {
+	if p.Method != "" && !strings.EqualFold(p.Method, r.Method) {
+		return false
+	}
+
+	if p.compiledPathRegexp != nil &&
+		!p.compiledPathRegexp.MatchString(r.URL.Path) {
+
+		return false
+	}
+
+	query := r.URL.Query()
+	for name, regExp := range p.compiledQuery {
+		if !anyMatches(regExp, query[name]) {
+			return false
+		}
+	}
+
+	for name, regExp := range p.compiledHeaders {
+		if !anyMatches(regExp, r.Header.Values(name)) {
+			return false
+		}
+	}
+
+	if p.MinBodySize > 0 || p.MaxBodySize > 0 {
+		switch {
+		// The body of a streamed request could be of any size, so it
+		// is priced like the largest body to prevent clients from
+		// evading the pricing of large bodies.
+		case r.ContentLength < 0:
+			return p.MaxBodySize == 0
+
+		case r.ContentLength < p.MinBodySize:
+			return false
+
+		case p.MaxBodySize > 0 && r.ContentLength > p.MaxBodySize:
+			return false
+		}
+	}
+
+	return true
+}
+
+// anyMatches returns true if the regular expression matches any of the given
+// values.
+func anyMatches(regExp *regexp.Regexp, values []string) bool {
+	for _, value := range values {
+		if regExp.MatchString(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RulePricer prices requests with the first of an ordered list of rules that
+// matches them. Requests that match none of the rules are charged a default
+// price. It implements the Pricer interface.
+type RulePricer struct {
+	rules        []*PriceRule
+	defaultPrice int64
+}
+
+// A compile-time constraint to ensure RulePricer implements Pricer.
+var _ Pricer = (*RulePricer)(nil)
+
+// NewRulePricer validates the given rules and creates a pricer that charges
+// the given default price for requests that don't match any of them.
+func NewRulePricer(rules []*PriceRule,
+	defaultPrice int64) (*RulePricer, error) {
+
+	for i, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, fmt.Errorf("price rule %d: %w", i, err)
+		}
+	}
+
+	return &RulePricer{
+		rules:        rules,
+		defaultPrice: defaultPrice,
+	}, nil
+}
+
+// GetPrice returns the price of the first rule that matches the given request
+// or the default price if none does.
+//
+// NOTE: This is part of the Pricer interface.
+func (p *RulePricer) GetPrice(_ context.Context,
+	r *http.Request) (int64, error) {
+
+	for _, rule := range p.rules {
+		if rule.matches(r) {
+			return rule.Price, nil
+		}
+	}
+
+	return p.defaultPrice, nil
+}
+
+// Close is part of the Pricer interface. For the RulePricer, the method does
+// nothing.
+func (p *RulePricer) Close() error {
+	return nil
+}
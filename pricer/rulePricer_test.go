@@ -0,0 +1,126 @@
+package pricer
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRulePricer tests that requests are priced by the first rule that matches
+// them.
+func TestRulePricer(t *testing.T) {
+	rules := []*PriceRule{{
+		Method:      "POST",
+		PathRegexp:  "^/upload",
+		MaxBodySize: 1024,
+		Price:       10,
+	}, {
+		Method:      "post",
+		PathRegexp:  "^/upload",
+		MinBodySize: 1025,
+		Price:       100,
+	}, {
+		PathRegexp: "^/search",
+		Query:      map[string]string{"mode": "^deep$"},
+		Price:      50,
+	}, {
+		Headers: map[string]string{"X-Plan": "free"},
+		Price:   0,
+	}}
+	p, err := NewRulePricer(rules, 5)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		body    string
+		headers map[string]string
+		price   int64
+	}{{
+		name:   "small upload",
+		method: "POST",
+		target: "/upload",
+		body:   "data",
+		price:  10,
+	}, {
+		name:   "large upload",
+		method: "POST",
+		target: "/upload",
+		body:   strings.Repeat("a", 2048),
+		price:  100,
+	}, {
+		name:   "upload with wrong method",
+		method: "GET",
+		target: "/upload",
+		price:  5,
+	}, {
+		name:   "deep search",
+		method: "GET",
+		target: "/search?mode=deep",
+		price:  50,
+	}, {
+		name:   "shallow search",
+		method: "GET",
+		target: "/search?mode=shallow",
+		price:  5,
+	}, {
+		name:    "free plan",
+		method:  "GET",
+		target:  "/other",
+		headers: map[string]string{"x-plan": "free"},
+		price:   0,
+	}, {
+		name:   "no match",
+		method: "GET",
+		target: "/other",
+		price:  5,
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest(
+				test.method, test.target,
+				strings.NewReader(test.body),
+			)
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+
+			price, err := p.GetPrice(context.Background(), r)
+			require.NoError(t, err)
+			require.Equal(t, test.price, price)
+		})
+	}
+
+	// Requests with a body of unknown size are priced like the largest
+	// bodies.
+	r := httptest.NewRequest("POST", "/upload", nil)
+	r.ContentLength = -1
+	price, err := p.GetPrice(context.Background(), r)
+	require.NoError(t, err)
+	require.EqualValues(t, 100, price)
+
+	// They never match rules with a maximum size.
+	limited, err := NewRulePricer([]*PriceRule{{
+		MaxBodySize: 1024,
+		Price:       1,
+	}}, 5)
+	require.NoError(t, err)
+	price, err = limited.GetPrice(context.Background(), r)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, price)
+
+	// Invalid rules are rejected.
+	_, err = NewRulePricer([]*PriceRule{{PathRegexp: "("}}, 5)
+	require.ErrorContains(t, err, "price rule 0")
+
+	_, err = NewRulePricer([]*PriceRule{{
+		MinBodySize: 10,
+		MaxBodySize: 5,
+	}}, 5)
+	require.ErrorContains(t, err, "max body size below min body size")
+}
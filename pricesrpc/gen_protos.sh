@@ -45,13 +45,13 @@ function generate() {
 
   # Generate the JSON/WASM client stubs.
   falafel=$(which falafel)
-  pkg="pricesrpc"
+  pkg=$(basename "$PWD")
   opts="package_name=$pkg,js_stubs=1,build_tags=//go:build js"
   protoc -I/usr/local/include -I. -I.. \
     --plugin=protoc-gen-custom=$falafel\
     --custom_out=. \
     --custom_opt="$opts" \
-    prices.proto
+    $PROTOS
 
   PACKAGES=""
   for package in $PACKAGES; do
@@ -78,6 +78,12 @@ format
 generate
 popd
 
+# Compile and format the adminrpc package.
+pushd adminrpc
+format
+generate
+popd
+
 pushd proxy/testdata
 format
 generate skip_rest
@@ -19,6 +19,9 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type PricesClient interface {
 	GetPrice(ctx context.Context, in *GetPriceRequest, opts ...grpc.CallOption) (*GetPriceResponse, error)
+	// GetPriceV2 returns the price and the restrictions of a new L402 for a
+	// request, given the context aperture has about the request.
+	GetPriceV2(ctx context.Context, in *GetPriceV2Request, opts ...grpc.CallOption) (*GetPriceV2Response, error)
 }
 
 type pricesClient struct {
@@ -38,11 +41,23 @@ func (c *pricesClient) GetPrice(ctx context.Context, in *GetPriceRequest, opts .
 	return out, nil
 }
 
+func (c *pricesClient) GetPriceV2(ctx context.Context, in *GetPriceV2Request, opts ...grpc.CallOption) (*GetPriceV2Response, error) {
+	out := new(GetPriceV2Response)
+	err := c.cc.Invoke(ctx, "/pricesrpc.Prices/GetPriceV2", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // PricesServer is the server API for Prices service.
 // All implementations must embed UnimplementedPricesServer
 // for forward compatibility
 type PricesServer interface {
 	GetPrice(context.Context, *GetPriceRequest) (*GetPriceResponse, error)
+	// GetPriceV2 returns the price and the restrictions of a new L402 for a
+	// request, given the context aperture has about the request.
+	GetPriceV2(context.Context, *GetPriceV2Request) (*GetPriceV2Response, error)
 	mustEmbedUnimplementedPricesServer()
 }
 
@@ -53,6 +68,9 @@ type UnimplementedPricesServer struct {
 func (UnimplementedPricesServer) GetPrice(context.Context, *GetPriceRequest) (*GetPriceResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetPrice not implemented")
 }
+func (UnimplementedPricesServer) GetPriceV2(context.Context, *GetPriceV2Request) (*GetPriceV2Response, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetPriceV2 not implemented")
+}
 func (UnimplementedPricesServer) mustEmbedUnimplementedPricesServer() {}
 
 // UnsafePricesServer may be embedded to opt out of forward compatibility for this service.
@@ -84,6 +102,24 @@ func _Prices_GetPrice_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Prices_GetPriceV2_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetPriceV2Request)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PricesServer).GetPriceV2(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pricesrpc.Prices/GetPriceV2",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PricesServer).GetPriceV2(ctx, req.(*GetPriceV2Request))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Prices_ServiceDesc is the grpc.ServiceDesc for Prices service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -95,6 +131,10 @@ var Prices_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetPrice",
 			Handler:    _Prices_GetPrice_Handler,
 		},
+		{
+			MethodName: "GetPriceV2",
+			Handler:    _Prices_GetPriceV2_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "prices.proto",
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+)
+
+const (
+	// BundleQueryParam is the URL query parameter clients can use to
+	// request an L402 of a bundle of services.
+	BundleQueryParam = "bundle"
+
+	// BundleHeader is the header field clients can use to request an L402
+	// of a bundle of services. It takes precedence over the query
+	// parameter.
+	BundleHeader = "X-L402-Bundle"
+)
+
+var (
+	// ErrUnknownBundle is returned if a client requests a bundle that
+	// doesn't exist or doesn't include the requested service.
+	ErrUnknownBundle = errors.New("unknown bundle")
+)
+
+// Bundle is a named set of backend services that can be bought together with
+// a single L402.
+type Bundle struct {
+	// Name is the name clients use to request an L402 of the bundle.
+	Name string `long:"name" description:"Name clients use to request an L402 of the bundle"`
+
+	// Services are the names of the services the L402s of the bundle grant
+	// access to.
+	Services []string `long:"services" description:"The names of the services the L402s of the bundle grant access to"`
+
+	// Price is the optional L402 value in satoshis of the bundle. Whether
+	// it is charged depends on the pricing strategy of the mint.
+	Price int64 `long:"price" description:"Static L402 value in satoshis of the bundle, which is charged if bundles are priced at their configured price"`
+}
+
+// includes returns true if the bundle includes the service with the given
+// name.
+func (b *Bundle) includes(name string) bool {
+	for _, service := range b.Services {
+		if service == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mintBundle returns the bundle as it is minted, with the given services it
+// includes.
+func (b *Bundle) mintBundle(services []*Service) (*mint.Bundle, error) {
+	byName := make(map[string]*Service, len(services))
+	for _, service := range services {
+		byName[service.Name] = service
+	}
+
+	bundle := &mint.Bundle{
+		Name:     b.Name,
+		Services: make([]l402.Service, 0, len(b.Services)),
+		Price:    b.Price,
+	}
+	for _, name := range b.Services {
+		service, ok := byName[name]
+		switch {
+		case !ok:
+			return nil, fmt.Errorf("bundle %s: unknown service %s",
+				b.Name, name)
+
+		// The resources of services with dynamic prices or price rules
+		// are authorized individually, so they can't be bought as a
+		// whole.
+		case service.pricedPerResource():
+			return nil, fmt.Errorf("bundle %s: service %s has "+
+				"dynamic prices", b.Name, name)
+
+		// In balance mode, the price of an L402 funds its balance,
+		// which a bundle price can't do for several services.
+		case service.Balance > 0:
+			return nil, fmt.Errorf("bundle %s: service %s is in "+
+				"balance mode", b.Name, name)
+		}
+
+		bundle.Services = append(bundle.Services, l402.Service{
+			Name:  service.Name,
+			Tier:  l402.BaseTier,
+			Price: service.Price,
+		})
+	}
+
+	return bundle, nil
+}
+
+// ValidateBundles makes sure the bundles have unique names and valid prices,
+// and that they only include services of the given list that can be bundled.
+func ValidateBundles(bundles []*Bundle, services []*Service) error {
+	names := make(map[string]struct{}, len(bundles))
+	for _, bundle := range bundles {
+		name := strings.ToLower(bundle.Name)
+		switch {
+		case name == "":
+			return errors.New("bundle name must be set")
+
+		case len(bundle.Services) == 0:
+			return fmt.Errorf("bundle %s: services must be set",
+				bundle.Name)
+
+		case bundle.Price < 0:
+			return fmt.Errorf("bundle %s: negative price",
+				bundle.Name)
+
+		case bundle.Price > maxServicePrice:
+			return fmt.Errorf("bundle %s: maximum price exceeded",
+				bundle.Name)
+		}
+
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("duplicate bundle name %s",
+				bundle.Name)
+		}
+		names[name] = struct{}{}
+
+		if _, err := bundle.mintBundle(services); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// challengeBundle returns the bundle a new L402 should be minted for when the
+// given request for the target service is challenged. Nil is returned if the
+// client didn't request a bundle. Bundle requests are ignored for services
+// that aren't part of any bundle, so they don't interfere with query
+// parameters of the backend.
+func challengeBundle(r *http.Request, target *Service, bundles []*Bundle,
+	services []*Service) (*mint.Bundle, error) {
+
+	bundled := false
+	for _, bundle := range bundles {
+		if bundle.includes(target.Name) {
+			bundled = true
+			break
+		}
+	}
+	if !bundled {
+		return nil, nil
+	}
+
+	requested := r.Header.Get(BundleHeader)
+	if requested == "" {
+		requested = r.URL.Query().Get(BundleQueryParam)
+	}
+	if requested == "" {
+		return nil, nil
+	}
+
+	for _, bundle := range bundles {
+		if strings.EqualFold(bundle.Name, requested) &&
+			bundle.includes(target.Name) {
+
+			return bundle.mintBundle(services)
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownBundle, requested)
+}
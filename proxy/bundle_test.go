@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/pricer"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChallengeBundle tests that clients can request an L402 of a bundle that
+// includes the service they're challenged for.
+func TestChallengeBundle(t *testing.T) {
+	service1 := &Service{Name: "service1", Price: 10}
+	service2 := &Service{Name: "service2", Price: 20}
+	service3 := &Service{Name: "service3", Price: 30}
+	services := []*Service{service1, service2, service3}
+
+	bundles := []*Bundle{{
+		Name:     "all",
+		Services: []string{"service1", "service2"},
+		Price:    25,
+	}}
+	require.NoError(t, ValidateBundles(bundles, services))
+
+	all := &mint.Bundle{
+		Name: "all",
+		Services: []l402.Service{
+			{Name: "service1", Price: 10},
+			{Name: "service2", Price: 20},
+		},
+		Price: 25,
+	}
+
+	challenge := func(target *Service, url string,
+		header string) (*mint.Bundle, error) {
+
+		r := httptest.NewRequest("GET", url, nil)
+		if header != "" {
+			r.Header.Set(BundleHeader, header)
+		}
+
+		return challengeBundle(r, target, bundles, services)
+	}
+
+	// Without a requested bundle, no bundle is used.
+	bundle, err := challenge(service1, "/", "")
+	require.NoError(t, err)
+	require.Nil(t, bundle)
+
+	// A bundle can be requested by query parameter or header for any of
+	// its services.
+	bundle, err = challenge(service1, "/?bundle=all", "")
+	require.NoError(t, err)
+	require.Equal(t, all, bundle)
+
+	bundle, err = challenge(service2, "/?bundle=other", "All")
+	require.NoError(t, err)
+	require.Equal(t, all, bundle)
+
+	_, err = challenge(service1, "/?bundle=other", "")
+	require.ErrorIs(t, err, ErrUnknownBundle)
+
+	// Services that aren't part of any bundle ignore the query parameter,
+	// as it might be meant for the backend.
+	bundle, err = challenge(service3, "/?bundle=all", "")
+	require.NoError(t, err)
+	require.Nil(t, bundle)
+
+	// If a bundled service was removed in the meantime, the bundle can't
+	// be minted.
+	services = services[:1]
+	_, err = challenge(service1, "/?bundle=all", "")
+	require.ErrorContains(t, err, "unknown service service2")
+	require.NotErrorIs(t, err, ErrUnknownBundle)
+}
+
+// TestValidateBundles tests the validation of bundles against the services
+// they include.
+func TestValidateBundles(t *testing.T) {
+	services := []*Service{
+		{Name: "service1", Price: 10},
+		{Name: "service2", Price: 20},
+		{Name: "dynamic", DynamicPrice: pricer.Config{Enabled: true}},
+		{Name: "rules", PriceRules: []*pricer.PriceRule{{Price: 1}}},
+		{Name: "balance", Balance: 100},
+	}
+
+	tests := []struct {
+		name    string
+		bundles []*Bundle
+		err     string
+	}{{
+		name:    "missing name",
+		bundles: []*Bundle{{Services: []string{"service1"}, Price: 1}},
+		err:     "bundle name must be set",
+	}, {
+		name:    "missing services",
+		bundles: []*Bundle{{Name: "all", Price: 1}},
+		err:     "services must be set",
+	}, {
+		name: "negative price",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"service1"}, Price: -1,
+		}},
+		err: "negative price",
+	}, {
+		name: "duplicate name",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"service1"}, Price: 1,
+		}, {
+			Name: "All", Services: []string{"service2"}, Price: 1,
+		}},
+		err: "duplicate bundle name",
+	}, {
+		name: "unknown service",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"service3"}, Price: 1,
+		}},
+		err: "unknown service service3",
+	}, {
+		name: "dynamic price",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"dynamic"}, Price: 1,
+		}},
+		err: "has dynamic prices",
+	}, {
+		name: "price rules",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"rules"}, Price: 1,
+		}},
+		err: "has dynamic prices",
+	}, {
+		name: "balance mode",
+		bundles: []*Bundle{{
+			Name: "all", Services: []string{"balance"}, Price: 1,
+		}},
+		err: "is in balance mode",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ErrorContains(
+				t, ValidateBundles(test.bundles, services),
+				test.err,
+			)
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// CapabilityRule defines the capability an L402 must grant to access the
+// requests of a service whose path matches a regular expression. For gRPC
+// services, the path of a request is the full method name, e.g.
+// /package_name.ServiceName/MethodName.
+type CapabilityRule struct {
+	// PathRegexp is a regular expression that matches the request paths
+	// that require the capability. If empty, matches all paths.
+	PathRegexp string `long:"pathregexp" description:"Regular expression to match the path of the URL against"`
+
+	// Capability is the capability an L402 must grant to access the
+	// matching paths.
+	Capability string `long:"capability" description:"Capability the L402 of a request must grant"`
+
+	// compiledPathRegexp is the compiled version of PathRegexp.
+	compiledPathRegexp *regexp.Regexp
+}
+
+// Matches returns true if the given path matches the rule's path pattern.
+func (c *CapabilityRule) Matches(path string) bool {
+	if c.compiledPathRegexp == nil {
+		return true
+	}
+
+	return c.compiledPathRegexp.MatchString(path)
+}
+
+// compile validates the rule and compiles its path pattern.
+func (c *CapabilityRule) compile() error {
+	switch {
+	case c.Capability == "":
+		return errors.New("capability must be set")
+
+	case strings.Contains(c.Capability, ","):
+		return fmt.Errorf("capability %s must not contain a comma",
+			c.Capability)
+	}
+
+	c.compiledPathRegexp = nil
+	if c.PathRegexp != "" {
+		compiled, err := regexp.Compile(c.PathRegexp)
+		if err != nil {
+			return fmt.Errorf("error compiling path regex: %w", err)
+		}
+		c.compiledPathRegexp = compiled
+	}
+
+	return nil
+}
+
+// RequiredCapability returns the capability an L402 must grant to access the
+// given path of the service. The first matching capability rule wins. If no
+// rule matches, an empty string is returned and no capability is required.
+func (s *Service) RequiredCapability(path string) string {
+	for _, rule := range s.CapabilityRules {
+		if rule.Matches(path) {
+			return rule.Capability
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,84 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestRequiredCapability tests that the first capability rule matching the
+// path of a request determines the required capability.
+func TestRequiredCapability(t *testing.T) {
+	service := &Service{
+		CapabilityRules: []*CapabilityRule{{
+			PathRegexp: "^/looprpc.SwapServer/LoopOut.*$",
+			Capability: "loop_out",
+		}, {
+			PathRegexp: "^/looprpc.SwapServer/.*$",
+			Capability: "swap",
+		}, {
+			PathRegexp: "^/admin/.*$",
+			Capability: "admin",
+		}},
+	}
+	for _, rule := range service.CapabilityRules {
+		require.NoError(t, rule.compile())
+	}
+
+	require.Equal(
+		t, "loop_out",
+		service.RequiredCapability("/looprpc.SwapServer/LoopOutQuote"),
+	)
+	require.Equal(
+		t, "swap",
+		service.RequiredCapability("/looprpc.SwapServer/LoopInQuote"),
+	)
+	require.Equal(t, "admin", service.RequiredCapability("/admin/users"))
+	require.Empty(t, service.RequiredCapability("/public"))
+
+	// A rule without a path regexp matches all paths.
+	service.CapabilityRules = append(
+		service.CapabilityRules, &CapabilityRule{Capability: "read"},
+	)
+	require.NoError(t, service.CapabilityRules[3].compile())
+	require.Equal(t, "read", service.RequiredCapability("/public"))
+}
+
+// TestCapabilityRuleValidation tests the validation of capability rules.
+func TestCapabilityRuleValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *CapabilityRule
+		err  string
+	}{{
+		name: "missing capability",
+		rule: &CapabilityRule{PathRegexp: "^/admin/.*$"},
+		err:  "capability must be set",
+	}, {
+		name: "capability list",
+		rule: &CapabilityRule{Capability: "read,write"},
+		err:  "must not contain a comma",
+	}, {
+		name: "invalid regexp",
+		rule: &CapabilityRule{PathRegexp: "(", Capability: "read"},
+		err:  "error compiling path regex",
+	}, {
+		name: "valid",
+		rule: &CapabilityRule{
+			PathRegexp: "^/admin/.*$",
+			Capability: "admin",
+		},
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.rule.compile()
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
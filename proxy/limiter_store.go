@@ -0,0 +1,177 @@
+package proxy
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/lightninglabs/neutrino/cache/lru"
+)
+
+// LimiterBucket describes a token bucket of a rate limiter.
+type LimiterBucket struct {
+	// Key uniquely identifies the bucket. It is made up of the name of the
+	// service, the rate limit rule and the client the bucket belongs to.
+	Key string
+
+	// Rate is the number of tokens that are added to the bucket per
+	// second.
+	Rate float64
+
+	// Burst is the maximum number of tokens the bucket can hold.
+	Burst int
+}
+
+// BucketState is the persisted state of a token bucket.
+type BucketState struct {
+	// Tokens is the number of tokens that were in the bucket at the time
+	// it was last updated.
+	Tokens float64
+
+	// Updated is the time the bucket was last updated. A zero time means
+	// the bucket is new, which makes it start out full.
+	Updated time.Time
+}
+
+// Take refills the bucket with the given state up to the given time and then
+// takes a single token from it. It returns the new state of the bucket and
+// zero if a token was available. Otherwise, the refilled state is returned
+// together with the time until a token will be available.
+func (b LimiterBucket) Take(state BucketState,
+	now time.Time) (BucketState, time.Duration) {
+
+	burst := float64(b.Burst)
+	tokens := burst
+	if !state.Updated.IsZero() {
+		elapsed := now.Sub(state.Updated).Seconds()
+		if elapsed < 0 {
+			elapsed = 0
+		}
+		tokens = math.Min(burst, state.Tokens+elapsed*b.Rate)
+	}
+
+	refilled := BucketState{
+		Tokens:  tokens,
+		Updated: now,
+	}
+	if tokens >= 1 {
+		refilled.Tokens--
+		return refilled, 0
+	}
+
+	// A bucket without a rate or burst never gets a token.
+	if b.Rate <= 0 || b.Burst <= 0 {
+		return refilled, time.Second
+	}
+
+	wait := time.Duration((1 - tokens) / b.Rate * float64(time.Second))
+
+	return refilled, wait
+}
+
+// FullAt returns the time at which the bucket with the given state will be
+// full again. From then on, the state is equivalent to a new bucket and can be
+// discarded.
+func (b LimiterBucket) FullAt(state BucketState) time.Time {
+	missing := float64(b.Burst) - state.Tokens
+	if missing <= 0 || b.Rate <= 0 {
+		return state.Updated
+	}
+
+	return state.Updated.Add(
+		time.Duration(missing / b.Rate * float64(time.Second)),
+	)
+}
+
+// LimiterStore keeps the token buckets of rate limiters. Stores that are shared
+// between multiple aperture instances make sure rate limits are enforced
+// globally instead of per instance.
+type LimiterStore interface {
+	// Take takes a token from each of the given buckets. Tokens are only
+	// taken if all buckets have one available. Otherwise, false is
+	// returned together with the longest time until a token will be
+	// available in each of the buckets that are empty.
+	Take(ctx context.Context, buckets []LimiterBucket) (bool,
+		time.Duration, error)
+}
+
+// bucketEntry holds the state of a token bucket. Implements cache.Value
+// interface.
+type bucketEntry struct {
+	state BucketState
+}
+
+// Size implements cache.Value. Returns 1 so the LRU cache counts entries
+// rather than bytes.
+func (e *bucketEntry) Size() (uint64, error) {
+	return 1, nil
+}
+
+// MemLimiterStore is a LimiterStore that keeps the token buckets in memory. It
+// can be shared between multiple rate limiters to simulate a distributed store
+// in tests.
+type MemLimiterStore struct {
+	mu      sync.Mutex
+	buckets *lru.Cache[string, *bucketEntry]
+	now     func() time.Time
+}
+
+// A compile-time constraint to ensure MemLimiterStore implements LimiterStore.
+var _ LimiterStore = (*MemLimiterStore)(nil)
+
+// NewMemLimiterStore creates a new in-memory limiter store that keeps at most
+// maxSize buckets. If the store is full, the least recently used buckets are
+// evicted.
+func NewMemLimiterStore(maxSize int) *MemLimiterStore {
+	return &MemLimiterStore{
+		buckets: lru.NewCache[string, *bucketEntry](uint64(maxSize)),
+		now:     time.Now,
+	}
+}
+
+// Take takes a token from each of the given buckets if all of them have one
+// available.
+//
+// NOTE: This is part of the LimiterStore interface.
+func (m *MemLimiterStore) Take(_ context.Context,
+	buckets []LimiterBucket) (bool, time.Duration, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	states := make([]BucketState, len(buckets))
+
+	var maxWait time.Duration
+	for i, bucket := range buckets {
+		var state BucketState
+		if entry, err := m.buckets.Get(bucket.Key); err == nil {
+			state = entry.state
+		}
+
+		var wait time.Duration
+		states[i], wait = bucket.Take(state, now)
+		if wait > maxWait {
+			maxWait = wait
+		}
+	}
+
+	if maxWait > 0 {
+		return false, maxWait, nil
+	}
+
+	for i, bucket := range buckets {
+		_, _ = m.buckets.Put(bucket.Key, &bucketEntry{state: states[i]})
+	}
+
+	return true, 0, nil
+}
+
+// Size returns the number of buckets in the store.
+func (m *MemLimiterStore) Size() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.buckets.Len()
+}
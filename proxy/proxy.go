@@ -1,8 +1,10 @@
 package proxy
 
 import (
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"math"
 	"net"
@@ -11,10 +13,14 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/freebie"
 	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/pricer"
 	"google.golang.org/grpc/codes"
 )
 
@@ -29,6 +35,40 @@ const (
 	hdrGrpcStatus  = "Grpc-Status"
 	hdrGrpcMessage = "Grpc-Message"
 	hdrTypeGrpc    = "application/grpc"
+
+	// hdrFreebieLimit is the header that contains the number of free
+	// requests a client can make per window.
+	hdrFreebieLimit = "X-Freebie-Limit"
+
+	// hdrFreebieRemaining is the header that contains the number of free
+	// requests a client has left in the current window.
+	hdrFreebieRemaining = "X-Freebie-Remaining"
+
+	// hdrFreebieWindow is the header that contains the length of the
+	// freebie window in seconds.
+	hdrFreebieWindow = "X-Freebie-Window"
+
+	// hdrFreebieReset is the header that contains the number of seconds
+	// until the oldest free request of the client leaves the freebie
+	// window.
+	hdrFreebieReset = "X-Freebie-Reset"
+)
+
+var (
+	// corsAllowedHeaders are the request header fields browser clients
+	// are allowed to send.
+	corsAllowedHeaders = []string{
+		"Authorization", "Grpc-Metadata-macaroon", "WWW-Authenticate",
+		TierHeader, BundleHeader, l402.HeaderTopUp,
+	}
+
+	// corsExposedHeaders are the response header fields browser clients
+	// are allowed to read.
+	corsExposedHeaders = []string{
+		"WWW-Authenticate", hdrFreebieLimit, hdrFreebieRemaining,
+		hdrFreebieWindow, hdrFreebieReset, "Retry-After",
+		RequestsRemainingHeader, BalanceRemainingHeader, TierHeader,
+	}
 )
 
 // LocalService is an interface that describes a service that is handled
@@ -71,35 +111,47 @@ func (l *localService) IsHandling(r *http.Request) bool {
 // a challenge to the client or forwards the request to another server and
 // proxies the response back to the client.
 type Proxy struct {
-	proxyBackend  *httputil.ReverseProxy
 	localServices []LocalService
 	authenticator auth.Authenticator
-	services      []*Service
-	blocklist     map[string]struct{}
+	freebieStore  freebie.Store
+	limiterStore  LimiterStore
+	usageStore    UsageStore
+
+	// blocklistMtx guards the blocklist, as it can be replaced at run
+	// time.
+	blocklistMtx sync.RWMutex
+	blocklist    map[string]struct{}
+
+	// servicesMtx guards the backend services, the reverse proxy that is
+	// configured for them and the bundles of services, as all of them can
+	// be replaced at run time.
+	servicesMtx  sync.RWMutex
+	proxyBackend *httputil.ReverseProxy
+	services     []*Service
+	bundles      []*Bundle
 }
 
 // New returns a new Proxy instance that proxies between the services specified,
 // using the auth to validate each request's headers and get new challenge
-// headers if necessary.
+// headers if necessary. The free requests of the services are counted in the
+// given freebie store and the token buckets of their rate limits are kept in
+// the given limiter store. If either of them is nil, the respective state is
+// only kept in memory. The requests made with L402s that are only valid for a
+// limited number of requests are counted in the given usage store.
 func New(auth auth.Authenticator, services []*Service,
-	blocklist []string, localServices ...LocalService) (*Proxy, error) {
-
-	blMap := make(map[string]struct{})
-	for _, ip := range blocklist {
-		parsed := net.ParseIP(ip)
-		if parsed == nil {
-			log.Warnf("Could not parse IP %q in blocklist; skipping", ip)
-			continue
-		}
-		blMap[parsed.String()] = struct{}{}
-	}
+	blocklist []string, freebieStore freebie.Store,
+	limiterStore LimiterStore, usageStore UsageStore,
+	localServices ...LocalService) (*Proxy, error) {
 
 	proxy := &Proxy{
 		localServices: localServices,
 		authenticator: auth,
-		services:      services,
-		blocklist:     blMap,
+		freebieStore:  freebieStore,
+		limiterStore:  limiterStore,
+		usageStore:    usageStore,
 	}
+	proxy.UpdateBlocklist(blocklist)
+
 	err := proxy.UpdateServices(services)
 	if err != nil {
 		return nil, err
@@ -121,7 +173,10 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	defer logRequest()
 
 	// Blocklist check
-	if _, blocked := p.blocklist[remoteIP.String()]; blocked {
+	p.blocklistMtx.RLock()
+	_, blocked := p.blocklist[remoteIP.String()]
+	p.blocklistMtx.RUnlock()
+	if blocked {
 		log.Debugf("Blocked request from IP: %s", remoteIP)
 		addCorsHeaders(w.Header())
 		sendDirectResponse(w, r, http.StatusForbidden, "access denied")
@@ -142,11 +197,18 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set(hdrContentType, hdrTypeGrpc)
 	}
 
+	// Take a snapshot of the current backend configuration so a
+	// concurrent update doesn't change it while we serve the request.
+	p.servicesMtx.RLock()
+	services, proxyBackend := p.services, p.proxyBackend
+	bundles := p.bundles
+	p.servicesMtx.RUnlock()
+
 	// Requests that can't be matched to a service backend will be
 	// dispatched to the static file server. If the file exists in the
 	// static file folder it will be served, otherwise the static server
 	// will return a 404 for us.
-	target, ok := matchService(r, p.services)
+	target, ok := matchService(r, services)
 	if !ok {
 		// This isn't a request for any configured remote backend that
 		// we are proxying for. So we give it to the local service that
@@ -183,7 +245,10 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return true
 		}
 		key := ExtractRateLimitKey(r, remoteIP, authenticated)
-		allowed, retryAfter := target.rateLimiter.Allow(r, key)
+		caveats := ExtractCaveats(r, authenticated)
+		allowed, retryAfter := target.rateLimiter.AllowCaveats(
+			r, key, caveats,
+		)
 		if !allowed {
 			prefixLog.Infof("Rate limit exceeded for key %s, "+
 				"retry after %v", key, retryAfter)
@@ -194,6 +259,266 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return allowed
 	}
 
+	// checkCapability is a helper that makes sure the L402 of an
+	// authenticated request grants the capability the requested path of
+	// the service requires, if any.
+	checkCapability := func() bool {
+		capability := target.RequiredCapability(r.URL.Path)
+		if capability == "" {
+			return true
+		}
+
+		caveats := ExtractCaveats(r, true)
+		err := l402.VerifyCapability(caveats, resourceName, capability)
+		if err != nil {
+			prefixLog.Infof("Capability check failed: %v", err)
+			addCorsHeaders(w.Header())
+			sendDirectResponse(
+				w, r, http.StatusForbidden,
+				"capability not authorized",
+			)
+
+			return false
+		}
+
+		return true
+	}
+
+	// challenge is a helper that sends a challenge for a new L402 of the
+	// requested service. It returns false if the resource is free, in
+	// which case the request should be passed to the backend instead.
+	challenge := func(authenticated bool) bool {
+		quote, err := quoteRequest(
+			r, target, resourceName, remoteIP, authenticated,
+		)
+		if err != nil {
+			prefixLog.Errorf("error getting resource price: %v",
+				err)
+			sendDirectResponse(
+				w, r, http.StatusInternalServerError,
+				"failure fetching resource price",
+			)
+			return true
+		}
+
+		// If the price returned is zero, then allow access to the
+		// service.
+		if quote.Price == 0 {
+			return false
+		}
+
+		// Authenticated requests are only challenged once their L402
+		// is used up, in which case it can be topped up.
+		p.sendChallenge(
+			w, r, prefixLog, target, resourceName, quote, bundles,
+			services, authenticated,
+		)
+		return true
+	}
+
+	// authenticatedTokenID is a helper that returns the token ID of the
+	// L402 of an authenticated request.
+	authenticatedTokenID := func() (l402.TokenID, error) {
+		mac := authenticatedMacaroon(r, true)
+		if mac == nil {
+			return l402.TokenID{}, errors.New("no L402 found")
+		}
+
+		id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+		if err != nil {
+			return l402.TokenID{}, err
+		}
+
+		return id.TokenID, nil
+	}
+
+	// usageTaken is set by checkUsage if it counted the request against
+	// the number of requests the L402 is valid for, of which
+	// requestsRemaining are left.
+	var (
+		usageTaken        bool
+		requestsRemaining int64
+	)
+
+	// checkUsage is a helper that counts the request of an authenticated
+	// user against the number of requests their L402 is valid for, if it
+	// is limited. Once all requests are used up, a challenge for a new L402
+	// is sent instead.
+	checkUsage := func() bool {
+		fail := func(err error) bool {
+			prefixLog.Errorf("Unable to count L402 usage: %v", err)
+			sendDirectResponse(
+				w, r, http.StatusInternalServerError,
+				"failure counting L402 usage",
+			)
+			return false
+		}
+
+		caveats := ExtractCaveats(r, true)
+		maxRequests, limited, err := l402.MaxRequests(
+			caveats, resourceName,
+		)
+		switch {
+		case err != nil:
+			return fail(err)
+
+		case !limited:
+			return true
+
+		case p.usageStore == nil:
+			return fail(errors.New("no usage store"))
+		}
+
+		tokenID, err := authenticatedTokenID()
+		if err != nil {
+			return fail(err)
+		}
+
+		remaining, err := p.usageStore.TakeUsage(
+			r.Context(), tokenID, resourceName, maxRequests,
+		)
+		switch {
+		case errors.Is(err, ErrUsageExhausted):
+			w.Header().Set(RequestsRemainingHeader, "0")
+			if target.SkipInvoiceCreation(r) {
+				addCorsHeaders(w.Header())
+				sendDirectResponse(
+					w, r, http.StatusUnauthorized,
+					"unauthorized",
+				)
+				return false
+			}
+
+			prefixLog.Infof("L402 usage exhausted. Sending 402.")
+			return !challenge(true)
+
+		case err != nil:
+			return fail(err)
+		}
+
+		usageTaken, requestsRemaining = true, remaining
+		return true
+	}
+
+	// checkBalance is a helper that deducts the price of the requested
+	// resource from the balance of the L402 of an authenticated user, if
+	// it is funded with one. Once the balance doesn't cover the price
+	// anymore, a challenge for a new L402 is sent instead, which can also
+	// be answered by topping up the L402.
+	checkBalance := func() bool {
+		fail := func(err error) bool {
+			prefixLog.Errorf("Unable to spend L402 balance: %v",
+				err)
+			sendDirectResponse(
+				w, r, http.StatusInternalServerError,
+				"failure spending L402 balance",
+			)
+			return false
+		}
+
+		caveats := ExtractCaveats(r, true)
+		balance, funded, err := l402.Balance(caveats, resourceName)
+		switch {
+		case err != nil:
+			return fail(err)
+
+		case !funded:
+			return true
+
+		case p.usageStore == nil:
+			return fail(errors.New("no usage store"))
+		}
+
+		quote, err := quoteRequest(
+			r, target, resourceName, remoteIP, true,
+		)
+		switch {
+		case err != nil:
+			return fail(err)
+
+		// Free resources don't spend any of the balance.
+		case quote.Price == 0:
+			return true
+		}
+
+		tokenID, err := authenticatedTokenID()
+		if err != nil {
+			return fail(err)
+		}
+
+		remaining, err := p.usageStore.SpendBalance(
+			r.Context(), tokenID, resourceName, quote.Price,
+			balance,
+		)
+		switch {
+		case errors.Is(err, ErrInsufficientBalance):
+			w.Header().Set(
+				BalanceRemainingHeader,
+				strconv.FormatInt(remaining, 10),
+			)
+			if target.SkipInvoiceCreation(r) {
+				addCorsHeaders(w.Header())
+				sendDirectResponse(
+					w, r, http.StatusUnauthorized,
+					"unauthorized",
+				)
+				return false
+			}
+
+			prefixLog.Infof("L402 balance insufficient. Sending " +
+				"402.")
+			return !challenge(true)
+
+		case err != nil:
+			return fail(err)
+		}
+
+		w.Header().Set(
+			BalanceRemainingHeader,
+			strconv.FormatInt(remaining, 10),
+		)
+		return true
+	}
+
+	// checkUsageAndBalance is a helper that counts the request of an
+	// authenticated user and spends its price. If the request was counted
+	// but its price can't be spent, it isn't served, so the request is
+	// given back to the L402.
+	checkUsageAndBalance := func() bool {
+		if !checkUsage() {
+			return false
+		}
+
+		if checkBalance() {
+			if usageTaken {
+				w.Header().Set(
+					RequestsRemainingHeader,
+					strconv.FormatInt(
+						requestsRemaining, 10,
+					),
+				)
+			}
+
+			return true
+		}
+
+		if !usageTaken {
+			return false
+		}
+
+		tokenID, err := authenticatedTokenID()
+		if err == nil {
+			err = p.usageStore.ReturnUsage(
+				r.Context(), tokenID, resourceName,
+			)
+		}
+		if err != nil {
+			prefixLog.Errorf("Unable to return L402 usage: %v", err)
+		}
+
+		return false
+	}
+
 	skipInvoiceCreation := target.SkipInvoiceCreation(r)
 	switch {
 	case authLevel.IsOn():
@@ -202,7 +527,7 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		// called in each case body rather than outside the switch so
 		// as to avoid calling this possibly expensive call for static
 		// resources.
-		acceptAuth := p.authenticator.Accept(&r.Header, resourceName)
+		acceptAuth := p.authenticator.Accept(r, resourceName)
 		if !acceptAuth {
 			if skipInvoiceCreation {
 				addCorsHeaders(w.Header())
@@ -214,42 +539,38 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 
-			price, err := target.pricer.GetPrice(r.Context(), r)
-			if err != nil {
-				prefixLog.Errorf("error getting "+
-					"resource price: %v", err)
-				sendDirectResponse(
-					w, r, http.StatusInternalServerError,
-					"failure fetching "+
-						"resource price",
-				)
-				return
-			}
-
-			// If the price returned is zero, then break out of the
+			// If the resource is free, then break out of the
 			// switch statement and allow access to the service.
-			if price == 0 {
+			prefixLog.Infof("Authentication failed. Sending 402.")
+			if !challenge(false) {
 				break
 			}
-
-			prefixLog.Infof("Authentication failed. Sending 402.")
-			p.handlePaymentRequired(w, r, resourceName, price)
 			return
 		}
 
-		// User is authenticated, apply rate limit with L402 token ID.
-		if !checkRateLimit(true) {
+		// User is authenticated, make sure the L402 grants access to
+		// the path, apply rate limit with L402 token ID, count the
+		// request if the L402 is only valid for a number of requests
+		// and spend its price if the L402 is funded with a balance.
+		if !checkCapability() || !checkRateLimit(true) ||
+			!checkUsageAndBalance() {
+
 			return
 		}
 
 	case authLevel.IsFreebie():
 		// We only need to respect the freebie counter if the user
 		// is not authenticated at all.
-		acceptAuth := p.authenticator.Accept(&r.Header, resourceName)
+		acceptAuth := p.authenticator.Accept(r, resourceName)
 		if !acceptAuth {
-			ok, err := target.freebieDB.CanPass(r, remoteIP)
+			// Checking and counting the free request is done in
+			// one step, so concurrent requests can't exceed the
+			// quota of the client.
+			ok, quota, err := target.freebieDB.TallyFreebie(
+				r, remoteIP,
+			)
 			if err != nil {
-				prefixLog.Errorf("Error querying freebie db: "+
+				prefixLog.Errorf("Error updating freebie db: "+
 					"%v", err)
 				sendDirectResponse(
 					w, r, http.StatusInternalServerError,
@@ -258,50 +579,28 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				return
 			}
 			if !ok {
-				price, err := target.pricer.GetPrice(
-					r.Context(), r,
-				)
-				if err != nil {
-					prefixLog.Errorf("error getting "+
-						"resource price: %v", err)
-					sendDirectResponse(
-						w, r, http.StatusInternalServerError,
-						"failure fetching "+
-							"resource price",
-					)
-					return
-				}
+				setFreebieHeaders(w.Header(), quota)
 
-				// If the price returned is zero, then break
-				// out of the switch statement and allow access
-				// to the service.
-				if price == 0 {
+				// If the resource is free, then break out of
+				// the switch statement and allow access to the
+				// service.
+				if !challenge(false) {
 					break
 				}
-
-				p.handlePaymentRequired(
-					w, r, resourceName, target.Price,
-				)
-				return
-			}
-			_, err = target.freebieDB.TallyFreebie(r, remoteIP)
-			if err != nil {
-				prefixLog.Errorf("Error updating freebie db: "+
-					"%v", err)
-				sendDirectResponse(
-					w, r, http.StatusInternalServerError,
-					"freebie DB failure",
-				)
 				return
 			}
+			setFreebieHeaders(w.Header(), quota)
 
 			// Unauthenticated freebie user, rate limit by IP.
 			if !checkRateLimit(false) {
 				return
 			}
-		} else if !checkRateLimit(true) {
-			// Authenticated user on freebie path, rate limit by
-			// L402 token.
+		} else if !checkCapability() || !checkRateLimit(true) ||
+			!checkUsageAndBalance() {
+
+			// Authenticated user on freebie path, check the
+			// capability, rate limit by L402 token, count the
+			// request and spend its price from the balance.
 			return
 		}
 
@@ -314,12 +613,34 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// If we got here, it means everything is OK to pass the request to the
 	// service backend via the reverse proxy.
-	p.proxyBackend.ServeHTTP(w, r)
+	proxyBackend.ServeHTTP(w, r)
+}
+
+// Services returns the backend services the proxy is currently configured
+// with. The returned services must not be modified.
+func (p *Proxy) Services() []*Service {
+	p.servicesMtx.RLock()
+	defer p.servicesMtx.RUnlock()
+
+	return p.services
 }
 
 // UpdateServices re-configures the proxy to use a new set of backend services.
+// The given services are prepared in place, so they must not be shared with a
+// running proxy. Use Service.Clone to obtain an independent copy first.
 func (p *Proxy) UpdateServices(services []*Service) error {
-	err := prepareServices(services)
+	// Remember the pricers of the current services so we can close the
+	// ones that are no longer used once the new services are in place.
+	p.servicesMtx.RLock()
+	oldPricers := make([]pricer.Pricer, 0, len(p.services))
+	for _, s := range p.services {
+		oldPricers = append(oldPricers, s.pricer)
+	}
+	p.servicesMtx.RUnlock()
+
+	err := prepareServices(
+		services, p.freebieStore, p.limiterStore, p.usageStore,
+	)
 	if err != nil {
 		return err
 	}
@@ -336,7 +657,7 @@ func (p *Proxy) UpdateServices(services []*Service) error {
 		},
 	}
 
-	p.proxyBackend = &httputil.ReverseProxy{
+	proxyBackend := &httputil.ReverseProxy{
 		Director:  p.director,
 		Transport: &trailerFixingTransport{next: transport},
 		ModifyResponse: func(res *http.Response) error {
@@ -349,11 +670,69 @@ func (p *Proxy) UpdateServices(services []*Service) error {
 		FlushInterval: -1,
 	}
 
+	p.servicesMtx.Lock()
+	p.services = services
+	p.proxyBackend = proxyBackend
+	p.servicesMtx.Unlock()
+
+	// Now that no new requests can reach the old services anymore, we
+	// close the pricers that were replaced.
+	newPricers := make(map[pricer.Pricer]struct{}, len(services))
+	for _, s := range services {
+		newPricers[s.pricer] = struct{}{}
+	}
+	for _, oldPricer := range oldPricers {
+		if _, ok := newPricers[oldPricer]; ok || oldPricer == nil {
+			continue
+		}
+
+		if err := oldPricer.Close(); err != nil {
+			log.Errorf("Error closing replaced pricer: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// UpdateBundles replaces the bundles of services clients can request L402s of.
+// The bundles are validated against the current backend services. If they're
+// invalid, the current bundles are kept.
+func (p *Proxy) UpdateBundles(bundles []*Bundle) error {
+	p.servicesMtx.Lock()
+	defer p.servicesMtx.Unlock()
+
+	if err := ValidateBundles(bundles, p.services); err != nil {
+		return err
+	}
+
+	p.bundles = bundles
+
 	return nil
 }
 
+// UpdateBlocklist replaces the list of IP addresses that are denied access to
+// the proxy. Entries that can't be parsed as an IP address are skipped.
+func (p *Proxy) UpdateBlocklist(blocklist []string) {
+	blMap := make(map[string]struct{}, len(blocklist))
+	for _, ip := range blocklist {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			log.Warnf("Could not parse IP %q in blocklist; skipping", ip)
+			continue
+		}
+		blMap[parsed.String()] = struct{}{}
+	}
+
+	p.blocklistMtx.Lock()
+	p.blocklist = blMap
+	p.blocklistMtx.Unlock()
+}
+
 // Close cleans up the Proxy by closing any remaining open connections.
 func (p *Proxy) Close() error {
+	p.servicesMtx.RLock()
+	defer p.servicesMtx.RUnlock()
+
 	var returnErr error
 	for _, s := range p.services {
 		if err := s.pricer.Close(); err != nil {
@@ -369,7 +748,11 @@ func (p *Proxy) Close() error {
 // director is a method that rewrites an incoming request to be forwarded to a
 // backend service.
 func (p *Proxy) director(req *http.Request) {
-	target, ok := matchService(req, p.services)
+	p.servicesMtx.RLock()
+	services := p.services
+	p.servicesMtx.RUnlock()
+
+	target, ok := matchService(req, services)
 	if ok {
 		// Rewrite address and protocol in the request so the
 		// real service is called instead.
@@ -465,21 +848,106 @@ func addCorsHeaders(header http.Header) {
 
 	header.Add("Access-Control-Allow-Origin", "*")
 	header.Add("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	header.Add("Access-Control-Expose-Headers", "WWW-Authenticate")
+	header.Add(
+		"Access-Control-Expose-Headers",
+		strings.Join(corsExposedHeaders, ", "),
+	)
 	header.Add(
 		"Access-Control-Allow-Headers",
-		"Authorization, Grpc-Metadata-macaroon, WWW-Authenticate",
+		strings.Join(corsAllowedHeaders, ", "),
 	)
 }
 
-// handlePaymentRequired returns fresh challenge header fields and status code
-// to the client signaling that a payment is required to fulfil the request.
-func (p *Proxy) handlePaymentRequired(w http.ResponseWriter, r *http.Request,
-	serviceName string, servicePrice int64) {
+// setFreebieHeaders adds the headers that tell a client how many free requests
+// it has left and when the next one is freed up.
+func setFreebieHeaders(header http.Header, quota freebie.Quota) {
+	header.Set(hdrFreebieLimit, strconv.Itoa(int(quota.Limit)))
+	header.Set(hdrFreebieRemaining, strconv.Itoa(int(quota.Remaining)))
+
+	if quota.Window > 0 {
+		header.Set(
+			hdrFreebieWindow,
+			strconv.Itoa(int(math.Ceil(quota.Window.Seconds()))),
+		)
+	}
+
+	if !quota.Reset.IsZero() {
+		reset := int(math.Ceil(time.Until(quota.Reset).Seconds()))
+		if reset < 0 {
+			reset = 0
+		}
+		header.Set(hdrFreebieReset, strconv.Itoa(reset))
+	}
+}
+
+// sendChallenge answers the given request for the target service with a
+// challenge. If the client requested a bundle, the challenge contains an L402
+// of the bundle. Otherwise, it contains an L402 of the requested tier of the
+// service, priced at the quoted price for the base tier and minted under the
+// restrictions of the quote. If the request was made with an exhausted L402,
+// the challenge also offers to top it up.
+func (p *Proxy) sendChallenge(w http.ResponseWriter, r *http.Request,
+	prefixLog *PrefixLog, target *Service, resourceName string,
+	quote *pricer.Quote, bundles []*Bundle, services []*Service,
+	exhausted bool) {
+
+	bundle, err := challengeBundle(r, target, bundles, services)
+	switch {
+	case errors.Is(err, ErrUnknownBundle):
+		addCorsHeaders(w.Header())
+		sendDirectResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+
+	case err != nil:
+		prefixLog.Errorf("Error resolving bundle: %v", err)
+		sendDirectResponse(
+			w, r, http.StatusInternalServerError,
+			"failure resolving bundle",
+		)
+		return
+
+	case bundle != nil:
+		header, err := p.authenticator.FreshBundleChallengeHeader(
+			r, bundle,
+		)
+		p.handlePaymentRequired(w, r, header, err)
+		return
+	}
+
+	service, err := target.challengeService(r, resourceName, quote.Price)
+	if err != nil {
+		addCorsHeaders(w.Header())
+		sendDirectResponse(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var terms *mint.Terms
+	if quote.HasTerms() {
+		terms = &mint.Terms{
+			Timeout:      quote.Timeout,
+			Capabilities: quote.Capabilities,
+			Caveats:      quote.Caveats,
+		}
+	}
+
+	// Tell clients of services with tiers which tier the L402 of the
+	// challenge is minted for.
+	if tier := target.tierName(service.Tier); tier != "" {
+		w.Header().Set(TierHeader, tier)
+	}
 
 	header, err := p.authenticator.FreshChallengeHeader(
-		serviceName, servicePrice,
+		r, service, terms, exhausted,
 	)
+	p.handlePaymentRequired(w, r, header, err)
+}
+
+// handlePaymentRequired returns the given fresh challenge header fields and
+// status code to the client signaling that a payment is required to fulfil the
+// request. If the challenge couldn't be created, an error is returned instead.
+func (p *Proxy) handlePaymentRequired(w http.ResponseWriter, r *http.Request,
+	header http.Header, err error) {
+
 	if err != nil {
 		log.Errorf("Error creating new challenge header: %v", err)
 		sendDirectResponse(
@@ -1,6 +1,7 @@
 package proxy_test
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,6 +21,7 @@ import (
 	"github.com/lightninglabs/aperture/proxy"
 	proxytest "github.com/lightninglabs/aperture/proxy/testdata"
 	"github.com/lightningnetwork/lnd/cert"
+	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/lightningnetwork/lnd/macaroons"
 	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
@@ -136,7 +139,9 @@ func TestProxyHTTPBlocklist(t *testing.T) {
 
 	// Block the IP that will be used in the request.
 	blockedIP := "127.0.0.1"
-	p, err := proxy.New(mockAuth, services, []string{blockedIP})
+	p, err := proxy.New(
+		mockAuth, services, []string{blockedIP}, nil, nil, nil,
+	)
 	require.NoError(t, err)
 
 	// Start the proxy server.
@@ -185,6 +190,356 @@ func TestProxyHTTPBlocklist(t *testing.T) {
 	body, err := io.ReadAll(resp.Body)
 	require.NoError(t, err)
 	require.Equal(t, "access denied\n", string(body))
+
+	// Once the IP is removed from the blocklist, the request should be
+	// forwarded to the backend.
+	p.UpdateBlocklist(nil)
+
+	resp2, err := client.Do(req)
+	require.NoError(t, err)
+	defer resp2.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp2.StatusCode)
+}
+
+// TestProxyHTTPCapabilities tests that the proxy rejects authenticated
+// requests whose L402 doesn't grant the capability required for the path.
+func TestProxyHTTPCapabilities(t *testing.T) {
+	services := []*proxy.Service{{
+		Name:       "svc",
+		Address:    testTargetServiceAddress,
+		HostRegexp: testHostRegexp,
+		PathRegexp: testPathRegexpHTTP,
+		Protocol:   "http",
+		Auth:       "on",
+		CapabilityRules: []*proxy.CapabilityRule{{
+			PathRegexp: "^/http/admin.*$",
+			Capability: "admin",
+		}},
+	}}
+
+	mockAuth := auth.NewMockAuthenticator()
+	p, err := proxy.New(
+		mockAuth, services, []string{}, nil, nil, nil,
+	)
+	require.NoError(t, err)
+
+	// Start the proxy server.
+	server := &http.Server{
+		Addr:    testProxyAddr,
+		Handler: http.HandlerFunc(p.ServeHTTP),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			t.Errorf("proxy serve error: %v", err)
+		}
+	}()
+	defer closeOrFail(t, server)
+
+	// Start the backend server.
+	backendService := &http.Server{Addr: testTargetServiceAddress}
+	go func() { _ = startBackendHTTP(backendService) }()
+	defer closeOrFail(t, backendService)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// request sends a request for the given path with an L402 that has the
+	// given capabilities caveat, if any, and returns the status code.
+	request := func(path string, capabilities string) int {
+		mac, err := macaroon.New(
+			[]byte("key"), []byte("id"), "loc",
+			macaroon.LatestVersion,
+		)
+		require.NoError(t, err)
+
+		if capabilities != "" {
+			err := l402.AddFirstPartyCaveats(mac, l402.NewCaveat(
+				"svc"+l402.CondCapabilitiesSuffix,
+				capabilities,
+			))
+			require.NoError(t, err)
+		}
+
+		url := fmt.Sprintf("http://%s%s", testProxyAddr, path)
+		req, err := http.NewRequest("GET", url, nil)
+		require.NoError(t, err)
+
+		err = l402.SetHeader(&req.Header, mac, lntypes.Preimage{1})
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer closeOrFail(t, resp.Body)
+
+		return resp.StatusCode
+	}
+
+	// Paths without a capability rule are accessible with any L402.
+	require.Equal(t, http.StatusOK, request("/http/test", ""))
+
+	// The admin paths require an L402 that grants the admin capability.
+	require.Equal(t, http.StatusForbidden, request("/http/admin", ""))
+	require.Equal(t, http.StatusForbidden, request("/http/admin", "read"))
+	require.Equal(t, http.StatusOK, request("/http/admin", "read,admin"))
+}
+
+// memUsageStore is a proxy.UsageStore that keeps the usage in memory.
+type memUsageStore struct {
+	mu    sync.Mutex
+	used  map[string]int64
+	spent map[string]int64
+}
+
+// TakeUsage records a request made with the L402 of the given token ID.
+func (m *memUsageStore) TakeUsage(_ context.Context, tokenID l402.TokenID,
+	service string, maxRequests int64) (int64, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := tokenID.String() + "/" + service
+	if m.used[key] >= maxRequests {
+		return 0, proxy.ErrUsageExhausted
+	}
+	m.used[key]++
+
+	return maxRequests - m.used[key], nil
+}
+
+// ReturnUsage gives back a request made with the L402 of the given token ID.
+func (m *memUsageStore) ReturnUsage(_ context.Context, tokenID l402.TokenID,
+	service string) error {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.used[tokenID.String()+"/"+service]--
+
+	return nil
+}
+
+// SpendBalance spends the price of a request made with the L402 of the given
+// token ID from its balance.
+func (m *memUsageStore) SpendBalance(_ context.Context, tokenID l402.TokenID,
+	service string, price, balance int64) (int64, error) {
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.spent == nil {
+		m.spent = make(map[string]int64)
+	}
+
+	key := tokenID.String() + "/" + service
+	if m.spent[key]+price > balance {
+		return balance - m.spent[key], proxy.ErrInsufficientBalance
+	}
+	m.spent[key] += price
+
+	return balance - m.spent[key], nil
+}
+
+// TestProxyHTTPUsage tests that the proxy counts the requests made with L402s
+// that are only valid for a limited number of requests and challenges clients
+// for a new L402 once they are used up.
+func TestProxyHTTPUsage(t *testing.T) {
+	services := []*proxy.Service{{
+		Name:        "svc",
+		Address:     testTargetServiceAddress,
+		HostRegexp:  testHostRegexp,
+		PathRegexp:  testPathRegexpHTTP,
+		Protocol:    "http",
+		Auth:        "on",
+		Price:       10,
+		MaxRequests: 2,
+	}}
+
+	// Services that limit the number of requests require a usage store.
+	mockAuth := auth.NewMockAuthenticator()
+	_, err := proxy.New(mockAuth, services, []string{}, nil, nil, nil)
+	require.ErrorContains(t, err, "max requests require a usage store")
+
+	usageStore := &memUsageStore{used: make(map[string]int64)}
+	p, err := proxy.New(
+		mockAuth, services, []string{}, nil, nil, usageStore,
+	)
+	require.NoError(t, err)
+
+	// Start the proxy server.
+	server := &http.Server{
+		Addr:    testProxyAddr,
+		Handler: http.HandlerFunc(p.ServeHTTP),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			t.Errorf("proxy serve error: %v", err)
+		}
+	}()
+	defer closeOrFail(t, server)
+
+	// Start the backend server.
+	backendService := &http.Server{Addr: testTargetServiceAddress}
+	go func() { _ = startBackendHTTP(backendService) }()
+	defer closeOrFail(t, backendService)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The requests are counted per token ID, so the L402 needs a valid
+	// identifier.
+	var id bytes.Buffer
+	err = l402.EncodeIdentifier(&id, &l402.Identifier{
+		Version: l402.LatestVersion,
+		TokenID: l402.TokenID{1, 2, 3},
+	})
+	require.NoError(t, err)
+
+	mac, err := macaroon.New(
+		[]byte("key"), id.Bytes(), "loc", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+
+	caveat := l402.NewMaxRequestsCaveat("svc", 2)
+	require.NoError(t, l402.AddFirstPartyCaveats(mac, caveat))
+
+	url := fmt.Sprintf("http://%s/http/test", testProxyAddr)
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+
+	err = l402.SetHeader(&req.Header, mac, lntypes.Preimage{1})
+	require.NoError(t, err)
+
+	// request sends the request and returns the status code and the
+	// number of remaining requests.
+	request := func() (int, string) {
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer closeOrFail(t, resp.Body)
+
+		return resp.StatusCode,
+			resp.Header.Get(proxy.RequestsRemainingHeader)
+	}
+
+	status, remaining := request()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "1", remaining)
+
+	status, remaining = request()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "0", remaining)
+
+	// Once the requests are used up, the client is challenged to buy a new
+	// L402.
+	status, remaining = request()
+	require.Equal(t, http.StatusPaymentRequired, status)
+	require.Equal(t, "0", remaining)
+}
+
+// TestProxyHTTPBalance tests that the proxy spends the price of requests made
+// with L402s that are funded with a balance and challenges clients for a new
+// L402 once the balance doesn't cover the price anymore.
+func TestProxyHTTPBalance(t *testing.T) {
+	services := []*proxy.Service{{
+		Name:       "svc",
+		Address:    testTargetServiceAddress,
+		HostRegexp: testHostRegexp,
+		PathRegexp: testPathRegexpHTTP,
+		Protocol:   "http",
+		Auth:       "on",
+		Price:      10,
+		Balance:    25,
+	}}
+
+	// Balance mode requires a usage store.
+	mockAuth := auth.NewMockAuthenticator()
+	_, err := proxy.New(mockAuth, services, []string{}, nil, nil, nil)
+	require.ErrorContains(t, err, "balance mode requires a usage store")
+
+	// The L402s are also only valid for a number of requests, which are
+	// counted before the balance is spent.
+	services[0].MaxRequests = 5
+
+	usageStore := &memUsageStore{used: make(map[string]int64)}
+	p, err := proxy.New(
+		mockAuth, services, []string{}, nil, nil, usageStore,
+	)
+	require.NoError(t, err)
+
+	// Start the proxy server.
+	server := &http.Server{
+		Addr:    testProxyAddr,
+		Handler: http.HandlerFunc(p.ServeHTTP),
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			t.Errorf("proxy serve error: %v", err)
+		}
+	}()
+	defer closeOrFail(t, server)
+
+	// Start the backend server.
+	backendService := &http.Server{Addr: testTargetServiceAddress}
+	go func() { _ = startBackendHTTP(backendService) }()
+	defer closeOrFail(t, backendService)
+
+	time.Sleep(100 * time.Millisecond)
+
+	// The balance is spent per token ID, so the L402 needs a valid
+	// identifier.
+	var id bytes.Buffer
+	err = l402.EncodeIdentifier(&id, &l402.Identifier{
+		Version: l402.LatestVersion,
+		TokenID: l402.TokenID{4, 5, 6},
+	})
+	require.NoError(t, err)
+
+	mac, err := macaroon.New(
+		[]byte("key"), id.Bytes(), "loc", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+
+	err = l402.AddFirstPartyCaveats(
+		mac, l402.NewBalanceCaveat("svc", 25),
+		l402.NewMaxRequestsCaveat("svc", 5),
+	)
+	require.NoError(t, err)
+
+	url := fmt.Sprintf("http://%s/http/test", testProxyAddr)
+	req, err := http.NewRequest("GET", url, nil)
+	require.NoError(t, err)
+
+	err = l402.SetHeader(&req.Header, mac, lntypes.Preimage{1})
+	require.NoError(t, err)
+
+	// request sends the request and returns the status code and the
+	// remaining balance.
+	request := func() (int, string) {
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer closeOrFail(t, resp.Body)
+
+		return resp.StatusCode,
+			resp.Header.Get(proxy.BalanceRemainingHeader)
+	}
+
+	status, remaining := request()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "15", remaining)
+
+	status, remaining = request()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "5", remaining)
+
+	// Once the balance doesn't cover the price anymore, the client is
+	// challenged to buy a new L402 and nothing is spent. The request isn't
+	// counted against the requests the L402 is valid for either.
+	status, remaining = request()
+	require.Equal(t, http.StatusPaymentRequired, status)
+	require.Equal(t, "5", remaining)
+
+	tokenID := l402.TokenID{4, 5, 6}
+	usageStore.mu.Lock()
+	require.EqualValues(t, 2, usageStore.used[tokenID.String()+"/svc"])
+	usageStore.mu.Unlock()
 }
 
 // runHTTPTest tests that the proxy can forward HTTP requests to a backend
@@ -202,7 +557,9 @@ func runHTTPTest(t *testing.T, tc *testCase, method string) {
 	}}
 
 	mockAuth := auth.NewMockAuthenticator()
-	p, err := proxy.New(mockAuth, services, []string{})
+	p, err := proxy.New(
+		mockAuth, services, []string{}, nil, nil, nil,
+	)
 	require.NoError(t, err)
 
 	// Start server that gives requests to the proxy.
@@ -397,7 +754,9 @@ func runGRPCTest(t *testing.T, tc *testCase) {
 
 	// Create the proxy server and start serving on TLS.
 	mockAuth := auth.NewMockAuthenticator()
-	p, err := proxy.New(mockAuth, services, []string{})
+	p, err := proxy.New(
+		mockAuth, services, []string{}, nil, nil, nil,
+	)
 	require.NoError(t, err)
 	server := &http.Server{
 		Addr:      testProxyAddr,
@@ -446,7 +805,9 @@ func runGRPCTest(t *testing.T, tc *testCase) {
 
 		// We expect the WWW-Authenticate header field to be set to an L402
 		// auth response.
-		expectedHeaderContent, _ := mockAuth.FreshChallengeHeader("", 0)
+		expectedHeaderContent, _ := mockAuth.FreshChallengeHeader(
+			nil, l402.Service{}, nil, false,
+		)
 		capturedHeader := captureMetadata.Get("WWW-Authenticate")
 		require.Len(t, capturedHeader, 2)
 		require.Equal(
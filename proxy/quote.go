@@ -0,0 +1,39 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/pricer"
+)
+
+// quoteRequest returns the quote of the pricer of the target service for the
+// given request. If the request is authenticated, the pricer is told about the
+// L402 it was made with.
+func quoteRequest(r *http.Request, target *Service, resourceName string,
+	remoteIP net.IP, authenticated bool) (*pricer.Quote, error) {
+
+	info := &pricer.RequestInfo{
+		ServiceName: target.Name,
+		RemoteIP:    remoteIP,
+	}
+	if mac := authenticatedMacaroon(r, authenticated); mac != nil {
+		id, err := l402.DecodeIdentifier(bytes.NewReader(mac.Id()))
+		if err != nil {
+			return nil, err
+		}
+
+		caveats := ExtractCaveats(r, true)
+		tier, _, err := l402.GrantedTier(caveats, resourceName)
+		if err != nil {
+			return nil, err
+		}
+
+		info.TokenID = &id.TokenID
+		info.Tier = tier
+	}
+
+	return pricer.GetQuote(r.Context(), target.pricer, r, info)
+}
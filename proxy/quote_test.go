@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/pricer"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/macaroon.v2"
+)
+
+// mockQuotePricer is a pricer that records the context of the requests it
+// quotes.
+type mockQuotePricer struct {
+	pricer.DefaultPricer
+
+	info *pricer.RequestInfo
+}
+
+// GetQuote records the given request context and returns a quote with the
+// static price.
+func (m *mockQuotePricer) GetQuote(_ context.Context, _ *http.Request,
+	info *pricer.RequestInfo) (*pricer.Quote, error) {
+
+	m.info = info
+
+	return &pricer.Quote{Price: m.Price, Capabilities: []string{"read"}},
+		nil
+}
+
+// TestQuoteRequest tests that pricers are given the context of the requests
+// they quote.
+func TestQuoteRequest(t *testing.T) {
+	quotePricer := &mockQuotePricer{
+		DefaultPricer: pricer.DefaultPricer{Price: 10},
+	}
+	service := &Service{Name: "service", pricer: quotePricer}
+	remoteIP := net.ParseIP("1.2.3.4")
+
+	// Unauthenticated requests are quoted without an L402.
+	r := httptest.NewRequest("GET", "/", nil)
+	quote, err := quoteRequest(r, service, "service", remoteIP, false)
+	require.NoError(t, err)
+	require.Equal(t, &pricer.Quote{
+		Price:        10,
+		Capabilities: []string{"read"},
+	}, quote)
+	require.Equal(t, &pricer.RequestInfo{
+		ServiceName: "service",
+		RemoteIP:    remoteIP,
+	}, quotePricer.info)
+
+	// Authenticated requests are quoted with the token ID and the tier of
+	// their L402.
+	preimage := lntypes.Preimage{1}
+	id := &l402.Identifier{
+		PaymentHash: preimage.Hash(),
+		TokenID:     l402.TokenID{2},
+	}
+	var idBytes bytes.Buffer
+	require.NoError(t, l402.EncodeIdentifier(&idBytes, id))
+
+	mac, err := macaroon.New(
+		[]byte("root key"), idBytes.Bytes(), "lsat",
+		macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+	servicesCaveat, err := l402.NewServicesCaveat(l402.Service{
+		Name: "service",
+		Tier: 2,
+	})
+	require.NoError(t, err)
+	require.NoError(t, l402.AddFirstPartyCaveats(mac, servicesCaveat))
+	require.NoError(t, l402.SetHeader(&r.Header, mac, preimage))
+
+	_, err = quoteRequest(r, service, "service", remoteIP, true)
+	require.NoError(t, err)
+	require.Equal(t, &id.TokenID, quotePricer.info.TokenID)
+	require.EqualValues(t, 2, quotePricer.info.Tier)
+
+	// Pricers that can't quote requests only determine the price.
+	service.pricer = pricer.NewDefaultPricer(20)
+	quote, err = quoteRequest(r, service, "service", remoteIP, true)
+	require.NoError(t, err)
+	require.Equal(t, &pricer.Quote{Price: 20}, quote)
+}
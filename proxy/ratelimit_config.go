@@ -1,8 +1,12 @@
 package proxy
 
 import (
+	"fmt"
 	"regexp"
+	"strings"
 	"time"
+
+	"github.com/lightninglabs/aperture/l402"
 )
 
 // RateLimitConfig defines a rate limiting rule for a specific path pattern.
@@ -21,8 +25,16 @@ type RateLimitConfig struct {
 	// exceeding the steady-state rate. Defaults to Requests if not set.
 	Burst int `long:"burst" description:"Maximum burst size (defaults to Requests if not set)"`
 
+	// Caveats is an optional list of caveats in the form "condition=value"
+	// that the L402 of a request must carry for this rate limit to apply.
+	// This allows tokens of different tiers to have different limits.
+	Caveats []string `long:"caveats" description:"List of caveats in the form condition=value the L402 of a request must carry for this rate limit to apply"`
+
 	// compiledPathRegexp is the compiled version of PathRegexp.
 	compiledPathRegexp *regexp.Regexp
+
+	// caveats is the decoded version of Caveats.
+	caveats []l402.Caveat
 }
 
 // Rate returns the rate.Limit value (requests per second) for this
@@ -54,3 +66,89 @@ func (r *RateLimitConfig) Matches(path string) bool {
 
 	return r.compiledPathRegexp.MatchString(path)
 }
+
+// HasCaveats returns true if this rate limit only applies to L402s that carry
+// certain caveats.
+func (r *RateLimitConfig) HasCaveats() bool {
+	return len(r.caveats) > 0
+}
+
+// MatchesCaveats returns true if the given caveats of an L402 satisfy all
+// caveats of this rate limit. A caveat is satisfied if the L402 has a caveat
+// with the same condition and either the same value or a comma-separated list
+// of values that contains it, like the capabilities caveat.
+//
+// Only the first caveat of each condition is considered. Caveats are added in
+// order, so the first one was added when the L402 was minted, while later ones
+// could have been added by its holder. That's why decodeCaveats only allows
+// conditions the mint sets on every L402 of the service.
+func (r *RateLimitConfig) MatchesCaveats(caveats []l402.Caveat) bool {
+	for _, required := range r.caveats {
+		value, ok := firstCaveatValue(caveats, required.Condition)
+		if !ok || !containsValue(value, required.Value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeCaveats decodes the caveats the rate limit of the given service is
+// restricted to. Only the services caveat, which contains the tier of the
+// service, and the capabilities caveat of the service are allowed, as the mint
+// sets them on every L402 of the service. The holder of an L402 could claim a
+// better tier by adding any other caveat to it.
+func (r *RateLimitConfig) decodeCaveats(serviceName string) error {
+	capabilities := serviceName + l402.CondCapabilitiesSuffix
+
+	r.caveats = make([]l402.Caveat, 0, len(r.Caveats))
+	for _, rawCaveat := range r.Caveats {
+		caveat, err := l402.DecodeCaveat(rawCaveat)
+		if err != nil {
+			return err
+		}
+
+		if caveat.Condition != l402.CondServices &&
+			caveat.Condition != capabilities {
+
+			return fmt.Errorf("caveat condition %s is not set on "+
+				"every L402, only %s and %s are allowed",
+				caveat.Condition, l402.CondServices,
+				capabilities)
+		}
+
+		r.caveats = append(r.caveats, caveat)
+	}
+
+	return nil
+}
+
+// firstCaveatValue returns the value of the first caveat with the given
+// condition.
+func firstCaveatValue(caveats []l402.Caveat, condition string) (string,
+	bool) {
+
+	for _, caveat := range caveats {
+		if caveat.Condition == condition {
+			return caveat.Value, true
+		}
+	}
+
+	return "", false
+}
+
+// containsValue returns true if the given caveat value is equal to the target
+// value or is a comma-separated list that contains it.
+func containsValue(value, target string) bool {
+	if value == target {
+		return true
+	}
+
+	for _, v := range strings.Split(value, ",") {
+		if v == target {
+			return true
+		}
+	}
+
+	return false
+}
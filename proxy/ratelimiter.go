@@ -2,8 +2,11 @@ package proxy
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -11,6 +14,7 @@ import (
 	"github.com/lightninglabs/aperture/netutil"
 	"github.com/lightninglabs/neutrino/cache/lru"
 	"golang.org/x/time/rate"
+	"gopkg.in/macaroon.v2"
 )
 
 const (
@@ -20,14 +24,14 @@ const (
 )
 
 // limiterKey is a composite key for the rate limiter cache. Using a struct
-// instead of a concatenated string saves memory because the pathPattern field
-// can reference the same underlying string across multiple keys.
+// instead of a concatenated string saves memory because the rule field
+// references the same config across multiple keys.
 type limiterKey struct {
 	// clientKey identifies the client (e.g., "ip:1.2.3.4" or "token:abc").
 	clientKey string
-	// pathPattern is the rate limit rule's PathRegexp (pointer to config's
-	// string, not a copy).
-	pathPattern string
+	// rule is the rate limit rule the limiter belongs to. Rules can share
+	// a path pattern if they apply to different caveats.
+	rule *RateLimitConfig
 }
 
 // limiterEntry holds a rate.Limiter. Implements cache.Value interface.
@@ -41,7 +45,9 @@ func (e *limiterEntry) Size() (uint64, error) {
 	return 1, nil
 }
 
-// RateLimiter manages per-key rate limiters with LRU eviction.
+// RateLimiter manages per-key rate limiters with LRU eviction. If a shared
+// LimiterStore is configured, the token buckets are kept in that store instead,
+// which enforces the limits across all aperture instances that use it.
 type RateLimiter struct {
 	// cacheMu protects the LRU cache which is not concurrency-safe.
 	cacheMu sync.Mutex
@@ -55,8 +61,13 @@ type RateLimiter struct {
 	// maxSize is the maximum number of entries in the cache.
 	maxSize int
 
-	// serviceName is used for metrics labels.
+	// serviceName is used for metrics labels and to identify the buckets
+	// of the service in the limiter store.
 	serviceName string
+
+	// store is the optional shared store of the token buckets. If it is
+	// nil or unavailable, the in-memory cache is used.
+	store LimiterStore
 }
 
 // RateLimiterOption is a functional option for configuring a RateLimiter.
@@ -69,6 +80,13 @@ func WithMaxCacheSize(size int) RateLimiterOption {
 	}
 }
 
+// WithLimiterStore sets the store the token buckets are kept in.
+func WithLimiterStore(store LimiterStore) RateLimiterOption {
+	return func(rl *RateLimiter) {
+		rl.store = store
+	}
+}
+
 // NewRateLimiter creates a new RateLimiter with the given configurations.
 func NewRateLimiter(serviceName string, configs []*RateLimitConfig,
 	opts ...RateLimiterOption) *RateLimiter {
@@ -95,7 +113,35 @@ func NewRateLimiter(serviceName string, configs []*RateLimitConfig,
 func (rl *RateLimiter) Allow(r *http.Request, key string) (bool,
 	time.Duration) {
 
-	path := r.URL.Path
+	return rl.AllowCaveats(r, key, nil)
+}
+
+// AllowCaveats checks if a request should be allowed based on all matching rate
+// limits, given the caveats of the request's L402. The caveats must only be
+// passed if the L402 has been validated by the authenticator, see
+// ExtractCaveats.
+func (rl *RateLimiter) AllowCaveats(r *http.Request, key string,
+	caveats []l402.Caveat) (bool, time.Duration) {
+
+	configs := rl.matchingConfigs(r.URL.Path, caveats)
+
+	// If no rules matched, allow the request.
+	if len(configs) == 0 {
+		return true, 0
+	}
+
+	if rl.store != nil {
+		allowed, retryAfter, err := rl.allowShared(r, key, configs)
+		if err == nil {
+			return allowed, retryAfter
+		}
+
+		// We rather enforce the limits per instance than not at all
+		// if the shared store is unavailable.
+		log.Warnf("Unable to check rate limits of service %s in "+
+			"limiter store, using local limits: %v",
+			rl.serviceName, err)
+	}
 
 	// Collect all matching configs and their reservations. We need to check
 	// all rules before consuming any tokens, so that if any rule denies we
@@ -104,20 +150,16 @@ func (rl *RateLimiter) Allow(r *http.Request, key string) (bool,
 		cfg         *RateLimitConfig
 		reservation *rate.Reservation
 	}
-	reservations := make([]ruleReservation, 0, len(rl.configs))
+	reservations := make([]ruleReservation, 0, len(configs))
 
-	for _, cfg := range rl.configs {
-		if !cfg.Matches(path) {
-			continue
-		}
-
-		// Create composite key: client key + path pattern for
-		// independent limiting per rule. Using a struct instead of
-		// string concatenation saves memory since pathPattern
-		// references the config's string.
+	for _, cfg := range configs {
+		// Create composite key: client key + rule for independent
+		// limiting per rule. Using a struct instead of string
+		// concatenation saves memory since the rule references the
+		// config.
 		cacheKey := limiterKey{
-			clientKey:   key,
-			pathPattern: cfg.PathRegexp,
+			clientKey: key,
+			rule:      cfg,
 		}
 
 		limiter := rl.getOrCreateLimiter(cacheKey, cfg)
@@ -129,11 +171,6 @@ func (rl *RateLimiter) Allow(r *http.Request, key string) (bool,
 		})
 	}
 
-	// If no rules matched, allow the request.
-	if len(reservations) == 0 {
-		return true, 0
-	}
-
 	// Check if all reservations can proceed immediately. If any rule
 	// denies, we must cancel ALL reservations to avoid consuming tokens
 	// unfairly.
@@ -180,6 +217,77 @@ func (rl *RateLimiter) Allow(r *http.Request, key string) (bool,
 	return true, 0
 }
 
+// matchingConfigs returns the rate limits that apply to a request for the
+// given path with the given L402 caveats. Rate limits that require caveats take
+// precedence over the ones that don't: if any of them matches, the rate limits
+// without caveats are not applied. This allows tokens of a higher tier to have
+// higher limits than the base tier.
+func (rl *RateLimiter) matchingConfigs(path string,
+	caveats []l402.Caveat) []*RateLimitConfig {
+
+	var base, tiered []*RateLimitConfig
+	for _, cfg := range rl.configs {
+		if !cfg.Matches(path) {
+			continue
+		}
+
+		switch {
+		case !cfg.HasCaveats():
+			base = append(base, cfg)
+
+		case cfg.MatchesCaveats(caveats):
+			tiered = append(tiered, cfg)
+		}
+	}
+
+	if len(tiered) > 0 {
+		return tiered
+	}
+
+	return base
+}
+
+// allowShared checks if a request should be allowed based on the token buckets
+// of the given matching rate limits in the limiter store.
+func (rl *RateLimiter) allowShared(r *http.Request, key string,
+	configs []*RateLimitConfig) (bool, time.Duration, error) {
+
+	buckets := make([]LimiterBucket, 0, len(configs))
+	for _, cfg := range configs {
+		buckets = append(buckets, LimiterBucket{
+			Key:   rl.bucketKey(cfg, key),
+			Rate:  cfg.Rate(),
+			Burst: cfg.EffectiveBurst(),
+		})
+	}
+
+	allowed, retryAfter, err := rl.store.Take(r.Context(), buckets)
+	if err != nil {
+		return false, 0, err
+	}
+
+	counter := rateLimitAllowed
+	if !allowed {
+		counter = rateLimitDenied
+	}
+	for _, cfg := range configs {
+		counter.WithLabelValues(rl.serviceName, cfg.PathRegexp).Inc()
+	}
+
+	return allowed, retryAfter, nil
+}
+
+// bucketKey returns the key of the token bucket of the given client and rule
+// in the limiter store. The path pattern and caveats of the rule are hashed to
+// keep the key short.
+func (rl *RateLimiter) bucketKey(cfg *RateLimitConfig, key string) string {
+	rule := append([]string{cfg.PathRegexp}, cfg.Caveats...)
+	ruleHash := sha256.Sum256([]byte(strings.Join(rule, "\x00")))
+
+	return rl.serviceName + "/" + hex.EncodeToString(ruleHash[:8]) + "/" +
+		key
+}
+
 // getOrCreateLimiter retrieves an existing limiter or creates a new one.
 func (rl *RateLimiter) getOrCreateLimiter(key limiterKey,
 	cfg *RateLimitConfig) *rate.Limiter {
@@ -234,15 +342,12 @@ func ExtractRateLimitKey(r *http.Request, remoteIP net.IP,
 
 	// Only use L402 token ID if the request has been authenticated.
 	// This prevents DoS attacks where garbage L402 tokens flood the cache.
-	if authenticated {
-		mac, _, err := l402.FromHeader(&r.Header)
-		if err == nil && mac != nil {
-			identifier, err := l402.DecodeIdentifier(
-				bytes.NewBuffer(mac.Id()),
-			)
-			if err == nil {
-				return "token:" + identifier.TokenID.String()
-			}
+	if mac := authenticatedMacaroon(r, authenticated); mac != nil {
+		identifier, err := l402.DecodeIdentifier(
+			bytes.NewBuffer(mac.Id()),
+		)
+		if err == nil {
+			return "token:" + identifier.TokenID.String()
 		}
 	}
 
@@ -250,3 +355,56 @@ func ExtractRateLimitKey(r *http.Request, remoteIP net.IP,
 	// Mask the IP to group clients from the same network segment.
 	return "ip:" + netutil.MaskIP(remoteIP).String()
 }
+
+// ExtractCaveats extracts the first-party caveats of the L402 of a request in
+// the order they were added. They are used to check the tier, capabilities,
+// usage and balance of the L402. Unauthenticated requests have no caveats.
+//
+// IMPORTANT: The authenticated parameter should only be true if the L402 token
+// has been validated by the authenticator. Otherwise, clients could claim any
+// tier by sending a forged token.
+func ExtractCaveats(r *http.Request,
+	authenticated bool) []l402.Caveat {
+
+	mac := authenticatedMacaroon(r, authenticated)
+	if mac == nil {
+		return nil
+	}
+
+	rawCaveats := mac.Caveats()
+	caveats := make([]l402.Caveat, 0, len(rawCaveats))
+	for _, rawCaveat := range rawCaveats {
+		// Third-party caveats aren't verified by us, so their
+		// identifiers must not be mistaken for first-party caveats.
+		if len(rawCaveat.VerificationId) > 0 {
+			continue
+		}
+
+		caveat, err := l402.DecodeCaveat(string(rawCaveat.Id))
+		if err != nil {
+			// Ignore any unknown caveats as we can't decode them.
+			continue
+		}
+
+		caveats = append(caveats, caveat)
+	}
+
+	return caveats
+}
+
+// authenticatedMacaroon returns the L402 macaroon of an authenticated request
+// or nil if the request is not authenticated or has no valid L402 header.
+func authenticatedMacaroon(r *http.Request,
+	authenticated bool) *macaroon.Macaroon {
+
+	if !authenticated {
+		return nil
+	}
+
+	mac, _, err := l402.FromHeader(&r.Header)
+	if err != nil {
+		return nil
+	}
+
+	return mac
+}
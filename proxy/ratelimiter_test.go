@@ -1,6 +1,8 @@
 package proxy
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -9,7 +11,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightningnetwork/lnd/lntypes"
 	"github.com/stretchr/testify/require"
+	"gopkg.in/macaroon.v2"
 )
 
 // TestRateLimiterBasic tests basic rate limiting functionality.
@@ -434,3 +439,239 @@ func TestRateLimiterTokenRefill(t *testing.T) {
 	allowed, _ = rl.Allow(req, "test-key")
 	require.True(t, allowed)
 }
+
+// TestRateLimiterSharedStore tests that rate limiters that share a limiter
+// store enforce their limits together.
+func TestRateLimiterSharedStore(t *testing.T) {
+	cfg := &RateLimitConfig{
+		Requests: 2,
+		Per:      time.Hour,
+		Burst:    2,
+	}
+
+	// Two rate limiters of the same service simulate two aperture
+	// instances that share a store.
+	store := NewMemLimiterStore(DefaultMaxCacheSize)
+	rl1 := NewRateLimiter(
+		"test-service", []*RateLimitConfig{cfg},
+		WithLimiterStore(store),
+	)
+	rl2 := NewRateLimiter(
+		"test-service", []*RateLimitConfig{cfg},
+		WithLimiterStore(store),
+	)
+	other := NewRateLimiter(
+		"other-service", []*RateLimitConfig{cfg},
+		WithLimiterStore(store),
+	)
+
+	req := httptest.NewRequest("GET", "/api/test", nil)
+	allowed, _ := rl1.Allow(req, "test-key")
+	require.True(t, allowed)
+	allowed, _ = rl2.Allow(req, "test-key")
+	require.True(t, allowed)
+
+	// The quota is used up on both instances.
+	allowed, retryAfter := rl1.Allow(req, "test-key")
+	require.False(t, allowed)
+	require.Greater(t, retryAfter, time.Duration(0))
+	allowed, _ = rl2.Allow(req, "test-key")
+	require.False(t, allowed)
+
+	// Other services are not affected.
+	allowed, _ = other.Allow(req, "test-key")
+	require.True(t, allowed)
+
+	// The local cache is not used at all.
+	require.Zero(t, rl1.Size())
+	require.Zero(t, rl2.Size())
+}
+
+// failingLimiterStore is a LimiterStore that is always unavailable.
+type failingLimiterStore struct{}
+
+func (failingLimiterStore) Take(context.Context, []LimiterBucket) (bool,
+	time.Duration, error) {
+
+	return false, 0, errors.New("store unavailable")
+}
+
+// TestRateLimiterStoreUnavailable tests that the local limits are enforced if
+// the limiter store is unavailable.
+func TestRateLimiterStoreUnavailable(t *testing.T) {
+	cfg := &RateLimitConfig{
+		Requests: 1,
+		Per:      time.Hour,
+		Burst:    1,
+	}
+
+	rl := NewRateLimiter(
+		"test-service", []*RateLimitConfig{cfg},
+		WithLimiterStore(failingLimiterStore{}),
+	)
+
+	req := httptest.NewRequest("GET", "/api/test", nil)
+	allowed, _ := rl.Allow(req, "test-key")
+	require.True(t, allowed)
+	allowed, _ = rl.Allow(req, "test-key")
+	require.False(t, allowed)
+}
+
+// TestLimiterBucketTake tests the token bucket algorithm that is used by the
+// limiter stores.
+func TestLimiterBucketTake(t *testing.T) {
+	bucket := LimiterBucket{
+		Key:   "key",
+		Rate:  2,
+		Burst: 2,
+	}
+	now := time.Unix(1_000_000, 0)
+
+	// A new bucket starts out full.
+	state, wait := bucket.Take(BucketState{}, now)
+	require.Zero(t, wait)
+	require.Equal(t, BucketState{Tokens: 1, Updated: now}, state)
+
+	state, wait = bucket.Take(state, now)
+	require.Zero(t, wait)
+	require.Zero(t, state.Tokens)
+	require.Equal(t, now.Add(time.Second), bucket.FullAt(state))
+
+	// An empty bucket returns the time until the next token.
+	state, wait = bucket.Take(state, now)
+	require.Equal(t, 500*time.Millisecond, wait)
+	require.Zero(t, state.Tokens)
+
+	// Tokens are refilled over time, but never beyond the burst.
+	state, wait = bucket.Take(state, now.Add(500*time.Millisecond))
+	require.Zero(t, wait)
+	require.Zero(t, state.Tokens)
+
+	state, wait = bucket.Take(state, now.Add(time.Hour))
+	require.Zero(t, wait)
+	require.Equal(t, 1.0, state.Tokens)
+}
+
+// TestRateLimiterCaveatTiers tests that rate limits with caveats replace the
+// ones without for L402s that carry the caveats.
+func TestRateLimiterCaveatTiers(t *testing.T) {
+	base := &RateLimitConfig{
+		Requests: 1,
+		Per:      time.Hour,
+	}
+	premium := &RateLimitConfig{
+		Requests: 3,
+		Per:      time.Hour,
+		Caveats:  []string{"svc_capabilities=premium"},
+	}
+	premium.caveats = []l402.Caveat{
+		l402.NewCaveat("svc_capabilities", "premium"),
+	}
+
+	rl := NewRateLimiter(
+		"test-service", []*RateLimitConfig{base, premium},
+	)
+	req := httptest.NewRequest("GET", "/api/test", nil)
+
+	allowN := func(key string, caveats []l402.Caveat) int {
+		for i := 0; ; i++ {
+			allowed, _ := rl.AllowCaveats(req, key, caveats)
+			if !allowed {
+				return i
+			}
+		}
+	}
+
+	// Requests without the caveat get the base limit.
+	require.Equal(t, 1, allowN("base", nil))
+
+	// Premium tokens get the premium limit, also if the capability is one
+	// of many.
+	require.Equal(t, 3, allowN("premium", []l402.Caveat{
+		l402.NewCaveat("svc_capabilities", "premium"),
+	}))
+	require.Equal(t, 3, allowN("multi", []l402.Caveat{
+		l402.NewCaveat("svc_capabilities", "basic,premium"),
+	}))
+
+	// A caveat added by the holder of a token doesn't change its tier.
+	require.Equal(t, 1, allowN("forged", []l402.Caveat{
+		l402.NewCaveat("svc_capabilities", "basic"),
+		l402.NewCaveat("svc_capabilities", "premium"),
+	}))
+}
+
+// TestRateLimitCaveatValidation tests that rate limits can only be restricted
+// to caveats the mint sets on every L402 of the service.
+func TestRateLimitCaveatValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		caveats []string
+		err     string
+	}{{
+		name:    "capabilities",
+		caveats: []string{"svc_capabilities=premium"},
+	}, {
+		name:    "tier",
+		caveats: []string{"services=svc:1"},
+	}, {
+		name:    "malformed",
+		caveats: []string{"svc_capabilities"},
+		err:     "condition=value",
+	}, {
+		name:    "capabilities of other service",
+		caveats: []string{"other_capabilities=premium"},
+		err:     "caveat condition other_capabilities is not set",
+	}, {
+		name:    "optional caveat",
+		caveats: []string{"svc_valid_until=9999999999"},
+		err:     "caveat condition svc_valid_until is not set",
+	}}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &RateLimitConfig{
+				Requests: 1,
+				Per:      time.Second,
+				Caveats:  tc.caveats,
+			}
+
+			err := cfg.decodeCaveats("svc")
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Len(t, cfg.caveats, len(tc.caveats))
+				return
+			}
+
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
+
+// TestExtractCaveats tests that the first-party caveats are only extracted from
+// authenticated requests.
+func TestExtractCaveats(t *testing.T) {
+	mac, err := macaroon.New(
+		[]byte("key"), []byte("id"), "loc", macaroon.LatestVersion,
+	)
+	require.NoError(t, err)
+
+	caveat := l402.NewCaveat("svc_capabilities", "premium")
+	require.NoError(t, l402.AddFirstPartyCaveats(mac, caveat))
+
+	// A third-party caveat whose identifier looks like a first-party
+	// caveat is skipped.
+	err = mac.AddThirdPartyCaveat(
+		[]byte("root"), []byte("svc_capabilities=admin"), "third",
+	)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/test", nil)
+	err = l402.SetHeader(&req.Header, mac, lntypes.Preimage{1, 2, 3})
+	require.NoError(t, err)
+
+	require.Nil(t, ExtractCaveats(req, false))
+	require.Equal(
+		t, []l402.Caveat{caveat}, ExtractCaveats(req, true),
+	)
+}
@@ -53,6 +53,12 @@ type Service struct {
 	// or "off" for no authentication.
 	Auth auth.Level `long:"auth" description:"required authentication"`
 
+	// FreebieKey is the strategy used to identify clients when counting
+	// their free requests. Valid values are "ip" (the default),
+	// "header:<name>", "cookie:<name>" and "path:<regexp>", where the
+	// first capture group of the regular expression is used as the key.
+	FreebieKey string `long:"freebiekey" description:"Strategy to identify clients for the freebie count: ip, header:<name>, cookie:<name> or path:<regexp>"`
+
 	// HostRegexp is a regular expression that is tested against the 'Host'
 	// HTTP header field to find out if this service should be used.
 	HostRegexp string `long:"hostregexp" description:"Regular expression to match the host against"`
@@ -78,10 +84,34 @@ type Service struct {
 	// after creation of the L402.
 	Timeout int64 `long:"timeout" description:"An integer value that indicates the number of seconds until the service access expires"`
 
+	// MaxRequests is an optional number of requests that can be made with
+	// an L402 of the service at the base tier. The requests are counted
+	// per L402 and once they are used up, the client has to buy a new one.
+	MaxRequests int64 `long:"maxrequests" description:"The number of requests that can be made with an L402 of the service"`
+
+	// Balance is an optional number of satoshis an L402 of the service is
+	// funded with. In balance mode, the L402 is priced at its balance and
+	// each request deducts the price returned by the service's pricer from
+	// it. Once the balance doesn't cover a request anymore, the client has
+	// to top up the L402 or buy a new one.
+	Balance int64 `long:"balance" description:"The number of satoshis an L402 of the service is funded with, which requests spend according to their price"`
+
+	// TopUp indicates whether L402s of the service can be topped up once
+	// they expire or their requests are used up. A top-up is priced like a
+	// new L402 of the same tier and grants its timeout, max requests and
+	// balance again, while the L402 keeps its token ID.
+	TopUp bool `long:"topup" description:"Whether L402s of the service can be topped up instead of buying new ones"`
+
 	// Capabilities is the list of capabilities authorized for the service
 	// at the base tier.
 	Capabilities string `long:"capabilities" description:"A comma-separated list of the service capabilities authorized for the base tier"`
 
+	// CapabilityRules is an optional list of rules that define which
+	// capability an L402 must grant to access certain paths of the
+	// service. The first matching rule wins. Authenticated requests whose
+	// L402 lacks the capability are rejected.
+	CapabilityRules []*CapabilityRule `long:"capabilityrules" description:"List of rules mapping paths to the capability required to access them"`
+
 	// Constraints is the set of constraints that will take form of caveats.
 	// They'll be enforced for a service at the base tier. The key should
 	// correspond to the caveat's condition.
@@ -95,6 +125,19 @@ type Service struct {
 	// the pricer if a gPRC server is to be used for price data.
 	DynamicPrice pricer.Config `long:"dynamicprice" description:"Configuration for connecting to the gRPC server to use for the pricer backend"`
 
+	// PriceRules is an optional ordered list of rules that price the
+	// requests to the service without a gRPC price server. The first
+	// matching rule wins and requests that match none are charged the
+	// static price. Like with dynamic prices, L402s are minted per
+	// resource.
+	PriceRules []*pricer.PriceRule `long:"pricerules" description:"Ordered list of rules mapping requests to prices, the first matching rule wins"`
+
+	// Tiers is an optional list of additional tiers of the service. Each
+	// tier has its own price and restrictions. Clients request an L402 of
+	// a tier by its name in the X-L402-Tier header or the tier query
+	// parameter. Otherwise, L402s are minted for the base tier.
+	Tiers []*ServiceTier `long:"tiers" description:"List of additional tiers of the service"`
+
 	// AuthWhitelistPaths is an optional list of regular expressions that
 	// are matched against the path of the URL of a request. If the request
 	// URL matches any of those regular expressions, the call is treated as
@@ -135,18 +178,24 @@ type Service struct {
 }
 
 // ResourceName returns the string to be used to identify which resource a
-// macaroon has access to. If DynamicPrice Enabled option is set to true then
-// the service has further restrictions per resource and so the name will
-// include both the service name and the specific resource name. Otherwise
+// macaroon has access to. If the service is priced per resource then the
+// service has further restrictions per resource and so the name will include
+// both the service name and the specific resource name. Otherwise
 // authorisation is only restricted by service name.
 func (s *Service) ResourceName(resourcePath string) string {
-	if s.DynamicPrice.Enabled {
+	if s.pricedPerResource() {
 		return fmt.Sprintf("%s%s", s.Name, resourcePath)
 	}
 
 	return s.Name
 }
 
+// pricedPerResource returns true if the resources of the service have their own
+// prices, either from a gRPC price server or from price rules.
+func (s *Service) pricedPerResource() bool {
+	return s.DynamicPrice.Enabled || len(s.PriceRules) > 0
+}
+
 // AuthRequired determines the auth level required for a given request.
 func (s *Service) AuthRequired(r *http.Request) auth.Level {
 	// Does the request match any whitelist entry?
@@ -176,14 +225,114 @@ func (s *Service) SkipInvoiceCreation(r *http.Request) bool {
 	return false
 }
 
+// Clone returns a deep copy of the service's configuration. Any state that is
+// derived from the configuration when the service is prepared for the proxy
+// is not copied.
+func (s *Service) Clone() *Service {
+	clone := &Service{
+		Name:         s.Name,
+		TLSCertPath:  s.TLSCertPath,
+		Address:      s.Address,
+		Protocol:     s.Protocol,
+		Auth:         s.Auth,
+		FreebieKey:   s.FreebieKey,
+		HostRegexp:   s.HostRegexp,
+		PathRegexp:   s.PathRegexp,
+		Timeout:      s.Timeout,
+		MaxRequests:  s.MaxRequests,
+		Balance:      s.Balance,
+		TopUp:        s.TopUp,
+		Capabilities: s.Capabilities,
+		Price:        s.Price,
+		DynamicPrice: s.DynamicPrice,
+	}
+
+	if s.Headers != nil {
+		clone.Headers = make(map[string]string, len(s.Headers))
+		for key, value := range s.Headers {
+			clone.Headers[key] = value
+		}
+	}
+
+	if s.Constraints != nil {
+		clone.Constraints = make(map[string]string, len(s.Constraints))
+		for cond, value := range s.Constraints {
+			clone.Constraints[cond] = value
+		}
+	}
+
+	if s.AuthWhitelistPaths != nil {
+		clone.AuthWhitelistPaths = append(
+			[]string{}, s.AuthWhitelistPaths...,
+		)
+	}
+
+	if s.AuthSkipInvoiceCreationPaths != nil {
+		clone.AuthSkipInvoiceCreationPaths = append(
+			[]string{}, s.AuthSkipInvoiceCreationPaths...,
+		)
+	}
+
+	for _, tier := range s.Tiers {
+		clone.Tiers = append(clone.Tiers, tier.Clone())
+	}
+
+	for _, rule := range s.PriceRules {
+		clone.PriceRules = append(clone.PriceRules, rule.Clone())
+	}
+
+	for _, rule := range s.CapabilityRules {
+		clone.CapabilityRules = append(
+			clone.CapabilityRules, &CapabilityRule{
+				PathRegexp: rule.PathRegexp,
+				Capability: rule.Capability,
+			},
+		)
+	}
+
+	for _, rl := range s.RateLimits {
+		clone.RateLimits = append(clone.RateLimits, &RateLimitConfig{
+			PathRegexp: rl.PathRegexp,
+			Requests:   rl.Requests,
+			Per:        rl.Per,
+			Burst:      rl.Burst,
+			Caveats:    append([]string(nil), rl.Caveats...),
+		})
+	}
+
+	return clone
+}
+
 // prepareServices prepares the backend service configurations to be used by the
-// proxy.
-func prepareServices(services []*Service) error {
+// proxy. The freebie databases of the services are created from the given
+// store or kept in memory if it is nil. The same goes for the token buckets of
+// the rate limits and the given limiter store. Services that limit the number
+// of requests per L402 require a usage store.
+func prepareServices(services []*Service, freebieStore freebie.Store,
+	limiterStore LimiterStore, usageStore UsageStore) error {
+
 	for _, service := range services {
+		if err := service.Auth.Validate(); err != nil {
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+
+		freebieKey, err := freebie.ParseKeyStrategy(service.FreebieKey)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+
 		// Each freebie enabled service gets its own store.
-		if service.Auth.IsFreebie() {
-			service.freebieDB = freebie.NewMemIPMaskStore(
+		switch {
+		case service.Auth.IsFreebie() && freebieStore != nil:
+			service.freebieDB = freebieStore.ServiceDB(
+				service.Name, service.Auth.FreebieCount(),
+				service.Auth.FreebieWindow(), freebieKey,
+			)
+
+		case service.Auth.IsFreebie():
+			service.freebieDB = freebie.NewMemStore(
 				service.Auth.FreebieCount(),
+				service.Auth.FreebieWindow(), freebieKey,
 			)
 		}
 
@@ -282,6 +431,38 @@ func prepareServices(services []*Service) error {
 			)
 		}
 
+		if err := validateTiers(service.Tiers); err != nil {
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+
+		if service.MaxRequests < 0 {
+			return fmt.Errorf("service %s: negative max requests",
+				service.Name)
+		}
+		if service.Balance < 0 {
+			return fmt.Errorf("service %s: negative balance",
+				service.Name)
+		}
+		if service.Balance > 0 && len(service.Tiers) > 0 {
+			return fmt.Errorf("service %s: balance mode doesn't "+
+				"support tiers", service.Name)
+		}
+		if service.limitsRequests() && usageStore == nil {
+			return fmt.Errorf("service %s: max requests require "+
+				"a usage store", service.Name)
+		}
+		if service.Balance > 0 && usageStore == nil {
+			return fmt.Errorf("service %s: balance mode requires "+
+				"a usage store", service.Name)
+		}
+
+		for i, rule := range service.CapabilityRules {
+			if err := rule.compile(); err != nil {
+				return fmt.Errorf("service %s capability "+
+					"rule %d: %w", service.Name, i, err)
+			}
+		}
+
 		// Validate and compile rate limit configurations.
 		if len(service.RateLimits) > 0 {
 			for i, rl := range service.RateLimits {
@@ -311,11 +492,26 @@ func prepareServices(services []*Service) error {
 					}
 					rl.compiledPathRegexp = compiled
 				}
+
+				// Decode the caveats the rate limit is
+				// restricted to.
+				err := rl.decodeCaveats(service.Name)
+				if err != nil {
+					return fmt.Errorf("service %s rate "+
+						"limit %d: %w", service.Name,
+						i, err)
+				}
 			}
 
 			// Create the rate limiter for this service.
+			var opts []RateLimiterOption
+			if limiterStore != nil {
+				opts = append(opts, WithLimiterStore(
+					limiterStore,
+				))
+			}
 			service.rateLimiter = NewRateLimiter(
-				service.Name, service.RateLimits,
+				service.Name, service.RateLimits, opts...,
 			)
 
 			log.Infof("Initialized rate limiter for service %s "+
@@ -325,17 +521,34 @@ func prepareServices(services []*Service) error {
 
 		// If dynamic prices are enabled then use the provided
 		// DynamicPrice options to initialise a gRPC backed
-		// pricer client.
+		// pricer client, which is wrapped so that an unavailable
+		// price server doesn't stall or fail requests.
+		if service.DynamicPrice.Enabled && len(service.PriceRules) > 0 {
+			return fmt.Errorf("service %s: dynamic prices can't "+
+				"be combined with price rules", service.Name)
+		}
 		if service.DynamicPrice.Enabled {
-			priceClient, err := pricer.NewGRPCPricer(
-				&service.DynamicPrice,
-			)
+			cfg := &service.DynamicPrice
+			if cfg.FallbackPrice > maxServicePrice {
+				return fmt.Errorf("service %s: maximum "+
+					"fallback price exceeded", service.Name)
+			}
+
+			priceClient, err := pricer.NewGRPCPricer(cfg)
 			if err != nil {
 				return fmt.Errorf("error initializing "+
 					"pricer: %v", err)
 			}
 
-			service.pricer = priceClient
+			service.pricer, err = pricer.NewResilientPricer(
+				priceClient, cfg,
+			)
+			if err != nil {
+				_ = priceClient.Close()
+				return fmt.Errorf("service %s: invalid "+
+					"dynamic price config: %w",
+					service.Name, err)
+			}
 			continue
 		}
 
@@ -356,6 +569,29 @@ func prepareServices(services []*Service) error {
 				"service %s", service.Name)
 		}
 
+		for i, rule := range service.PriceRules {
+			if rule.Price > maxServicePrice {
+				return fmt.Errorf("service %s: price rule %d: "+
+					"maximum price exceeded", service.Name,
+					i)
+			}
+		}
+
+		// With price rules, requests are priced by the first rule they
+		// match and fall back to the static price.
+		if len(service.PriceRules) > 0 {
+			rulePricer, err := pricer.NewRulePricer(
+				service.PriceRules, service.Price,
+			)
+			if err != nil {
+				return fmt.Errorf("service %s: %w",
+					service.Name, err)
+			}
+
+			service.pricer = rulePricer
+			continue
+		}
+
 		// Initialise a default pricer where all resources in a server
 		// are given the same price.
 		service.pricer = pricer.NewDefaultPricer(service.Price)
@@ -0,0 +1,28 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrServiceNotFound is returned when a service that doesn't exist is
+	// looked up or removed from a ServiceStore.
+	ErrServiceNotFound = errors.New("service not found")
+)
+
+// ServiceStore is the interface of a persistent store for the backend
+// services that are added or updated at run time.
+type ServiceStore interface {
+	// Services returns all stored services in the order they were first
+	// added.
+	Services(ctx context.Context) ([]*Service, error)
+
+	// StoreService adds the given service to the store or replaces the
+	// configuration of an existing service with the same name.
+	StoreService(ctx context.Context, service *Service) error
+
+	// DeleteService removes the service with the given name from the
+	// store. If there is no such service, ErrServiceNotFound is returned.
+	DeleteService(ctx context.Context, name string) error
+}
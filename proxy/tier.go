@@ -0,0 +1,191 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lightninglabs/aperture/l402"
+)
+
+const (
+	// BaseTierName is the name clients can use to explicitly request an
+	// L402 of the base tier of a service.
+	BaseTierName = "base"
+
+	// TierQueryParam is the URL query parameter clients can use to request
+	// an L402 of a specific tier of a service.
+	TierQueryParam = "tier"
+
+	// TierHeader is the header field clients can use to request an L402 of
+	// a specific tier of a service. It takes precedence over the query
+	// parameter.
+	TierHeader = "X-L402-Tier"
+)
+
+var (
+	// ErrUnknownTier is returned if a client requests a tier that the
+	// service doesn't offer.
+	ErrUnknownTier = errors.New("unknown service tier")
+)
+
+// ServiceTier is an additional tier of a backend service. L402s of a tier are
+// minted with its own price and restrictions instead of the ones of the base
+// tier, which are defined by the service itself.
+type ServiceTier struct {
+	// Name is the name clients use to request an L402 of the tier.
+	Name string `long:"name" description:"Name clients use to request an L402 of the tier"`
+
+	// Level is the number of the tier that is encoded in the services
+	// caveat of its L402s. It must be unique within the service and can't
+	// be 0, which is the base tier.
+	Level uint8 `long:"level" description:"Number of the tier in the services caveat, between 1 and 255"`
+
+	// Price is the L402 value in satoshis of the tier.
+	Price int64 `long:"price" description:"Static L402 value in satoshis of the tier"`
+
+	// Timeout is an optional value that indicates in how many seconds the
+	// L402s of the tier time out after their creation.
+	Timeout int64 `long:"timeout" description:"An integer value that indicates the number of seconds until access of the tier expires"`
+
+	// MaxRequests is an optional number of requests that can be made with
+	// an L402 of the tier.
+	MaxRequests int64 `long:"maxrequests" description:"The number of requests that can be made with an L402 of the tier"`
+
+	// Capabilities is the list of capabilities authorized for the tier.
+	Capabilities string `long:"capabilities" description:"A comma-separated list of the service capabilities authorized for the tier"`
+
+	// Constraints is the set of constraints that will take form of caveats
+	// for L402s of the tier. The key should correspond to the caveat's
+	// condition.
+	Constraints map[string]string `long:"constraints" description:"The service constraints to enforce at the tier"`
+}
+
+// Clone returns a deep copy of the tier.
+func (t *ServiceTier) Clone() *ServiceTier {
+	clone := *t
+
+	if t.Constraints != nil {
+		clone.Constraints = make(map[string]string, len(t.Constraints))
+		for cond, value := range t.Constraints {
+			clone.Constraints[cond] = value
+		}
+	}
+
+	return &clone
+}
+
+// validateTiers makes sure the tiers of a service have unique names and
+// levels, and valid prices. Tiers without a price get the default price.
+func validateTiers(tiers []*ServiceTier) error {
+	names := make(map[string]struct{}, len(tiers))
+	levels := make(map[uint8]struct{}, len(tiers))
+	for _, tier := range tiers {
+		name := strings.ToLower(tier.Name)
+		switch {
+		case name == "":
+			return errors.New("tier name must be set")
+
+		case name == BaseTierName:
+			return fmt.Errorf("tier name %s is reserved for the "+
+				"base tier", BaseTierName)
+
+		case tier.Level == uint8(l402.BaseTier):
+			return fmt.Errorf("tier %s: level must be positive",
+				tier.Name)
+
+		case tier.Price < 0:
+			return fmt.Errorf("tier %s: negative price", tier.Name)
+
+		case tier.Price > maxServicePrice:
+			return fmt.Errorf("tier %s: maximum price exceeded",
+				tier.Name)
+
+		case tier.Timeout < 0:
+			return fmt.Errorf("tier %s: negative timeout",
+				tier.Name)
+
+		case tier.MaxRequests < 0:
+			return fmt.Errorf("tier %s: negative max requests",
+				tier.Name)
+		}
+
+		if _, ok := names[name]; ok {
+			return fmt.Errorf("duplicate tier name %s", tier.Name)
+		}
+		names[name] = struct{}{}
+
+		if _, ok := levels[tier.Level]; ok {
+			return fmt.Errorf("duplicate tier level %d", tier.Level)
+		}
+		levels[tier.Level] = struct{}{}
+
+		if tier.Price == 0 {
+			tier.Price = defaultServicePrice
+		}
+	}
+
+	return nil
+}
+
+// challengeService returns the service a new L402 should be minted for when
+// the given request is challenged. If the client requested one of the tiers of
+// the service, the L402 is minted for that tier at its price. Otherwise, it is
+// minted for the base tier at the given base price. Tier requests are ignored
+// for services without tiers, so they don't interfere with query parameters
+// of the backend.
+func (s *Service) challengeService(r *http.Request, name string,
+	basePrice int64) (l402.Service, error) {
+
+	service := l402.Service{
+		Name:  name,
+		Tier:  l402.BaseTier,
+		Price: basePrice,
+	}
+
+	// In balance mode, the L402 is priced at the balance it is funded
+	// with, while requests spend their price from that balance.
+	if s.Balance > 0 {
+		service.Price = s.Balance
+	}
+
+	if len(s.Tiers) == 0 {
+		return service, nil
+	}
+
+	requested := r.Header.Get(TierHeader)
+	if requested == "" {
+		requested = r.URL.Query().Get(TierQueryParam)
+	}
+	if requested == "" || strings.EqualFold(requested, BaseTierName) {
+		return service, nil
+	}
+
+	for _, tier := range s.Tiers {
+		if strings.EqualFold(tier.Name, requested) {
+			service.Tier = l402.ServiceTier(tier.Level)
+			service.Price = tier.Price
+
+			return service, nil
+		}
+	}
+
+	return l402.Service{}, fmt.Errorf("%w: %s", ErrUnknownTier, requested)
+}
+
+// tierName returns the name of the tier of the service with the given level.
+// It returns an empty string for services without tiers.
+func (s *Service) tierName(level l402.ServiceTier) string {
+	if len(s.Tiers) == 0 {
+		return ""
+	}
+
+	for _, tier := range s.Tiers {
+		if l402.ServiceTier(tier.Level) == level {
+			return tier.Name
+		}
+	}
+
+	return BaseTierName
+}
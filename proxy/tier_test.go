@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/stretchr/testify/require"
+)
+
+// TestChallengeServiceTier tests that clients can request an L402 of a
+// specific tier of a service.
+func TestChallengeServiceTier(t *testing.T) {
+	service := &Service{
+		Name: "service",
+		Tiers: []*ServiceTier{{
+			Name:  "premium",
+			Level: 2,
+			Price: 100,
+		}},
+	}
+	require.NoError(t, validateTiers(service.Tiers))
+
+	base := l402.Service{Name: "service", Price: 10}
+	premium := l402.Service{Name: "service", Tier: 2, Price: 100}
+
+	challenge := func(target string, header string) (l402.Service,
+		error) {
+
+		r := httptest.NewRequest("GET", target, nil)
+		if header != "" {
+			r.Header.Set(TierHeader, header)
+		}
+
+		return service.challengeService(r, "service", 10)
+	}
+
+	// Without a requested tier, the base tier is used.
+	s, err := challenge("/", "")
+	require.NoError(t, err)
+	require.Equal(t, base, s)
+
+	s, err = challenge("/?tier=base", "")
+	require.NoError(t, err)
+	require.Equal(t, base, s)
+
+	// A tier can be requested by query parameter or header, where the
+	// header takes precedence.
+	s, err = challenge("/?tier=premium", "")
+	require.NoError(t, err)
+	require.Equal(t, premium, s)
+
+	s, err = challenge("/?tier=base", "Premium")
+	require.NoError(t, err)
+	require.Equal(t, premium, s)
+
+	_, err = challenge("/?tier=gold", "")
+	require.ErrorIs(t, err, ErrUnknownTier)
+
+	// The tier a challenge is minted for is reported by its name.
+	require.Equal(t, BaseTierName, service.tierName(base.Tier))
+	require.Equal(t, "premium", service.tierName(premium.Tier))
+
+	// Services without tiers ignore the query parameter, as it might be
+	// meant for the backend.
+	service.Tiers = nil
+	s, err = challenge("/?tier=gold", "")
+	require.NoError(t, err)
+	require.Equal(t, base, s)
+	require.Empty(t, service.tierName(s.Tier))
+}
+
+// TestValidateTiers tests the validation of the tiers of a service.
+func TestValidateTiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		tiers []*ServiceTier
+		err   string
+	}{{
+		name:  "missing name",
+		tiers: []*ServiceTier{{Level: 1}},
+		err:   "tier name must be set",
+	}, {
+		name:  "base tier name",
+		tiers: []*ServiceTier{{Name: "Base", Level: 1}},
+		err:   "reserved for the base tier",
+	}, {
+		name:  "base tier level",
+		tiers: []*ServiceTier{{Name: "premium"}},
+		err:   "level must be positive",
+	}, {
+		name:  "negative price",
+		tiers: []*ServiceTier{{Name: "premium", Level: 1, Price: -1}},
+		err:   "negative price",
+	}, {
+		name: "duplicate name",
+		tiers: []*ServiceTier{
+			{Name: "premium", Level: 1},
+			{Name: "Premium", Level: 2},
+		},
+		err: "duplicate tier name",
+	}, {
+		name: "duplicate level",
+		tiers: []*ServiceTier{
+			{Name: "premium", Level: 1},
+			{Name: "gold", Level: 1},
+		},
+		err: "duplicate tier level",
+	}}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			require.ErrorContains(
+				t, validateTiers(test.tiers), test.err,
+			)
+		})
+	}
+
+	// Tiers without a price get the default price.
+	tiers := []*ServiceTier{{Name: "premium", Level: 1}}
+	require.NoError(t, validateTiers(tiers))
+	require.EqualValues(t, defaultServicePrice, tiers[0].Price)
+}
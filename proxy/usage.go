@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+
+	"github.com/lightninglabs/aperture/l402"
+)
+
+const (
+	// RequestsRemainingHeader is the header field that tells clients how
+	// many requests they can still make with their L402 to a service that
+	// limits the number of requests per L402.
+	RequestsRemainingHeader = "X-L402-Requests-Remaining"
+
+	// BalanceRemainingHeader is the header field that tells clients how
+	// many satoshis of the balance of their L402 remain for requests to a
+	// service in balance mode.
+	BalanceRemainingHeader = "X-L402-Balance-Remaining"
+)
+
+var (
+	// ErrUsageExhausted is returned by a UsageStore if all requests that
+	// can be made with an L402 to a service have been used up.
+	ErrUsageExhausted = errors.New("L402 usage exhausted")
+
+	// ErrInsufficientBalance is returned by a UsageStore if the remaining
+	// balance of an L402 doesn't cover the price of a request.
+	ErrInsufficientBalance = errors.New("insufficient L402 balance")
+)
+
+// UsageStore keeps track of the number of requests that were made with L402s
+// that are only valid for a limited number of requests and of the satoshis
+// spent by L402s that are funded with a balance.
+type UsageStore interface {
+	// TakeUsage records a request that is made with the L402 of the given
+	// token ID to the given service, unless the maximum number of requests
+	// was already reached, in which case ErrUsageExhausted is returned.
+	// The number of requests that can still be made is returned. The
+	// check and the update must happen atomically.
+	TakeUsage(ctx context.Context, tokenID l402.TokenID, service string,
+		maxRequests int64) (int64, error)
+
+	// ReturnUsage gives back a request that was recorded by TakeUsage for
+	// the L402 of the given token ID to the given service but wasn't
+	// served, for example because the balance of the L402 didn't cover
+	// its price.
+	ReturnUsage(ctx context.Context, tokenID l402.TokenID,
+		service string) error
+
+	// SpendBalance deducts the price of a request that is made with the
+	// L402 of the given token ID to the given service from its balance and
+	// returns the remaining balance. If the remaining balance doesn't
+	// cover the price, nothing is deducted and ErrInsufficientBalance is
+	// returned along with the remaining balance. The check and the update
+	// must happen atomically.
+	SpendBalance(ctx context.Context, tokenID l402.TokenID, service string,
+		price, balance int64) (int64, error)
+}
+
+// limitsRequests returns true if the L402s of the service or any of its tiers
+// are only valid for a limited number of requests.
+func (s *Service) limitsRequests() bool {
+	if s.MaxRequests > 0 {
+		return true
+	}
+
+	for _, tier := range s.Tiers {
+		if tier.MaxRequests > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,82 @@
+package aperture
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/lightninglabs/aperture/proxy"
+)
+
+// Reload applies the reloadable parts of the given configuration to the
+// running proxy. These are the backend services, including their pricing and
+// rate limits, the bundles of services and the blocklist. If the new services
+// are invalid, an error is returned and the running configuration is left
+// untouched. If only the new bundles are invalid, an error is returned too, but
+// the new services and blocklist are applied while the running bundles are
+// kept. All other options only take effect after a restart.
+func (a *Aperture) Reload(cfg *Config) error {
+	// The proxy prepares the services it is given in place, so we need to
+	// make sure the configuration we keep stays untouched.
+	var err error
+	if a.adminSrv != nil {
+		err = a.adminSrv.updateStaticServices(
+			context.Background(), cfg.Services,
+		)
+	} else {
+		err = a.UpdateServices(cloneServices(cfg.Services))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to update services: %w", err)
+	}
+
+	// The services are already applied at this point, so the rest of the
+	// configuration is applied even if the bundles turn out to be invalid.
+	bundleErr := a.proxy.UpdateBundles(cfg.Bundles)
+
+	a.proxy.UpdateBlocklist(cfg.Blocklist)
+
+	logServiceChanges(a.cfg.Services, cfg.Services)
+	if !reflect.DeepEqual(a.cfg.Blocklist, cfg.Blocklist) {
+		log.Infof("Updated blocklist, now blocking %d IP address(es)",
+			len(cfg.Blocklist))
+	}
+
+	a.cfg.Services = cfg.Services
+	a.cfg.Blocklist = cfg.Blocklist
+
+	if bundleErr != nil {
+		return fmt.Errorf("unable to update bundles: %w", bundleErr)
+	}
+	a.cfg.Bundles = cfg.Bundles
+
+	return nil
+}
+
+// logServiceChanges logs which services of the configuration file were added,
+// changed or removed.
+func logServiceChanges(oldServices, newServices []*proxy.Service) {
+	oldByName := make(map[string]*proxy.Service, len(oldServices))
+	for _, service := range oldServices {
+		oldByName[service.Name] = service
+	}
+
+	for _, service := range newServices {
+		old, ok := oldByName[service.Name]
+		delete(oldByName, service.Name)
+
+		switch {
+		case !ok:
+			log.Infof("Added service %s from reloaded config",
+				service.Name)
+
+		case !reflect.DeepEqual(old, service):
+			log.Infof("Updated service %s from reloaded config",
+				service.Name)
+		}
+	}
+
+	for name := range oldByName {
+		log.Infof("Removed service %s from reloaded config", name)
+	}
+}
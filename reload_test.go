@@ -0,0 +1,166 @@
+package aperture
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lightninglabs/aperture/adminrpc"
+	"github.com/lightninglabs/aperture/aperturedb"
+	"github.com/lightninglabs/aperture/auth"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+// TestReload tests that the services of a reloaded configuration are applied
+// to the running proxy and that invalid ones are rejected without affecting
+// the running configuration.
+func TestReload(t *testing.T) {
+	services := []*proxy.Service{{
+		Name:       "service1",
+		Address:    "127.0.0.1:10009",
+		Protocol:   "https",
+		HostRegexp: "^service1.com$",
+		Price:      10,
+	}}
+
+	prxy, err := proxy.New(
+		auth.NewMockAuthenticator(), cloneServices(services), nil,
+		nil, nil, nil,
+	)
+	require.NoError(t, err)
+
+	a := &Aperture{
+		cfg: &Config{
+			Services: services,
+		},
+		proxy:          prxy,
+		serviceLimiter: newStaticServiceLimiter(services),
+	}
+
+	// Reloading a configuration with an invalid service should fail and
+	// keep the running services.
+	invalid := &Config{
+		Services: []*proxy.Service{{
+			Name:       "invalid",
+			HostRegexp: "[",
+		}},
+	}
+	require.Error(t, a.Reload(invalid))
+	require.Equal(t, []string{"service1"}, serviceNames(prxy.Services()))
+	require.Equal(t, services, a.cfg.Services)
+
+	// A valid configuration should replace the running services.
+	updated := services[0].Clone()
+	updated.Price = 20
+	valid := &Config{
+		Services: []*proxy.Service{updated, {
+			Name:       "service2",
+			Address:    "127.0.0.1:8080",
+			Protocol:   "http",
+			HostRegexp: "^service2.com$",
+		}},
+		Bundles: []*proxy.Bundle{{
+			Name:     "all",
+			Services: []string{"service1", "service2"},
+			Price:    25,
+		}},
+		Blocklist: []string{"10.0.0.1"},
+	}
+	require.NoError(t, a.Reload(valid))
+	require.Equal(
+		t, []string{"service1", "service2"},
+		serviceNames(prxy.Services()),
+	)
+	require.EqualValues(t, 20, prxy.Services()[0].Price)
+	require.Equal(t, valid.Services, a.cfg.Services)
+	require.Equal(t, valid.Bundles, a.cfg.Bundles)
+	require.Equal(t, valid.Blocklist, a.cfg.Blocklist)
+
+	// Bundles of unknown services are rejected and the running bundles
+	// are kept. The valid services and the blocklist are still applied.
+	changed := valid.Services[1].Clone()
+	changed.Price = 30
+	invalidBundles := &Config{
+		Services: []*proxy.Service{valid.Services[0], changed},
+		Bundles: []*proxy.Bundle{{
+			Name:     "all",
+			Services: []string{"service3"},
+			Price:    25,
+		}},
+		Blocklist: []string{"10.0.0.2"},
+	}
+	require.Error(t, a.Reload(invalidBundles))
+	require.Equal(t, valid.Bundles, a.cfg.Bundles)
+	require.Equal(t, invalidBundles.Services, a.cfg.Services)
+	require.Equal(t, invalidBundles.Blocklist, a.cfg.Blocklist)
+	require.EqualValues(t, 30, prxy.Services()[1].Price)
+
+	req := httptest.NewRequest("GET", "http://service2.com/", nil)
+	req.RemoteAddr = "10.0.0.2:1234"
+	rec := httptest.NewRecorder()
+	prxy.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+// TestReloadAdmin tests that services that were added or changed through the
+// admin API survive a reload of the configuration file.
+func TestReloadAdmin(t *testing.T) {
+	ctx := context.Background()
+	db := aperturedb.NewTestDB(t).BaseDB
+
+	static := []*proxy.Service{{
+		Name:       "static",
+		Address:    "127.0.0.1:10009",
+		Protocol:   "https",
+		HostRegexp: "^static.com$",
+		Price:      10,
+	}}
+	server, prxy := newTestAdminServer(t, db, static)
+
+	_, err := server.AddService(ctx, &adminrpc.AddServiceRequest{
+		Service: &adminrpc.Service{
+			Name:       "dynamic",
+			Address:    "127.0.0.1:8080",
+			Protocol:   "http",
+			HostRegexp: "^dynamic.com$",
+		},
+	})
+	require.NoError(t, err)
+
+	a := &Aperture{
+		cfg: &Config{
+			Services: static,
+		},
+		proxy:          prxy,
+		serviceLimiter: newStaticServiceLimiter(static),
+		adminSrv:       server,
+	}
+
+	// Replace the static service with a new one. The dynamic service must
+	// still be there afterwards.
+	reloaded := &Config{
+		Services: []*proxy.Service{{
+			Name:       "other",
+			Address:    "127.0.0.1:10010",
+			Protocol:   "https",
+			HostRegexp: "^other.com$",
+		}},
+	}
+	require.NoError(t, a.Reload(reloaded))
+	require.Equal(
+		t, []string{"other", "dynamic"}, serviceNames(prxy.Services()),
+	)
+
+	// The new static service can't be removed through the admin API
+	// anymore while the old one is gone.
+	_, err = server.RemoveService(ctx, &adminrpc.RemoveServiceRequest{
+		Name: "other",
+	})
+	require.Error(t, err)
+	_, err = server.RemoveService(ctx, &adminrpc.RemoveServiceRequest{
+		Name: "static",
+	})
+	require.Error(t, err)
+}
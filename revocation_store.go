@@ -0,0 +1,153 @@
+package aperture
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// revocationsPrefix is the key we'll use to prefix the revocation
+	// list of L402s when storing it in an etcd cluster.
+	revocationsPrefix = "revocations"
+
+	// revokedTokenIDPrefix is the key we'll use to prefix the entries of
+	// the revocation list that revoke L402s by their token ID.
+	revokedTokenIDPrefix = "token"
+
+	// revokedHashPrefix is the key we'll use to prefix the entries of the
+	// revocation list that revoke L402s by their payment hash.
+	revokedHashPrefix = "hash"
+)
+
+// revocationKey returns the full key to store in the database for an entry of
+// the revocation list. The entry revokes L402s by their token ID if set,
+// otherwise by their payment hash.
+//
+// The resulting path of an entry within etcd would look like:
+// lsat/proxy/revocations/token/<token_id> or
+// lsat/proxy/revocations/hash/<payment_hash>
+func revocationKey(revocation *mint.Revocation) string {
+	kind, value := revokedHashPrefix, revocation.PaymentHash.String()
+	if revocation.TokenID != (l402.TokenID{}) {
+		kind, value = revokedTokenIDPrefix, revocation.TokenID.String()
+	}
+
+	return strings.Join(
+		[]string{topLevelKey, revocationsPrefix, kind, value},
+		etcdKeyDelimeter,
+	)
+}
+
+// revocationStore is a store of the revocation list of L402s backed by an etcd
+// cluster.
+type revocationStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure revocationStore implements
+// mint.RevocationStore.
+var _ mint.RevocationStore = (*revocationStore)(nil)
+
+// newRevocationStore instantiates a new revocation list store backed by an
+// etcd cluster.
+func newRevocationStore(client *clientv3.Client) *revocationStore {
+	return &revocationStore{Client: client}
+}
+
+// RevokeL402 adds the given revocation to the revocation list. An existing
+// entry is kept as is.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (s *revocationStore) RevokeL402(ctx context.Context,
+	revocation *mint.Revocation) error {
+
+	entry := *revocation
+	entry.RevokedAt = time.Now()
+	value, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	key := revocationKey(&entry)
+	_, err = s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(key, string(value)),
+	).Commit()
+
+	return err
+}
+
+// IsRevoked returns true if the L402 with the given token ID or the given
+// payment hash was revoked.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (s *revocationStore) IsRevoked(ctx context.Context, tokenID l402.TokenID,
+	paymentHash lntypes.Hash) (bool, error) {
+
+	resp, err := s.Txn(ctx).Then(
+		clientv3.OpGet(
+			revocationKey(&mint.Revocation{TokenID: tokenID}),
+			clientv3.WithCountOnly(),
+		),
+		clientv3.OpGet(
+			revocationKey(&mint.Revocation{
+				PaymentHash: paymentHash,
+			}),
+			clientv3.WithCountOnly(),
+		),
+	).Commit()
+	if err != nil {
+		return false, err
+	}
+
+	for _, getResp := range resp.Responses {
+		if getResp.GetResponseRange().Count > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Revocations returns all entries of the revocation list in the order they were
+// added.
+//
+// NOTE: This is part of the mint.RevocationStore interface.
+func (s *revocationStore) Revocations(
+	ctx context.Context) ([]*mint.Revocation, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, revocationsPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(
+		ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(
+			clientv3.SortByCreateRevision, clientv3.SortAscend,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	revocations := make([]*mint.Revocation, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var revocation mint.Revocation
+		if err := json.Unmarshal(kv.Value, &revocation); err != nil {
+			return nil, fmt.Errorf("unable to decode revocation "+
+				"%s: %w", kv.Key, err)
+		}
+
+		revocations = append(revocations, &revocation)
+	}
+
+	return revocations, nil
+}
@@ -0,0 +1,57 @@
+package aperture
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+// TestRevocationStore ensures the different operations of the revocationStore
+// behave as expected.
+func TestRevocationStore(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newRevocationStore(etcdClient)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	paymentHash := lntypes.Hash{4, 5, 6}
+
+	revoked, err := store.IsRevoked(ctx, tokenID, paymentHash)
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	// Revoke one L402 by its token ID and another one by its payment
+	// hash.
+	byTokenID := &mint.Revocation{TokenID: tokenID, Reason: "abuse"}
+	require.NoError(t, store.RevokeL402(ctx, byTokenID))
+	require.NoError(t, store.RevokeL402(ctx, byTokenID))
+
+	byHash := &mint.Revocation{PaymentHash: paymentHash}
+	require.NoError(t, store.RevokeL402(ctx, byHash))
+
+	revoked, err = store.IsRevoked(ctx, tokenID, lntypes.Hash{7})
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, l402.TokenID{7}, paymentHash)
+	require.NoError(t, err)
+	require.True(t, revoked)
+
+	revoked, err = store.IsRevoked(ctx, l402.TokenID{7}, lntypes.Hash{7})
+	require.NoError(t, err)
+	require.False(t, revoked)
+
+	revocations, err := store.Revocations(ctx)
+	require.NoError(t, err)
+	require.Len(t, revocations, 2)
+	require.Equal(t, tokenID, revocations[0].TokenID)
+	require.Equal(t, "abuse", revocations[0].Reason)
+	require.Equal(t, paymentHash, revocations[1].PaymentHash)
+}
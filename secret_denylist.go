@@ -0,0 +1,93 @@
+package aperture
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/mint"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// secretDenylistPrefix is the key we'll use to prefix the denylist of
+	// revoked secrets when storing it in an etcd cluster.
+	secretDenylistPrefix = "secretdenylist"
+)
+
+// deniedSecretKey returns the full key to store in the database for a secret
+// on the denylist.
+//
+// The resulting path of the identifier bff4ee83 within etcd would look like:
+// lsat/proxy/secretdenylist/bff4ee83
+func deniedSecretKey(id [sha256.Size]byte) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, secretDenylistPrefix,
+			hex.EncodeToString(id[:]),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// secretDenylist is the denylist of revoked secrets backed by an etcd cluster.
+type secretDenylist struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure secretDenylist implements
+// mint.SecretDenylist.
+var _ mint.SecretDenylist = (*secretDenylist)(nil)
+
+// newSecretDenylist instantiates a new denylist of revoked secrets backed by an
+// etcd cluster.
+func newSecretDenylist(client *clientv3.Client) *secretDenylist {
+	return &secretDenylist{Client: client}
+}
+
+// DenySecret adds the secret keyed by the given hash to the denylist.
+//
+// NOTE: This is part of the mint.SecretDenylist interface.
+func (s *secretDenylist) DenySecret(ctx context.Context,
+	id [sha256.Size]byte) error {
+
+	key := deniedSecretKey(id)
+	_, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(
+			key, strconv.FormatInt(time.Now().Unix(), 10),
+		),
+	).Commit()
+
+	return err
+}
+
+// DeniedSecrets returns the hashes of all secrets on the denylist.
+//
+// NOTE: This is part of the mint.SecretDenylist interface.
+func (s *secretDenylist) DeniedSecrets(
+	ctx context.Context) ([][sha256.Size]byte, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, secretDenylistPrefix, ""},
+		etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([][sha256.Size]byte, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		id, err := decodeIDKey(string(kv.Key), prefix)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, id)
+	}
+
+	return hashes, nil
+}
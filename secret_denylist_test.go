@@ -0,0 +1,34 @@
+package aperture
+
+import (
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestSecretDenylist ensures the different operations of the secretDenylist
+// behave as expected.
+func TestSecretDenylist(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newSecretDenylist(etcdClient)
+
+	hashes, err := store.DeniedSecrets(ctx)
+	require.NoError(t, err)
+	require.Empty(t, hashes)
+
+	// Denying a secret twice only adds it once.
+	first, second := [sha256.Size]byte{1}, [sha256.Size]byte{2}
+	require.NoError(t, store.DenySecret(ctx, first))
+	require.NoError(t, store.DenySecret(ctx, second))
+	require.NoError(t, store.DenySecret(ctx, first))
+
+	hashes, err = store.DeniedSecrets(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, [][sha256.Size]byte{first, second}, hashes)
+}
@@ -5,18 +5,47 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/lightninglabs/aperture/aperturedb"
 	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
 	clientv3 "go.etcd.io/etcd/client/v3"
 )
 
+const (
+	// secretExpiryTxRetries is the number of times updating the expiry of
+	// a secret is retried if another instance modified it concurrently.
+	secretExpiryTxRetries = 10
+)
+
 var (
 	// secretsPrefix is the key we'll use to prefix all L402 identifiers
 	// with when storing secrets in an etcd cluster.
 	secretsPrefix = "secrets"
+
+	// secretExpiryPrefix is the key we'll use to prefix the expiry of
+	// secrets when storing it in an etcd cluster.
+	secretExpiryPrefix = "secretexpiry"
+
+	// rootKeysPrefix is the key we'll use to prefix the root keys that
+	// wrap the secrets when storing them in an etcd cluster.
+	rootKeysPrefix = "rootkeys"
+
+	// errRootKeyExists is returned if a root key is added with the version
+	// of another root key.
+	errRootKeyExists = errors.New("root key already exists")
+
+	// errSecretExpiryRetriesExceeded is returned if the expiry of a secret
+	// couldn't be updated because of concurrent modifications within the
+	// allowed number of retries.
+	errSecretExpiryRetriesExceeded = errors.New("secret expiry tx " +
+		"retries exceeded")
 )
 
 // idKey returns the full key to store in the database for an L402 identifier.
@@ -32,22 +61,114 @@ func idKey(id [sha256.Size]byte) string {
 	)
 }
 
+// secretExpiryKey returns the full key to store in the database for the expiry
+// of the secret of an L402 identifier.
+//
+// The resulting path of the identifier bff4ee83 within etcd would look like:
+// lsat/proxy/secretexpiry/bff4ee83
+func secretExpiryKey(id [sha256.Size]byte) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, secretExpiryPrefix,
+			hex.EncodeToString(id[:]),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// rootKeyKey returns the full key to store in the database for the root key of
+// the given version. The version is zero-padded so that the keys sort in the
+// order of their versions.
+//
+// The resulting path of version 1 within etcd would look like:
+// lsat/proxy/rootkeys/0000000001
+func rootKeyKey(version uint32) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, rootKeysPrefix,
+			fmt.Sprintf("%010d", version),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// storedSecret is a secret as it is stored in an etcd cluster, wrapped with a
+// root key. Secrets that were stored before root keys were introduced are
+// stored as their plain bytes instead.
+type storedSecret struct {
+	// Secret is the wrapped secret.
+	Secret []byte
+
+	// KeyVersion is the version of the root key that wraps the secret.
+	KeyVersion uint32
+
+	// MintedKeyVersion is the version of the latest root key at the time
+	// the secret was created.
+	MintedKeyVersion uint32
+}
+
+// decodeStoredSecret decodes a secret as it is stored in an etcd cluster.
+func decodeStoredSecret(value []byte) (*storedSecret, error) {
+	if len(value) == l402.SecretSize {
+		return &storedSecret{Secret: value}, nil
+	}
+
+	var secret storedSecret
+	if err := json.Unmarshal(value, &secret); err != nil {
+		return nil, fmt.Errorf("unable to decode secret: %w", err)
+	}
+
+	return &secret, nil
+}
+
+// secretExpiry is the expiry of a secret along with whether its L402 was
+// settled, as it is stored in an etcd cluster.
+type secretExpiry struct {
+	mint.SecretExpiry
+
+	// Settled is true once the L402 of the secret was paid for.
+	Settled bool
+}
+
+// expired returns true if the secret can be pruned because its L402 couldn't
+// be used anymore before the given time.
+func (e *secretExpiry) expired(before time.Time) bool {
+	if !e.Settled {
+		return e.InvoiceExpiry.Before(before)
+	}
+
+	return !e.ValidUntil.IsZero() && e.ValidUntil.Before(before)
+}
+
 // secretStore is a store of L402 secrets backed by an etcd cluster.
 type secretStore struct {
 	*clientv3.Client
+
+	// encrypter encrypts the root keys. It may be nil to store them in
+	// plaintext.
+	encrypter *aperturedb.Encrypter
 }
 
 // A compile-time constraint to ensure secretStore implements mint.SecretStore.
 var _ mint.SecretStore = (*secretStore)(nil)
 
+// A compile-time constraint to ensure secretStore implements
+// mint.SecretExpiryStore.
+var _ mint.SecretExpiryStore = (*secretStore)(nil)
+
+// A compile-time constraint to ensure secretStore implements
+// mint.RootKeyStore.
+var _ mint.RootKeyStore = (*secretStore)(nil)
+
 // newSecretStore instantiates a new L402 secrets store backed by an etcd
-// cluster.
-func newSecretStore(client *clientv3.Client) *secretStore {
-	return &secretStore{Client: client}
+// cluster. The root keys are encrypted with the given encrypter, which may be
+// nil to store them in plaintext.
+func newSecretStore(client *clientv3.Client,
+	encrypter *aperturedb.Encrypter) *secretStore {
+
+	return &secretStore{Client: client, encrypter: encrypter}
 }
 
 // NewSecret creates a new cryptographically random secret which is keyed by the
-// given hash.
+// given hash. The secret is stored wrapped with the latest root key.
 func (s *secretStore) NewSecret(ctx context.Context,
 	id [sha256.Size]byte) ([l402.SecretSize]byte, error) {
 
@@ -56,7 +177,26 @@ func (s *secretStore) NewSecret(ctx context.Context,
 		return secret, err
 	}
 
-	_, err := s.Put(ctx, idKey(id), string(secret[:]))
+	rootKey, err := s.latestRootKey(ctx)
+	if err != nil {
+		return secret, err
+	}
+
+	wrapped, err := rootKey.WrapSecret(id, secret)
+	if err != nil {
+		return secret, err
+	}
+
+	value, err := json.Marshal(&storedSecret{
+		Secret:           wrapped,
+		KeyVersion:       rootKey.Version,
+		MintedKeyVersion: rootKey.Version,
+	})
+	if err != nil {
+		return secret, err
+	}
+
+	_, err = s.Put(ctx, idKey(id), string(value))
 	return secret, err
 }
 
@@ -72,14 +212,21 @@ func (s *secretStore) GetSecret(ctx context.Context,
 	if len(resp.Kvs) == 0 {
 		return [l402.SecretSize]byte{}, mint.ErrSecretNotFound
 	}
-	if len(resp.Kvs[0].Value) != l402.SecretSize {
-		return [l402.SecretSize]byte{}, fmt.Errorf("invalid secret "+
-			"size %v", len(resp.Kvs[0].Value))
+
+	stored, err := decodeStoredSecret(resp.Kvs[0].Value)
+	if err != nil {
+		return [l402.SecretSize]byte{}, err
 	}
 
-	var secret [l402.SecretSize]byte
-	copy(secret[:], resp.Kvs[0].Value)
-	return secret, nil
+	var rootKey *mint.RootKey
+	if stored.KeyVersion != 0 {
+		rootKey, err = s.getRootKey(ctx, stored.KeyVersion)
+		if err != nil {
+			return [l402.SecretSize]byte{}, err
+		}
+	}
+
+	return unwrapStoredSecret(id, stored, rootKey)
 }
 
 // RevokeSecret removes the cryptographically random secret that corresponds to
@@ -87,6 +234,516 @@ func (s *secretStore) GetSecret(ctx context.Context,
 func (s *secretStore) RevokeSecret(ctx context.Context,
 	id [sha256.Size]byte) error {
 
-	_, err := s.Delete(ctx, idKey(id))
+	_, err := s.Txn(ctx).Then(
+		clientv3.OpDelete(idKey(id)),
+		clientv3.OpDelete(secretExpiryKey(id)),
+	).Commit()
+
 	return err
 }
+
+// SetSecretExpiry sets the expiry of the secret keyed by the given hash.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *secretStore) SetSecretExpiry(ctx context.Context,
+	id [sha256.Size]byte, expiry *mint.SecretExpiry) error {
+
+	value, err := json.Marshal(&secretExpiry{SecretExpiry: *expiry})
+	if err != nil {
+		return err
+	}
+
+	txnResp, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(idKey(id)), ">", 0),
+	).Then(
+		clientv3.OpPut(secretExpiryKey(id), string(value)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return mint.ErrSecretNotFound
+	}
+
+	return nil
+}
+
+// SettleSecret records that the L402 of the secret keyed by the given hash was
+// paid for. This acts as a NOP if it was already settled.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *secretStore) SettleSecret(ctx context.Context,
+	id [sha256.Size]byte) error {
+
+	return s.updateSecretExpiry(ctx, id, func(expiry *secretExpiry) bool {
+		if expiry.Settled {
+			return false
+		}
+
+		expiry.Settled = true
+		return true
+	})
+}
+
+// ExtendSecret extends the time the L402 of the secret keyed by the given hash
+// expires to the given time, unless it already expires later or never.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *secretStore) ExtendSecret(ctx context.Context, id [sha256.Size]byte,
+	validUntil time.Time) error {
+
+	return s.updateSecretExpiry(ctx, id, func(expiry *secretExpiry) bool {
+		if expiry.ValidUntil.IsZero() ||
+			!validUntil.After(expiry.ValidUntil) {
+
+			return false
+		}
+
+		expiry.ValidUntil = validUntil
+		return true
+	})
+}
+
+// updateSecretExpiry applies the given update to the expiry of the secret
+// keyed by the given hash in a transaction that only succeeds if the expiry
+// wasn't modified concurrently, otherwise the attempt is retried. The update
+// returns false if there's nothing to update. Secrets without an expiry are
+// left untouched.
+func (s *secretStore) updateSecretExpiry(ctx context.Context,
+	id [sha256.Size]byte, update func(*secretExpiry) bool) error {
+
+	key := secretExpiryKey(id)
+	for i := 0; i < secretExpiryTxRetries; i++ {
+		resp, err := s.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		if len(resp.Kvs) == 0 {
+			return nil
+		}
+
+		var expiry secretExpiry
+		err = json.Unmarshal(resp.Kvs[0].Value, &expiry)
+		if err != nil {
+			return fmt.Errorf("unable to decode secret expiry: %w",
+				err)
+		}
+		if !update(&expiry) {
+			return nil
+		}
+
+		value, err := json.Marshal(&expiry)
+		if err != nil {
+			return err
+		}
+
+		txnResp, err := s.Txn(ctx).If(
+			clientv3.Compare(
+				clientv3.ModRevision(key), "=",
+				resp.Kvs[0].ModRevision,
+			),
+		).Then(
+			clientv3.OpPut(key, string(value)),
+		).Commit()
+		if err != nil {
+			return err
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+	}
+
+	return errSecretExpiryRetriesExceeded
+}
+
+// UnsettledSecrets returns the payment hashes of the L402s that aren't settled
+// and whose invoices expired before the given time, keyed by the hash of their
+// secrets. As etcd can't filter by value, the expiry of all secrets is read and
+// checked here.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *secretStore) UnsettledSecrets(ctx context.Context,
+	before time.Time) (map[[sha256.Size]byte]lntypes.Hash, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, secretExpiryPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	unsettled := make(map[[sha256.Size]byte]lntypes.Hash)
+	for _, kv := range resp.Kvs {
+		var expiry secretExpiry
+		if err := json.Unmarshal(kv.Value, &expiry); err != nil {
+			return nil, fmt.Errorf("unable to decode expiry of "+
+				"secret %s: %w", kv.Key, err)
+		}
+		if expiry.Settled || !expiry.InvoiceExpiry.Before(before) {
+			continue
+		}
+
+		id, err := decodeIDKey(string(kv.Key), prefix)
+		if err != nil {
+			return nil, err
+		}
+		unsettled[id] = expiry.PaymentHash
+	}
+
+	return unsettled, nil
+}
+
+// PruneSecrets removes all secrets that expired before the given time and
+// returns the number of removed secrets. As etcd can't filter by value, the
+// expiry of all secrets is read and checked here. Secrets whose expiry is
+// modified concurrently are left for the next run.
+//
+// NOTE: This is part of the mint.SecretExpiryStore interface.
+func (s *secretStore) PruneSecrets(ctx context.Context,
+	before time.Time) (int64, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, secretExpiryPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	var pruned int64
+	for _, kv := range resp.Kvs {
+		var expiry secretExpiry
+		if err := json.Unmarshal(kv.Value, &expiry); err != nil {
+			return pruned, fmt.Errorf("unable to decode expiry of "+
+				"secret %s: %w", kv.Key, err)
+		}
+		if !expiry.expired(before) {
+			continue
+		}
+
+		id, err := decodeIDKey(string(kv.Key), prefix)
+		if err != nil {
+			return pruned, err
+		}
+
+		txnResp, err := s.Txn(ctx).If(
+			clientv3.Compare(
+				clientv3.ModRevision(string(kv.Key)), "=",
+				kv.ModRevision,
+			),
+		).Then(
+			clientv3.OpDelete(idKey(id)),
+			clientv3.OpDelete(string(kv.Key)),
+		).Commit()
+		if err != nil {
+			return pruned, err
+		}
+		if txnResp.Succeeded {
+			pruned++
+		}
+	}
+
+	return pruned, nil
+}
+
+// ListRootKeys returns all root keys in the order of their versions.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *secretStore) ListRootKeys(ctx context.Context) ([]*mint.RootKey,
+	error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, rootKeysPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(
+		ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortAscend),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	rootKeys := make([]*mint.RootKey, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		rootKey, err := s.decodeRootKey(kv.Key, kv.Value)
+		if err != nil {
+			return nil, err
+		}
+
+		rootKeys = append(rootKeys, rootKey)
+	}
+
+	return rootKeys, nil
+}
+
+// RotateRootKey creates a root key with the next version and wraps all stored
+// secrets with it. Secrets that are modified concurrently are left wrapped with
+// their previous root key, which remains valid.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *secretStore) RotateRootKey(ctx context.Context) (*mint.RootKey,
+	int64, error) {
+
+	rootKeys, err := s.ListRootKeys(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var version uint32 = 1
+	keysByVersion := make(map[uint32]*mint.RootKey, len(rootKeys))
+	for _, rootKey := range rootKeys {
+		keysByVersion[rootKey.Version] = rootKey
+		version = rootKey.Version + 1
+	}
+
+	rootKey, err := s.addRootKey(ctx, version)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	prefix := strings.Join(
+		[]string{topLevelKey, secretsPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rewrapped int64
+	for _, kv := range resp.Kvs {
+		stored, err := decodeStoredSecret(kv.Value)
+		if err != nil {
+			return nil, rewrapped, err
+		}
+		if stored.KeyVersion >= version {
+			continue
+		}
+
+		id, err := decodeIDKey(string(kv.Key), prefix)
+		if err != nil {
+			return nil, rewrapped, err
+		}
+
+		var oldKey *mint.RootKey
+		if stored.KeyVersion != 0 {
+			oldKey = keysByVersion[stored.KeyVersion]
+		}
+		secret, err := unwrapStoredSecret(id, stored, oldKey)
+		if err != nil {
+			return nil, rewrapped, err
+		}
+
+		wrapped, err := rootKey.WrapSecret(id, secret)
+		if err != nil {
+			return nil, rewrapped, err
+		}
+
+		stored.Secret = wrapped
+		stored.KeyVersion = version
+		value, err := json.Marshal(stored)
+		if err != nil {
+			return nil, rewrapped, err
+		}
+
+		txnResp, err := s.Txn(ctx).If(
+			clientv3.Compare(
+				clientv3.ModRevision(string(kv.Key)), "=",
+				kv.ModRevision,
+			),
+		).Then(
+			clientv3.OpPut(string(kv.Key), string(value)),
+		).Commit()
+		if err != nil {
+			return nil, rewrapped, err
+		}
+		if txnResp.Succeeded {
+			rewrapped++
+		}
+	}
+
+	return rootKey, rewrapped, nil
+}
+
+// InvalidateRootKeys removes all secrets that were created while a root key
+// older than the given version was the latest one, along with those root keys.
+//
+// NOTE: This is part of the mint.RootKeyStore interface.
+func (s *secretStore) InvalidateRootKeys(ctx context.Context,
+	version uint32) (int64, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, secretsPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return 0, err
+	}
+
+	var invalidated int64
+	for _, kv := range resp.Kvs {
+		stored, err := decodeStoredSecret(kv.Value)
+		if err != nil {
+			return invalidated, err
+		}
+		if stored.MintedKeyVersion >= version {
+			continue
+		}
+
+		id, err := decodeIDKey(string(kv.Key), prefix)
+		if err != nil {
+			return invalidated, err
+		}
+
+		_, err = s.Txn(ctx).Then(
+			clientv3.OpDelete(idKey(id)),
+			clientv3.OpDelete(secretExpiryKey(id)),
+		).Commit()
+		if err != nil {
+			return invalidated, err
+		}
+		invalidated++
+	}
+
+	_, err = s.Delete(
+		ctx, rootKeyKey(0), clientv3.WithRange(rootKeyKey(version)),
+	)
+	if err != nil {
+		return invalidated, err
+	}
+
+	return invalidated, nil
+}
+
+// latestRootKey returns the root key with the highest version, creating the
+// first one if there is none yet.
+func (s *secretStore) latestRootKey(ctx context.Context) (*mint.RootKey,
+	error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, rootKeysPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(
+		ctx, prefix, clientv3.WithPrefix(), clientv3.WithLimit(1),
+		clientv3.WithSort(clientv3.SortByKey, clientv3.SortDescend),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		rootKey, err := s.addRootKey(ctx, 1)
+		if !errors.Is(err, errRootKeyExists) {
+			return rootKey, err
+		}
+
+		// Another instance created the first root key concurrently,
+		// so we use that one instead.
+		return s.getRootKey(ctx, 1)
+	}
+
+	return s.decodeRootKey(resp.Kvs[0].Key, resp.Kvs[0].Value)
+}
+
+// getRootKey returns the root key of the given version.
+func (s *secretStore) getRootKey(ctx context.Context,
+	version uint32) (*mint.RootKey, error) {
+
+	resp, err := s.Get(ctx, rootKeyKey(version))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, fmt.Errorf("%w: version %d",
+			mint.ErrRootKeyNotFound, version)
+	}
+
+	return s.decodeRootKey(resp.Kvs[0].Key, resp.Kvs[0].Value)
+}
+
+// addRootKey creates and stores a new random root key with the given version.
+// If a root key with that version exists already, errRootKeyExists is
+// returned.
+func (s *secretStore) addRootKey(ctx context.Context,
+	version uint32) (*mint.RootKey, error) {
+
+	rootKey, err := mint.NewRootKey(version, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := json.Marshal(rootKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key := rootKeyKey(version)
+	value, err = s.encrypter.Encrypt(value, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	txnResp, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(key, string(value)),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+	if !txnResp.Succeeded {
+		return nil, errRootKeyExists
+	}
+
+	return rootKey, nil
+}
+
+// decodeRootKey decrypts and decodes the root key stored under the given key.
+// Root keys that were stored before encryption was enabled are stored in
+// plaintext.
+func (s *secretStore) decodeRootKey(key, value []byte) (*mint.RootKey, error) {
+	value, err := s.encrypter.Decrypt(value, key)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt root key %s: %w",
+			key, err)
+	}
+
+	var rootKey mint.RootKey
+	if err := json.Unmarshal(value, &rootKey); err != nil {
+		return nil, fmt.Errorf("unable to decode root key %s: %w", key,
+			err)
+	}
+
+	return &rootKey, nil
+}
+
+// decodeIDKey decodes the L402 identifier hash of a secret or secret expiry key
+// with the given prefix.
+func decodeIDKey(key, prefix string) ([sha256.Size]byte, error) {
+	var id [sha256.Size]byte
+	hexID := strings.TrimPrefix(key, prefix)
+	if _, err := hex.Decode(id[:], []byte(hexID)); err != nil {
+		return id, fmt.Errorf("invalid key %s: %w", key, err)
+	}
+
+	return id, nil
+}
+
+// unwrapStoredSecret returns the plaintext of a stored secret that is wrapped
+// with the given root key. Secrets that were stored before root keys were
+// introduced aren't wrapped.
+func unwrapStoredSecret(id [sha256.Size]byte, stored *storedSecret,
+	rootKey *mint.RootKey) ([l402.SecretSize]byte, error) {
+
+	var secret [l402.SecretSize]byte
+	if stored.KeyVersion == 0 {
+		copy(secret[:], stored.Secret)
+		return secret, nil
+	}
+
+	if rootKey == nil {
+		return secret, fmt.Errorf("%w: version %d",
+			mint.ErrRootKeyNotFound, stored.KeyVersion)
+	}
+
+	return rootKey.UnwrapSecret(id, stored.Secret)
+}
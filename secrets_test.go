@@ -11,6 +11,8 @@ import (
 
 	"github.com/lightninglabs/aperture/l402"
 	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
 	clientv3 "go.etcd.io/etcd/client/v3"
 	"go.etcd.io/etcd/server/v3/embed"
 )
@@ -92,7 +94,7 @@ func TestSecretStore(t *testing.T) {
 	defer serverCleanup()
 
 	ctx := context.Background()
-	store := newSecretStore(etcdClient)
+	store := newSecretStore(etcdClient, nil)
 
 	// Create a test ID and ensure a secret doesn't exist for it yet as we
 	// haven't created one.
@@ -113,3 +115,174 @@ func TestSecretStore(t *testing.T) {
 	}
 	assertSecretExists(t, store, id, nil)
 }
+
+// TestSecretStoreExpiry ensures that the secretStore only prunes the secrets of
+// L402s that can no longer be used.
+func TestSecretStoreExpiry(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newSecretStore(etcdClient, nil)
+
+	// Create a secret without expiry, an unpaid one, a settled one that
+	// never expires and a settled one that expires.
+	var (
+		noExpiry  = [sha256.Size]byte{1}
+		unpaid    = [sha256.Size]byte{2}
+		forever   = [sha256.Size]byte{3}
+		expiring  = [sha256.Size]byte{4}
+		invoiceAt = time.Unix(1_000, 0)
+	)
+	for _, id := range [][sha256.Size]byte{
+		noExpiry, unpaid, forever, expiring,
+	} {
+		_, err := store.NewSecret(ctx, id)
+		require.NoError(t, err)
+	}
+
+	expiry := &mint.SecretExpiry{
+		PaymentHash:   lntypes.Hash{7},
+		InvoiceExpiry: invoiceAt,
+	}
+	require.NoError(t, store.SetSecretExpiry(ctx, unpaid, expiry))
+	require.NoError(t, store.SetSecretExpiry(ctx, forever, expiry))
+
+	expiry.ValidUntil = time.Unix(2_000, 0)
+	require.NoError(t, store.SetSecretExpiry(ctx, expiring, expiry))
+
+	// Setting the expiry of an unknown secret fails.
+	err := store.SetSecretExpiry(ctx, [sha256.Size]byte{9}, expiry)
+	require.ErrorIs(t, err, mint.ErrSecretNotFound)
+
+	// All secrets with an expiry are unsettled until they're settled.
+	afterInvoice := invoiceAt.Add(time.Second)
+	unsettled, err := store.UnsettledSecrets(ctx, invoiceAt)
+	require.NoError(t, err)
+	require.Empty(t, unsettled)
+
+	unsettled, err = store.UnsettledSecrets(ctx, afterInvoice)
+	require.NoError(t, err)
+	require.Equal(t, map[[sha256.Size]byte]lntypes.Hash{
+		unpaid:   {7},
+		forever:  {7},
+		expiring: {7},
+	}, unsettled)
+
+	require.NoError(t, store.SettleSecret(ctx, forever))
+	require.NoError(t, store.SettleSecret(ctx, expiring))
+	require.NoError(t, store.SettleSecret(ctx, expiring))
+	require.NoError(t, store.SettleSecret(ctx, noExpiry))
+
+	unsettled, err = store.UnsettledSecrets(ctx, afterInvoice)
+	require.NoError(t, err)
+	require.Equal(t, map[[sha256.Size]byte]lntypes.Hash{
+		unpaid: {7},
+	}, unsettled)
+
+	// Extending never shortens the validity and never makes a secret that
+	// never expires expire.
+	require.NoError(t, store.ExtendSecret(
+		ctx, expiring, time.Unix(3_000, 0),
+	))
+	require.NoError(t, store.ExtendSecret(
+		ctx, expiring, time.Unix(2_500, 0),
+	))
+	require.NoError(t, store.ExtendSecret(
+		ctx, forever, time.Unix(2_500, 0),
+	))
+
+	// Nothing expired before the invoices did.
+	pruned, err := store.PruneSecrets(ctx, invoiceAt)
+	require.NoError(t, err)
+	require.Zero(t, pruned)
+
+	// Once the invoices expired, only the unpaid secret is pruned.
+	pruned, err = store.PruneSecrets(ctx, time.Unix(2_900, 0))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	assertSecretExists(t, store, unpaid, nil)
+
+	// Once the extended L402 expired, its secret is pruned as well.
+	pruned, err = store.PruneSecrets(ctx, time.Unix(3_100, 0))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, pruned)
+	assertSecretExists(t, store, expiring, nil)
+
+	for _, id := range [][sha256.Size]byte{noExpiry, forever} {
+		_, err := store.GetSecret(ctx, id)
+		require.NoError(t, err)
+	}
+
+	// Revoking a secret removes its expiry as well.
+	require.NoError(t, store.RevokeSecret(ctx, forever))
+	resp, err := etcdClient.Get(ctx, secretExpiryKey(forever))
+	require.NoError(t, err)
+	require.Empty(t, resp.Kvs)
+}
+
+// TestSecretStoreRootKeys ensures that the secretStore wraps secrets with the
+// latest root key and that they can be rotated and invalidated.
+func TestSecretStoreRootKeys(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newSecretStore(etcdClient, nil)
+
+	// A secret that was stored before root keys were introduced isn't
+	// wrapped.
+	legacyID := [sha256.Size]byte{1}
+	legacySecret := [l402.SecretSize]byte{1, 2, 3}
+	_, err := etcdClient.Put(ctx, idKey(legacyID), string(legacySecret[:]))
+	require.NoError(t, err)
+	assertSecretExists(t, store, legacyID, &legacySecret)
+
+	// The first root key is created along with the first new secret,
+	// which is only stored wrapped.
+	firstID := [sha256.Size]byte{2}
+	firstSecret, err := store.NewSecret(ctx, firstID)
+	require.NoError(t, err)
+
+	rootKeys, err := store.ListRootKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, rootKeys, 1)
+	require.EqualValues(t, 1, rootKeys[0].Version)
+
+	resp, err := etcdClient.Get(ctx, idKey(firstID))
+	require.NoError(t, err)
+	require.NotContains(
+		t, string(resp.Kvs[0].Value), string(firstSecret[:]),
+	)
+
+	// Rotating wraps both secrets with the new root key.
+	rootKey, rewrapped, err := store.RotateRootKey(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, rootKey.Version)
+	require.EqualValues(t, 2, rewrapped)
+
+	secondID := [sha256.Size]byte{3}
+	secondSecret, err := store.NewSecret(ctx, secondID)
+	require.NoError(t, err)
+
+	assertSecretExists(t, store, legacyID, &legacySecret)
+	assertSecretExists(t, store, firstID, &firstSecret)
+	assertSecretExists(t, store, secondID, &secondSecret)
+
+	// Invalidating the first version removes the secrets that were
+	// created before the rotation, along with the old root key.
+	invalidated, err := store.InvalidateRootKeys(ctx, 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, invalidated)
+
+	assertSecretExists(t, store, legacyID, nil)
+	assertSecretExists(t, store, firstID, nil)
+	assertSecretExists(t, store, secondID, &secondSecret)
+
+	rootKeys, err = store.ListRootKeys(ctx)
+	require.NoError(t, err)
+	require.Len(t, rootKeys, 1)
+	require.EqualValues(t, 2, rootKeys[0].Version)
+}
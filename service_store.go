@@ -0,0 +1,108 @@
+package aperture
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/lightninglabs/aperture/proxy"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// servicesPrefix is the key we'll use to prefix all backend services
+	// with when storing them in an etcd cluster.
+	servicesPrefix = "services"
+)
+
+// serviceKey returns the full key to store in the database for a backend
+// service. The name is hex-encoded in order to prevent conflicts with the etcd
+// key delimeter.
+//
+// The resulting path of the service "foo" within etcd would look like:
+// lsat/proxy/services/666f6f
+func serviceKey(name string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, servicesPrefix,
+			hex.EncodeToString([]byte(name)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// serviceStore is a store of backend services backed by an etcd cluster.
+type serviceStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure serviceStore implements
+// proxy.ServiceStore.
+var _ proxy.ServiceStore = (*serviceStore)(nil)
+
+// newServiceStore instantiates a new backend service store backed by an etcd
+// cluster.
+func newServiceStore(client *clientv3.Client) *serviceStore {
+	return &serviceStore{Client: client}
+}
+
+// Services returns all stored services in the order they were first added.
+func (s *serviceStore) Services(ctx context.Context) ([]*proxy.Service,
+	error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, servicesPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(
+		ctx, prefix, clientv3.WithPrefix(),
+		clientv3.WithSort(
+			clientv3.SortByCreateRevision, clientv3.SortAscend,
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	services := make([]*proxy.Service, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		var service proxy.Service
+		if err := json.Unmarshal(kv.Value, &service); err != nil {
+			return nil, fmt.Errorf("unable to decode service "+
+				"%s: %w", kv.Key, err)
+		}
+
+		services = append(services, &service)
+	}
+
+	return services, nil
+}
+
+// StoreService adds the given service to the store or replaces the
+// configuration of an existing service with the same name.
+func (s *serviceStore) StoreService(ctx context.Context,
+	service *proxy.Service) error {
+
+	config, err := json.Marshal(service)
+	if err != nil {
+		return fmt.Errorf("unable to encode service %s: %w",
+			service.Name, err)
+	}
+
+	_, err = s.Put(ctx, serviceKey(service.Name), string(config))
+	return err
+}
+
+// DeleteService removes the service with the given name from the store. If
+// there is no such service, proxy.ErrServiceNotFound is returned.
+func (s *serviceStore) DeleteService(ctx context.Context, name string) error {
+	resp, err := s.Delete(ctx, serviceKey(name))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return proxy.ErrServiceNotFound
+	}
+
+	return nil
+}
@@ -2,6 +2,7 @@ package aperture
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/lightninglabs/aperture/l402"
@@ -9,13 +10,30 @@ import (
 	"github.com/lightninglabs/aperture/proxy"
 )
 
-// staticServiceLimiter provides static restrictions for services.
+// staticServiceLimiter provides static restrictions for services and their
+// tiers. The restrictions are keyed by the name and tier of a service only, as
+// the price of an L402 can vary if it is determined dynamically.
 //
 // TODO(wilmer): use etcd instead.
 type staticServiceLimiter struct {
+	// mu guards the restrictions below as they can be replaced at run
+	// time.
+	mu sync.RWMutex
+
 	capabilities map[l402.Service]l402.Caveat
 	constraints  map[l402.Service][]l402.Caveat
-	timeouts     map[l402.Service]l402.Caveat
+	maxRequests  map[l402.Service]l402.Caveat
+	balances     map[l402.Service]l402.Caveat
+	topUps       map[l402.Service]mint.TopUpGrant
+
+	// timeouts holds the number of seconds the L402s of each service are
+	// valid for. The timeout caveats are created when an L402 is minted,
+	// as they contain the time the L402 expires.
+	timeouts map[l402.Service]int64
+
+	// now returns the current time, which the timeout caveats are based
+	// on.
+	now func() time.Time
 }
 
 // A compile-time constraint to ensure staticServiceLimiter implements
@@ -27,39 +45,86 @@ var _ mint.ServiceLimiter = (*staticServiceLimiter)(nil)
 func newStaticServiceLimiter(
 	proxyServices []*proxy.Service) *staticServiceLimiter {
 
+	l := &staticServiceLimiter{now: time.Now}
+	l.update(proxyServices)
+
+	return l
+}
+
+// update replaces the restrictions of the limiter with the ones of the given
+// services.
+func (l *staticServiceLimiter) update(proxyServices []*proxy.Service) {
 	capabilities := make(map[l402.Service]l402.Caveat)
 	constraints := make(map[l402.Service][]l402.Caveat)
-	timeouts := make(map[l402.Service]l402.Caveat)
+	timeouts := make(map[l402.Service]int64)
+	maxRequests := make(map[l402.Service]l402.Caveat)
+	balances := make(map[l402.Service]l402.Caveat)
+	topUps := make(map[l402.Service]mint.TopUpGrant)
 
-	for _, proxyService := range proxyServices {
-		s := l402.Service{
-			Name:  proxyService.Name,
-			Tier:  l402.BaseTier,
-			Price: proxyService.Price,
-		}
+	addRestrictions := func(name string, tier l402.ServiceTier,
+		timeout, serviceMaxRequests, serviceBalance int64, topUp bool,
+		serviceCapabilities string,
+		serviceConstraints map[string]string) {
+
+		s := restrictionsKey(l402.Service{Name: name, Tier: tier})
 
-		if proxyService.Timeout > 0 {
-			timeouts[s] = l402.NewTimeoutCaveat(
-				proxyService.Name,
-				proxyService.Timeout,
-				time.Now,
+		if timeout > 0 {
+			timeouts[s] = timeout
+		}
+		if serviceMaxRequests > 0 {
+			maxRequests[s] = l402.NewMaxRequestsCaveat(
+				name, serviceMaxRequests,
+			)
+		}
+		if serviceBalance > 0 {
+			balances[s] = l402.NewBalanceCaveat(
+				name, serviceBalance,
 			)
 		}
+		if topUp {
+			topUps[s] = mint.TopUpGrant{
+				Requests: serviceMaxRequests,
+				Balance:  serviceBalance,
+				Validity: time.Duration(timeout) * time.Second,
+			}
+		}
 
 		capabilities[s] = l402.NewCapabilitiesCaveat(
-			proxyService.Name, proxyService.Capabilities,
+			name, serviceCapabilities,
 		)
-		for cond, value := range proxyService.Constraints {
+		for cond, value := range serviceConstraints {
 			caveat := l402.Caveat{Condition: cond, Value: value}
 			constraints[s] = append(constraints[s], caveat)
 		}
 	}
 
-	return &staticServiceLimiter{
-		capabilities: capabilities,
-		constraints:  constraints,
-		timeouts:     timeouts,
+	for _, proxyService := range proxyServices {
+		addRestrictions(
+			proxyService.Name, l402.BaseTier, proxyService.Timeout,
+			proxyService.MaxRequests, proxyService.Balance,
+			proxyService.TopUp, proxyService.Capabilities,
+			proxyService.Constraints,
+		)
+
+		for _, tier := range proxyService.Tiers {
+			addRestrictions(
+				proxyService.Name, l402.ServiceTier(tier.Level),
+				tier.Timeout, tier.MaxRequests, 0,
+				proxyService.TopUp, tier.Capabilities,
+				tier.Constraints,
+			)
+		}
 	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.capabilities = capabilities
+	l.constraints = constraints
+	l.timeouts = timeouts
+	l.maxRequests = maxRequests
+	l.balances = balances
+	l.topUps = topUps
 }
 
 // ServiceCapabilities returns the capabilities caveats for each service. This
@@ -67,9 +132,12 @@ func newStaticServiceLimiter(
 func (l *staticServiceLimiter) ServiceCapabilities(ctx context.Context,
 	services ...l402.Service) ([]l402.Caveat, error) {
 
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	res := make([]l402.Caveat, 0, len(services))
 	for _, service := range services {
-		capabilities, ok := l.capabilities[service]
+		capabilities, ok := l.capabilities[restrictionsKey(service)]
 		if !ok {
 			continue
 		}
@@ -84,9 +152,12 @@ func (l *staticServiceLimiter) ServiceCapabilities(ctx context.Context,
 func (l *staticServiceLimiter) ServiceConstraints(ctx context.Context,
 	services ...l402.Service) ([]l402.Caveat, error) {
 
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	res := make([]l402.Caveat, 0, len(services))
 	for _, service := range services {
-		constraints, ok := l.constraints[service]
+		constraints, ok := l.constraints[restrictionsKey(service)]
 		if !ok {
 			continue
 		}
@@ -97,18 +168,85 @@ func (l *staticServiceLimiter) ServiceConstraints(ctx context.Context,
 }
 
 // ServiceTimeouts returns the timeout caveat for each service. This enforces
-// an expiration time for service access if enabled.
+// an expiration time for service access if enabled. As the caveats are
+// requested when an L402 is minted, they expire the timeout of the service
+// from now.
 func (l *staticServiceLimiter) ServiceTimeouts(ctx context.Context,
 	services ...l402.Service) ([]l402.Caveat, error) {
 
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make([]l402.Caveat, 0, len(services))
+	for _, service := range services {
+		timeout, ok := l.timeouts[restrictionsKey(service)]
+		if !ok {
+			continue
+		}
+		res = append(res, l402.NewTimeoutCaveat(
+			service.Name, timeout, l.now,
+		))
+	}
+
+	return res, nil
+}
+
+// ServiceMaxRequests returns the max requests caveat for each service. This
+// limits the number of requests that can be made to a service if enabled.
+func (l *staticServiceLimiter) ServiceMaxRequests(ctx context.Context,
+	services ...l402.Service) ([]l402.Caveat, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
 	res := make([]l402.Caveat, 0, len(services))
 	for _, service := range services {
-		timeout, ok := l.timeouts[service]
+		maxRequests, ok := l.maxRequests[restrictionsKey(service)]
 		if !ok {
 			continue
 		}
-		res = append(res, timeout)
+		res = append(res, maxRequests)
 	}
 
 	return res, nil
 }
+
+// ServiceBalances returns the balance caveat for each service. This funds an
+// L402 with satoshis that are spent by requests to the service if enabled.
+func (l *staticServiceLimiter) ServiceBalances(ctx context.Context,
+	services ...l402.Service) ([]l402.Caveat, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	res := make([]l402.Caveat, 0, len(services))
+	for _, service := range services {
+		balance, ok := l.balances[restrictionsKey(service)]
+		if !ok {
+			continue
+		}
+		res = append(res, balance)
+	}
+
+	return res, nil
+}
+
+// ServiceTopUp returns what a top-up of an L402 for the service grants, which
+// are the max requests, balance and timeout of the service's tier.
+func (l *staticServiceLimiter) ServiceTopUp(ctx context.Context,
+	service l402.Service) (mint.TopUpGrant, error) {
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.topUps[restrictionsKey(service)], nil
+}
+
+// restrictionsKey returns the key the restrictions of the given service are
+// stored under.
+func restrictionsKey(service l402.Service) l402.Service {
+	return l402.Service{
+		Name: service.Name,
+		Tier: service.Tier,
+	}
+}
@@ -0,0 +1,52 @@
+package aperture
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+// TestStaticServiceLimiterTimeouts tests that the timeout caveats of the static
+// service limiter are based on the time the L402 is minted instead of the time
+// the services were loaded.
+func TestStaticServiceLimiterTimeouts(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	l := newStaticServiceLimiter([]*proxy.Service{{
+		Name:    "service1",
+		Timeout: 60,
+		Tiers: []*proxy.ServiceTier{{
+			Name:    "premium",
+			Level:   1,
+			Timeout: 3600,
+		}},
+	}, {
+		Name: "service2",
+	}})
+	l.now = func() time.Time {
+		return now
+	}
+
+	ctx := context.Background()
+	base := l402.Service{Name: "service1", Tier: l402.BaseTier}
+	premium := l402.Service{Name: "service1", Tier: 1}
+	noTimeout := l402.Service{Name: "service2", Tier: l402.BaseTier}
+
+	caveats, err := l.ServiceTimeouts(ctx, base, premium, noTimeout)
+	require.NoError(t, err)
+	require.Equal(t, []l402.Caveat{
+		l402.NewTimeoutCaveat("service1", 60, l.now),
+		l402.NewTimeoutCaveat("service1", 3600, l.now),
+	}, caveats)
+
+	// L402s minted later expire later.
+	now = now.Add(time.Hour)
+	caveats, err = l.ServiceTimeouts(ctx, base)
+	require.NoError(t, err)
+	require.Equal(t, []l402.Caveat{
+		l402.NewCaveat("service1_valid_until", "1003660"),
+	}, caveats)
+}
@@ -0,0 +1,268 @@
+package aperture
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	// tokensPrefix is the key we'll use to prefix the inventory of issued
+	// L402s when storing it in an etcd cluster.
+	tokensPrefix = "tokens"
+
+	// tokenSettledPrefix is the key we'll use to prefix the time issued
+	// L402s were settled at when storing it in an etcd cluster.
+	tokenSettledPrefix = "tokensettled"
+
+	// errTokenExists is returned if an L402 is added to the inventory with
+	// the token ID of another L402.
+	errTokenExists = errors.New("token already exists")
+)
+
+// tokenKey returns the full key to store in the database for an issued L402.
+//
+// The resulting path of the L402 within etcd would look like:
+// lsat/proxy/tokens/<token_id>
+func tokenKey(tokenID l402.TokenID) string {
+	return strings.Join(
+		[]string{topLevelKey, tokensPrefix, tokenID.String()},
+		etcdKeyDelimeter,
+	)
+}
+
+// tokenSettledKey returns the full key to store in the database for the time
+// an issued L402 was settled at.
+//
+// The resulting path of the settlement time within etcd would look like:
+// lsat/proxy/tokensettled/<token_id>
+func tokenSettledKey(tokenID l402.TokenID) string {
+	return strings.Join(
+		[]string{topLevelKey, tokenSettledPrefix, tokenID.String()},
+		etcdKeyDelimeter,
+	)
+}
+
+// tokenStore is a store of the inventory of issued L402s backed by an etcd
+// cluster.
+type tokenStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure tokenStore implements mint.TokenStore.
+var _ mint.TokenStore = (*tokenStore)(nil)
+
+// newTokenStore instantiates a new inventory of issued L402s backed by an etcd
+// cluster.
+func newTokenStore(client *clientv3.Client) *tokenStore {
+	return &tokenStore{Client: client}
+}
+
+// AddToken records a newly issued L402.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (s *tokenStore) AddToken(ctx context.Context, token *mint.Token) error {
+	// The settlement time is stored separately, so that settling doesn't
+	// require rewriting the L402.
+	entry := *token
+	entry.SettledAt = time.Time{}
+	value, err := json.Marshal(&entry)
+	if err != nil {
+		return err
+	}
+
+	key := tokenKey(token.TokenID)
+	txnResp, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(key, string(value)),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return errTokenExists
+	}
+
+	return nil
+}
+
+// SettleToken records the given time as the time the L402 with the given
+// token ID was settled, unless it was settled before or isn't known.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (s *tokenStore) SettleToken(ctx context.Context, tokenID l402.TokenID,
+	settledAt time.Time) error {
+
+	key := tokenSettledKey(tokenID)
+	_, err := s.Txn(ctx).If(
+		clientv3.Compare(
+			clientv3.CreateRevision(tokenKey(tokenID)), ">", 0,
+		),
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(key, strconv.FormatInt(settledAt.Unix(), 10)),
+	).Commit()
+
+	return err
+}
+
+// GetToken returns the issued L402 with the given token ID.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (s *tokenStore) GetToken(ctx context.Context,
+	tokenID l402.TokenID) (*mint.Token, error) {
+
+	resp, err := s.Txn(ctx).Then(
+		clientv3.OpGet(tokenKey(tokenID)),
+		clientv3.OpGet(tokenSettledKey(tokenID)),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenKvs := resp.Responses[0].GetResponseRange().Kvs
+	if len(tokenKvs) == 0 {
+		return nil, mint.ErrTokenNotFound
+	}
+
+	var token mint.Token
+	if err := json.Unmarshal(tokenKvs[0].Value, &token); err != nil {
+		return nil, fmt.Errorf("unable to decode token: %w", err)
+	}
+
+	settledKvs := resp.Responses[1].GetResponseRange().Kvs
+	if len(settledKvs) > 0 {
+		token.SettledAt, err = parseSettledAt(settledKvs[0].Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &token, nil
+}
+
+// ListTokens returns the issued L402s that match the given filter in the order
+// they were issued. As etcd can't filter by value, the whole inventory is read
+// and filtered here.
+//
+// NOTE: This is part of the mint.TokenStore interface.
+func (s *tokenStore) ListTokens(ctx context.Context,
+	filter *mint.TokenFilter) ([]*mint.Token, error) {
+
+	tokensPrefixKey := strings.Join(
+		[]string{topLevelKey, tokensPrefix, ""}, etcdKeyDelimeter,
+	)
+	settledPrefixKey := strings.Join(
+		[]string{topLevelKey, tokenSettledPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Txn(ctx).Then(
+		clientv3.OpGet(
+			tokensPrefixKey, clientv3.WithPrefix(),
+			clientv3.WithSort(
+				clientv3.SortByCreateRevision,
+				clientv3.SortAscend,
+			),
+		),
+		clientv3.OpGet(settledPrefixKey, clientv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	settled := make(map[string]time.Time)
+	for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+		tokenID := strings.TrimPrefix(string(kv.Key), settledPrefixKey)
+		settled[tokenID], err = parseSettledAt(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var (
+		tokens  = make([]*mint.Token, 0, filter.Limit)
+		skipped int
+	)
+	for _, kv := range resp.Responses[0].GetResponseRange().Kvs {
+		if len(tokens) == filter.Limit {
+			break
+		}
+
+		var token mint.Token
+		if err := json.Unmarshal(kv.Value, &token); err != nil {
+			return nil, fmt.Errorf("unable to decode token %s: %w",
+				kv.Key, err)
+		}
+		token.SettledAt = settled[token.TokenID.String()]
+
+		if !tokenMatches(&token, filter) {
+			continue
+		}
+		if skipped < filter.Offset {
+			skipped++
+			continue
+		}
+
+		tokens = append(tokens, &token)
+	}
+
+	return tokens, nil
+}
+
+// parseSettledAt decodes the time an L402 was settled at.
+func parseSettledAt(value []byte) (time.Time, error) {
+	timestamp, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode token "+
+			"settlement time: %w", err)
+	}
+
+	return time.Unix(timestamp, 0), nil
+}
+
+// tokenMatches returns true if the given issued L402 matches the filter.
+func tokenMatches(token *mint.Token, filter *mint.TokenFilter) bool {
+	if filter.PaymentHash != (lntypes.Hash{}) &&
+		token.PaymentHash != filter.PaymentHash {
+
+		return false
+	}
+
+	if !filter.CreatedAfter.IsZero() &&
+		token.CreatedAt.Before(filter.CreatedAfter) {
+
+		return false
+	}
+
+	if !filter.CreatedBefore.IsZero() &&
+		!token.CreatedAt.Before(filter.CreatedBefore) {
+
+		return false
+	}
+
+	if filter.Settled != nil &&
+		*filter.Settled == token.SettledAt.IsZero() {
+
+		return false
+	}
+
+	if filter.Service == "" {
+		return true
+	}
+	for _, service := range token.Services {
+		if service.Name == filter.Service {
+			return true
+		}
+	}
+
+	return false
+}
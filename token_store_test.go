@@ -0,0 +1,110 @@
+package aperture
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTokenStore ensures the different operations of the tokenStore behave as
+// expected.
+func TestTokenStore(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newTokenStore(etcdClient)
+
+	_, err := store.GetToken(ctx, l402.TokenID{1})
+	require.ErrorIs(t, err, mint.ErrTokenNotFound)
+
+	// Issue two tokens and make sure a token ID can't be reused.
+	foo := l402.Service{Name: "foo", Tier: l402.BaseTier, Price: 10}
+	bar := l402.Service{Name: "bar", Tier: 2, Price: 20}
+	first := &mint.Token{
+		TokenID:     l402.TokenID{1},
+		PaymentHash: lntypes.Hash{1},
+		Services:    []l402.Service{foo},
+		Price:       10,
+		CreatedAt:   time.Unix(1_000, 0),
+	}
+	second := &mint.Token{
+		TokenID:     l402.TokenID{2},
+		PaymentHash: lntypes.Hash{2},
+		Services:    []l402.Service{foo, bar},
+		Price:       20,
+		CreatedAt:   time.Unix(2_000, 0),
+	}
+	require.NoError(t, store.AddToken(ctx, first))
+	require.NoError(t, store.AddToken(ctx, second))
+	require.ErrorIs(t, store.AddToken(ctx, first), errTokenExists)
+
+	token, err := store.GetToken(ctx, second.TokenID)
+	require.NoError(t, err)
+	require.Equal(t, second.PaymentHash, token.PaymentHash)
+	require.Equal(t, second.Services, token.Services)
+	require.True(t, token.SettledAt.IsZero())
+
+	// Only the first settlement of a known token is recorded.
+	err = store.SettleToken(ctx, second.TokenID, time.Unix(2_500, 0))
+	require.NoError(t, err)
+	err = store.SettleToken(ctx, second.TokenID, time.Unix(2_600, 0))
+	require.NoError(t, err)
+	err = store.SettleToken(ctx, l402.TokenID{7}, time.Unix(2_600, 0))
+	require.NoError(t, err)
+
+	token, err = store.GetToken(ctx, second.TokenID)
+	require.NoError(t, err)
+	require.Equal(t, int64(2_500), token.SettledAt.Unix())
+
+	_, err = store.GetToken(ctx, l402.TokenID{7})
+	require.ErrorIs(t, err, mint.ErrTokenNotFound)
+
+	// The inventory can be filtered and paginated.
+	settled, unsettled := true, false
+	tokens, err := store.ListTokens(ctx, &mint.TokenFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	require.Equal(t, first.TokenID, tokens[0].TokenID)
+	require.Equal(t, second.TokenID, tokens[1].TokenID)
+
+	tokens, err = store.ListTokens(ctx, &mint.TokenFilter{
+		Offset: 1,
+		Limit:  1,
+	})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, second.TokenID, tokens[0].TokenID)
+
+	tokens, err = store.ListTokens(ctx, &mint.TokenFilter{
+		Service: "bar",
+		Settled: &settled,
+		Limit:   10,
+	})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, second.TokenID, tokens[0].TokenID)
+
+	tokens, err = store.ListTokens(ctx, &mint.TokenFilter{
+		Settled:       &unsettled,
+		CreatedBefore: time.Unix(2_000, 0),
+		Limit:         10,
+	})
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	require.Equal(t, first.TokenID, tokens[0].TokenID)
+
+	tokens, err = store.ListTokens(ctx, &mint.TokenFilter{
+		PaymentHash: lntypes.Hash{1},
+		Service:     "bar",
+		Limit:       10,
+	})
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+}
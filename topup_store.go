@@ -0,0 +1,383 @@
+package aperture
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightningnetwork/lnd/lntypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// topUpTxRetries is the number of times settling a top-up is retried
+	// if another instance modified it or the usage of its L402
+	// concurrently.
+	topUpTxRetries = 10
+)
+
+var (
+	// topUpsPrefix is the key we'll use to prefix the top-ups of L402s
+	// when storing them in an etcd cluster.
+	topUpsPrefix = "topups"
+
+	// topUpValidityPrefix is the key we'll use to prefix the time until
+	// which top-ups extend the validity of L402s when storing it in an
+	// etcd cluster.
+	topUpValidityPrefix = "topupvalidity"
+
+	// pendingTopUpPrefix is the key we'll use to prefix the payment hash
+	// of the latest top-up of L402s when storing it in an etcd cluster.
+	pendingTopUpPrefix = "topuppending"
+
+	// errTopUpExists is returned if a top-up is added for an invoice that
+	// already pays for another top-up.
+	errTopUpExists = errors.New("top-up already exists")
+
+	// errTopUpRetriesExceeded is returned if a top-up couldn't be settled
+	// because of concurrent modifications within the allowed number of
+	// retries.
+	errTopUpRetriesExceeded = errors.New("top-up tx retries exceeded")
+)
+
+// topUpKey returns the full key to store in the database for the top-up that
+// is paid for with the invoice of the given payment hash.
+//
+// The resulting path of the top-up within etcd would look like:
+// lsat/proxy/topups/<payment_hash>
+func topUpKey(hash lntypes.Hash) string {
+	return strings.Join(
+		[]string{topLevelKey, topUpsPrefix, hash.String()},
+		etcdKeyDelimeter,
+	)
+}
+
+// topUpValidityKey returns the full key to store in the database for the time
+// until which top-ups extend the validity of an L402 for a service. The name of
+// the service is hex-encoded in order to prevent conflicts with the etcd key
+// delimeter.
+//
+// The resulting path of the service "foo" within etcd would look like:
+// lsat/proxy/topupvalidity/<token_id>/666f6f
+func topUpValidityKey(tokenID l402.TokenID, service string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, topUpValidityPrefix, tokenID.String(),
+			hex.EncodeToString([]byte(service)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// pendingTopUpKey returns the full key to store in the database for the
+// payment hash of the latest top-up of an L402 for a service. The name of the
+// service is hex-encoded in order to prevent conflicts with the etcd key
+// delimeter.
+//
+// The resulting path of the service "foo" within etcd would look like:
+// lsat/proxy/topuppending/<token_id>/666f6f
+func pendingTopUpKey(tokenID l402.TokenID, service string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, pendingTopUpPrefix, tokenID.String(),
+			hex.EncodeToString([]byte(service)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// topUpStore is a store of the top-ups of L402s backed by an etcd cluster. The
+// additional requests and balance of settled top-ups are credited to the usage
+// that is tracked by the usageStore of the same cluster.
+type topUpStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure topUpStore implements mint.TopUpStore.
+var _ mint.TopUpStore = (*topUpStore)(nil)
+
+// newTopUpStore instantiates a new top-up store backed by an etcd cluster.
+func newTopUpStore(client *clientv3.Client) *topUpStore {
+	return &topUpStore{Client: client}
+}
+
+// AddTopUp records a new pending top-up. It replaces earlier top-ups of the
+// L402 for the same service as the one that is looked up by PendingTopUp.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) AddTopUp(ctx context.Context, topUp *mint.TopUp) error {
+	value, err := json.Marshal(topUp)
+	if err != nil {
+		return err
+	}
+
+	key := topUpKey(topUp.PaymentHash)
+	pendingKey := pendingTopUpKey(topUp.TokenID, topUp.Service)
+	txnResp, err := s.Txn(ctx).If(
+		clientv3.Compare(clientv3.CreateRevision(key), "=", 0),
+	).Then(
+		clientv3.OpPut(key, string(value)),
+		clientv3.OpPut(pendingKey, topUp.PaymentHash.String()),
+	).Commit()
+	if err != nil {
+		return err
+	}
+	if !txnResp.Succeeded {
+		return errTopUpExists
+	}
+
+	return nil
+}
+
+// GetTopUp returns the top-up that is paid for with the invoice of the given
+// payment hash.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) GetTopUp(ctx context.Context,
+	hash lntypes.Hash) (*mint.TopUp, error) {
+
+	topUp, _, err := s.getTopUp(ctx, hash)
+	return topUp, err
+}
+
+// getTopUp returns the top-up that is paid for with the invoice of the given
+// payment hash along with the revision it was last modified at.
+func (s *topUpStore) getTopUp(ctx context.Context,
+	hash lntypes.Hash) (*mint.TopUp, int64, error) {
+
+	resp, err := s.Get(ctx, topUpKey(hash))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, mint.ErrTopUpNotFound
+	}
+
+	var topUp mint.TopUp
+	if err := json.Unmarshal(resp.Kvs[0].Value, &topUp); err != nil {
+		return nil, 0, fmt.Errorf("unable to decode top-up: %w", err)
+	}
+
+	return &topUp, resp.Kvs[0].ModRevision, nil
+}
+
+// SettleTopUp marks the top-up that is paid for with the invoice of the given
+// payment hash as settled. Its additional requests and balance are credited to
+// the usage of its L402 in a transaction that only succeeds if neither was
+// modified concurrently, otherwise the attempt is retried.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) SettleTopUp(ctx context.Context, hash lntypes.Hash,
+	validUntil time.Time) error {
+
+	for i := 0; i < topUpTxRetries; i++ {
+		topUp, revision, err := s.getTopUp(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if topUp.Settled {
+			return mint.ErrTopUpSettled
+		}
+
+		topUp.Settled = true
+		topUp.ValidUntil = validUntil
+		value, err := json.Marshal(topUp)
+		if err != nil {
+			return err
+		}
+
+		key := topUpKey(hash)
+		cmps := []clientv3.Cmp{clientv3.Compare(
+			clientv3.ModRevision(key), "=", revision,
+		)}
+		ops := []clientv3.Op{clientv3.OpPut(key, string(value))}
+
+		if !validUntil.IsZero() {
+			validityKey := topUpValidityKey(
+				topUp.TokenID, topUp.Service,
+			)
+			ops = append(ops, clientv3.OpPut(
+				validityKey,
+				strconv.FormatInt(validUntil.Unix(), 10),
+			))
+		}
+
+		tokenID, service := topUp.TokenID, topUp.Service
+		credits := map[string]int64{
+			usageKey(tokenID, service):   topUp.Requests,
+			balanceKey(tokenID, service): topUp.Balance,
+		}
+		for key, amount := range credits {
+			if amount == 0 {
+				continue
+			}
+
+			cmp, op, err := s.creditCounter(ctx, key, amount)
+			if err != nil {
+				return err
+			}
+			cmps = append(cmps, cmp)
+			ops = append(ops, op)
+		}
+
+		txnResp, err := s.Txn(ctx).If(cmps...).Then(ops...).Commit()
+		if err != nil {
+			return err
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+	}
+
+	return errTopUpRetriesExceeded
+}
+
+// creditCounter returns the operation that credits the given amount to the
+// counter stored at the given key, along with the comparison that makes sure
+// the counter wasn't modified in the meantime.
+func (s *topUpStore) creditCounter(ctx context.Context, key string,
+	amount int64) (clientv3.Cmp, clientv3.Op, error) {
+
+	value, cmp, err := getCounter(ctx, s.Client, key)
+	if err != nil {
+		return clientv3.Cmp{}, clientv3.Op{}, err
+	}
+
+	op := clientv3.OpPut(key, strconv.FormatInt(value-amount, 10))
+
+	return cmp, op, nil
+}
+
+// ValidUntil returns the time until which the settled top-ups of the L402 with
+// the given token ID extend its validity for a service.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) ValidUntil(ctx context.Context, tokenID l402.TokenID,
+	service string) (time.Time, error) {
+
+	resp, err := s.Get(ctx, topUpValidityKey(tokenID, service))
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return time.Time{}, nil
+	}
+
+	timestamp, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unable to decode top-up "+
+			"validity: %w", err)
+	}
+
+	return time.Unix(timestamp, 0), nil
+}
+
+// PendingTopUp returns a top-up of the L402 with the given token ID for a
+// service that isn't settled and whose invoice expires after the given time.
+// Only the latest top-up of the L402 for the service is considered.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) PendingTopUp(ctx context.Context, tokenID l402.TokenID,
+	service string, after time.Time) (*mint.TopUp, error) {
+
+	resp, err := s.Get(ctx, pendingTopUpKey(tokenID, service))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, mint.ErrTopUpNotFound
+	}
+
+	hash, err := lntypes.MakeHashFromStr(string(resp.Kvs[0].Value))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode pending top-up: %w",
+			err)
+	}
+
+	topUp, err := s.GetTopUp(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	if topUp.Settled || !topUp.InvoiceExpiry.After(after) {
+		return nil, mint.ErrTopUpNotFound
+	}
+
+	return topUp, nil
+}
+
+// ExpiredTopUps returns the payment hashes of the top-ups that aren't settled
+// and whose invoices expired before the given time. As etcd can't filter by
+// value, all top-ups are read and checked here.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) ExpiredTopUps(ctx context.Context,
+	before time.Time) ([]lntypes.Hash, error) {
+
+	prefix := strings.Join(
+		[]string{topLevelKey, topUpsPrefix, ""}, etcdKeyDelimeter,
+	)
+	resp, err := s.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []lntypes.Hash
+	for _, kv := range resp.Kvs {
+		var topUp mint.TopUp
+		if err := json.Unmarshal(kv.Value, &topUp); err != nil {
+			return nil, fmt.Errorf("unable to decode top-up %s: %w",
+				kv.Key, err)
+		}
+		if topUp.Settled || topUp.InvoiceExpiry.IsZero() ||
+			!topUp.InvoiceExpiry.Before(before) {
+
+			continue
+		}
+
+		expired = append(expired, topUp.PaymentHash)
+	}
+
+	return expired, nil
+}
+
+// RemoveTopUp removes the top-up that is paid for with the invoice of the
+// given payment hash unless it was settled. The top-up is only removed if it
+// wasn't modified concurrently.
+//
+// NOTE: This is part of the mint.TopUpStore interface.
+func (s *topUpStore) RemoveTopUp(ctx context.Context,
+	hash lntypes.Hash) error {
+
+	topUp, revision, err := s.getTopUp(ctx, hash)
+	switch {
+	case errors.Is(err, mint.ErrTopUpNotFound):
+		return nil
+
+	case err != nil:
+		return err
+
+	case topUp.Settled:
+		return nil
+	}
+
+	key := topUpKey(hash)
+	pendingKey := pendingTopUpKey(topUp.TokenID, topUp.Service)
+	_, err = s.Txn(ctx).If(
+		clientv3.Compare(clientv3.ModRevision(key), "=", revision),
+	).Then(
+		clientv3.OpDelete(key),
+		clientv3.OpTxn(
+			[]clientv3.Cmp{clientv3.Compare(
+				clientv3.Value(pendingKey), "=", hash.String(),
+			)},
+			[]clientv3.Op{clientv3.OpDelete(pendingKey)}, nil,
+		),
+	).Commit()
+
+	return err
+}
@@ -0,0 +1,137 @@
+package aperture
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/mint"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/lightningnetwork/lnd/lntypes"
+	"github.com/stretchr/testify/require"
+)
+
+// TestTopUpStore ensures the different operations of the topUpStore behave as
+// expected.
+func TestTopUpStore(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newTopUpStore(etcdClient)
+	usage := newUsageStore(etcdClient)
+
+	tokenID := l402.TokenID{1, 2, 3}
+	topUp := &mint.TopUp{
+		TopUpGrant: mint.TopUpGrant{
+			Requests: 2,
+			Balance:  10,
+			Validity: time.Hour,
+		},
+		TokenID:        tokenID,
+		Service:        "service",
+		PaymentHash:    lntypes.Hash{4, 5, 6},
+		PaymentRequest: "lnbc1topup",
+		InvoiceExpiry:  time.Unix(1000, 0).UTC(),
+	}
+	require.NoError(t, store.AddTopUp(ctx, topUp))
+	require.ErrorIs(t, store.AddTopUp(ctx, topUp), errTopUpExists)
+
+	_, err := store.GetTopUp(ctx, lntypes.Hash{7})
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	// The top-up is pending until its invoice expires.
+	pending, err := store.PendingTopUp(
+		ctx, tokenID, "service", time.Unix(999, 0),
+	)
+	require.NoError(t, err)
+	require.Equal(t, topUp, pending)
+
+	_, err = store.PendingTopUp(ctx, tokenID, "service", time.Unix(1000, 0))
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	_, err = store.PendingTopUp(ctx, tokenID, "other", time.Unix(999, 0))
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	expired, err := store.ExpiredTopUps(ctx, time.Unix(1000, 0))
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	expired, err = store.ExpiredTopUps(ctx, time.Unix(1001, 0))
+	require.NoError(t, err)
+	require.Equal(t, []lntypes.Hash{topUp.PaymentHash}, expired)
+
+	// Use up the only request of the token.
+	_, err = usage.TakeUsage(ctx, tokenID, "service", 1)
+	require.NoError(t, err)
+	_, err = usage.TakeUsage(ctx, tokenID, "service", 1)
+	require.ErrorIs(t, err, proxy.ErrUsageExhausted)
+
+	// Spend the whole balance of the token as well.
+	_, err = usage.SpendBalance(ctx, tokenID, "service", 10, 10)
+	require.NoError(t, err)
+	_, err = usage.SpendBalance(ctx, tokenID, "service", 10, 10)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+
+	// Settling the top-up credits its requests and balance to the token
+	// and extends its validity.
+	validUntil := time.Unix(10_000, 0)
+	err = store.SettleTopUp(ctx, topUp.PaymentHash, validUntil)
+	require.NoError(t, err)
+
+	remaining, err := usage.TakeUsage(ctx, tokenID, "service", 1)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	remaining, err = usage.SpendBalance(ctx, tokenID, "service", 10, 10)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	settled, err := store.GetTopUp(ctx, topUp.PaymentHash)
+	require.NoError(t, err)
+	require.True(t, settled.Settled)
+
+	extended, err := store.ValidUntil(ctx, tokenID, "service")
+	require.NoError(t, err)
+	require.Equal(t, validUntil, extended)
+
+	// A top-up can only be settled once.
+	err = store.SettleTopUp(ctx, topUp.PaymentHash, validUntil)
+	require.ErrorIs(t, err, mint.ErrTopUpSettled)
+
+	// The validity of other services isn't extended.
+	extended, err = store.ValidUntil(ctx, tokenID, "other")
+	require.NoError(t, err)
+	require.True(t, extended.IsZero())
+
+	// Settled top-ups are neither pending, reported as expired nor
+	// removed.
+	_, err = store.PendingTopUp(ctx, tokenID, "service", time.Unix(999, 0))
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	expired, err = store.ExpiredTopUps(ctx, time.Unix(1001, 0))
+	require.NoError(t, err)
+	require.Empty(t, expired)
+
+	require.NoError(t, store.RemoveTopUp(ctx, topUp.PaymentHash))
+	_, err = store.GetTopUp(ctx, topUp.PaymentHash)
+	require.NoError(t, err)
+
+	// Unsettled top-ups are removed along with the reference to them as
+	// the latest top-up.
+	unpaid := *topUp
+	unpaid.PaymentHash = lntypes.Hash{8}
+	require.NoError(t, store.AddTopUp(ctx, &unpaid))
+	_, err = store.PendingTopUp(ctx, tokenID, "service", time.Unix(999, 0))
+	require.NoError(t, err)
+
+	require.NoError(t, store.RemoveTopUp(ctx, unpaid.PaymentHash))
+	_, err = store.GetTopUp(ctx, unpaid.PaymentHash)
+	require.ErrorIs(t, err, mint.ErrTopUpNotFound)
+
+	resp, err := etcdClient.Get(ctx, pendingTopUpKey(tokenID, "service"))
+	require.NoError(t, err)
+	require.Empty(t, resp.Kvs)
+}
@@ -0,0 +1,218 @@
+package aperture
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/proxy"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// usageTxRetries is the number of times counting a request is retried
+	// if another instance counted a request of the same L402 concurrently.
+	usageTxRetries = 10
+)
+
+var (
+	// usagePrefix is the key we'll use to prefix the number of requests
+	// made with L402s when storing them in an etcd cluster.
+	usagePrefix = "usage"
+
+	// balancePrefix is the key we'll use to prefix the number of satoshis
+	// spent by L402s that are funded with a balance when storing them in
+	// an etcd cluster.
+	balancePrefix = "balance"
+
+	// errUsageRetriesExceeded is returned if a request couldn't be counted
+	// because of concurrent modifications within the allowed number of
+	// retries.
+	errUsageRetriesExceeded = errors.New("token usage tx retries exceeded")
+)
+
+// balanceKey returns the full key to store in the database for the number of
+// satoshis an L402 spent on requests to a service. The name of the service is
+// hex-encoded in order to prevent conflicts with the etcd key delimeter.
+//
+// The resulting path of the service "foo" within etcd would look like:
+// lsat/proxy/balance/<token_id>/666f6f
+func balanceKey(tokenID l402.TokenID, service string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, balancePrefix, tokenID.String(),
+			hex.EncodeToString([]byte(service)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// usageKey returns the full key to store in the database for the number of
+// requests made with an L402 to a service. The name of the service is
+// hex-encoded in order to prevent conflicts with the etcd key delimeter.
+//
+// The resulting path of the service "foo" within etcd would look like:
+// lsat/proxy/usage/<token_id>/666f6f
+func usageKey(tokenID l402.TokenID, service string) string {
+	return strings.Join(
+		[]string{
+			topLevelKey, usagePrefix, tokenID.String(),
+			hex.EncodeToString([]byte(service)),
+		}, etcdKeyDelimeter,
+	)
+}
+
+// usageStore is a store of the number of requests made with L402s that are
+// only valid for a limited number of requests and of the satoshis spent by
+// L402s that are funded with a balance, backed by an etcd cluster.
+type usageStore struct {
+	*clientv3.Client
+}
+
+// A compile-time constraint to ensure usageStore implements proxy.UsageStore.
+var _ proxy.UsageStore = (*usageStore)(nil)
+
+// newUsageStore instantiates a new token usage store backed by an etcd
+// cluster.
+func newUsageStore(client *clientv3.Client) *usageStore {
+	return &usageStore{Client: client}
+}
+
+// TakeUsage records a request that is made with the L402 of the given token ID
+// to the given service, unless the maximum number of requests was already
+// reached. The count is updated in a transaction that only succeeds if it
+// wasn't modified concurrently, otherwise the attempt is retried.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (s *usageStore) TakeUsage(ctx context.Context, tokenID l402.TokenID,
+	service string, maxRequests int64) (int64, error) {
+
+	key := usageKey(tokenID, service)
+	for i := 0; i < usageTxRetries; i++ {
+		used, cmp, err := getCounter(ctx, s.Client, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if used >= maxRequests {
+			return 0, proxy.ErrUsageExhausted
+		}
+		used++
+
+		txnResp, err := s.Txn(ctx).If(cmp).Then(
+			clientv3.OpPut(key, strconv.FormatInt(used, 10)),
+		).Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txnResp.Succeeded {
+			return maxRequests - used, nil
+		}
+	}
+
+	return 0, errUsageRetriesExceeded
+}
+
+// ReturnUsage gives back a request that was recorded by TakeUsage for the L402
+// of the given token ID to the given service but wasn't served. The count is
+// updated in a transaction that only succeeds if it wasn't modified
+// concurrently, otherwise the attempt is retried.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (s *usageStore) ReturnUsage(ctx context.Context, tokenID l402.TokenID,
+	service string) error {
+
+	key := usageKey(tokenID, service)
+	for i := 0; i < usageTxRetries; i++ {
+		used, cmp, err := getCounter(ctx, s.Client, key)
+		if err != nil {
+			return err
+		}
+
+		// There is nothing to give back if no request was counted.
+		if used <= 0 {
+			return nil
+		}
+		used--
+
+		txnResp, err := s.Txn(ctx).If(cmp).Then(
+			clientv3.OpPut(key, strconv.FormatInt(used, 10)),
+		).Commit()
+		if err != nil {
+			return err
+		}
+		if txnResp.Succeeded {
+			return nil
+		}
+	}
+
+	return errUsageRetriesExceeded
+}
+
+// SpendBalance deducts the price of a request that is made with the L402 of
+// the given token ID to the given service from its balance, unless the
+// remaining balance doesn't cover it. The spent amount is updated in a
+// transaction that only succeeds if it wasn't modified concurrently, otherwise
+// the attempt is retried.
+//
+// NOTE: This is part of the proxy.UsageStore interface.
+func (s *usageStore) SpendBalance(ctx context.Context, tokenID l402.TokenID,
+	service string, price, balance int64) (int64, error) {
+
+	key := balanceKey(tokenID, service)
+	for i := 0; i < usageTxRetries; i++ {
+		spent, cmp, err := getCounter(ctx, s.Client, key)
+		if err != nil {
+			return 0, err
+		}
+
+		if spent+price > balance {
+			return balance - spent, proxy.ErrInsufficientBalance
+		}
+		spent += price
+
+		txnResp, err := s.Txn(ctx).If(cmp).Then(
+			clientv3.OpPut(key, strconv.FormatInt(spent, 10)),
+		).Commit()
+		if err != nil {
+			return 0, err
+		}
+		if txnResp.Succeeded {
+			return balance - spent, nil
+		}
+	}
+
+	return 0, errUsageRetriesExceeded
+}
+
+// getCounter returns the value of the counter stored at the given key along
+// with the comparison that makes sure it isn't modified before it is updated.
+// A counter that wasn't stored yet is zero and must not be created by anyone
+// else in the meantime.
+func getCounter(ctx context.Context, kv clientv3.KV,
+	key string) (int64, clientv3.Cmp, error) {
+
+	resp, err := kv.Get(ctx, key)
+	if err != nil {
+		return 0, clientv3.Cmp{}, err
+	}
+
+	if len(resp.Kvs) == 0 {
+		cmp := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		return 0, cmp, nil
+	}
+
+	value, err := strconv.ParseInt(string(resp.Kvs[0].Value), 10, 64)
+	if err != nil {
+		return 0, clientv3.Cmp{}, fmt.Errorf("unable to decode "+
+			"counter: %w", err)
+	}
+
+	cmp := clientv3.Compare(
+		clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision,
+	)
+	return value, cmp, nil
+}
@@ -0,0 +1,78 @@
+package aperture
+
+import (
+	"context"
+	"testing"
+
+	"github.com/lightninglabs/aperture/l402"
+	"github.com/lightninglabs/aperture/proxy"
+	"github.com/stretchr/testify/require"
+)
+
+// TestUsageStore ensures the different operations of the usageStore behave as
+// expected.
+func TestUsageStore(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newUsageStore(etcdClient)
+	tokenID := l402.TokenID{1, 2, 3}
+
+	// The token can be used for exactly two requests to the service.
+	remaining, err := store.TakeUsage(ctx, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+
+	remaining, err = store.TakeUsage(ctx, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	_, err = store.TakeUsage(ctx, tokenID, "service", 2)
+	require.ErrorIs(t, err, proxy.ErrUsageExhausted)
+
+	// A request that is given back can be made again.
+	require.NoError(t, store.ReturnUsage(ctx, tokenID, "service"))
+
+	remaining, err = store.TakeUsage(ctx, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 0, remaining)
+
+	// Nothing is given back for a token without any requests.
+	require.NoError(t, store.ReturnUsage(ctx, tokenID, "unused"))
+
+	// The usage of other services is tracked separately.
+	remaining, err = store.TakeUsage(ctx, tokenID, "other", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+}
+
+// TestUsageStoreBalance ensures the balances of L402s are spent as expected.
+func TestUsageStoreBalance(t *testing.T) {
+	etcdClient, serverCleanup := etcdSetup(t)
+	defer etcdClient.Close()
+	defer serverCleanup()
+
+	ctx := context.Background()
+	store := newUsageStore(etcdClient)
+	tokenID := l402.TokenID{1, 2, 3}
+
+	remaining, err := store.SpendBalance(ctx, tokenID, "service", 10, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 15, remaining)
+
+	remaining, err = store.SpendBalance(ctx, tokenID, "service", 10, 25)
+	require.NoError(t, err)
+	require.EqualValues(t, 5, remaining)
+
+	// Once the balance doesn't cover the price anymore, nothing is spent.
+	remaining, err = store.SpendBalance(ctx, tokenID, "service", 10, 25)
+	require.ErrorIs(t, err, proxy.ErrInsufficientBalance)
+	require.EqualValues(t, 5, remaining)
+
+	// The balance is spent separately from the number of requests.
+	remaining, err = store.TakeUsage(ctx, tokenID, "service", 2)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, remaining)
+}